@@ -7,11 +7,14 @@
 package config
 
 import (
+	"crypto/rand"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/encodingscheme"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/middlewares"
 	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/configuration"
 	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/helper"
 	"github.com/pkg/errors"
@@ -24,6 +27,9 @@ const (
 	maxCloudConnectorRetrySeconds = 60
 )
 
+// DailyTurnComputeTimeLayout is the time layout of DailyTurnComputeTime
+const DailyTurnComputeTimeLayout = "15:04"
+
 type (
 	variables struct {
 		ServiceName, LoggingLevel, Port                                                                string
@@ -63,6 +69,61 @@ type (
 		CoreCommandUrl string
 		EnableCORS     bool
 		CORSOrigin     string
+
+		// ProductDataCacheTTLSeconds is how long product metadata is cached, 0 disables the cache
+		ProductDataCacheTTLSeconds int
+
+		// DailyTurnComputeTime is the local time of day (HH:MM) the daily turn of all active
+		// products is computed, empty disables the scheduled computation
+		DailyTurnComputeTime string
+
+		// SnapshotIntervalMinutes is how often inventory counts are snapshot for as-of queries,
+		// 0 disables snapshots. Snapshots older than SnapshotRetentionDays are deleted.
+		SnapshotIntervalMinutes, SnapshotRetentionDays int
+		// SnapshotRecordEpcs records the EPCs of the present tags in the snapshots, so as-of
+		// queries can return them. Off by default, as it stores every EPC with each snapshot.
+		SnapshotRecordEpcs bool
+
+		// AggregateBucketLimit is how many product, facility and minute buckets an aggregate
+		// query may compute confidence for before it is rejected as too broad. It only applies
+		// to confidence models the database cannot evaluate, such as the plugin.
+		AggregateBucketLimit int
+
+		// EventStreamBufferSize is how many tag events are buffered per event stream client,
+		// clients falling further behind are disconnected
+		EventStreamBufferSize int
+
+		// WebhookMaxAttempts is how many times a webhook delivery is attempted before failing,
+		// WebhookRetryBaseSeconds the delay before its first retry, doubled on every retry
+		WebhookMaxAttempts, WebhookRetryBaseSeconds int
+		// WebhookDisableAfterFailures is how many consecutive failed attempts disable a webhook
+		WebhookDisableAfterFailures int
+		// WebhookDeliveryRetentionDays is how long the history of finished deliveries is kept
+		WebhookDeliveryRetentionDays int
+		// WebhookTimeoutSeconds is how long a single webhook request may take, and
+		// WebhookDeliveryWorkers how many webhooks are delivered to concurrently
+		WebhookTimeoutSeconds, WebhookDeliveryWorkers int
+
+		// AuthEnabled requires an API key or JWT bearer token granting the role each route requires
+		AuthEnabled bool
+		// AuthAPIKeys are accepted in the X-API-Key header
+		AuthAPIKeys []middlewares.APIKey
+		// AuthJWTKeySet verifies bearer tokens, nil when bearer tokens are not accepted
+		AuthJWTKeySet *middlewares.KeySet
+		// AuthJWTIssuer and AuthJWTAudience must match the iss and aud claims of bearer tokens when set,
+		// AuthJWTRoleClaim is the claim holding the role, or roles, of the caller
+		AuthJWTIssuer, AuthJWTAudience, AuthJWTRoleClaim string
+		// AuthAccessTokens issues the short-lived access tokens accepted in the access_token query
+		// parameter of the event stream, for browser clients that cannot set headers
+		AuthAccessTokens *middlewares.AccessTokens
+
+		// HealthRequiredServices are the services, by name, the service is not ready without
+		HealthRequiredServices []string
+		// HealthCheckTimeoutMillis is how long the readiness checks wait for each dependency
+		HealthCheckTimeoutMillis int
+
+		// PrometheusEnabled exposes the metrics in the Prometheus text format on /metrics
+		PrometheusEnabled bool
 	}
 )
 
@@ -376,6 +437,65 @@ func InitConfig() error {
 		return errors.Wrapf(err, "Unable to load config variables: %s", err.Error())
 	}
 
+	AppConfig.DailyTurnComputeTime = getOrDefaultString(config, "dailyTurnComputeTime", "")
+	if AppConfig.DailyTurnComputeTime != "" {
+		if _, err := time.Parse(DailyTurnComputeTimeLayout, AppConfig.DailyTurnComputeTime); err != nil {
+			return errors.Errorf("dailyTurnComputeTime must be a time of day formatted as HH:MM. Value: %s", AppConfig.DailyTurnComputeTime)
+		}
+	}
+
+	AppConfig.SnapshotIntervalMinutes = getOrDefaultInt(config, "snapshotIntervalMinutes", 60)
+	if AppConfig.SnapshotIntervalMinutes < 0 {
+		return fmt.Errorf("SnapshotIntervalMinutes should not be negative! SnapshotIntervalMinutes: %d", AppConfig.SnapshotIntervalMinutes)
+	}
+
+	AppConfig.SnapshotRetentionDays = getOrDefaultInt(config, "snapshotRetentionDays", 30)
+	if AppConfig.SnapshotRetentionDays <= 0 {
+		return fmt.Errorf("SnapshotRetentionDays should be greater than 0! SnapshotRetentionDays: %d", AppConfig.SnapshotRetentionDays)
+	}
+
+	AppConfig.SnapshotRecordEpcs = getOrDefaultBool(config, "snapshotRecordEpcs", false)
+
+	AppConfig.AggregateBucketLimit = getOrDefaultInt(config, "aggregateBucketLimit", 10000)
+	if AppConfig.AggregateBucketLimit <= 0 {
+		return fmt.Errorf("AggregateBucketLimit should be greater than 0! AggregateBucketLimit: %d", AppConfig.AggregateBucketLimit)
+	}
+
+	AppConfig.EventStreamBufferSize = getOrDefaultInt(config, "eventStreamBufferSize", 256)
+	if AppConfig.EventStreamBufferSize <= 0 {
+		return fmt.Errorf("EventStreamBufferSize should be greater than 0! EventStreamBufferSize: %d", AppConfig.EventStreamBufferSize)
+	}
+
+	AppConfig.WebhookMaxAttempts = getOrDefaultInt(config, "webhookMaxAttempts", 8)
+	if AppConfig.WebhookMaxAttempts <= 0 {
+		return fmt.Errorf("WebhookMaxAttempts should be greater than 0! WebhookMaxAttempts: %d", AppConfig.WebhookMaxAttempts)
+	}
+
+	AppConfig.WebhookRetryBaseSeconds = getOrDefaultInt(config, "webhookRetryBaseSeconds", 30)
+	if AppConfig.WebhookRetryBaseSeconds <= 0 {
+		return fmt.Errorf("WebhookRetryBaseSeconds should be greater than 0! WebhookRetryBaseSeconds: %d", AppConfig.WebhookRetryBaseSeconds)
+	}
+
+	AppConfig.WebhookDisableAfterFailures = getOrDefaultInt(config, "webhookDisableAfterFailures", 20)
+	if AppConfig.WebhookDisableAfterFailures <= 0 {
+		return fmt.Errorf("WebhookDisableAfterFailures should be greater than 0! WebhookDisableAfterFailures: %d", AppConfig.WebhookDisableAfterFailures)
+	}
+
+	AppConfig.WebhookDeliveryRetentionDays = getOrDefaultInt(config, "webhookDeliveryRetentionDays", 7)
+	if AppConfig.WebhookDeliveryRetentionDays <= 0 {
+		return fmt.Errorf("WebhookDeliveryRetentionDays should be greater than 0! WebhookDeliveryRetentionDays: %d", AppConfig.WebhookDeliveryRetentionDays)
+	}
+
+	AppConfig.WebhookTimeoutSeconds = getOrDefaultInt(config, "webhookTimeoutSeconds", 10)
+	if AppConfig.WebhookTimeoutSeconds <= 0 {
+		return fmt.Errorf("WebhookTimeoutSeconds should be greater than 0! WebhookTimeoutSeconds: %d", AppConfig.WebhookTimeoutSeconds)
+	}
+
+	AppConfig.WebhookDeliveryWorkers = getOrDefaultInt(config, "webhookDeliveryWorkers", 8)
+	if AppConfig.WebhookDeliveryWorkers <= 0 {
+		return fmt.Errorf("WebhookDeliveryWorkers should be greater than 0! WebhookDeliveryWorkers: %d", AppConfig.WebhookDeliveryWorkers)
+	}
+
 	AppConfig.TagDecoders, err = getTagDecoders(config)
 	if err != nil {
 		return err
@@ -409,9 +529,32 @@ func InitConfig() error {
 
 	AppConfig.CoreCommandUrl = getOrDefaultString(config, "coreCommandUrl", "http://edgex-core-command:48082")
 
+	AppConfig.ProductDataCacheTTLSeconds = getOrDefaultInt(config, "productDataCacheTTLSeconds", 300)
+	if AppConfig.ProductDataCacheTTLSeconds < 0 {
+		return fmt.Errorf("ProductDataCacheTTLSeconds should not be negative! ProductDataCacheTTLSeconds: %d", AppConfig.ProductDataCacheTTLSeconds)
+	}
+
 	AppConfig.EnableCORS = getOrDefaultBool(config, "enableCORS", true)
 	AppConfig.CORSOrigin = getOrDefaultString(config, "corsOrigin", "*")
 
+	AppConfig.HealthRequiredServices = nil
+	for _, name := range strings.Split(getOrDefaultString(config, "healthRequiredServices", ""), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			AppConfig.HealthRequiredServices = append(AppConfig.HealthRequiredServices, name)
+		}
+	}
+
+	AppConfig.HealthCheckTimeoutMillis = getOrDefaultInt(config, "healthCheckTimeoutMillis", 2000)
+	if AppConfig.HealthCheckTimeoutMillis <= 0 {
+		return fmt.Errorf("HealthCheckTimeoutMillis should be greater than 0! HealthCheckTimeoutMillis: %d", AppConfig.HealthCheckTimeoutMillis)
+	}
+
+	AppConfig.PrometheusEnabled = getOrDefaultBool(config, "prometheusEnabled", false)
+
+	if err := parseAuth(&AppConfig, config); err != nil {
+		return errors.Wrapf(err, "Unable to load config variables: %s", err.Error())
+	}
+
 	return nil
 }
 
@@ -540,6 +683,92 @@ func parseCoefficients(AppConfig *variables, config *configuration.Configuration
 	return nil
 }
 
+func parseAuth(AppConfig *variables, config *configuration.Configuration) error {
+	AppConfig.AuthEnabled = getOrDefaultBool(config, "authEnabled", false)
+
+	// API keys are secret, so they are preferably read from a docker secret
+	apiKeysString, err := helper.GetSecret("authApiKeys")
+	if err != nil {
+		apiKeysString = getOrDefaultString(config, "authApiKeys", "")
+	}
+	AppConfig.AuthAPIKeys, err = parseAPIKeys(strings.TrimSpace(apiKeysString))
+	if err != nil {
+		return err
+	}
+
+	if keySetFile := getOrDefaultString(config, "authJwtKeySetFile", ""); keySetFile != "" {
+		AppConfig.AuthJWTKeySet, err = middlewares.LoadKeySet(keySetFile)
+		if err != nil {
+			return err
+		}
+	}
+	AppConfig.AuthJWTIssuer = getOrDefaultString(config, "authJwtIssuer", "")
+	AppConfig.AuthJWTAudience = getOrDefaultString(config, "authJwtAudience", "")
+	AppConfig.AuthJWTRoleClaim = getOrDefaultString(config, "authJwtRoleClaim", "roles")
+
+	if AppConfig.AuthEnabled && len(AppConfig.AuthAPIKeys) == 0 && AppConfig.AuthJWTKeySet == nil {
+		return errors.New("AuthEnabled requires authApiKeys or authJwtKeySetFile to be set")
+	}
+
+	lifetime := getOrDefaultInt(config, "authAccessTokenLifetimeSeconds", 60)
+	if lifetime <= 0 {
+		return fmt.Errorf("AuthAccessTokenLifetimeSeconds should be greater than 0! AuthAccessTokenLifetimeSeconds: %d", lifetime)
+	}
+	// without a shared secret, tokens are only accepted by the instance that issued them
+	secret, err := helper.GetSecret("authAccessTokenSecret")
+	if err != nil {
+		secret = getOrDefaultString(config, "authAccessTokenSecret", "")
+	}
+	key := []byte(strings.TrimSpace(secret))
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return errors.Wrap(err, "unable to generate the access token secret")
+		}
+	}
+	AppConfig.AuthAccessTokens = middlewares.NewAccessTokens(key, time.Duration(lifetime)*time.Second)
+
+	return nil
+}
+
+// parseAPIKeys parses a name:role:key,name:role:key string. The key is last so it
+// may hold colons.
+func parseAPIKeys(apiKeysString string) ([]middlewares.APIKey, error) {
+	var apiKeys []middlewares.APIKey
+	// an empty string is valid, but accepts no API keys
+	if len(apiKeysString) == 0 {
+		return apiKeys, nil
+	}
+
+	names := make(map[string]bool)
+	keys := make(map[string]bool)
+	for _, tuple := range strings.Split(apiKeysString, ",") {
+		parts := strings.SplitN(tuple, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			// never include the tuple itself, it holds the key
+			return nil, errors.Errorf("authApiKeys entry %d is not a valid name:role:key tuple", len(apiKeys)+1)
+		}
+
+		role, err := middlewares.ParseRole(parts[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Role of API key %s is not valid", parts[0])
+		}
+
+		if names[parts[0]] {
+			return nil, errors.Errorf("authApiKeys has more than one key named %s", parts[0])
+		}
+		if keys[parts[2]] {
+			return nil, errors.Errorf("API key %s is not unique", parts[0])
+		}
+		names[parts[0]] = true
+		keys[parts[2]] = true
+
+		apiKeys = append(apiKeys, middlewares.APIKey{Name: parts[0], Role: role, Key: parts[2]})
+	}
+
+	return apiKeys, nil
+}
+
 func parseAgeOuts(ageOutString string) (map[string]int, error) {
 	ageOuts := make(map[string]int)
 	// an empty string is valid, but should just be an empty map
@@ -607,11 +836,65 @@ CREATE TABLE IF NOT EXISTS facilities (
 	data JSONB	
 );
 
+CREATE UNIQUE INDEX IF NOT EXISTS idx_facility_name
+ON facilities ((data->>'name'));
+
 CREATE TABLE IF NOT EXISTS dailyturnhistory (
 	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
 	data JSONB	
 );
 
-CREATE UNIQUE INDEX IF NOT EXISTS idx_product_id
-ON dailyturnhistory ((data->>'product_id'));
+UPDATE dailyturnhistory SET data = data || '{"facility_id": ""}'
+WHERE data->>'facility_id' IS NULL;
+
+DROP INDEX IF EXISTS idx_product_id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_facility_id
+ON dailyturnhistory ((data->>'product_id'), (data->>'facility_id'));
+
+CREATE TABLE IF NOT EXISTS shippingnotices (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	data JSONB	
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_asn_id
+ON shippingnotices ((data->>'asn_id'));
+
+CREATE TABLE IF NOT EXISTS stockthresholds (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	data JSONB	
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stock_product_facility_id
+ON stockthresholds ((data->>'product_id'), (data->>'facility_id'));
+
+CREATE TABLE IF NOT EXISTS snapshots (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	data JSONB	
+);
+
+CREATE INDEX IF NOT EXISTS idx_snapshot_facility_timestamp
+ON snapshots ((data->>'facility_id'), ((data->>'timestamp')::bigint));
+
+CREATE TABLE IF NOT EXISTS webhooks (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	data JSONB	
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_webhook_id
+ON webhooks ((data->>'id'));
+
+CREATE TABLE IF NOT EXISTS webhookdeliveries (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	data JSONB	
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_webhook_delivery_id
+ON webhookdeliveries ((data->>'id'));
+
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_status_next_attempt
+ON webhookdeliveries ((data->>'status'), ((data->>'next_attempt')::bigint));
+
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_subscription_created
+ON webhookdeliveries ((data->>'subscription_id'), ((data->>'created')::bigint));
 `
@@ -7,7 +7,11 @@
 package config
 
 import (
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/middlewares"
 )
 
 func TestParseAgeOuts(t *testing.T) {
@@ -105,3 +109,49 @@ func TestParseAgeNegativeValue(t *testing.T) {
 		t.Fatal("Failed to catch parse error")
 	}
 }
+
+func TestParseAPIKeys(t *testing.T) {
+	apiKeys, err := parseAPIKeys("dashboard:reader:abc123,pipeline:Operator:def:456,ops:admin:ghi789")
+	if err != nil {
+		t.Fatalf("Unexpected error during parsing: %s", err.Error())
+	}
+
+	expected := []middlewares.APIKey{
+		{Name: "dashboard", Role: middlewares.RoleReader, Key: "abc123"},
+		{Name: "pipeline", Role: middlewares.RoleOperator, Key: "def:456"},
+		{Name: "ops", Role: middlewares.RoleAdmin, Key: "ghi789"},
+	}
+	if !reflect.DeepEqual(apiKeys, expected) {
+		t.Errorf("Expected %v. Actual: %v", expected, apiKeys)
+	}
+}
+
+func TestParseAPIKeysEmptyString(t *testing.T) {
+	apiKeys, err := parseAPIKeys("")
+	if err != nil {
+		t.Fatalf("Unexpected error during parsing: %s", err.Error())
+	}
+	if len(apiKeys) != 0 {
+		t.Errorf("Expected no API keys. Actual: %d", len(apiKeys))
+	}
+}
+
+func TestParseAPIKeysInvalid(t *testing.T) {
+	invalid := []string{
+		"dashboard:reader",
+		"dashboard:reader:",
+		":reader:abc123",
+		"dashboard:superuser:abc123",
+		"dashboard:reader:abc123,",
+		"dashboard:reader:abc123,dashboard:admin:def456",
+		"dashboard:reader:abc123,ops:admin:abc123",
+	}
+	for _, apiKeysString := range invalid {
+		_, err := parseAPIKeys(apiKeysString)
+		if err == nil {
+			t.Errorf("Failed to catch parse error of %s", apiKeysString)
+		} else if strings.Contains(err.Error(), "abc123") {
+			t.Errorf("Error should not include the key: %s", err.Error())
+		}
+	}
+}
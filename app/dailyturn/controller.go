@@ -16,6 +16,7 @@ import (
 	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"reflect"
+	"strings"
 
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/tag"
 	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
@@ -28,6 +29,7 @@ const (
 	tagsTable       = "tags"
 	jsonb           = "data"
 	productIdColumn = "product_id"
+	facilityColumn  = "facility_id"
 	eventColumn     = "event"
 	lastReadColumn  = "last_read"
 	departedEvent   = "departed"
@@ -52,7 +54,7 @@ func Upsert(dbs *sql.DB, history History) error {
 	}
 
 	upsertStmt := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s) 
-									 ON CONFLICT (( %s  ->> %s )) 
+									 ON CONFLICT (( %s  ->> %s ), ( %s  ->> %s )) 
 									 DO UPDATE SET %s = %s.%s || %s; `,
 		pq.QuoteIdentifier(historyTable),
 		pq.QuoteIdentifier(jsonb),
@@ -60,6 +62,8 @@ func Upsert(dbs *sql.DB, history History) error {
 		pq.QuoteIdentifier(jsonb),
 		pq.QuoteLiteral(productIdColumn),
 		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(facilityColumn),
+		pq.QuoteIdentifier(jsonb),
 		pq.QuoteIdentifier(historyTable),
 		pq.QuoteIdentifier(jsonb),
 		pq.QuoteLiteral(string(obj)),
@@ -77,27 +81,28 @@ func Upsert(dbs *sql.DB, history History) error {
 	return nil
 }
 
-func computeDailyTurnRecord(dbs *sql.DB, productId string) error {
-	history, err := FindHistoryByProductId(dbs, productId)
+func computeDailyTurnRecord(dbs *sql.DB, productId string, facilityId string) error {
+	history, err := FindHistoryByProductId(dbs, productId, facilityId)
 	if err != nil {
 		return err
 	}
 
 	now := helper.UnixMilliNow()
 
-	log.Debugf("computeDailyTurnRecord: %s", productId)
+	log.Debugf("computeDailyTurnRecord: %s at facility %s", productId, facilityId)
 
 	if reflect.DeepEqual(history, History{}) {
 		// create a new history with 0 records, but a timestamp
 		history = History{
-			ProductID: productId,
-			DailyTurn: 0,
-			Timestamp: now,
-			Records:   []Record{},
+			ProductID:  productId,
+			FacilityID: facilityId,
+			DailyTurn:  0,
+			Timestamp:  now,
+			Records:    []Record{},
 		}
-		log.Debugf("Create new history: %s", productId)
+		log.Debugf("Create new history: %s at facility %s", productId, facilityId)
 	} else {
-		result, err := FindPresentOrDepartedTagsSinceTimestamp(dbs, productId, history.Timestamp)
+		result, err := FindPresentOrDepartedTagsSinceTimestamp(dbs, productId, facilityId, history.Timestamp)
 		if err != nil {
 			return err
 		}
@@ -132,7 +137,8 @@ func computeDailyTurnRecord(dbs *sql.DB, productId string) error {
 // database for calculating the dailyturn. NOTE: this should be called AFTER ingesting the
 // new tags into the database. The reason for this is we don't want to double count EPCs already
 // in the database by simply adding quantity to the inventory count, so we let the inventory count
-// fill up via the processing already in place.
+// fill up via the processing already in place. The daily turn is computed for the facility
+// of the ASN site; ASNs without a site are computed across all facilities.
 func ProcessIncomingASNList(dbs *sql.DB, asnList []tag.AdvanceShippingNotice) {
 	// Metrics
 	metrics.GetOrRegisterGaugeCollection(`Inventory.DailyTurn.ProcessIncomingASNList.Attempt`, nil).Add(1)
@@ -143,9 +149,10 @@ func ProcessIncomingASNList(dbs *sql.DB, asnList []tag.AdvanceShippingNotice) {
 
 	for _, asn := range asnList {
 		for _, asnItem := range asn.Items {
-			if err := computeDailyTurnRecord(dbs, asnItem.ItemGTIN); err != nil {
+			if err := computeDailyTurnRecord(dbs, asnItem.ItemGTIN, asn.SiteID); err != nil {
 				// this is not an error because the data may not be ready yet to compute the daily turn
-				log.Infof("Unable to compute the daily turn for product_id %s: %v", asnItem.ItemGTIN, err.Error())
+				log.Infof("Unable to compute the daily turn for product_id %s at facility %s: %v",
+					asnItem.ItemGTIN, asn.SiteID, err.Error())
 				continue
 			}
 		}
@@ -154,7 +161,99 @@ func ProcessIncomingASNList(dbs *sql.DB, asnList []tag.AdvanceShippingNotice) {
 	mProcessLatency.Update(time.Since(beginTimer))
 }
 
-// CreateHistoryMap builds a map[string] based of array of product ids for search efficiency
+// ComputeAll computes a daily turn record for every active product at each facility it was
+// read at, so products replenished without ASNs get a daily turn as well. Products whose
+// history was updated less than a day ago are skipped.
+func ComputeAll(dbs *sql.DB) {
+	// Metrics
+	metrics.GetOrRegisterGaugeCollection(`Inventory.DailyTurn.ComputeAll.Attempt`, nil).Add(1)
+	mComputed := metrics.GetOrRegisterGauge(`Inventory.DailyTurn.ComputeAll.Computed`, nil)
+	mFindErr := metrics.GetOrRegisterGauge(`Inventory.DailyTurn.ComputeAll.Find-Error`, nil)
+	mComputeLatency := metrics.GetOrRegisterTimer(`Inventory.DailyTurn.ComputeAll.Compute-Latency`, nil)
+
+	log.Debug("Compute daily turn of all active products")
+	beginTimer := time.Now()
+
+	products, err := findActiveProducts(dbs)
+	if err != nil {
+		mFindErr.Update(1)
+		log.Errorf("Unable to find active products to compute the daily turn: %v", err.Error())
+		return
+	}
+
+	computed := 0
+	for _, product := range products {
+		if err := computeDailyTurnRecord(dbs, product.productID, product.facilityID); err != nil {
+			// this is not an error because the data may not be ready yet to compute the daily turn
+			log.Infof("Unable to compute the daily turn for product_id %s at facility %s: %v",
+				product.productID, product.facilityID, err.Error())
+			continue
+		}
+		computed++
+	}
+
+	mComputed.Update(int64(computed))
+	mComputeLatency.Update(time.Since(beginTimer))
+	log.Infof("Computed daily turn of %d out of %d active products", computed, len(products))
+}
+
+// NextComputeTime returns the next time after now at the timeOfDay, formatted as
+// config.DailyTurnComputeTimeLayout, in the location of now
+func NextComputeTime(now time.Time, timeOfDay string) (time.Time, error) {
+	clock, err := time.Parse(config.DailyTurnComputeTimeLayout, timeOfDay)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "invalid daily turn compute time %s", timeOfDay)
+	}
+
+	next := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next, nil
+}
+
+type activeProduct struct {
+	productID  string
+	facilityID string
+}
+
+// findActiveProducts returns the products of the tags that were read, along with the
+// facilities they were read at
+func findActiveProducts(dbs *sql.DB) ([]activeProduct, error) {
+	selectQuery := fmt.Sprintf(`SELECT DISTINCT %s ->> %s, COALESCE(%s ->> %s, '') FROM %s
+									WHERE %s ->> %s <> '' AND (%s ->> %s)::numeric > 0 ORDER BY 1, 2`,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(productIdColumn),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(facilityColumn),
+		pq.QuoteIdentifier(tagsTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(productIdColumn),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(lastReadColumn),
+	)
+
+	rows, err := dbs.Query(selectQuery)
+	if err != nil {
+		return nil, errors.Wrap(err, "db.tags.findActiveProducts()")
+	}
+	defer rows.Close()
+
+	var products []activeProduct
+	for rows.Next() {
+		var product activeProduct
+		if err := rows.Scan(&product.productID, &product.facilityID); err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+
+	return products, rows.Err()
+}
+
+// CreateHistoryMap builds a map[string] keyed by HistoryKey of the product and facility of
+// the tags for search efficiency. When a product has no history at the facility of the tag,
+// the history computed across all facilities is used.
 func CreateHistoryMap(dbs *sql.DB, tags []tag.Tag) map[string]History {
 	historyMap := make(map[string]History)
 
@@ -162,27 +261,32 @@ func CreateHistoryMap(dbs *sql.DB, tags []tag.Tag) map[string]History {
 
 	for i := 0; i < len(tags); i++ {
 		productId := tags[i].ProductID
+		facilityId := tags[i].FacilityID
+		key := HistoryKey(productId, facilityId)
 
-		if _, alreadyExists := historyMap[productId]; alreadyExists == true {
+		if _, alreadyExists := historyMap[key]; alreadyExists == true {
 			// skip lookup for products we already have
 			continue
 		}
 
-		history, err := FindHistoryByProductId(dbs, productId)
+		history, err := FindHistoryByProductId(dbs, productId, facilityId)
+		if err == nil && reflect.DeepEqual(history, History{}) && facilityId != "" {
+			history, err = FindHistoryByProductId(dbs, productId, "")
+		}
 		if err != nil {
 			log.Errorf("Error adding daily turn history to map for product %s: %v", productId, err.Error())
 			continue
 		}
 
-		historyMap[productId] = history
+		historyMap[key] = history
 	}
 
 	return historyMap
 }
 
-// FindHistoryByProductId searches DB for tag based on the productId value
+// FindHistoryByProductId searches DB for the history of the productId at the facilityId
 // Returns the History if found or empty History if it does not exist
-func FindHistoryByProductId(dbs *sql.DB, productId string) (History, error) {
+func FindHistoryByProductId(dbs *sql.DB, productId string, facilityId string) (History, error) {
 
 	// Metrics
 	metrics.GetOrRegisterGaugeCollection(`Inventory.FindHistoryByProductId.Attempt`, nil).Add(1)
@@ -193,12 +297,15 @@ func FindHistoryByProductId(dbs *sql.DB, productId string) (History, error) {
 
 	var history History
 
-	selectQuery := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ->> %s = %s LIMIT 1`,
+	selectQuery := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ->> %s = %s AND %s ->> %s = %s LIMIT 1`,
 		pq.QuoteIdentifier(jsonb),
 		pq.QuoteIdentifier(historyTable),
 		pq.QuoteIdentifier(jsonb),
 		pq.QuoteLiteral(productIdColumn),
 		pq.QuoteLiteral(productId),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(facilityColumn),
+		pq.QuoteLiteral(facilityId),
 	)
 
 	retrieveTimer := time.Now()
@@ -218,7 +325,67 @@ func FindHistoryByProductId(dbs *sql.DB, productId string) (History, error) {
 	return history, nil
 }
 
-func FindPresentOrDepartedTagsSinceTimestamp(db *sql.DB, productId string, sinceTimestamp int64) (PresentOrDepartedResults, error) {
+// FindHistory returns the daily turn histories matching the filter, with their records
+// restricted to the time window of the filter
+func FindHistory(dbs *sql.DB, filter Filter) ([]History, error) {
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`Inventory.FindHistory.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`Inventory.FindHistory.Success`, nil)
+	mFindErr := metrics.GetOrRegisterGauge(`Inventory.FindHistory.Find-Error`, nil)
+	mFindLatency := metrics.GetOrRegisterTimer(`Inventory.FindHistory.Find-Latency`, nil)
+
+	conditions := []string{"TRUE"}
+	if filter.ProductID != "" {
+		conditions = append(conditions,
+			fmt.Sprintf(`%s ->> %s = %s`, pq.QuoteIdentifier(jsonb), pq.QuoteLiteral(productIdColumn), pq.QuoteLiteral(filter.ProductID)))
+	}
+	if filter.FacilityID != "" {
+		conditions = append(conditions,
+			fmt.Sprintf(`%s ->> %s = %s`, pq.QuoteIdentifier(jsonb), pq.QuoteLiteral(facilityColumn), pq.QuoteLiteral(filter.FacilityID)))
+	}
+
+	selectQuery := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ORDER BY %s ->> %s, %s ->> %s`,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteIdentifier(historyTable),
+		strings.Join(conditions, " AND "),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(productIdColumn),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(facilityColumn),
+	)
+
+	retrieveTimer := time.Now()
+	rows, err := dbs.Query(selectQuery)
+	if err != nil {
+		mFindErr.Update(1)
+		return nil, errors.Wrap(err, "db.dailyturnhistory.FindHistory()")
+	}
+	defer rows.Close()
+
+	histories := make([]History, 0)
+	for rows.Next() {
+		var history History
+		if err := rows.Scan(&history); err != nil {
+			mFindErr.Update(1)
+			return nil, err
+		}
+		history.filterRecords(filter.StartTime, filter.EndTime)
+		histories = append(histories, history)
+	}
+	if err := rows.Err(); err != nil {
+		mFindErr.Update(1)
+		return nil, err
+	}
+	mFindLatency.Update(time.Since(retrieveTimer))
+
+	mSuccess.Update(1)
+	return histories, nil
+}
+
+// FindPresentOrDepartedTagsSinceTimestamp counts the present tags and the tags departed since the
+// timestamp of a product at the facility. An empty facilityId counts the tags of all facilities.
+func FindPresentOrDepartedTagsSinceTimestamp(db *sql.DB, productId string, facilityId string, sinceTimestamp int64) (PresentOrDepartedResults, error) {
 	// Metrics
 	metrics.GetOrRegisterGaugeCollection(`Inventory.FindPresentOrDepartedTagsSinceTimestamp.Attempt`, nil).Add(1)
 	mSuccess := metrics.GetOrRegisterGaugeCollection(`Inventory.FindPresentOrDepartedTagsSinceTimestamp.Success`, nil)
@@ -230,9 +397,18 @@ func FindPresentOrDepartedTagsSinceTimestamp(db *sql.DB, productId string, since
 	retrieveTimer := time.Now()
 	timestamp := fmt.Sprintf("%v", sinceTimestamp)
 
+	facilityCondition := ""
+	if facilityId != "" {
+		facilityCondition = fmt.Sprintf(" AND %s ->> %s = %s",
+			pq.QuoteIdentifier(jsonb),
+			pq.QuoteLiteral(facilityColumn),
+			pq.QuoteLiteral(facilityId),
+		)
+	}
+
 	// query for not departed i.e. present tags
 	selectStmt := fmt.Sprintf("SELECT count(*) FROM %s WHERE %s ->> %s = %s"+
-		"AND %s ->> %s != %s AND (%s ->> %s)::numeric > '0'",
+		"AND %s ->> %s != %s AND (%s ->> %s)::numeric > '0'%s",
 		pq.QuoteIdentifier(tagsTable),
 		pq.QuoteIdentifier(jsonb),
 		pq.QuoteLiteral(productIdColumn),
@@ -242,6 +418,7 @@ func FindPresentOrDepartedTagsSinceTimestamp(db *sql.DB, productId string, since
 		pq.QuoteLiteral(departedEvent),
 		pq.QuoteIdentifier(jsonb),
 		pq.QuoteLiteral(lastReadColumn),
+		facilityCondition,
 	)
 
 	row := db.QueryRow(selectStmt)
@@ -257,7 +434,7 @@ func FindPresentOrDepartedTagsSinceTimestamp(db *sql.DB, productId string, since
 
 	// query for departed tags
 	selectStmt = fmt.Sprintf("SELECT count(*) FROM %s  WHERE %s ->> %s = %s"+
-		"AND %s ->> %s = %s AND (%s ->> %s)::numeric > %s",
+		"AND %s ->> %s = %s AND (%s ->> %s)::numeric > %s%s",
 		pq.QuoteIdentifier(tagsTable),
 		pq.QuoteIdentifier(jsonb),
 		pq.QuoteLiteral(productIdColumn),
@@ -268,6 +445,7 @@ func FindPresentOrDepartedTagsSinceTimestamp(db *sql.DB, productId string, since
 		pq.QuoteIdentifier(jsonb),
 		pq.QuoteLiteral(lastReadColumn),
 		pq.QuoteLiteral(timestamp),
+		facilityCondition,
 	)
 
 	row = db.QueryRow(selectStmt)
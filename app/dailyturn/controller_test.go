@@ -21,6 +21,7 @@ import (
 	"reflect"
 	"strconv"
 	"testing"
+	"time"
 )
 
 var (
@@ -46,7 +47,7 @@ func TestFindHistoryByProductId(t *testing.T) {
 	productId := t.Name()
 	insertSampleHistory(t, testDB.DB, productId, 0)
 
-	if _, err := FindHistoryByProductId(testDB.DB, productId); err != nil {
+	if _, err := FindHistoryByProductId(testDB.DB, productId, ""); err != nil {
 		t.Error("Unable to query find history by productId", err.Error())
 	}
 }
@@ -80,7 +81,7 @@ func TestProcessIncomingASNList(t *testing.T) {
 	var oldTimestamp int64
 
 	for _, productId := range productIds {
-		history, _ := FindHistoryByProductId(testDB.DB, productId)
+		history, _ := FindHistoryByProductId(testDB.DB, productId, "")
 		if !reflect.DeepEqual(history, History{}) {
 			t.Fatalf("History is expected to be empty")
 		}
@@ -96,7 +97,7 @@ func TestProcessIncomingASNList(t *testing.T) {
 	ProcessIncomingASNList(testDB.DB, asnList)
 
 	for _, productId := range productIds {
-		history, _ := FindHistoryByProductId(testDB.DB, productId)
+		history, _ := FindHistoryByProductId(testDB.DB, productId, "")
 		if len(history.Records) != 0 || history.Timestamp < 1 {
 			t.Fatalf("Expected history records to be 0 and timestamp to be > 1: %d, %d",
 				len(history.Records), history.Timestamp)
@@ -113,7 +114,7 @@ func TestProcessIncomingASNList(t *testing.T) {
 	ProcessIncomingASNList(testDB.DB, asnList)
 
 	for _, productId := range productIds {
-		history, _ := FindHistoryByProductId(testDB.DB, productId)
+		history, _ := FindHistoryByProductId(testDB.DB, productId, "")
 		if len(history.Records) != 1 || history.Timestamp <= oldTimestamp {
 			t.Fatalf("Expected history records to be 1 and timestamp to be > oldTimestamp: %d, %d, %d",
 				len(history.Records), history.Timestamp, oldTimestamp)
@@ -130,7 +131,7 @@ func TestProcessIncomingASNList(t *testing.T) {
 	ProcessIncomingASNList(testDB.DB, asnList)
 
 	for _, productId := range productIds {
-		history, _ := FindHistoryByProductId(testDB.DB, productId)
+		history, _ := FindHistoryByProductId(testDB.DB, productId, "")
 		if len(history.Records) != 2 || history.Timestamp <= oldTimestamp {
 			t.Fatalf("Expected history records to be 2 and timestamp to be > oldTimestamp: %d, %d, %d",
 				len(history.Records), history.Timestamp, oldTimestamp)
@@ -166,7 +167,7 @@ func TestProcessIncomingASNList_TruncateHistoryRecords(t *testing.T) {
 
 		ProcessIncomingASNList(testDB.DB, asnList)
 
-		history, _ := FindHistoryByProductId(testDB.DB, productId)
+		history, _ := FindHistoryByProductId(testDB.DB, productId, "")
 		if len(history.Records) > maxRecords {
 			t.Fatalf("Too many history records were found: %d. Expected to limit records to %d", len(history.Records), maxRecords)
 		}
@@ -237,6 +238,26 @@ func TestRecord_ComputeDailyTurn_ErrTimeTooShort(t *testing.T) {
 	}
 }
 
+func TestRecord_ComputeDailyTurn_Tolerance(t *testing.T) {
+	now := helper.UnixMilliNow()
+
+	// a day minus a daylight saving time shift
+	record := Record{
+		Timestamp:         now,
+		PreviousTimestamp: now - int64(23*time.Hour/time.Millisecond),
+		Departed:          100,
+		Present:           300,
+	}
+	if err := record.ComputeDailyTurn(); err != nil {
+		t.Fatalf("unexpected error computing daily turn within the tolerance: %v", err.Error())
+	}
+
+	record.PreviousTimestamp = now - int64(21*time.Hour/time.Millisecond)
+	if err := record.ComputeDailyTurn(); err != ErrTimeTooShort {
+		t.Fatalf("Expected error ErrTimeTooShort computing daily turn, but got: %v", err)
+	}
+}
+
 func TestRecord_ComputeDailyTurn_ErrNoInventory(t *testing.T) {
 	now := helper.UnixMilliNow()
 
@@ -415,7 +436,7 @@ func TestFindPresentAndDepartedTagsSinceTimestamp(t *testing.T) {
 	}
 
 	// we should find all of the tags that we put in. this is searching for departed tags since yesterday
-	result, err := FindPresentOrDepartedTagsSinceTimestamp(testDB.DB, productId, helper.UnixMilliNow()-int64(millisecondsInDay))
+	result, err := FindPresentOrDepartedTagsSinceTimestamp(testDB.DB, productId, "", helper.UnixMilliNow()-int64(millisecondsInDay))
 	if err != nil {
 		t.Fatalf("Unable to find present or departed tags: %v", err.Error())
 	}
@@ -427,7 +448,7 @@ func TestFindPresentAndDepartedTagsSinceTimestamp(t *testing.T) {
 	}
 
 	// test that this will find 0 departed tags (because our timestamp is in the future)
-	result, err = FindPresentOrDepartedTagsSinceTimestamp(testDB.DB, productId, helper.UnixMilliNow()+int64(millisecondsInDay))
+	result, err = FindPresentOrDepartedTagsSinceTimestamp(testDB.DB, productId, "", helper.UnixMilliNow()+int64(millisecondsInDay))
 	if err != nil {
 		t.Fatalf("Unable to find present or departed tags: %v", err.Error())
 	}
@@ -441,7 +462,7 @@ func TestFindPresentAndDepartedTagsSinceTimestamp(t *testing.T) {
 		t.Fatal("Unable to insert sample tags into the database")
 	}
 	// test that tags with a last_read of 0 are ignored
-	result, err = FindPresentOrDepartedTagsSinceTimestamp(testDB.DB, productId, helper.UnixMilliNow()-int64(millisecondsInDay))
+	result, err = FindPresentOrDepartedTagsSinceTimestamp(testDB.DB, productId, "", helper.UnixMilliNow()-int64(millisecondsInDay))
 	if err != nil {
 		t.Fatalf("Unable to find present or departed tags: %v", err.Error())
 	}
@@ -455,6 +476,175 @@ func TestFindPresentAndDepartedTagsSinceTimestamp(t *testing.T) {
 	}
 }
 
+func TestProcessIncomingASNList_PerFacility(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	clearAllData(t, testDB.DB)
+
+	productId := t.Name()
+	facilities := []string{"Store100", "Store200"}
+
+	// Store100 sold 10 out of 100 while Store200 sold 50 out of 100
+	if err := insertFacilityTags(t, testDB.DB, productId, facilities[0], 100, 10, helper.UnixMilliNow()); err != nil {
+		t.Fatal("Unable to insert sample tags into the database")
+	}
+	if err := insertFacilityTags(t, testDB.DB, productId, facilities[1], 100, 50, helper.UnixMilliNow()); err != nil {
+		t.Fatal("Unable to insert sample tags into the database")
+	}
+
+	for i := 0; i < 2; i++ {
+		for _, facilityId := range facilities {
+			asnList := []tag.AdvanceShippingNotice{
+				{
+					EventTime: strconv.Itoa(int(helper.UnixMilliNow())),
+					SiteID:    facilityId,
+					Items:     []tag.ASNInputItem{{ItemGTIN: productId, EPCs: make([]string, 1)}},
+				},
+			}
+			ProcessIncomingASNList(testDB.DB, asnList)
+
+			// spoof timestamp
+			history, err := FindHistoryByProductId(testDB.DB, productId, facilityId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			history.Timestamp -= int64(2 * millisecondsInDay)
+			if err := Upsert(testDB.DB, history); err != nil {
+				t.Fatal("Unexpected error upserting data")
+			}
+		}
+	}
+
+	histories, err := FindHistory(testDB.DB, Filter{ProductID: productId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(histories) != len(facilities) {
+		t.Fatalf("Expected a history per facility, got %d", len(histories))
+	}
+	for i, history := range histories {
+		if history.FacilityID != facilities[i] || len(history.Records) != 1 {
+			t.Fatalf("Expected 1 record for %s, got %+v", facilities[i], history)
+		}
+	}
+	if histories[0].Records[0].Departed != 10 || histories[1].Records[0].Departed != 50 {
+		t.Errorf("Expected departed tags to be counted per facility, got %d and %d",
+			histories[0].Records[0].Departed, histories[1].Records[0].Departed)
+	}
+
+	histories, err = FindHistory(testDB.DB, Filter{FacilityID: facilities[1], StartTime: helper.UnixMilliNow() + 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(histories) != 1 || len(histories[0].Records) != 0 {
+		t.Errorf("Expected the history of %s without records after the start time, got %+v", facilities[1], histories)
+	}
+}
+
+func TestHistory_FilterRecords(t *testing.T) {
+	history := History{
+		Records: []Record{
+			{Timestamp: 3000},
+			{Timestamp: 2000},
+			{Timestamp: 1000},
+		},
+	}
+
+	history.filterRecords(1500, 0)
+	if len(history.Records) != 2 || history.Records[1].Timestamp != 2000 {
+		t.Fatalf("Expected records since 1500, got %+v", history.Records)
+	}
+
+	history.filterRecords(0, 2500)
+	if len(history.Records) != 1 || history.Records[0].Timestamp != 2000 {
+		t.Fatalf("Expected records until 2500, got %+v", history.Records)
+	}
+}
+
+func TestComputeAll(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	clearAllData(t, testDB.DB)
+
+	productId := t.Name()
+	facilityId := "Store100"
+
+	if err := insertFacilityTags(t, testDB.DB, productId, facilityId, 100, 25, helper.UnixMilliNow()); err != nil {
+		t.Fatal("Unable to insert sample tags into the database")
+	}
+	// tags that were never read are not active
+	if err := insertFacilityTags(t, testDB.DB, productId+"_unread", facilityId, 10, 0, 0); err != nil {
+		t.Fatal("Unable to insert sample tags into the database")
+	}
+
+	ComputeAll(testDB.DB)
+
+	history, err := FindHistoryByProductId(testDB.DB, productId, facilityId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.Timestamp == 0 || len(history.Records) != 0 {
+		t.Fatalf("Expected a new history without records, got %+v", history)
+	}
+	unread, err := FindHistoryByProductId(testDB.DB, productId+"_unread", facilityId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(unread, History{}) {
+		t.Fatalf("Expected no history for products that were never read, got %+v", unread)
+	}
+
+	// running again within a day does not add a record
+	ComputeAll(testDB.DB)
+	if history, _ = FindHistoryByProductId(testDB.DB, productId, facilityId); len(history.Records) != 0 {
+		t.Fatalf("Expected no record within a day, got %d", len(history.Records))
+	}
+
+	// spoof timestamp
+	history.Timestamp -= int64(2 * millisecondsInDay)
+	if err := Upsert(testDB.DB, history); err != nil {
+		t.Fatal("Unexpected error upserting data")
+	}
+
+	ComputeAll(testDB.DB)
+	if history, _ = FindHistoryByProductId(testDB.DB, productId, facilityId); len(history.Records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(history.Records))
+	}
+	if history.Records[0].Departed != 25 || history.Records[0].Present != 75 {
+		t.Errorf("Unexpected record %+v", history.Records[0])
+	}
+}
+
+func TestNextComputeTime(t *testing.T) {
+	location := time.FixedZone("test", -5*60*60)
+	now := time.Date(2019, 3, 12, 10, 30, 0, 0, location)
+
+	tests := []struct {
+		timeOfDay string
+		expected  time.Time
+	}{
+		{"11:00", time.Date(2019, 3, 12, 11, 0, 0, 0, location)},
+		{"10:30", time.Date(2019, 3, 13, 10, 30, 0, 0, location)},
+		{"02:00", time.Date(2019, 3, 13, 2, 0, 0, 0, location)},
+	}
+
+	for _, test := range tests {
+		next, err := NextComputeTime(now, test.timeOfDay)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", test.timeOfDay, err)
+		}
+		if !next.Equal(test.expected) {
+			t.Errorf("Expected next compute time for %s to be %v, got %v", test.timeOfDay, test.expected, next)
+		}
+	}
+
+	if _, err := NextComputeTime(now, "2am"); err == nil {
+		t.Error("Expected an error for an invalid time of day")
+	}
+}
+
 func insertSampleHistory(t *testing.T, db *sql.DB, sampleID string, lastTimestamp int64) {
 	var history History
 	history.ProductID = sampleID
@@ -466,10 +656,15 @@ func insertSampleHistory(t *testing.T, db *sql.DB, sampleID string, lastTimestam
 }
 
 func insertTags(t *testing.T, db *sql.DB, productId string, tagCount int, departedCount int, lastRead int64) error {
+	return insertFacilityTags(t, db, productId, "", tagCount, departedCount, lastRead)
+}
+
+func insertFacilityTags(t *testing.T, db *sql.DB, productId string, facilityId string, tagCount int, departedCount int, lastRead int64) error {
 	tags := make([]tag.Tag, tagCount)
 	for i, tagItem := range tags {
-		tagItem.Epc = productId + strconv.Itoa(+tagCount+i)
+		tagItem.Epc = productId + facilityId + strconv.Itoa(+tagCount+i)
 		tagItem.ProductID = productId
+		tagItem.FacilityID = facilityId
 		tagItem.LastRead = lastRead
 		if i < departedCount {
 			tagItem.Event = departedEvent
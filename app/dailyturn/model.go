@@ -17,6 +17,10 @@ import (
 
 const millisecondsInDay = float64(24 * time.Hour / time.Millisecond)
 
+// intervalTolerance lets records computed on a daily schedule be slightly less than a
+// day apart, so timer jitter or a daylight saving time change does not skip a record
+const intervalTolerance = 2 * time.Hour
+
 var (
 	// ErrTimeTooShort is when the time between two ASNs is not long enough to compute the daily turn
 	ErrTimeTooShort = errors.New("time between asn is too short, daily turn will not be computed")
@@ -24,12 +28,28 @@ var (
 	ErrNoInventory = errors.New("no inventory found for product, daily turn will not be computed")
 )
 
-// History is the model of the history of daily turn computations for a product
+// History is the model of the history of daily turn computations for a product at a facility
+//swagger:model DailyTurnHistory
 type History struct { //nolint :golint
-	ProductID string   `json:"product_id" bson:"product_id"`
-	DailyTurn float64  `json:"daily_turn" bson:"daily_turn"`
-	Records   []Record `json:"records" bson:"records"`
-	Timestamp int64    `json:"last_timestamp" bson:"last_timestamp"`
+	ProductID  string   `json:"product_id" bson:"product_id"`
+	FacilityID string   `json:"facility_id" bson:"facility_id"`
+	DailyTurn  float64  `json:"daily_turn" bson:"daily_turn"`
+	Records    []Record `json:"records" bson:"records"`
+	Timestamp  int64    `json:"last_timestamp" bson:"last_timestamp"`
+}
+
+// Filter restricts the daily turn histories that are returned. Empty or zero fields are
+// not filtered on, and the time window applies to the timestamp of the history records.
+type Filter struct {
+	ProductID  string
+	FacilityID string
+	StartTime  int64
+	EndTime    int64
+}
+
+// Response is the model used to return the query response
+type Response struct {
+	Results interface{} `json:"results"`
 }
 
 // Record is the model for each daily turn data point
@@ -49,7 +69,7 @@ func (record *Record) ComputeDailyTurn() error {
 	}
 
 	daysSinceLastTimestamp := float64(record.Timestamp-record.PreviousTimestamp) / millisecondsInDay
-	if daysSinceLastTimestamp < 1.0 {
+	if daysSinceLastTimestamp < 1.0-float64(intervalTolerance/time.Millisecond)/millisecondsInDay {
 		return ErrTimeTooShort
 	}
 
@@ -70,6 +90,24 @@ func (history *History) ComputeAverageDailyTurn() {
 	}
 }
 
+// filterRecords keeps only the records with a timestamp within the time window, an end
+// time of 0 meaning no upper bound
+func (history *History) filterRecords(start int64, end int64) {
+	records := make([]Record, 0, len(history.Records))
+	for _, record := range history.Records {
+		if record.Timestamp < start || (end > 0 && record.Timestamp > end) {
+			continue
+		}
+		records = append(records, record)
+	}
+	history.Records = records
+}
+
+// HistoryKey is the key of the daily turn history of a product at a facility, used by CreateHistoryMap
+func HistoryKey(productID string, facilityID string) string {
+	return productID + "|" + facilityID
+}
+
 func computeMedian(records []Record) float64 {
 	// make a copy to avoid modifying input data
 	copyRecords := append([]Record(nil), records...)
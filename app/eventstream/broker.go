@@ -0,0 +1,165 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package eventstream
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/tag"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	"github.com/pkg/errors"
+)
+
+// ErrSlowConsumer is the reason a subscription is closed when its subscriber does not keep
+// up with the published events
+var ErrSlowConsumer = errors.New("subscriber did not keep up with the event stream")
+
+// Filter selects the tag events delivered to a subscription. Empty fields match any value.
+type Filter struct {
+	FacilityID string
+	ProductID  string
+	// Event of the tag, such as arrival, moved or departed
+	Event     string
+	EpcPrefix string
+}
+
+// Matches reports whether the tag event passes the filter
+func (filter Filter) Matches(tagData tag.Tag) bool {
+	return (filter.FacilityID == "" || tagData.FacilityID == filter.FacilityID) &&
+		(filter.ProductID == "" || tagData.ProductID == filter.ProductID) &&
+		(filter.Event == "" || tagData.Event == filter.Event) &&
+		strings.HasPrefix(tagData.Epc, filter.EpcPrefix)
+}
+
+// Message is a tag event delivered to subscribers
+type Message struct {
+	// Sequence number of the event, increasing across all subscriptions
+	ID  uint64
+	Tag tag.Tag
+}
+
+// Subscription receives the published tag events matching its filter
+type Subscription struct {
+	filter   Filter
+	messages chan Message
+	err      error
+}
+
+// Messages returns the channel events are delivered on. It is closed when the subscription
+// ends, after which Err reports why.
+func (subscription *Subscription) Messages() <-chan Message {
+	return subscription.messages
+}
+
+// Err returns ErrSlowConsumer if the subscription was closed because its buffer was full,
+// nil otherwise
+func (subscription *Subscription) Err() error {
+	return subscription.err
+}
+
+// Broker fans published tag events out to subscriptions. Publishing never blocks: a
+// subscriber whose buffer is full is disconnected rather than slowing down tag processing.
+type Broker struct {
+	mutex       sync.Mutex
+	bufferSize  int
+	sequence    uint64
+	subscribers map[*Subscription]struct{}
+}
+
+// NewBroker creates a broker buffering up to bufferSize events per subscription
+func NewBroker(bufferSize int) *Broker {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	return &Broker{
+		bufferSize:  bufferSize,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+var defaultBroker = NewBroker(256)
+
+// Init replaces the broker used by Publish and Subscribe, it is meant to be called on startup
+func Init(bufferSize int) {
+	defaultBroker = NewBroker(bufferSize)
+}
+
+// Publish delivers tag events to the subscribers of the default broker
+func Publish(tags []tag.Tag) {
+	defaultBroker.Publish(tags)
+}
+
+// Subscribe subscribes to the tag events of the default broker
+func Subscribe(filter Filter) *Subscription {
+	return defaultBroker.Subscribe(filter)
+}
+
+// Unsubscribe ends a subscription to the default broker
+func Unsubscribe(subscription *Subscription) {
+	defaultBroker.Unsubscribe(subscription)
+}
+
+// Subscribe returns a subscription to the tag events matching the filter
+func (broker *Broker) Subscribe(filter Filter) *Subscription {
+	subscription := &Subscription{
+		filter:   filter,
+		messages: make(chan Message, broker.bufferSize),
+	}
+
+	broker.mutex.Lock()
+	broker.subscribers[subscription] = struct{}{}
+	metrics.GetOrRegisterGauge(`Inventory.EventStream.Subscribers`, nil).Update(int64(len(broker.subscribers)))
+	broker.mutex.Unlock()
+
+	return subscription
+}
+
+// Unsubscribe ends the subscription, closing its channel. It does nothing if the
+// subscription has already ended.
+func (broker *Broker) Unsubscribe(subscription *Subscription) {
+	broker.mutex.Lock()
+	broker.removeLocked(subscription, nil)
+	broker.mutex.Unlock()
+}
+
+// Publish delivers the tag events to every subscription whose filter they match
+func (broker *Broker) Publish(tags []tag.Tag) {
+	mPublished := metrics.GetOrRegisterCounter(`Inventory.EventStream.Published`, nil)
+	mSlowConsumer := metrics.GetOrRegisterCounter(`Inventory.EventStream.SlowConsumer`, nil)
+
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	for _, tagData := range tags {
+		broker.sequence++
+		message := Message{ID: broker.sequence, Tag: tagData}
+
+		for subscription := range broker.subscribers {
+			if !subscription.filter.Matches(tagData) {
+				continue
+			}
+			select {
+			case subscription.messages <- message:
+			default:
+				mSlowConsumer.Inc(1)
+				broker.removeLocked(subscription, ErrSlowConsumer)
+			}
+		}
+	}
+	mPublished.Inc(int64(len(tags)))
+}
+
+func (broker *Broker) removeLocked(subscription *Subscription, err error) {
+	if _, ok := broker.subscribers[subscription]; !ok {
+		return
+	}
+	delete(broker.subscribers, subscription)
+	subscription.err = err
+	close(subscription.messages)
+	metrics.GetOrRegisterGauge(`Inventory.EventStream.Subscribers`, nil).Update(int64(len(broker.subscribers)))
+}
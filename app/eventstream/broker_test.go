@@ -0,0 +1,85 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package eventstream
+
+import (
+	"testing"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/tag"
+)
+
+func TestFilterMatches(t *testing.T) {
+	tagData := tag.Tag{Epc: "30143639F84191AD22900204", FacilityID: "store001", ProductID: "00888446671424", Event: "arrival"}
+
+	testCases := map[string]struct {
+		filter  Filter
+		matches bool
+	}{
+		"empty":          {Filter{}, true},
+		"all fields":     {Filter{FacilityID: "store001", ProductID: "00888446671424", Event: "arrival", EpcPrefix: "3014"}, true},
+		"other facility": {Filter{FacilityID: "store002"}, false},
+		"other product":  {Filter{ProductID: "00888446671425"}, false},
+		"other event":    {Filter{Event: "departed"}, false},
+		"other prefix":   {Filter{EpcPrefix: "3015"}, false},
+	}
+
+	for name, testCase := range testCases {
+		if testCase.filter.Matches(tagData) != testCase.matches {
+			t.Errorf("Expected %s filter to match %v", name, testCase.matches)
+		}
+	}
+}
+
+func TestBroker_Publish(t *testing.T) {
+	broker := NewBroker(10)
+
+	all := broker.Subscribe(Filter{})
+	store2 := broker.Subscribe(Filter{FacilityID: "store002"})
+
+	broker.Publish([]tag.Tag{
+		{Epc: "e1", FacilityID: "store001"},
+		{Epc: "e2", FacilityID: "store002"},
+	})
+
+	if len(all.Messages()) != 2 {
+		t.Errorf("Expected 2 messages for the unfiltered subscription, received %d", len(all.Messages()))
+	}
+	message := <-store2.Messages()
+	if message.Tag.Epc != "e2" || message.ID != 2 || len(store2.Messages()) != 0 {
+		t.Errorf("Expected only e2 with id 2, received %+v", message)
+	}
+
+	broker.Unsubscribe(store2)
+	if _, open := <-store2.Messages(); open || store2.Err() != nil {
+		t.Error("Expected unsubscribing to close the channel without an error")
+	}
+	// Unsubscribing twice is harmless
+	broker.Unsubscribe(store2)
+}
+
+func TestBroker_SlowConsumer(t *testing.T) {
+	broker := NewBroker(1)
+
+	slow := broker.Subscribe(Filter{})
+	fast := broker.Subscribe(Filter{})
+
+	broker.Publish([]tag.Tag{{Epc: "e1"}})
+	<-fast.Messages()
+	broker.Publish([]tag.Tag{{Epc: "e2"}})
+
+	// The buffered event is still delivered before the channel is closed
+	if message := <-slow.Messages(); message.Tag.Epc != "e1" {
+		t.Errorf("Expected buffered e1, received %+v", message)
+	}
+	if _, open := <-slow.Messages(); open || slow.Err() != ErrSlowConsumer {
+		t.Errorf("Expected the slow consumer to be disconnected, received %v", slow.Err())
+	}
+
+	if message := <-fast.Messages(); message.Tag.Epc != "e2" || fast.Err() != nil {
+		t.Errorf("Expected the fast consumer to keep receiving, received %+v", message)
+	}
+}
@@ -0,0 +1,125 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/tag"
+	"github.com/pkg/errors"
+)
+
+const (
+	// FormatCSV exports one comma separated row per tag, preceded by a header row
+	FormatCSV = "csv"
+	// FormatNDJSON exports one JSON object per line per tag
+	FormatNDJSON = "ndjson"
+)
+
+var contentTypes = map[string]string{
+	FormatCSV:    "text/csv",
+	FormatNDJSON: "application/x-ndjson",
+}
+
+// ContentType returns the content type of the export format, or "" if the format is unknown
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// Writer writes tags in an export format. Written tags are only guaranteed to reach the
+// underlying writer once Flush is called.
+type Writer interface {
+	Write(tagData tag.Tag) error
+	Flush() error
+}
+
+// NewWriter returns a writer of the export format. Confidence is only exported when
+// withConfidence is set.
+func NewWriter(format string, writer io.Writer, withConfidence bool) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(writer, withConfidence), nil
+	case FormatNDJSON:
+		return &ndjsonWriter{encoder: json.NewEncoder(writer), withConfidence: withConfidence}, nil
+	}
+	return nil, errors.Errorf("unsupported export format %s", format)
+}
+
+var csvHeader = []string{"epc", "product_id", "uri", "tid", "facility_id", "location", "epc_state",
+	"qualified_state", "epc_context", "event", "source", "arrived", "last_read"}
+
+type csvWriter struct {
+	writer         *csv.Writer
+	withConfidence bool
+}
+
+func newCSVWriter(writer io.Writer, withConfidence bool) *csvWriter {
+	csvWriter := &csvWriter{writer: csv.NewWriter(writer), withConfidence: withConfidence}
+
+	header := csvHeader
+	if withConfidence {
+		header = append(append([]string{}, csvHeader...), "confidence")
+	}
+	// Errors are reported by Flush
+	_ = csvWriter.writer.Write(header)
+
+	return csvWriter
+}
+
+func (writer *csvWriter) Write(tagData tag.Tag) error {
+	location := ""
+	if len(tagData.LocationHistory) > 0 {
+		location = tagData.LocationHistory[0].Location
+	}
+
+	record := []string{
+		tagData.Epc,
+		tagData.ProductID,
+		tagData.URI,
+		tagData.Tid,
+		tagData.FacilityID,
+		location,
+		tagData.EpcState,
+		tagData.QualifiedState,
+		tagData.EpcContext,
+		tagData.Event,
+		tagData.Source,
+		strconv.FormatInt(tagData.Arrived, 10),
+		strconv.FormatInt(tagData.LastRead, 10),
+	}
+	if writer.withConfidence {
+		record = append(record, strconv.FormatFloat(tagData.Confidence, 'f', -1, 64))
+	}
+
+	return writer.writer.Write(record)
+}
+
+func (writer *csvWriter) Flush() error {
+	writer.writer.Flush()
+	return writer.writer.Error()
+}
+
+type ndjsonWriter struct {
+	encoder        *json.Encoder
+	withConfidence bool
+}
+
+func (writer *ndjsonWriter) Write(tagData tag.Tag) error {
+	if !writer.withConfidence {
+		tagData.Confidence = 0
+	}
+	// Encode terminates every object with a newline
+	return writer.encoder.Encode(tagData)
+}
+
+// Flush does nothing, as every tag is written as it is encoded
+func (writer *ndjsonWriter) Flush() error {
+	return nil
+}
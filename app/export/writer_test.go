@@ -0,0 +1,103 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/tag"
+)
+
+var testTags = []tag.Tag{
+	{
+		Epc:             "30143639F84191AD22900204",
+		ProductID:       "00888446671424",
+		FacilityID:      "store001",
+		EpcState:        "present",
+		Arrived:         1000,
+		LastRead:        2000,
+		Confidence:      0.75,
+		LocationHistory: []tag.LocationHistory{{Location: "RSP-150000-0"}, {Location: "RSP-150000-1"}},
+	},
+	{Epc: "30143639F84191AD66100107", FacilityID: "store001"},
+}
+
+func TestCSVWriter(t *testing.T) {
+	var buffer bytes.Buffer
+	writer, err := NewWriter(FormatCSV, &buffer, true)
+	if err != nil {
+		t.Fatalf("Error creating writer %s", err.Error())
+	}
+	for _, tagData := range testTags {
+		if err := writer.Write(tagData); err != nil {
+			t.Fatalf("Error writing tag %s", err.Error())
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatalf("Error flushing writer %s", err.Error())
+	}
+
+	expected := "epc,product_id,uri,tid,facility_id,location,epc_state,qualified_state,epc_context,event,source,arrived,last_read,confidence\n" +
+		"30143639F84191AD22900204,00888446671424,,,store001,RSP-150000-0,present,,,,,1000,2000,0.75\n" +
+		"30143639F84191AD66100107,,,,store001,,,,,,,0,0,0\n"
+	if buffer.String() != expected {
+		t.Errorf("Expected %q, received %q", expected, buffer.String())
+	}
+}
+
+func TestCSVWriter_Empty(t *testing.T) {
+	var buffer bytes.Buffer
+	writer, err := NewWriter(FormatCSV, &buffer, false)
+	if err != nil {
+		t.Fatalf("Error creating writer %s", err.Error())
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatalf("Error flushing writer %s", err.Error())
+	}
+
+	if buffer.String() != strings.Join(csvHeader, ",")+"\n" {
+		t.Errorf("Expected only the header, received %q", buffer.String())
+	}
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	var buffer bytes.Buffer
+	writer, err := NewWriter(FormatNDJSON, &buffer, false)
+	if err != nil {
+		t.Fatalf("Error creating writer %s", err.Error())
+	}
+	for _, tagData := range testTags {
+		if err := writer.Write(tagData); err != nil {
+			t.Fatalf("Error writing tag %s", err.Error())
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatalf("Error flushing writer %s", err.Error())
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	if len(lines) != len(testTags) {
+		t.Fatalf("Expected %d lines, received %q", len(testTags), buffer.String())
+	}
+	if !strings.Contains(lines[0], `"epc":"30143639F84191AD22900204"`) {
+		t.Errorf("Expected first line to be the first tag, received %s", lines[0])
+	}
+	if strings.Contains(buffer.String(), "confidence") {
+		t.Error("Expected confidence not to be exported")
+	}
+}
+
+func TestNewWriter_UnsupportedFormat(t *testing.T) {
+	if _, err := NewWriter("xml", &bytes.Buffer{}, false); err == nil {
+		t.Error("Expected an error for an unsupported format")
+	}
+	if ContentType("xml") != "" || ContentType(FormatCSV) != "text/csv" {
+		t.Error("Unexpected content types")
+	}
+}
@@ -14,8 +14,11 @@ import (
 	odata "github.com/intel/rsp-sw-toolkit-im-suite-go-odata/postgresql"
 	"github.com/lib/pq"
 	"net/url"
+	"strings"
 	"time"
 
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/sensor"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/odatafilter"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/web"
 	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
 	"github.com/pkg/errors"
@@ -26,6 +29,17 @@ const jsonb = "data"
 const nameColumn = "name"
 const coefficientsColumn = "coefficients"
 
+// tables that refer to facilities by name
+const tagsTable = "tags"
+const rspConfigTable = "rspconfig"
+const facilityIDColumn = "facility_id"
+
+// ownedTables hold records of a facility that are deleted along with it
+var ownedTables = []string{"stockthresholds", "dailyturnhistory", "snapshots", "shippingnotices"}
+
+// uniqueViolation is the postgres error code of an insert breaking a unique index
+const uniqueViolation = "23505"
+
 type facilityDataWrapper struct {
 	ID   []uint8  `db:"id" json:"id"`
 	Data Facility `db:"data" json:"data"`
@@ -118,7 +132,7 @@ func Retrieve(dbs *sql.DB, query url.Values) (interface{}, *CountType, error) {
 	retrieveTimer := time.Now()
 
 	// Run OData PostgreSQL
-	rows, err := odata.ODataSQLQuery(query, facilitiesTable, jsonb, dbs)
+	rows, err := odatafilter.SQLQuery(query, facilitiesTable, jsonb, dbs)
 	if err != nil {
 		if errors.Cause(err) == odata.ErrInvalidInput {
 			mInputErr.Update(1)
@@ -243,6 +257,53 @@ func CreateFacilityMap(dbs *sql.DB) (map[string]Facility, error) {
 
 }
 
+// CheckUniqueNames returns an error listing the facility names stored more than once, along
+// with the IDs of their rows. Facility names are unique, and which of the duplicates to keep
+// is left to an operator rather than picked arbitrarily.
+func CheckUniqueNames(dbs *sql.DB) error {
+
+	// the facilities table does not exist before the schema is first created
+	var exists bool
+	if err := dbs.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, facilitiesTable).Scan(&exists); err != nil {
+		return errors.Wrap(err, "error checking facility names")
+	}
+	if !exists {
+		return nil
+	}
+
+	selectQuery := fmt.Sprintf(`SELECT %[1]s ->> %[2]s, string_agg(id::text, ', ' ORDER BY id)
+								FROM %[3]s GROUP BY %[1]s ->> %[2]s HAVING count(*) > 1
+								ORDER BY %[1]s ->> %[2]s`,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(nameColumn),
+		pq.QuoteIdentifier(facilitiesTable),
+	)
+
+	rows, err := dbs.Query(selectQuery)
+	if err != nil {
+		return errors.Wrap(err, "error checking facility names")
+	}
+	defer rows.Close()
+
+	var duplicates []string
+	for rows.Next() {
+		var name, ids string
+		if err := rows.Scan(&name, &ids); err != nil {
+			return err
+		}
+		duplicates = append(duplicates, fmt.Sprintf("%q (ids %s)", name, ids))
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(err, "error checking facility names")
+	}
+
+	if len(duplicates) > 0 {
+		return errors.Errorf("facility names must be unique, delete all but one row of each duplicated facility: %s",
+			strings.Join(duplicates, "; "))
+	}
+	return nil
+}
+
 func findAll(dbs *sql.DB) ([]Facility, error) {
 
 	selectQuery := fmt.Sprintf(`SELECT %s FROM %s`,
@@ -281,7 +342,8 @@ func insert(dbs *sql.DB, facility Facility) error {
 		return err
 	}
 
-	insertStmt := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s); `,
+	// a facility created since the facilities were queried is left as it is
+	insertStmt := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING; `,
 		pq.QuoteIdentifier(facilitiesTable),
 		pq.QuoteIdentifier(jsonb),
 		pq.QuoteLiteral(string(obj)),
@@ -328,6 +390,276 @@ func Delete(dbs *sql.DB, name string) error {
 	return nil
 }
 
+// Find returns the facility of the given name
+func Find(dbs *sql.DB, name string) (Facility, error) {
+
+	selectQuery := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ->> %s = $1 LIMIT 1`,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteIdentifier(facilitiesTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(nameColumn),
+	)
+
+	var facility Facility
+	if err := dbs.QueryRow(selectQuery, name).Scan(&facility); err != nil {
+		if err == sql.ErrNoRows {
+			return Facility{}, web.ErrNotFound
+		}
+		return Facility{}, errors.Wrap(err, "error in finding facility")
+	}
+	return facility, nil
+}
+
+// FindDetails returns the facility of the given name along with the number of
+// sensors and tags referring to it
+func FindDetails(dbs *sql.DB, name string) (Details, error) {
+
+	facility, err := Find(dbs, name)
+	if err != nil {
+		return Details{}, err
+	}
+
+	references, err := countReferences(dbs, name)
+	if err != nil {
+		return Details{}, err
+	}
+
+	return Details{Facility: facility, References: references}, nil
+}
+
+// Create inserts a new facility, returning web.ErrConflict if a facility of the same
+// name already exists
+func Create(dbs *sql.DB, facility Facility) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`Inventory.Create-Facility.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`Inventory.Create-Facility.Success`, nil)
+	mInsertErr := metrics.GetOrRegisterGauge(`Inventory.Create-Facility.Insert-Error`, nil)
+	mErrConflict := metrics.GetOrRegisterGauge(`Inventory.Create-Facility.Conflict-Error`, nil)
+	mInsertLatency := metrics.GetOrRegisterTimer(`Inventory.Create-Facility.Insert-Latency`, nil)
+
+	obj, err := json.Marshal(facility)
+	if err != nil {
+		return err
+	}
+
+	insertStmt := fmt.Sprintf(`INSERT INTO %s (%s) VALUES ($1::jsonb)`,
+		pq.QuoteIdentifier(facilitiesTable),
+		pq.QuoteIdentifier(jsonb),
+	)
+
+	insertTimer := time.Now()
+	if _, err := dbs.Exec(insertStmt, string(obj)); err != nil {
+		// names are unique by idx_facility_name
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolation {
+			mErrConflict.Update(1)
+			return errors.Wrapf(web.ErrConflict, "facility %s already exists", facility.Name)
+		}
+		mInsertErr.Update(1)
+		return errors.Wrap(err, "error in inserting facility")
+	}
+	mInsertLatency.Update(time.Since(insertTimer))
+
+	mSuccess.Update(1)
+	return nil
+}
+
+// Update merges the fields of the body that are set into the facility of the given
+// name and returns the updated facility
+func Update(dbs *sql.DB, name string, body UpdateBody) (Facility, error) {
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`Inventory.Update-Facility-Metadata.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`Inventory.Update-Facility-Metadata.Success`, nil)
+	mUpdateErr := metrics.GetOrRegisterGauge(`Inventory.Update-Facility-Metadata.Update-Error`, nil)
+	mErrNotFound := metrics.GetOrRegisterGauge(`Inventory.Update-Facility-Metadata.NotFound-Error`, nil)
+	mUpdateLatency := metrics.GetOrRegisterTimer(`Inventory.Update-Facility-Metadata.Update-Latency`, nil)
+
+	// fields left out of the body are left out of the patch, so || keeps their values
+	obj, err := json.Marshal(body)
+	if err != nil {
+		return Facility{}, err
+	}
+	var patch map[string]interface{}
+	if err := json.Unmarshal(obj, &patch); err != nil {
+		return Facility{}, err
+	}
+	for field, value := range patch {
+		if value == nil {
+			delete(patch, field)
+		}
+	}
+	if obj, err = json.Marshal(patch); err != nil {
+		return Facility{}, err
+	}
+
+	updateStmt := fmt.Sprintf(`UPDATE %s SET %s = %s || $1::jsonb
+					WHERE %s ->> %s = $2 RETURNING %s`,
+		pq.QuoteIdentifier(facilitiesTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(nameColumn),
+		pq.QuoteIdentifier(jsonb),
+	)
+
+	updateTimer := time.Now()
+	var facility Facility
+	if err := dbs.QueryRow(updateStmt, string(obj), name).Scan(&facility); err != nil {
+		if err == sql.ErrNoRows {
+			mErrNotFound.Update(1)
+			return Facility{}, web.ErrNotFound
+		}
+		mUpdateErr.Update(1)
+		return Facility{}, errors.Wrap(err, "error in updating facility")
+	}
+	mUpdateLatency.Update(time.Since(updateTimer))
+
+	mSuccess.Update(1)
+	return facility, nil
+}
+
+// Remove deletes the facility of the given name along with its stock thresholds, daily
+// turn history, snapshots and shipping notices. A facility that sensors or tags still
+// refer to is only deleted when cascade is set, in which case its tags are deleted and
+// its sensors are moved to the default facility; otherwise web.ErrConflict is returned.
+// Everything is deleted in a single transaction. A sensor that still reports the facility
+// moves back to it with its next reads, which brings its tags back.
+func Remove(dbs *sql.DB, name string, cascade bool) (References, error) {
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`Inventory.Remove-Facility.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`Inventory.Remove-Facility.Success`, nil)
+	mDeleteErr := metrics.GetOrRegisterGauge(`Inventory.Remove-Facility.Delete-Error`, nil)
+	mErrNotFound := metrics.GetOrRegisterGauge(`Inventory.Remove-Facility.NotFound-Error`, nil)
+	mErrConflict := metrics.GetOrRegisterGauge(`Inventory.Remove-Facility.Conflict-Error`, nil)
+	mDeleteLatency := metrics.GetOrRegisterTimer(`Inventory.Remove-Facility.Delete-Latency`, nil)
+
+	if name == sensor.DefaultFacility {
+		mErrConflict.Update(1)
+		return References{}, errors.Wrapf(web.ErrConflict, "facility %s cannot be deleted", name)
+	}
+
+	deleteTimer := time.Now()
+	tx, err := dbs.Begin()
+	if err != nil {
+		mDeleteErr.Update(1)
+		return References{}, errors.Wrap(err, "error in starting transaction")
+	}
+	// rolls back unless committed
+	defer tx.Rollback() //nolint:errcheck
+
+	// lock the facility so sensors and tags are counted against a facility that stays put
+	lockQuery := fmt.Sprintf(`SELECT 1 FROM %s WHERE %s ->> %s = $1 FOR UPDATE`,
+		pq.QuoteIdentifier(facilitiesTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(nameColumn),
+	)
+	var found int
+	if err := tx.QueryRow(lockQuery, name).Scan(&found); err != nil {
+		if err == sql.ErrNoRows {
+			mErrNotFound.Update(1)
+			return References{}, web.ErrNotFound
+		}
+		mDeleteErr.Update(1)
+		return References{}, errors.Wrap(err, "error in finding facility")
+	}
+
+	references, err := countReferences(tx, name)
+	if err != nil {
+		mDeleteErr.Update(1)
+		return References{}, err
+	}
+
+	if references.Sensors > 0 || references.Tags > 0 {
+		if !cascade {
+			mErrConflict.Update(1)
+			return references, errors.Wrapf(web.ErrConflict,
+				"facility %s is referred to by %d sensors and %d tags", name, references.Sensors, references.Tags)
+		}
+
+		deleteTags := fmt.Sprintf(`DELETE FROM %s WHERE %s ->> %s = $1`,
+			pq.QuoteIdentifier(tagsTable),
+			pq.QuoteIdentifier(jsonb),
+			pq.QuoteLiteral(facilityIDColumn),
+		)
+		if _, err := tx.Exec(deleteTags, name); err != nil {
+			mDeleteErr.Update(1)
+			return References{}, errors.Wrap(err, "error in deleting tags of facility")
+		}
+
+		moveSensors := fmt.Sprintf(`UPDATE %s SET %s = jsonb_set(%s, $1, to_jsonb($2::text))
+						WHERE %s ->> %s = $3`,
+			pq.QuoteIdentifier(rspConfigTable),
+			pq.QuoteIdentifier(jsonb),
+			pq.QuoteIdentifier(jsonb),
+			pq.QuoteIdentifier(jsonb),
+			pq.QuoteLiteral(facilityIDColumn),
+		)
+		if _, err := tx.Exec(moveSensors, pq.Array([]string{facilityIDColumn}), sensor.DefaultFacility, name); err != nil {
+			mDeleteErr.Update(1)
+			return References{}, errors.Wrap(err, "error in moving sensors of facility")
+		}
+	}
+
+	for _, table := range ownedTables {
+		deleteOwned := fmt.Sprintf(`DELETE FROM %s WHERE %s ->> %s = $1`,
+			pq.QuoteIdentifier(table),
+			pq.QuoteIdentifier(jsonb),
+			pq.QuoteLiteral(facilityIDColumn),
+		)
+		if _, err := tx.Exec(deleteOwned, name); err != nil {
+			mDeleteErr.Update(1)
+			return References{}, errors.Wrapf(err, "error in deleting %s of facility", table)
+		}
+	}
+
+	deleteStmt := fmt.Sprintf(`DELETE FROM %s WHERE %s ->> %s = $1`,
+		pq.QuoteIdentifier(facilitiesTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(nameColumn),
+	)
+	if _, err := tx.Exec(deleteStmt, name); err != nil {
+		mDeleteErr.Update(1)
+		return References{}, errors.Wrap(err, "error in deleting facility")
+	}
+
+	if err := tx.Commit(); err != nil {
+		mDeleteErr.Update(1)
+		return References{}, errors.Wrap(err, "error in committing transaction")
+	}
+	mDeleteLatency.Update(time.Since(deleteTimer))
+
+	mSuccess.Update(1)
+	return references, nil
+}
+
+// queryRower is implemented by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// countReferences counts the sensors and tags that refer to the facility
+func countReferences(dbs queryRower, name string) (References, error) {
+
+	countQuery := fmt.Sprintf(`SELECT
+			(SELECT count(*) FROM %s WHERE %s ->> %s = $1),
+			(SELECT count(*) FROM %s WHERE %s ->> %s = $1)`,
+		pq.QuoteIdentifier(rspConfigTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(facilityIDColumn),
+		pq.QuoteIdentifier(tagsTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(facilityIDColumn),
+	)
+
+	var references References
+	if err := dbs.QueryRow(countQuery, name).Scan(&references.Sensors, &references.Tags); err != nil {
+		return References{}, errors.Wrap(err, "error in counting facility references")
+	}
+	return references, nil
+}
+
 // Value implements driver.Valuer interfaces
 func (facility Facility) Value() (driver.Value, error) {
 	return json.Marshal(facility)
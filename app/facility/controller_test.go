@@ -14,9 +14,12 @@ import (
 	"net/url"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/sensor"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/web"
+	"github.com/pkg/errors"
 )
 
 var dbHost integrationtest.DBHost
@@ -254,3 +257,159 @@ func TestUpdate_nonExistItem(t *testing.T) {
 		}
 	}
 }
+
+func TestCreateAndUpdate(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	clearAllData(t, testDB.DB)
+
+	newFacility := Facility{
+		Name:         "store001",
+		DisplayName:  "Store 1",
+		TimeZone:     "America/Los_Angeles",
+		Coefficients: Coefficients{DailyInventoryPercentage: 0.01, ProbUnreadToRead: 0.2, ProbInStoreRead: 0.75, ProbExitError: 0.1},
+	}
+	if err := Create(testDB.DB, newFacility); err != nil {
+		t.Fatalf("error creating facility: %+v", err)
+	}
+	if err := Create(testDB.DB, newFacility); errors.Cause(err) != web.ErrConflict {
+		t.Errorf("expected conflict creating the facility twice, got %v", err)
+	}
+
+	displayName := "Hillsboro Store"
+	address := Address{City: "Hillsboro", Country: "US"}
+	updated, err := Update(testDB.DB, "store001", UpdateBody{DisplayName: &displayName, Address: &address})
+	if err != nil {
+		t.Fatalf("error updating facility: %+v", err)
+	}
+
+	expected := newFacility
+	expected.DisplayName = displayName
+	expected.Address = &address
+	if !reflect.DeepEqual(updated, expected) {
+		t.Errorf("expected %+v, got %+v", expected, updated)
+	}
+
+	found, err := Find(testDB.DB, "store001")
+	if err != nil {
+		t.Fatalf("error finding facility: %+v", err)
+	}
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected %+v, got %+v", expected, found)
+	}
+
+	if _, err := Update(testDB.DB, "store002", UpdateBody{DisplayName: &displayName}); err != web.ErrNotFound {
+		t.Errorf("expected not found updating an unknown facility, got %v", err)
+	}
+	if _, err := Find(testDB.DB, "store002"); err != web.ErrNotFound {
+		t.Errorf("expected not found finding an unknown facility, got %v", err)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	clearAllData(t, testDB.DB)
+	insertSampleCustom(t, testDB.DB, "store001")
+	insertSampleCustom(t, testDB.DB, "store002")
+
+	statements := []string{
+		`INSERT INTO rspconfig (data) VALUES ('{"device_id":"RSP-150000","facility_id":"store001"}')`,
+		`INSERT INTO tags (data) VALUES ('{"epc":"30143639F8419105417AED6F","facility_id":"store001"}')`,
+		`INSERT INTO tags (data) VALUES ('{"epc":"30143639F8419105417AED70","facility_id":"store002"}')`,
+		`INSERT INTO stockthresholds (data) VALUES ('{"product_id":"00012345678905","facility_id":"store001","min_quantity":1}')`,
+		`INSERT INTO dailyturnhistory (data) VALUES ('{"product_id":"00012345678905","facility_id":"store001"}')`,
+		`INSERT INTO snapshots (data) VALUES ('{"facility_id":"store001","product_id":"00012345678905","timestamp":1000}')`,
+		`INSERT INTO shippingnotices (data) VALUES ('{"asn_id":"asn1","facility_id":"store001"}')`,
+	}
+	for _, statement := range statements {
+		if _, err := testDB.DB.Exec(statement); err != nil {
+			t.Fatalf("error inserting references: %s", err)
+		}
+	}
+
+	details, err := FindDetails(testDB.DB, "store001")
+	if err != nil {
+		t.Fatalf("error finding facility: %+v", err)
+	}
+	if details.Sensors != 1 || details.Tags != 1 {
+		t.Errorf("expected 1 sensor and 1 tag, got %+v", details.References)
+	}
+
+	if _, err := Remove(testDB.DB, "store001", false); errors.Cause(err) != web.ErrConflict {
+		t.Fatalf("expected conflict deleting a facility that is referred to, got %v", err)
+	}
+	if _, err := Find(testDB.DB, "store001"); err != nil {
+		t.Fatalf("expected the facility to remain: %v", err)
+	}
+
+	if _, err := Remove(testDB.DB, "store001", true); err != nil {
+		t.Fatalf("error deleting facility: %+v", err)
+	}
+	if _, err := Find(testDB.DB, "store001"); err != web.ErrNotFound {
+		t.Errorf("expected the facility to be deleted, got %v", err)
+	}
+
+	var sensorFacility string
+	if err := testDB.DB.QueryRow(`SELECT data->>'facility_id' FROM rspconfig WHERE data->>'device_id' = 'RSP-150000'`).Scan(&sensorFacility); err != nil {
+		t.Fatalf("error finding sensor: %s", err)
+	}
+	if sensorFacility != sensor.DefaultFacility {
+		t.Errorf("expected sensor to be moved to %s, got %s", sensor.DefaultFacility, sensorFacility)
+	}
+
+	var tagCount int
+	if err := testDB.DB.QueryRow(`SELECT count(*) FROM tags`).Scan(&tagCount); err != nil {
+		t.Fatalf("error counting tags: %s", err)
+	}
+	if tagCount != 1 {
+		t.Errorf("expected only the tag of store002 to remain, got %d tags", tagCount)
+	}
+
+	for _, table := range ownedTables {
+		var count int
+		if err := testDB.DB.QueryRow(`SELECT count(*) FROM ` + table).Scan(&count); err != nil {
+			t.Fatalf("error counting %s: %s", table, err)
+		}
+		if count != 0 {
+			t.Errorf("expected the %s of store001 to be deleted, got %d", table, count)
+		}
+	}
+
+	if _, err := Remove(testDB.DB, "store001", true); err != web.ErrNotFound {
+		t.Errorf("expected not found deleting an unknown facility, got %v", err)
+	}
+}
+
+func TestCheckUniqueNames(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	clearAllData(t, testDB.DB)
+	insertSampleCustom(t, testDB.DB, "store001")
+	if err := CheckUniqueNames(testDB.DB); err != nil {
+		t.Fatalf("expected unique facility names, got %v", err)
+	}
+
+	// duplicates stored before names were unique
+	statements := []string{
+		`DROP INDEX idx_facility_name`,
+		`INSERT INTO facilities (data) VALUES ('{"name":"store001"}')`,
+	}
+	for _, statement := range statements {
+		if _, err := testDB.DB.Exec(statement); err != nil {
+			t.Fatalf("error inserting duplicate facility: %s", err)
+		}
+	}
+
+	err := CheckUniqueNames(testDB.DB)
+	if err == nil || !strings.Contains(err.Error(), `"store001"`) {
+		t.Errorf("expected the duplicated facility to be listed, got %v", err)
+	}
+	var count int
+	if err := testDB.DB.QueryRow(`SELECT count(*) FROM facilities`).Scan(&count); err != nil || count != 2 {
+		t.Errorf("expected the duplicates to be kept, got %d %v", count, err)
+	}
+}
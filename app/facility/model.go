@@ -9,12 +9,43 @@ package facility
 // Facility represents a facility model
 //swagger:model Facility
 type Facility struct {
-	// Facility name
+	// Facility name, the identifier tags and sensors refer to the facility by
 	Name string `json:"name"  db:"name"`
+	// Human readable name of the facility
+	DisplayName string `json:"display_name,omitempty"  db:"display_name"`
+	// IANA time zone of the facility, such as America/Los_Angeles
+	TimeZone string `json:"time_zone,omitempty"  db:"time_zone"`
+	// Postal address of the facility
+	Address *Address `json:"address,omitempty"  db:"address"`
 	// The coefficients used in the probabilistic inventory algorithm
 	Coefficients Coefficients `json:"coefficients"  db:"coefficients"`
 }
 
+// Address is the postal address of a facility
+//swagger:model Address
+type Address struct {
+	Street     string `json:"street,omitempty"`
+	City       string `json:"city,omitempty"`
+	Region     string `json:"region,omitempty"`
+	PostalCode string `json:"postal_code,omitempty"`
+	Country    string `json:"country,omitempty"`
+}
+
+// Details is a facility along with the number of sensors and tags referring to it
+//swagger:model FacilityDetails
+type Details struct {
+	Facility
+	References
+}
+
+// References counts the sensors and tags referring to a facility
+type References struct {
+	// Number of sensors configured for the facility
+	Sensors int `json:"sensor_count"`
+	// Number of tags last seen in the facility
+	Tags int `json:"tag_count"`
+}
+
 // CountType represents a wrapper for count and inlinecount
 type CountType struct {
 	Count *int `json:"count"`
@@ -42,6 +73,16 @@ type Coefficients struct {
 	ProbExitError float64 `json:"probexiterror" db:"probexiterror"`
 }
 
+// UpdateBody is the request body to update the metadata of a facility. Fields that are
+// not provided are left unchanged.
+//swagger:ignore
+type UpdateBody struct {
+	DisplayName  *string       `json:"display_name"`
+	TimeZone     *string       `json:"time_zone"`
+	Address      *Address      `json:"address"`
+	Coefficients *Coefficients `json:"coefficients"`
+}
+
 // RequestBody represents a struct for the requestBody to Update facility collection
 //swagger:ignore
 type RequestBody struct {
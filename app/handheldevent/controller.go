@@ -12,6 +12,7 @@ import (
 	"encoding/json"
 	"fmt"
 	odata "github.com/intel/rsp-sw-toolkit-im-suite-go-odata/postgresql"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/odatafilter"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/web"
 	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
 	"github.com/lib/pq"
@@ -62,7 +63,7 @@ func Retrieve(dbs *sql.DB, query url.Values) (interface{}, *CountType, error) {
 	retrieveTimer := time.Now()
 
 	// Run OData PostgreSQL
-	rows, err := odata.ODataSQLQuery(query, handheldEventsTable, jsonb, dbs)
+	rows, err := odatafilter.SQLQuery(query, handheldEventsTable, jsonb, dbs)
 	if err != nil {
 		if errors.Cause(err) == odata.ErrInvalidInput {
 			mInputErr.Update(1)
@@ -146,3 +147,43 @@ func Insert(dbs *sql.DB, handheldEvent HandheldEvent) error {
 
 	return nil
 }
+
+// FindBySession retrieves the handheld events recorded for a full scan session
+func FindBySession(dbs *sql.DB, sessionID string) ([]HandheldEvent, error) {
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`HandheldEvent.FindBySession.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`HandheldEvent.FindBySession.Success`, nil)
+	mFindErr := metrics.GetOrRegisterGauge("HandheldEvent.FindBySession.Find-Error", nil)
+
+	selectQuery := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ->> 'session_id' = %s`,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteIdentifier(handheldEventsTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(sessionID),
+	)
+
+	rows, err := dbs.Query(selectQuery)
+	if err != nil {
+		mFindErr.Update(1)
+		return nil, errors.Wrap(err, "error retrieving handheld session events")
+	}
+	defer rows.Close()
+
+	events := make([]HandheldEvent, 0)
+	for rows.Next() {
+		var event HandheldEvent
+		if err := rows.Scan(&event); err != nil {
+			mFindErr.Update(1)
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		mFindErr.Update(1)
+		return nil, err
+	}
+
+	mSuccess.Update(1)
+	return events, nil
+}
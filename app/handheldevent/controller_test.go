@@ -145,6 +145,43 @@ func TestInsertHandHeldEvents(t *testing.T) {
 	}
 }
 
+func TestFindBySession(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+	clearAllData(t, testDB.DB)
+
+	insertSample(t, testDB.DB)
+
+	sessionEvents := []HandheldEvent{
+		{Event: FullScanStart, Timestamp: 1000, SessionID: "session-1", FacilityID: "store001"},
+		{Event: FullScanComplete, Timestamp: 2000, SessionID: "session-1", FacilityID: "store001"},
+		{Event: FullScanStart, Timestamp: 3000, SessionID: "session-2", FacilityID: "store001"},
+	}
+	for _, event := range sessionEvents {
+		if err := Insert(testDB.DB, event); err != nil {
+			t.Fatalf("error inserting handheld event %s", err.Error())
+		}
+	}
+
+	events, err := FindBySession(testDB.DB, "session-1")
+	if err != nil {
+		t.Fatalf("error finding handheld session %s", err.Error())
+	}
+	if len(events) != 2 {
+		t.Errorf("expected 2 events for session, received %d", len(events))
+	}
+
+	events, err = FindBySession(testDB.DB, "unknown")
+	if err != nil {
+		t.Fatalf("error finding handheld session %s", err.Error())
+	}
+	if len(events) != 0 {
+		t.Errorf("expected no events for unknown session, received %d", len(events))
+	}
+
+	clearAllData(t, testDB.DB)
+}
+
 func insertSample(t *testing.T, db *sql.DB) {
 	var eventData HandheldEvent
 
@@ -6,6 +6,17 @@
 
 package handheldevent
 
+import "github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/tag"
+
+const (
+	// FullScanStart is the event recorded when a handheld full scan session begins
+	FullScanStart = "FullScanStart"
+	// FullScanComplete is the event recorded when a handheld full scan session ends
+	FullScanComplete = "FullScanComplete"
+	// Calculate is the event recorded when a calculation is requested from a handheld
+	Calculate = "Calculate"
+)
+
 // HandheldEvent represents a handheld event model
 //swagger:model HandheldEvent
 type HandheldEvent struct {
@@ -14,6 +25,47 @@ type HandheldEvent struct {
 	// Time event was received in epoch
 	// min: 13
 	Timestamp int64 `json:"timestamp"`
+	// Full scan session the event belongs to
+	SessionID string `json:"session_id,omitempty"`
+	// Facility being scanned
+	FacilityID string `json:"facility_id,omitempty"`
+	// Zone (location) being scanned, empty when scanning the whole facility
+	Zone string `json:"zone,omitempty"`
+}
+
+// SessionStartBody is the request body for starting a full scan session
+type SessionStartBody struct {
+	// Facility to scan
+	FacilityID string `json:"facility_id"`
+	// Zone (location) to scan, leave empty to scan the whole facility
+	Zone string `json:"zone"`
+	// Session start time in milliseconds epoch, defaults to the current time
+	Timestamp int64 `json:"timestamp"`
+}
+
+// SessionCompleteBody is the request body for completing a full scan session
+type SessionCompleteBody struct {
+	// Full scan session identifier returned when the session was started
+	SessionID string `json:"session_id"`
+}
+
+// ReconciliationReport is the result of completing a full scan session
+//swagger:model ReconciliationReport
+type ReconciliationReport struct {
+	// Full scan session identifier
+	SessionID string `json:"session_id"`
+	// Facility that was scanned
+	FacilityID string `json:"facility_id"`
+	// Zone that was scanned, empty for the whole facility
+	Zone string `json:"zone,omitempty"`
+	// Session start time in milliseconds epoch
+	Started int64 `json:"started"`
+	// Session completion time in milliseconds epoch
+	Completed int64 `json:"completed"`
+	// Number of tags believed present that were not read during the session
+	MissingCount int `json:"missing_count"`
+	// Tags believed present that were not read during the session
+	Missing []tag.Tag `json:"missing"`
 }
 
 // CountType represents a wrapper for count and inlinecount
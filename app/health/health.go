@@ -0,0 +1,173 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// StatusUp is the status of a dependency that responded, or a service whose
+	// required dependencies all responded
+	StatusUp = "up"
+	// StatusDown is the status of a dependency that did not respond, or a service
+	// with a required dependency that did not respond
+	StatusDown = "down"
+)
+
+// Check is the result of checking a dependency
+type Check struct {
+	// Name of the dependency
+	Name string `json:"name"`
+	// Whether the service is not ready when the dependency is down
+	Required bool `json:"required"`
+	// up or down
+	Status string `json:"status"`
+	// Time in milliseconds the dependency took to respond
+	LatencyMillis float64 `json:"latency_ms"`
+	// Why the dependency is down
+	Error string `json:"error,omitempty"`
+}
+
+// Pipeline is the state of the EdgeX pipeline feeding the service
+type Pipeline struct {
+	// Whether the app-functions-sdk context has been grabbed, which happens on the first
+	// event received. Events cannot be pushed to core data until then.
+	SdkContextGrabbed bool `json:"sdk_context_grabbed"`
+	// Time in milliseconds the last inventory_data was received, 0 if none was
+	LastInventoryData int64 `json:"last_inventory_data"`
+	// Seconds since the last inventory_data was received, omitted if none was
+	SecondsSinceInventoryData *float64 `json:"seconds_since_inventory_data,omitempty"`
+	// Number of inventory events waiting to be processed
+	EventQueueDepth int `json:"event_queue_depth"`
+	// Number of inventory events that can wait before receiving events blocks
+	EventQueueCapacity int `json:"event_queue_capacity"`
+}
+
+// Report is the readiness of the service
+type Report struct {
+	// up unless a required dependency is down
+	Status   string    `json:"status"`
+	Checks   []Check   `json:"checks"`
+	Pipeline *Pipeline `json:"pipeline,omitempty"`
+}
+
+// Service is an HTTP service the service depends on
+type Service struct {
+	Name     string
+	URL      string
+	Required bool
+}
+
+// NewReport returns the report of the checks and, when given, the required check of the
+// pipeline. The report is down when a required check is down.
+func NewReport(checks []Check, pipeline *Pipeline) Report {
+	if pipeline != nil {
+		checks = append(checks, pipeline.check())
+	}
+	report := Report{Status: StatusUp, Checks: checks, Pipeline: pipeline}
+	for _, check := range checks {
+		if check.Required && check.Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+// check returns the pipeline check, which is down until the app-functions-sdk context has
+// been grabbed, as events cannot be pushed to core data, and while the event queue is full,
+// as receiving events is blocked
+func (pipeline Pipeline) check() Check {
+	check := Check{Name: "pipeline", Required: true, Status: StatusUp}
+	switch {
+	case !pipeline.SdkContextGrabbed:
+		check.Status = StatusDown
+		check.Error = "no event has been received, the app-functions-sdk context has not been grabbed"
+	case pipeline.EventQueueCapacity > 0 && pipeline.EventQueueDepth >= pipeline.EventQueueCapacity:
+		check.Status = StatusDown
+		check.Error = fmt.Sprintf("inventory event queue is full with %d events", pipeline.EventQueueDepth)
+	}
+	return check
+}
+
+// PingDatabase checks the database responds within timeout
+func PingDatabase(db *sql.DB, timeout time.Duration) Check {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := db.PingContext(ctx)
+	return newCheck("database", true, start, err)
+}
+
+// CheckServices checks each service accepts connections within timeout. Services are
+// checked concurrently and reported in the order given.
+func CheckServices(services []Service, timeout time.Duration) []Check {
+	checks := make([]Check, len(services))
+
+	var wg sync.WaitGroup
+	for i := range services {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			checks[i] = dialService(services[i], timeout)
+		}(i)
+	}
+	wg.Wait()
+
+	return checks
+}
+
+// dialService opens, and closes, a TCP connection to the host of the service URL
+func dialService(service Service, timeout time.Duration) Check {
+	start := time.Now()
+
+	if service.URL == "" {
+		return newCheck(service.Name, service.Required, start, errors.New("service is not configured"))
+	}
+
+	serviceURL, err := url.Parse(service.URL)
+	if err != nil || serviceURL.Hostname() == "" {
+		return newCheck(service.Name, service.Required, start, errors.Errorf("invalid service URL %q", service.URL))
+	}
+
+	port := serviceURL.Port()
+	if port == "" {
+		port = "80"
+		if serviceURL.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(serviceURL.Hostname(), port), timeout)
+	if err == nil {
+		_ = conn.Close()
+	}
+	return newCheck(service.Name, service.Required, start, err)
+}
+
+func newCheck(name string, required bool, start time.Time, err error) Check {
+	check := Check{
+		Name:          name,
+		Required:      required,
+		Status:        StatusUp,
+		LatencyMillis: float64(time.Since(start)) / float64(time.Millisecond),
+	}
+	if err != nil {
+		check.Status = StatusDown
+		check.Error = err.Error()
+	}
+	return check
+}
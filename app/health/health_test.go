@@ -0,0 +1,90 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckServices(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// a server that was closed leaves a port nothing listens on
+	closed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closed.Close()
+
+	services := []Service{
+		{Name: "up", URL: server.URL},
+		{Name: "closed", URL: closed.URL, Required: true},
+		{Name: "not-configured", URL: ""},
+		{Name: "invalid", URL: "://"},
+	}
+	expected := []string{StatusUp, StatusDown, StatusDown, StatusDown}
+
+	checks := CheckServices(services, time.Second)
+	if len(checks) != len(services) {
+		t.Fatalf("expected %d checks, got %d", len(services), len(checks))
+	}
+	for i, check := range checks {
+		if check.Name != services[i].Name || check.Required != services[i].Required {
+			t.Errorf("expected check %d to be of service %+v, got %+v", i, services[i], check)
+		}
+		if check.Status != expected[i] {
+			t.Errorf("expected %s to be %s, got %+v", check.Name, expected[i], check)
+		}
+		if check.Status == StatusDown && check.Error == "" {
+			t.Errorf("expected %s to report why it is down", check.Name)
+		}
+	}
+}
+
+func TestNewReport(t *testing.T) {
+	tests := []struct {
+		name     string
+		checks   []Check
+		expected string
+	}{
+		{"no checks", nil, StatusUp},
+		{"optional check down", []Check{{Name: "database", Required: true, Status: StatusUp}, {Name: "rules", Status: StatusDown}}, StatusUp},
+		{"required check down", []Check{{Name: "database", Required: true, Status: StatusDown}, {Name: "rules", Status: StatusUp}}, StatusDown},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if report := NewReport(test.checks, nil); report.Status != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, report.Status)
+			}
+		})
+	}
+}
+
+func TestNewReportPipeline(t *testing.T) {
+	database := Check{Name: "database", Required: true, Status: StatusUp}
+	tests := []struct {
+		name     string
+		pipeline Pipeline
+		expected string
+	}{
+		{"context grabbed", Pipeline{SdkContextGrabbed: true, EventQueueDepth: 9, EventQueueCapacity: 10}, StatusUp},
+		{"context not grabbed", Pipeline{EventQueueCapacity: 10}, StatusDown},
+		{"event queue full", Pipeline{SdkContextGrabbed: true, EventQueueDepth: 10, EventQueueCapacity: 10}, StatusDown},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := NewReport([]Check{database}, &test.pipeline)
+			if report.Status != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, report.Status)
+			}
+			if len(report.Checks) != 2 || report.Checks[1].Name != "pipeline" || report.Checks[1].Status != test.expected {
+				t.Errorf("expected the pipeline to be checked, got %+v", report.Checks)
+			}
+		})
+	}
+}
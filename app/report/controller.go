@@ -0,0 +1,360 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package report
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/tag"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+const (
+	tagsTable       = "tags"
+	facilitiesTable = "facilities"
+	jsonb           = "data"
+	facilityColumn = "facility_id"
+	epcStateColumn = "epc_state"
+	lastReadColumn = "last_read"
+	presentState   = "present"
+	nameColumn     = "name"
+	timeZoneColumn = "time_zone"
+
+	epcStateDeparted      = "departed"
+	departureReasonColumn = "departure_reason"
+	departedAtColumn      = "departed_at"
+	// Departures through an exit; sold tags depart with reason pos instead
+	departureReasonExit = "exit"
+)
+
+// CycleCount builds the cycle count accuracy report of a facility for the count that
+// ran between start and end. Tags believed present before the count started are
+// expected, tags read between start and end are counted. The report is computed from
+// the current state of the tags, so end must not be in the past.
+func CycleCount(dbs *sql.DB, facilityID string, start int64, end int64) (CycleCountReport, error) {
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`Inventory.CycleCountReport.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`Inventory.CycleCountReport.Success`, nil)
+	mFindErr := metrics.GetOrRegisterGauge(`Inventory.CycleCountReport.Find-Error`, nil)
+	mFindLatency := metrics.GetOrRegisterTimer(`Inventory.CycleCountReport.Find-Latency`, nil)
+
+	// Only tags that are present, or were read since the count started, can be
+	// either expected or counted
+	selectQuery := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ->> %s = %s
+								AND (%s ->> %s = %s OR (%s ->> %s)::bigint >= %d)`,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteIdentifier(tagsTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(facilityColumn),
+		pq.QuoteLiteral(facilityID),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(epcStateColumn),
+		pq.QuoteLiteral(presentState),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(lastReadColumn),
+		start,
+	)
+
+	retrieveTimer := time.Now()
+	rows, err := dbs.Query(selectQuery)
+	if err != nil {
+		mFindErr.Update(1)
+		return CycleCountReport{}, errors.Wrap(err, "error retrieving tags for cycle count report")
+	}
+	defer rows.Close()
+
+	var tags []tag.Tag
+	for rows.Next() {
+		var tagData tag.Tag
+		if err := rows.Scan(&tagData); err != nil {
+			mFindErr.Update(1)
+			return CycleCountReport{}, err
+		}
+		tags = append(tags, tagData)
+	}
+	if err := rows.Err(); err != nil {
+		mFindErr.Update(1)
+		return CycleCountReport{}, err
+	}
+	mFindLatency.Update(time.Since(retrieveTimer))
+
+	mSuccess.Update(1)
+	return CycleCountReport{
+		FacilityID: facilityID,
+		StartTime:  start,
+		EndTime:    end,
+		Results:    computeCycleCount(tags, start, end),
+	}, nil
+}
+
+// computeCycleCount groups tags per product, comparing the tags expected when the count
+// started against the tags read during the count. Results are sorted by product id.
+func computeCycleCount(tags []tag.Tag, start int64, end int64) []CycleCountEntry {
+	entries := make(map[string]*CycleCountEntry)
+
+	for _, tagData := range tags {
+		// A tag that departed after being read during the count was still there when it started
+		expected := tagData.Arrived < start && (tagData.EpcState == presentState || tagData.LastRead >= start)
+		counted := tagData.LastRead >= start && tagData.LastRead <= end
+		if !expected && !counted {
+			continue
+		}
+
+		entry, ok := entries[tagData.ProductID]
+		if !ok {
+			entry = &CycleCountEntry{
+				ProductID:  tagData.ProductID,
+				Missing:    []string{},
+				Unexpected: []string{},
+			}
+			entries[tagData.ProductID] = entry
+		}
+
+		if expected {
+			entry.Expected++
+		}
+		if counted {
+			entry.Counted++
+		}
+		if expected && !counted {
+			entry.Missing = append(entry.Missing, tagData.Epc)
+		}
+		if counted && !expected {
+			entry.Unexpected = append(entry.Unexpected, tagData.Epc)
+		}
+	}
+
+	results := make([]CycleCountEntry, 0, len(entries))
+	for _, entry := range entries {
+		sort.Strings(entry.Missing)
+		sort.Strings(entry.Unexpected)
+		results = append(results, *entry)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ProductID < results[j].ProductID
+	})
+
+	return results
+}
+
+// WriteCycleCountCSV writes the cycle count report as CSV, one row per product. Missing
+// and unexpected EPCs are separated by semicolons.
+func WriteCycleCountCSV(writer io.Writer, report CycleCountReport) error {
+	csvWriter := csv.NewWriter(writer)
+
+	if err := csvWriter.Write([]string{"product_id", "expected", "counted", "missing", "unexpected"}); err != nil {
+		return err
+	}
+	for _, entry := range report.Results {
+		record := []string{
+			entry.ProductID,
+			strconv.Itoa(entry.Expected),
+			strconv.Itoa(entry.Counted),
+			strings.Join(entry.Missing, ";"),
+			strings.Join(entry.Unexpected, ";"),
+		}
+		if err := csvWriter.Write(record); err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// Shrink builds the shrink report of exit departures between start and end, for a single
+// facility or for all facilities when facilityID is empty. A tag departing through an exit
+// was not sold, as sold tags are departed by the point of sale.
+func Shrink(dbs *sql.DB, facilityID string, start int64, end int64) (ShrinkReport, error) {
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`Inventory.ShrinkReport.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`Inventory.ShrinkReport.Success`, nil)
+	mFindErr := metrics.GetOrRegisterGauge(`Inventory.ShrinkReport.Find-Error`, nil)
+	mFindLatency := metrics.GetOrRegisterTimer(`Inventory.ShrinkReport.Find-Latency`, nil)
+
+	// Tags that departed before departed_at was recorded only have their last read
+	selectQuery := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ->> %s = %s AND %s ->> %s = %s
+								AND COALESCE(%s ->> %s, %s ->> %s)::bigint BETWEEN %d AND %d`,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteIdentifier(tagsTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(epcStateColumn),
+		pq.QuoteLiteral(epcStateDeparted),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(departureReasonColumn),
+		pq.QuoteLiteral(departureReasonExit),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(departedAtColumn),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(lastReadColumn),
+		start,
+		end,
+	)
+	if facilityID != "" {
+		selectQuery += fmt.Sprintf(` AND %s ->> %s = %s`,
+			pq.QuoteIdentifier(jsonb),
+			pq.QuoteLiteral(facilityColumn),
+			pq.QuoteLiteral(facilityID),
+		)
+	}
+
+	retrieveTimer := time.Now()
+	rows, err := dbs.Query(selectQuery)
+	if err != nil {
+		mFindErr.Update(1)
+		return ShrinkReport{}, errors.Wrap(err, "error retrieving tags for shrink report")
+	}
+	defer rows.Close()
+
+	var tags []tag.Tag
+	for rows.Next() {
+		var tagData tag.Tag
+		if err := rows.Scan(&tagData); err != nil {
+			mFindErr.Update(1)
+			return ShrinkReport{}, err
+		}
+		tags = append(tags, tagData)
+	}
+	if err := rows.Err(); err != nil {
+		mFindErr.Update(1)
+		return ShrinkReport{}, err
+	}
+	mFindLatency.Update(time.Since(retrieveTimer))
+
+	locations, err := facilityLocations(dbs)
+	if err != nil {
+		mFindErr.Update(1)
+		return ShrinkReport{}, err
+	}
+
+	mSuccess.Update(1)
+	return ShrinkReport{
+		FacilityID: facilityID,
+		StartTime:  start,
+		EndTime:    end,
+		Results:    computeShrink(tags, locations),
+	}, nil
+}
+
+// facilityLocations returns the time zone of each facility that has one
+func facilityLocations(dbs *sql.DB) (map[string]*time.Location, error) {
+	selectQuery := fmt.Sprintf(`SELECT %s ->> %s, %s ->> %s FROM %s WHERE COALESCE(%s ->> %s, '') <> ''`,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(nameColumn),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(timeZoneColumn),
+		pq.QuoteIdentifier(facilitiesTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(timeZoneColumn),
+	)
+
+	rows, err := dbs.Query(selectQuery)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving facility time zones")
+	}
+	defer rows.Close()
+
+	locations := make(map[string]*time.Location)
+	for rows.Next() {
+		var name, timeZone string
+		if err := rows.Scan(&name, &timeZone); err != nil {
+			return nil, err
+		}
+		// Time zones are validated when facilities are updated
+		if location, err := time.LoadLocation(timeZone); err == nil {
+			locations[name] = location
+		}
+	}
+	return locations, rows.Err()
+}
+
+// computeShrink counts exit departures per product, facility, exit alias and hour of day,
+// in the time zone of the facility, or UTC when it has none. Results are sorted by count,
+// highest first, so hotspots come first.
+func computeShrink(tags []tag.Tag, locations map[string]*time.Location) []ShrinkEntry {
+	entries := make(map[ShrinkEntry]int)
+
+	for _, tagData := range tags {
+		if tagData.EpcState != epcStateDeparted || tagData.DepartureReason != departureReasonExit {
+			continue
+		}
+		departedAt := tagData.DepartedAt
+		if departedAt == 0 {
+			departedAt = tagData.LastRead
+		}
+		location, ok := locations[tagData.FacilityID]
+		if !ok {
+			location = time.UTC
+		}
+		key := ShrinkEntry{
+			ProductID:  tagData.ProductID,
+			FacilityID: tagData.FacilityID,
+			ExitAlias:  tagData.DepartureLocation,
+			Hour:       time.Unix(0, departedAt*int64(time.Millisecond)).In(location).Hour(),
+		}
+		entries[key]++
+	}
+
+	results := make([]ShrinkEntry, 0, len(entries))
+	for entry, count := range entries {
+		entry.Count = count
+		results = append(results, entry)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.FacilityID != b.FacilityID {
+			return a.FacilityID < b.FacilityID
+		}
+		if a.ExitAlias != b.ExitAlias {
+			return a.ExitAlias < b.ExitAlias
+		}
+		if a.Hour != b.Hour {
+			return a.Hour < b.Hour
+		}
+		return a.ProductID < b.ProductID
+	})
+
+	return results
+}
+
+// WriteShrinkCSV writes the shrink report as CSV, one row per product, facility, exit and hour
+func WriteShrinkCSV(writer io.Writer, report ShrinkReport) error {
+	csvWriter := csv.NewWriter(writer)
+
+	if err := csvWriter.Write([]string{"product_id", "facility_id", "exit_alias", "hour", "count"}); err != nil {
+		return err
+	}
+	for _, entry := range report.Results {
+		record := []string{
+			entry.ProductID,
+			entry.FacilityID,
+			entry.ExitAlias,
+			strconv.Itoa(entry.Hour),
+			strconv.Itoa(entry.Count),
+		}
+		if err := csvWriter.Write(record); err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
@@ -0,0 +1,122 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package report
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/tag"
+)
+
+func TestComputeCycleCount(t *testing.T) {
+	start := int64(1000)
+	end := int64(2000)
+
+	tags := []tag.Tag{
+		// present before the count and read during it
+		{Epc: "counted", ProductID: "A", Arrived: 100, LastRead: 1500, EpcState: "present"},
+		// present before the count and not read
+		{Epc: "missing", ProductID: "A", Arrived: 100, LastRead: 500, EpcState: "present"},
+		// arrived during the count
+		{Epc: "unexpected", ProductID: "A", Arrived: 1200, LastRead: 1200, EpcState: "present"},
+		// read during the count, departed afterwards
+		{Epc: "departed-after", ProductID: "B", Arrived: 100, LastRead: 1800, EpcState: "departed"},
+		// departed before the count
+		{Epc: "departed-before", ProductID: "B", Arrived: 100, LastRead: 500, EpcState: "departed"},
+	}
+
+	expected := []CycleCountEntry{
+		{ProductID: "A", Expected: 2, Counted: 2, Missing: []string{"missing"}, Unexpected: []string{"unexpected"}},
+		{ProductID: "B", Expected: 1, Counted: 1, Missing: []string{}, Unexpected: []string{}},
+	}
+
+	results := computeCycleCount(tags, start, end)
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Expected %+v, received %+v", expected, results)
+	}
+}
+
+func TestWriteCycleCountCSV(t *testing.T) {
+	report := CycleCountReport{
+		FacilityID: "store001",
+		Results: []CycleCountEntry{
+			{ProductID: "A", Expected: 2, Counted: 1, Missing: []string{"e1", "e2"}, Unexpected: []string{}},
+		},
+	}
+
+	var buffer bytes.Buffer
+	if err := WriteCycleCountCSV(&buffer, report); err != nil {
+		t.Fatalf("Error writing csv %s", err.Error())
+	}
+
+	expected := "product_id,expected,counted,missing,unexpected\nA,2,1,e1;e2,\n"
+	if buffer.String() != expected {
+		t.Errorf("Expected %q, received %q", expected, buffer.String())
+	}
+}
+
+func TestComputeShrink(t *testing.T) {
+	// 2019-01-01 10:15 and 10:45 UTC, and 2019-01-01 14:00 UTC
+	tenAM := int64(1546337700000)
+	tenFortyFiveAM := int64(1546339500000)
+	twoPM := int64(1546351200000)
+
+	tags := []tag.Tag{
+		{Epc: "e1", ProductID: "A", FacilityID: "store001", EpcState: "departed", DepartureReason: "exit", DepartureLocation: "front-door", LastRead: tenAM},
+		{Epc: "e2", ProductID: "A", FacilityID: "store001", EpcState: "departed", DepartureReason: "exit", DepartureLocation: "front-door", LastRead: tenFortyFiveAM},
+		{Epc: "e3", ProductID: "A", FacilityID: "store001", EpcState: "departed", DepartureReason: "exit", DepartureLocation: "front-door", LastRead: twoPM},
+		{Epc: "e4", ProductID: "B", FacilityID: "store001", EpcState: "departed", DepartureReason: "exit", DepartureLocation: "back-door", LastRead: tenAM},
+		// read at 10:15 but departed at 14:00
+		{Epc: "e7", ProductID: "B", FacilityID: "store001", EpcState: "departed", DepartureReason: "exit", DepartureLocation: "back-door", LastRead: tenAM, DepartedAt: twoPM},
+		// sold
+		{Epc: "e5", ProductID: "A", FacilityID: "store001", EpcState: "departed", DepartureReason: "pos", DepartureLocation: "front-door", LastRead: tenAM},
+		// returned after departing
+		{Epc: "e6", ProductID: "A", FacilityID: "store001", EpcState: "present", LastRead: tenAM},
+		// departed at 10:15 UTC, 5:15 in New York
+		{Epc: "e8", ProductID: "A", FacilityID: "store002", EpcState: "departed", DepartureReason: "exit", DepartureLocation: "front-door", LastRead: tenAM},
+	}
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	locations := map[string]*time.Location{"store002": newYork}
+
+	expected := []ShrinkEntry{
+		{ProductID: "A", FacilityID: "store001", ExitAlias: "front-door", Hour: 10, Count: 2},
+		{ProductID: "B", FacilityID: "store001", ExitAlias: "back-door", Hour: 10, Count: 1},
+		{ProductID: "B", FacilityID: "store001", ExitAlias: "back-door", Hour: 14, Count: 1},
+		{ProductID: "A", FacilityID: "store001", ExitAlias: "front-door", Hour: 14, Count: 1},
+		{ProductID: "A", FacilityID: "store002", ExitAlias: "front-door", Hour: 5, Count: 1},
+	}
+
+	results := computeShrink(tags, locations)
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Expected %+v, received %+v", expected, results)
+	}
+}
+
+func TestWriteShrinkCSV(t *testing.T) {
+	report := ShrinkReport{
+		Results: []ShrinkEntry{
+			{ProductID: "A", FacilityID: "store001", ExitAlias: "front-door", Hour: 10, Count: 2},
+		},
+	}
+
+	var buffer bytes.Buffer
+	if err := WriteShrinkCSV(&buffer, report); err != nil {
+		t.Fatalf("Error writing csv %s", err.Error())
+	}
+
+	expected := "product_id,facility_id,exit_alias,hour,count\nA,store001,front-door,10,2\n"
+	if buffer.String() != expected {
+		t.Errorf("Expected %q, received %q", expected, buffer.String())
+	}
+}
@@ -0,0 +1,60 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package report
+
+// CycleCountReport is the cycle count accuracy report for a facility and time window
+//swagger:model CycleCountReport
+type CycleCountReport struct {
+	// Facility the report was run for
+	FacilityID string `json:"facility_id"`
+	// Millisecond epoch start time of the count
+	StartTime int64 `json:"starttime"`
+	// Millisecond epoch time the report was computed, which ends the count
+	EndTime int64 `json:"endtime"`
+	// Accuracy of the count per product
+	Results []CycleCountEntry `json:"results"`
+}
+
+// CycleCountEntry is the cycle count accuracy of a single product
+type CycleCountEntry struct {
+	// Product ID
+	ProductID string `json:"product_id"`
+	// Number of tags believed present when the count started
+	Expected int `json:"expected"`
+	// Number of tags read during the count
+	Counted int `json:"counted"`
+	// EPCs believed present that were not read during the count
+	Missing []string `json:"missing"`
+	// EPCs read during the count that were not believed present
+	Unexpected []string `json:"unexpected"`
+}
+
+// ShrinkReport aggregates tags that departed through an exit without being sold
+//swagger:model ShrinkReport
+type ShrinkReport struct {
+	// Facility the report was run for, empty for all facilities
+	FacilityID string `json:"facility_id,omitempty"`
+	// Millisecond epoch start time of the report window
+	StartTime int64 `json:"starttime"`
+	// Millisecond epoch end time of the report window
+	EndTime int64 `json:"endtime"`
+	// Departures per product, facility, exit and hour of day
+	Results []ShrinkEntry `json:"results"`
+}
+
+// ShrinkEntry is the number of exit departures of a product through a single exit
+// during one hour of the day
+type ShrinkEntry struct {
+	ProductID  string `json:"product_id"`
+	FacilityID string `json:"facility_id"`
+	// Alias of the sensor the tags departed through
+	ExitAlias string `json:"exit_alias"`
+	// Hour of the day (0-23) the tags departed, in the time zone of the facility or UTC
+	Hour int `json:"hour"`
+	// Number of tags that departed
+	Count int `json:"count"`
+}
@@ -0,0 +1,147 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"plugin"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/helper"
+	"github.com/pkg/errors"
+)
+
+const (
+	confidencePluginPath = "/plugin/inventory-probabilistic-algo"
+	millisPerMinute      = 60 * 1000
+	minutesPerDay        = 24 * 60
+	// minExponent bounds the exponents of the SQL confidence, as the database reports
+	// floating point underflows as errors instead of rounding them to 0
+	minExponent = -200
+)
+
+// ConfidenceModel calculates the probability that an item is actually present
+type ConfidenceModel interface {
+	// Name identifies the model, it is reported on the index endpoint
+	Name() string
+	// Confidence returns a probability between 0 and 1 based on the percent of inventory
+	// that is sold daily, the daily probabilities of an unreadable tag becoming readable,
+	// of an item in the store being read and of an exit error, and the last time the
+	// tag was read in milliseconds epoch
+	Confidence(dailyInvPerc, probUnreadToRead, probInStore, probExitError float64, lastRead int64) float64
+}
+
+// SQLConfidenceModel is a ConfidenceModel the database can evaluate, so aggregates over
+// many tags do not load every tag
+type SQLConfidenceModel interface {
+	ConfidenceModel
+	// ConfidenceSQL returns the SQL expression of Confidence as of the millisecond epoch
+	// time now, given the SQL expressions of its arguments
+	ConfidenceSQL(dailyInvPerc, probUnreadToRead, probInStore, probExitError, lastRead string, now int64) string
+}
+
+// DefaultConfidenceModel is the built-in confidence model, used unless the probabilistic
+// algorithm plugin is available.
+//
+// For a tag last read d days ago that has not been reported departed, it compares two
+// explanations of why it has not been read since:
+//
+//	present = (1 - dailyInvPerc)^d * (1 - probInStore)^min(d,1) * (1 - probUnreadToRead)^max(d-1,0)
+//	gone    = (1 - (1 - dailyInvPerc)^d) * probExitError
+//
+// The first is the item staying in the store while going unread: it is missed on the
+// first day with probability 1 - probInStore, and after that only becomes readable
+// again with probability probUnreadToRead per day. The second is the item leaving the
+// store without its departure being detected. The confidence is present / (present + gone),
+// and is 0 when neither explanation is possible. d has a resolution of one minute.
+type DefaultConfidenceModel struct{}
+
+// Name identifies the model
+func (DefaultConfidenceModel) Name() string {
+	return "default"
+}
+
+// Confidence calculates the probability that an item is actually present
+func (DefaultConfidenceModel) Confidence(dailyInvPerc, probUnreadToRead, probInStore, probExitError float64, lastRead int64) float64 {
+	elapsed := helper.UnixMilliNow() - lastRead
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	days := float64(elapsed/millisPerMinute) / minutesPerDay
+
+	stayed := math.Pow(1-dailyInvPerc, days)
+	unread := math.Pow(1-probInStore, math.Min(days, 1)) * math.Pow(1-probUnreadToRead, math.Max(days-1, 0))
+
+	present := stayed * unread
+	gone := (1 - stayed) * probExitError
+	if present+gone <= 0 {
+		return 0.0
+	}
+
+	return math.Max(0, math.Min(1, present/(present+gone)))
+}
+
+// ConfidenceSQL returns the SQL expression of Confidence
+func (DefaultConfidenceModel) ConfidenceSQL(dailyInvPerc, probUnreadToRead, probInStore, probExitError, lastRead string, now int64) string {
+	days := fmt.Sprintf(`(GREATEST(%d - (%s), 0) / %d)::float8 / %d`, now, lastRead, millisPerMinute, minutesPerDay)
+
+	stayed := powSQL(`1 - (`+dailyInvPerc+`)`, days)
+	unread := powSQL(`1 - (`+probInStore+`)`, `LEAST(`+days+`, 1)`) + ` * ` +
+		powSQL(`1 - (`+probUnreadToRead+`)`, `GREATEST(`+days+` - 1, 0)`)
+
+	present := `(` + stayed + ` * ` + unread + `)`
+	gone := `((1 - ` + stayed + `) * (` + probExitError + `))`
+	return fmt.Sprintf(`CASE WHEN %[1]s + %[2]s <= 0 THEN 0 ELSE GREATEST(0, LEAST(1, %[1]s / (%[1]s + %[2]s))) END`,
+		present, gone)
+}
+
+// powSQL returns the SQL expression of base raised to exponent, for a base between 0 and 1
+func powSQL(base string, exponent string) string {
+	return fmt.Sprintf(`(CASE WHEN (%[1]s) <= 0 THEN CASE WHEN (%[2]s) = 0 THEN 1 ELSE 0 END
+		ELSE exp(GREATEST((%[2]s) * ln(%[1]s), %[3]d)) END)`, base, exponent, minExponent)
+}
+
+// pluginConfidenceModel calculates the confidence with the probabilistic algorithm plugin
+type pluginConfidenceModel struct {
+	calculate func(float64, float64, float64, float64, int64) float64
+}
+
+func (pluginConfidenceModel) Name() string {
+	return "plugin"
+}
+
+func (model pluginConfidenceModel) Confidence(dailyInvPerc, probUnreadToRead, probInStore, probExitError float64, lastRead int64) float64 {
+	return model.calculate(dailyInvPerc, probUnreadToRead, probInStore, probExitError, lastRead)
+}
+
+var confidenceModel ConfidenceModel = DefaultConfidenceModel{}
+
+// SetConfidenceModel replaces the model used to calculate the confidence of tags
+func SetConfidenceModel(model ConfidenceModel) {
+	confidenceModel = model
+}
+
+// ActiveConfidenceModel returns the name of the model used to calculate the confidence of tags
+func ActiveConfidenceModel() string {
+	return confidenceModel.Name()
+}
+
+func loadConfidencePlugin() error {
+	confidencePlugin, err := plugin.Open(confidencePluginPath)
+	if err != nil {
+		return errors.New("Intel Probabilistic Algorithm plugin not found; using the default confidence model.")
+	}
+	calculateConfidence, err := confidencePlugin.Lookup("CalculateConfidence")
+	if err != nil {
+		return errors.New("Unable to find CalculateConfidence function in plugin")
+	}
+	// panics if this plugin & function exists but signature doesn't match
+	SetConfidenceModel(pluginConfidenceModel{
+		calculate: calculateConfidence.(func(float64, float64, float64, float64, int64) float64),
+	})
+	return nil
+}
@@ -0,0 +1,81 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/helper"
+)
+
+func TestDefaultConfidenceModel(t *testing.T) {
+	model := DefaultConfidenceModel{}
+	if model.Name() != "default" {
+		t.Errorf("Expected model name default, received %s", model.Name())
+	}
+	// aggregates are computed by the database with the default model
+	if _, ok := interface{}(model).(SQLConfidenceModel); !ok {
+		t.Error("Expected the default model to be evaluated by the database")
+	}
+
+	dailyInvPerc, probUnreadToRead, probInStore, probExitError := 0.01, 0.1, 0.75, 0.1
+
+	justRead := model.Confidence(dailyInvPerc, probUnreadToRead, probInStore, probExitError, helper.UnixMilliNow())
+	if justRead != 1 {
+		t.Errorf("Expected confidence 1 for a tag that was just read, received %f", justRead)
+	}
+
+	previous := justRead
+	for _, days := range []int{1, 2, 5, 10, 30} {
+		lastRead := helper.UnixMilli(time.Now().AddDate(0, 0, -days))
+		confidence := model.Confidence(dailyInvPerc, probUnreadToRead, probInStore, probExitError, lastRead)
+		if confidence < 0 || confidence > 1 {
+			t.Errorf("Confidence must be 0-1, received %f after %d days", confidence, days)
+		}
+		if confidence >= previous {
+			t.Errorf("Expected confidence to decrease over time, received %f after %d days", confidence, days)
+		}
+		previous = confidence
+	}
+
+	// Without exit errors every departure is detected, so a tag that is not departed is present
+	lastRead := helper.UnixMilli(time.Now().AddDate(0, 0, -10))
+	if confidence := model.Confidence(dailyInvPerc, probUnreadToRead, probInStore, 0, lastRead); confidence != 1 {
+		t.Errorf("Expected confidence 1 without exit errors, received %f", confidence)
+	}
+
+	// A tag that is always read when present must have left if it was not read
+	if confidence := model.Confidence(dailyInvPerc, probUnreadToRead, 1, probExitError, lastRead); confidence != 0 {
+		t.Errorf("Expected confidence 0 when tags are always read, received %f", confidence)
+	}
+
+	// Neither explanation is possible
+	if confidence := model.Confidence(dailyInvPerc, probUnreadToRead, 1, 0, lastRead); confidence != 0 {
+		t.Errorf("Expected confidence 0, received %f", confidence)
+	}
+}
+
+type fixedConfidenceModel float64
+
+func (fixedConfidenceModel) Name() string {
+	return "fixed"
+}
+
+func (model fixedConfidenceModel) Confidence(_, _, _, _ float64, _ int64) float64 {
+	return float64(model)
+}
+
+func TestSetConfidenceModel(t *testing.T) {
+	previous := confidenceModel
+	defer SetConfidenceModel(previous)
+
+	SetConfidenceModel(fixedConfidenceModel(0.5))
+	if ActiveConfidenceModel() != "fixed" {
+		t.Errorf("Expected active model fixed, received %s", ActiveConfidenceModel())
+	}
+}
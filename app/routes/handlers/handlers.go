@@ -7,38 +7,154 @@
 package handlers
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 	"github.com/intel/rsp-sw-toolkit-im-suite-go-odata/parser"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/alert"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/dailyturn"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/epccontext"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/eventstream"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/export"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/facility"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/handheldevent"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/health"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/report"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/routes/schemas"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/sensor"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/shippingnotice"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/snapshot"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/stocklevel"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/tag"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/webhook"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/jsonrpc"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/middlewares"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/prometheus"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/web"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/productdata"
 	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/helper"
+	"github.com/pborman/uuid"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"io"
 	"net/http"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 )
 
 // Inventory represents the User API method handler set.
 type Inventory struct {
-	MasterDB *sql.DB
-	MaxSize  int
-	Url      string
+	MasterDB  *sql.DB
+	MaxSize   int
+	Url       string
+	Processor DataProcessor
+	Pipeline  PipelineMonitor
+	// MetricsExporter writes the metrics for the Prometheus endpoint, nil when it is disabled
+	MetricsExporter *prometheus.Exporter
+	// AccessTokens issues the access tokens of the event stream, nil when authentication is disabled
+	AccessTokens *middlewares.AccessTokens
+}
+
+// DataProcessor feeds data received through the REST API into the same
+// processing pipeline used for data received from EdgeX
+type DataProcessor interface {
+	// ProcessTagData runs tag events from the given source ("fixed" or "handheld")
+	// through the tag state model and publishes the resulting events
+	ProcessTagData(invEvent *jsonrpc.InventoryEvent, source string) error
+}
+
+// PipelineMonitor reports the state of the EdgeX pipeline for the readiness endpoint
+type PipelineMonitor interface {
+	PipelineStatus() health.Pipeline
+}
+
+// IndexResponse is the response of the index endpoint
+type IndexResponse struct {
+	// Name of the service
+	Service string `json:"service"`
+	// Name of the model used to calculate the confidence of tags
+	ConfidenceModel string `json:"confidence_model"`
 }
 
 // Index is used for Docker Healthcheck commands to indicate
-// whether the http server is up and running to take requests
+// whether the http server is up and running to take requests. It also
+// reports which confidence model is active
 //nolint:unparam
 func (inve *Inventory) Index(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
-	web.Respond(ctx, writer, "Inventory Service", http.StatusOK)
+	web.Respond(ctx, writer, IndexResponse{
+		Service:         "Inventory Service",
+		ConfidenceModel: ActiveConfidenceModel(),
+	}, http.StatusOK)
+	return nil
+}
+
+// GetLiveness reports the http server is up and running to take requests, regardless
+// of the state of its dependencies
+// 200 OK
+func (inve *Inventory) GetLiveness(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+	web.Respond(ctx, writer, health.Report{Status: health.StatusUp, Checks: []health.Check{}}, http.StatusOK)
+	return nil
+}
+
+// GetReadiness reports the state of the database, the EdgeX pipeline and the configured
+// services. The service is not ready when the database, the pipeline or a required service
+// is down.
+// 200 OK, 503 Service Unavailable
+func (inve *Inventory) GetReadiness(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.GetReadiness.Attempt", nil).Update(1)
+	mReady := metrics.GetOrRegisterGauge("Inventory.GetReadiness.Ready", nil)
+	mNotReady := metrics.GetOrRegisterGauge("Inventory.GetReadiness.NotReady", nil)
+
+	timeout := time.Duration(config.AppConfig.HealthCheckTimeoutMillis) * time.Millisecond
+
+	checks := []health.Check{health.PingDatabase(inve.MasterDB, timeout)}
+	checks = append(checks, health.CheckServices(healthServices(), timeout)...)
+
+	var pipeline *health.Pipeline
+	if inve.Pipeline != nil {
+		status := inve.Pipeline.PipelineStatus()
+		pipeline = &status
+	}
+
+	report := health.NewReport(checks, pipeline)
+	if report.Status != health.StatusUp {
+		mNotReady.Update(1)
+		web.Respond(ctx, writer, report, http.StatusServiceUnavailable)
+		return nil
+	}
+
+	mReady.Update(1)
+	web.Respond(ctx, writer, report, http.StatusOK)
+	return nil
+}
+
+// GetMetrics writes the metrics of the service in the Prometheus text exposition format
+// 200 OK, 404 Not Found
+func (inve *Inventory) GetMetrics(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+	if inve.MetricsExporter == nil {
+		return web.ErrNotFound
+	}
+
+	var buffer bytes.Buffer
+	if err := inve.MetricsExporter.Write(&buffer); err != nil {
+		return errors.Wrap(err, "error writing metrics")
+	}
+
+	writer.Header().Set("Content-Type", prometheus.ContentType)
+	writer.WriteHeader(http.StatusOK)
+	// the status is sent, so a scraper that went away is not reported
+	_, _ = buffer.WriteTo(writer)
 	return nil
 }
 
@@ -79,7 +195,7 @@ func (inve *Inventory) GetTags(ctx context.Context, writer http.ResponseWriter,
 		isConfidence = true
 	}
 
-	tags, count, err := tag.Retrieve(inve.MasterDB, url, inve.MaxSize)
+	tags, count, paging, err := tag.Retrieve(inve.MasterDB, url, inve.MaxSize)
 	if err != nil {
 		mRetrieveErr.Update(1)
 		return errors.Wrap(err, "Error retrieving Tag")
@@ -135,7 +251,7 @@ func (inve *Inventory) GetTags(ctx context.Context, writer http.ResponseWriter,
 
 	if count != nil && resultSlice != nil {
 		mSuccess.Update(1)
-		web.Respond(ctx, writer, tag.Response{Results: resultSlice, Count: count.Count}, http.StatusOK)
+		web.Respond(ctx, writer, tag.Response{Results: resultSlice, Count: count.Count, PagingType: paging}, http.StatusOK)
 		return nil
 	}
 
@@ -147,7 +263,7 @@ func (inve *Inventory) GetTags(ctx context.Context, writer http.ResponseWriter,
 	}
 
 	mSuccess.Update(1)
-	web.Respond(ctx, writer, tag.Response{Results: resultSlice}, http.StatusOK)
+	web.Respond(ctx, writer, tag.Response{Results: resultSlice, PagingType: paging}, http.StatusOK)
 	return nil
 }
 
@@ -225,6 +341,72 @@ func (inve *Inventory) SetEpcContext(ctx context.Context, writer http.ResponseWr
 	return nil
 }
 
+// BulkUpdateQualifiedState sets the qualified state of the tags of a facility listed by EPC
+// or matching a filter, in one transaction
+// 200 OK, 400 Bad Request, 500 Internal
+func (inve *Inventory) BulkUpdateQualifiedState(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.BulkUpdateQualifiedState.Attempt", nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.BulkUpdateQualifiedState.Success", nil)
+	mValidationErr := metrics.GetOrRegisterGauge("Inventory.BulkUpdateQualifiedState.Validation-Error", nil)
+	mUpdateErr := metrics.GetOrRegisterGauge("Inventory.BulkUpdateQualifiedState.Update-Error", nil)
+
+	var body tag.BulkUpdateBody
+
+	validationErrors, err := readAndValidateRequest(request, schemas.BulkUpdateQualifiedStateSchema, &body)
+	if err != nil {
+		mValidationErr.Update(1)
+		return err
+	}
+	if validationErrors != nil {
+		mValidationErr.Update(1)
+		web.Respond(ctx, writer, validationErrors, http.StatusBadRequest)
+		return nil
+	}
+
+	if err := processBulkUpdateRequest(ctx, inve.MasterDB, writer, &body, "qualified_state", body.QualifiedState); err != nil {
+		mUpdateErr.Update(1)
+		return err
+	}
+
+	mSuccess.Update(1)
+	return nil
+}
+
+// BulkSetEpcContext sets, or clears when empty, the epc context of the tags of a facility
+// listed by EPC or matching a filter, in one transaction
+// 200 OK, 400 Bad Request, 500 Internal
+func (inve *Inventory) BulkSetEpcContext(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.BulkSetEpcContext.Attempt", nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.BulkSetEpcContext.Success", nil)
+	mValidationErr := metrics.GetOrRegisterGauge("Inventory.BulkSetEpcContext.Validation-Error", nil)
+	mUpdateErr := metrics.GetOrRegisterGauge("Inventory.BulkSetEpcContext.Update-Error", nil)
+
+	var body tag.BulkUpdateBody
+
+	validationErrors, err := readAndValidateRequest(request, schemas.BulkSetEpcContextSchema, &body)
+	if err != nil {
+		mValidationErr.Update(1)
+		return err
+	}
+	if validationErrors != nil {
+		mValidationErr.Update(1)
+		web.Respond(ctx, writer, validationErrors, http.StatusBadRequest)
+		return nil
+	}
+
+	if err := processBulkUpdateRequest(ctx, inve.MasterDB, writer, &body, "epc_context", body.EpcContext); err != nil {
+		mUpdateErr.Update(1)
+		return err
+	}
+
+	mSuccess.Update(1)
+	return nil
+}
+
 // DeleteEpcContext removes the tag's epc context value
 // 200 OK, 400 Bad Request, 500 Internal
 func (inve *Inventory) DeleteEpcContext(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
@@ -316,6 +498,39 @@ func (inve *Inventory) GetSearchByEpc(ctx context.Context, writer http.ResponseW
 	return processGetRequest(ctx, schemas.SearchByEpcSchema, inve.MasterDB, request, writer, inve.Url)
 }
 
+// PostDecode decodes a list of EPCs with the configured tag decoders and returns,
+// per EPC, the decoder that matched and what it decoded, or why none did
+// 200 OK, 400 Bad Request, 500 Internal
+func (inve *Inventory) PostDecode(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.PostDecode.Attempt", nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.PostDecode.Success", nil)
+	mValidationErr := metrics.GetOrRegisterGauge("Inventory.PostDecode.Validation-Error", nil)
+
+	var requestBody tag.DecodeBody
+
+	validationErrors, err := readAndValidateRequest(request, schemas.DecodeSchema, &requestBody)
+	if err != nil {
+		mValidationErr.Update(1)
+		return err
+	}
+	if validationErrors != nil {
+		mValidationErr.Update(1)
+		web.Respond(ctx, writer, validationErrors, http.StatusBadRequest)
+		return nil
+	}
+
+	results := make([]tag.DecodeResult, len(requestBody.Epcs))
+	for i, epc := range requestBody.Epcs {
+		results[i] = tag.Decode(epc)
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, tag.Response{Results: results}, http.StatusOK)
+	return nil
+}
+
 // GetFacilities retrieves all Facilities from the database
 // 200 OK, 400 Bad Request, 500 Internal
 //nolint:dupl
@@ -363,6 +578,214 @@ func (inve *Inventory) GetFacilities(ctx context.Context, writer http.ResponseWr
 	return nil
 }
 
+// GetFacility returns a facility along with the number of sensors and tags referring to it
+// 200 OK, 404 Not Found, 500 Internal
+func (inve *Inventory) GetFacility(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.GetFacility.Attempt", nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.GetFacility.Success", nil)
+	mRetrieveErr := metrics.GetOrRegisterGauge("Inventory.GetFacility.Retrieve-Error", nil)
+
+	details, err := facility.FindDetails(inve.MasterDB, mux.Vars(request)["facilityId"])
+	if err != nil {
+		mRetrieveErr.Update(1)
+		return errors.Wrap(err, "error retrieving facility")
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, details, http.StatusOK)
+	return nil
+}
+
+// PostFacility creates a facility. Coefficients default to the configured coefficients.
+// 201 StatusCreated, 400 Bad Request, 409 Conflict, 500 Internal
+func (inve *Inventory) PostFacility(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.PostFacility.Attempt", nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.PostFacility.Success", nil)
+	mValidationErr := metrics.GetOrRegisterGauge("Inventory.PostFacility.Validation-Error", nil)
+	mInsertErr := metrics.GetOrRegisterGauge("Inventory.PostFacility.Insert-Error", nil)
+
+	newFacility := facility.Facility{Coefficients: defaultCoefficients()}
+
+	validationErrors, err := readAndValidateRequest(request, schemas.CreateFacilitySchema, &newFacility)
+	if err != nil {
+		mValidationErr.Update(1)
+		return err
+	}
+	if validationErrors != nil {
+		mValidationErr.Update(1)
+		web.Respond(ctx, writer, validationErrors, http.StatusBadRequest)
+		return nil
+	}
+	if newFacility.TimeZone != "" {
+		if err := validateTimeZone(newFacility.TimeZone); err != nil {
+			mValidationErr.Update(1)
+			return err
+		}
+	}
+
+	if err := facility.Create(inve.MasterDB, newFacility); err != nil {
+		mInsertErr.Update(1)
+		return errors.Wrap(err, "error creating facility")
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, newFacility, http.StatusCreated)
+	return nil
+}
+
+// PutFacility updates the display name, time zone, address or coefficients of a facility.
+// Fields left out of the request body are not changed.
+// 200 OK, 400 Bad Request, 404 Not Found, 500 Internal
+func (inve *Inventory) PutFacility(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.PutFacility.Attempt", nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.PutFacility.Success", nil)
+	mValidationErr := metrics.GetOrRegisterGauge("Inventory.PutFacility.Validation-Error", nil)
+	mUpdateErr := metrics.GetOrRegisterGauge("Inventory.PutFacility.Update-Error", nil)
+
+	var changes facility.UpdateBody
+
+	validationErrors, err := readAndValidateRequest(request, schemas.UpdateFacilitySchema, &changes)
+	if err != nil {
+		mValidationErr.Update(1)
+		return err
+	}
+	if validationErrors != nil {
+		mValidationErr.Update(1)
+		web.Respond(ctx, writer, validationErrors, http.StatusBadRequest)
+		return nil
+	}
+	if changes.TimeZone != nil {
+		if err := validateTimeZone(*changes.TimeZone); err != nil {
+			mValidationErr.Update(1)
+			return err
+		}
+	}
+
+	updated, err := facility.Update(inve.MasterDB, mux.Vars(request)["facilityId"], changes)
+	if err != nil {
+		mUpdateErr.Update(1)
+		return errors.Wrap(err, "error updating facility")
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, updated, http.StatusOK)
+	return nil
+}
+
+// DeleteFacility deletes a facility and its records. A facility that sensors or tags refer
+// to is only deleted with cascade=true, which deletes its tags and moves its sensors to the
+// default facility.
+// 204 StatusNoContent, 400 Bad Request, 404 Not Found, 409 Conflict, 500 Internal
+func (inve *Inventory) DeleteFacility(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.DeleteFacility.Attempt", nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.DeleteFacility.Success", nil)
+	mInputErr := metrics.GetOrRegisterGauge("Inventory.DeleteFacility.Input-Error", nil)
+	mDeleteErr := metrics.GetOrRegisterGauge("Inventory.DeleteFacility.Delete-Error", nil)
+
+	cascade := false
+	if value := request.URL.Query().Get("cascade"); value != "" {
+		var err error
+		if cascade, err = strconv.ParseBool(value); err != nil {
+			mInputErr.Update(1)
+			return errors.Wrap(web.ErrInvalidInput, "cascade must be true or false")
+		}
+	}
+
+	if _, err := facility.Remove(inve.MasterDB, mux.Vars(request)["facilityId"], cascade); err != nil {
+		mDeleteErr.Update(1)
+		return errors.Wrap(err, "error deleting facility")
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, nil, http.StatusNoContent)
+	return nil
+}
+
+// GetSensors returns all sensors along with their inventory_data statistics
+// 200 OK, 500 Internal
+func (inve *Inventory) GetSensors(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.GetSensors.Attempt", nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.GetSensors.Success", nil)
+	mRetrieveErr := metrics.GetOrRegisterGauge("Inventory.GetSensors.Retrieve-Error", nil)
+
+	sensors, err := sensor.FindAllStatus(inve.MasterDB)
+	if err != nil {
+		mRetrieveErr.Update(1)
+		return errors.Wrap(err, "error retrieving sensors")
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, sensor.Response{Results: sensors}, http.StatusOK)
+	return nil
+}
+
+// GetSensor returns a sensor along with its inventory_data statistics
+// 200 OK, 404 Not Found, 500 Internal
+func (inve *Inventory) GetSensor(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.GetSensor.Attempt", nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.GetSensor.Success", nil)
+	mRetrieveErr := metrics.GetOrRegisterGauge("Inventory.GetSensor.Retrieve-Error", nil)
+
+	status, err := sensor.FindStatus(inve.MasterDB, mux.Vars(request)["deviceId"])
+	if err != nil {
+		mRetrieveErr.Update(1)
+		return errors.Wrap(err, "error retrieving sensor")
+	}
+	if status == nil {
+		return web.ErrNotFound
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, status, http.StatusOK)
+	return nil
+}
+
+// RefreshSensor retrieves the facility, personality and aliases of a sensor from the
+// RSP Controller and returns the updated sensor
+// 200 OK, 502 Bad Gateway, 500 Internal
+func (inve *Inventory) RefreshSensor(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.RefreshSensor.Attempt", nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.RefreshSensor.Success", nil)
+	mRefreshErr := metrics.GetOrRegisterGauge("Inventory.RefreshSensor.Refresh-Error", nil)
+	mRetrieveErr := metrics.GetOrRegisterGauge("Inventory.RefreshSensor.Retrieve-Error", nil)
+
+	deviceID := mux.Vars(request)["deviceId"]
+
+	// Unknown sensors are not found, and RSP Controller failures are bad gateways
+	if _, err := sensor.RefreshBasicInfo(inve.MasterDB, deviceID); err != nil {
+		mRefreshErr.Update(1)
+		return errors.Wrap(err, "error refreshing sensor")
+	}
+
+	status, err := sensor.FindStatus(inve.MasterDB, deviceID)
+	if err != nil {
+		mRetrieveErr.Update(1)
+		return errors.Wrap(err, "error retrieving sensor")
+	}
+	if status == nil {
+		mRetrieveErr.Update(1)
+		return errors.Errorf("sensor %s was not stored after refreshing it", deviceID)
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, status, http.StatusOK)
+	return nil
+}
+
 // GetHandheldEvents retrieves all Handheld events from the database
 // 200 OK, 400 Bad Request, 500 Internal
 //nolint:dupl
@@ -462,3 +885,1259 @@ func (inve *Inventory) UpdateCoefficients(ctx context.Context, writer http.Respo
 	web.Respond(ctx, writer, nil, http.StatusOK)
 	return nil
 }
+
+// PostHandheldReads ingests a batch of handheld reads through the tag state model
+// and returns the result of processing each EPC
+// 200 OK, 400 Bad Request, 500 Internal
+func (inve *Inventory) PostHandheldReads(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.PostHandheldReads.Attempt", nil).Update(1)
+
+	startTime := time.Now()
+	mLatency := metrics.GetOrRegisterTimer("Inventory.PostHandheldReads.Latency", nil)
+	defer func() { mLatency.Update(time.Since(startTime)) }()
+	mProcessLatency := metrics.GetOrRegisterTimer("Inventory.PostHandheldReads.Process-Latency", nil)
+
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.PostHandheldReads.Success", nil)
+	mValidationErr := metrics.GetOrRegisterGauge("Inventory.PostHandheldReads.Validation-Error", nil)
+	mProcessErr := metrics.GetOrRegisterGauge("Inventory.PostHandheldReads.Process-Error", nil)
+	mFindErr := metrics.GetOrRegisterGauge("Inventory.PostHandheldReads.Find-Error", nil)
+
+	var requestBody tag.HandheldReadsBody
+
+	validationErrors, err := readAndValidateRequest(request, schemas.HandheldReadsSchema, &requestBody)
+	if err != nil {
+		mValidationErr.Update(1)
+		return err
+	}
+	if validationErrors != nil {
+		mValidationErr.Update(1)
+		web.Respond(ctx, writer, validationErrors, http.StatusBadRequest)
+		return nil
+	}
+
+	if inve.Processor == nil {
+		return errors.New("handheld reads processor is not configured")
+	}
+
+	invEvent, results := buildHandheldEvent(&requestBody)
+
+	processTimer := time.Now()
+	if err := inve.Processor.ProcessTagData(invEvent, handheldSource); err != nil {
+		mProcessErr.Update(1)
+		return errors.Wrap(err, "error processing handheld reads")
+	}
+	mProcessLatency.Update(time.Since(processTimer))
+
+	// Report the state of each processed tag as it is now stored in the database
+	for i := range results {
+		if results[i].Status != handheldReadProcessed {
+			continue
+		}
+		tagFromDB, err := tag.FindByEpc(inve.MasterDB, results[i].Epc)
+		if err != nil {
+			mFindErr.Update(1)
+			return errors.Wrap(err, "error retrieving processed tag")
+		}
+		results[i].ProductID = tagFromDB.ProductID
+		results[i].Event = tagFromDB.Event
+		results[i].EpcState = tagFromDB.EpcState
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, tag.Response{Results: results}, http.StatusOK)
+	return nil
+}
+
+// StartHandheldSession starts a handheld full scan session for a facility or zone
+func (inve *Inventory) StartHandheldSession(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.StartHandheldSession.Attempt", nil).Update(1)
+
+	startTime := time.Now()
+	mLatency := metrics.GetOrRegisterTimer("Inventory.StartHandheldSession.Latency", nil)
+	defer func() { mLatency.Update(time.Since(startTime)) }()
+
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.StartHandheldSession.Success", nil)
+	mValidationErr := metrics.GetOrRegisterGauge("Inventory.StartHandheldSession.Validation-Error", nil)
+	mInsertErr := metrics.GetOrRegisterGauge("Inventory.StartHandheldSession.Insert-Error", nil)
+
+	var requestBody handheldevent.SessionStartBody
+
+	validationErrors, err := readAndValidateRequest(request, schemas.HandheldSessionStartSchema, &requestBody)
+	if err != nil {
+		mValidationErr.Update(1)
+		return err
+	}
+	if validationErrors != nil {
+		mValidationErr.Update(1)
+		web.Respond(ctx, writer, validationErrors, http.StatusBadRequest)
+		return nil
+	}
+
+	session := handheldevent.HandheldEvent{
+		Event:      handheldevent.FullScanStart,
+		Timestamp:  requestBody.Timestamp,
+		SessionID:  uuid.New(),
+		FacilityID: requestBody.FacilityID,
+		Zone:       requestBody.Zone,
+	}
+	if session.Timestamp == 0 {
+		session.Timestamp = helper.UnixMilliNow()
+	}
+
+	if err := handheldevent.Insert(inve.MasterDB, session); err != nil {
+		mInsertErr.Update(1)
+		return errors.Wrap(err, "error starting handheld session")
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, session, http.StatusOK)
+	return nil
+}
+
+// CompleteHandheldSession completes a handheld full scan session and reconciles the
+// tags believed present in the scanned facility or zone against the tags read since
+// the session started
+func (inve *Inventory) CompleteHandheldSession(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.CompleteHandheldSession.Attempt", nil).Update(1)
+
+	startTime := time.Now()
+	mLatency := metrics.GetOrRegisterTimer("Inventory.CompleteHandheldSession.Latency", nil)
+	defer func() { mLatency.Update(time.Since(startTime)) }()
+
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.CompleteHandheldSession.Success", nil)
+	mValidationErr := metrics.GetOrRegisterGauge("Inventory.CompleteHandheldSession.Validation-Error", nil)
+	mFindErr := metrics.GetOrRegisterGauge("Inventory.CompleteHandheldSession.Find-Error", nil)
+	mReconcileErr := metrics.GetOrRegisterGauge("Inventory.CompleteHandheldSession.Reconcile-Error", nil)
+	mInsertErr := metrics.GetOrRegisterGauge("Inventory.CompleteHandheldSession.Insert-Error", nil)
+
+	var requestBody handheldevent.SessionCompleteBody
+
+	validationErrors, err := readAndValidateRequest(request, schemas.HandheldSessionCompleteSchema, &requestBody)
+	if err != nil {
+		mValidationErr.Update(1)
+		return err
+	}
+	if validationErrors != nil {
+		mValidationErr.Update(1)
+		web.Respond(ctx, writer, validationErrors, http.StatusBadRequest)
+		return nil
+	}
+
+	events, err := handheldevent.FindBySession(inve.MasterDB, requestBody.SessionID)
+	if err != nil {
+		mFindErr.Update(1)
+		return errors.Wrap(err, "error retrieving handheld session")
+	}
+
+	var session *handheldevent.HandheldEvent
+	for i := range events {
+		switch events[i].Event {
+		case handheldevent.FullScanStart:
+			session = &events[i]
+		case handheldevent.FullScanComplete:
+			mValidationErr.Update(1)
+			return errors.Wrapf(web.ErrConflict, "handheld session %s is already complete", requestBody.SessionID)
+		}
+	}
+	if session == nil {
+		return errors.Wrapf(web.ErrNotFound, "handheld session %s not found", requestBody.SessionID)
+	}
+
+	missing, err := tag.MarkMissingCandidates(inve.MasterDB, session.FacilityID, session.Zone, session.Timestamp)
+	if err != nil {
+		mReconcileErr.Update(1)
+		return errors.Wrap(err, "error reconciling handheld session")
+	}
+
+	completed := handheldevent.HandheldEvent{
+		Event:      handheldevent.FullScanComplete,
+		Timestamp:  helper.UnixMilliNow(),
+		SessionID:  session.SessionID,
+		FacilityID: session.FacilityID,
+		Zone:       session.Zone,
+	}
+	if err := handheldevent.Insert(inve.MasterDB, completed); err != nil {
+		mInsertErr.Update(1)
+		return errors.Wrap(err, "error completing handheld session")
+	}
+
+	report := handheldevent.ReconciliationReport{
+		SessionID:    session.SessionID,
+		FacilityID:   session.FacilityID,
+		Zone:         session.Zone,
+		Started:      session.Timestamp,
+		Completed:    completed.Timestamp,
+		MissingCount: len(missing),
+		Missing:      missing,
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, report, http.StatusOK)
+	return nil
+}
+
+// GetCycleCountReport returns the cycle count accuracy report of a facility per product,
+// as JSON or as CSV when format=csv
+func (inve *Inventory) GetCycleCountReport(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.GetCycleCountReport.Attempt", nil).Update(1)
+
+	startTime := time.Now()
+	mLatency := metrics.GetOrRegisterTimer("Inventory.GetCycleCountReport.Latency", nil)
+	defer func() { mLatency.Update(time.Since(startTime)) }()
+
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.GetCycleCountReport.Success", nil)
+	mInputErr := metrics.GetOrRegisterGauge("Inventory.GetCycleCountReport.Input-Error", nil)
+	mRetrieveErr := metrics.GetOrRegisterGauge("Inventory.GetCycleCountReport.Retrieve-Error", nil)
+
+	query := request.URL.Query()
+
+	facilityID := query.Get("facility_id")
+	if facilityID == "" {
+		mInputErr.Update(1)
+		return errors.Wrap(web.ErrInvalidInput, "facility_id is required")
+	}
+
+	start, err := strconv.ParseInt(query.Get("starttime"), 10, 64)
+	if err != nil || start < 0 {
+		mInputErr.Update(1)
+		return errors.Wrap(web.ErrInvalidInput, "starttime must be a millisecond epoch time")
+	}
+
+	// Only the last read of each tag is stored, so a count can only be reported up to now
+	end := helper.UnixMilliNow()
+	if start > end {
+		mInputErr.Update(1)
+		return errors.Wrap(web.ErrInvalidInput, "starttime cannot be in the future")
+	}
+
+	format := query.Get("format")
+	if format != "" && format != reportFormatJSON && format != reportFormatCSV {
+		mInputErr.Update(1)
+		return errors.Wrapf(web.ErrInvalidInput, "unsupported format %s", format)
+	}
+
+	cycleCountReport, err := report.CycleCount(inve.MasterDB, facilityID, start, end)
+	if err != nil {
+		mRetrieveErr.Update(1)
+		return errors.Wrap(err, "error retrieving cycle count report")
+	}
+
+	mSuccess.Update(1)
+	if format == reportFormatCSV {
+		writer.Header().Set("Content-Type", "text/csv")
+		writer.Header().Set("Content-Disposition", "attachment; filename=cyclecount.csv")
+		writer.WriteHeader(http.StatusOK)
+		return report.WriteCycleCountCSV(writer, cycleCountReport)
+	}
+
+	web.Respond(ctx, writer, cycleCountReport, http.StatusOK)
+	return nil
+}
+
+// GetShrinkReport returns exit departures without a sale per product, facility, exit and
+// hour of day, as JSON or as CSV when format=csv
+func (inve *Inventory) GetShrinkReport(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.GetShrinkReport.Attempt", nil).Update(1)
+
+	startTime := time.Now()
+	mLatency := metrics.GetOrRegisterTimer("Inventory.GetShrinkReport.Latency", nil)
+	defer func() { mLatency.Update(time.Since(startTime)) }()
+
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.GetShrinkReport.Success", nil)
+	mInputErr := metrics.GetOrRegisterGauge("Inventory.GetShrinkReport.Input-Error", nil)
+	mRetrieveErr := metrics.GetOrRegisterGauge("Inventory.GetShrinkReport.Retrieve-Error", nil)
+
+	query := request.URL.Query()
+
+	start, err := strconv.ParseInt(query.Get("starttime"), 10, 64)
+	if err != nil || start < 0 {
+		mInputErr.Update(1)
+		return errors.Wrap(web.ErrInvalidInput, "starttime must be a millisecond epoch time")
+	}
+
+	end := helper.UnixMilliNow()
+	if query.Get("endtime") != "" {
+		end, err = strconv.ParseInt(query.Get("endtime"), 10, 64)
+		if err != nil || end < start {
+			mInputErr.Update(1)
+			return errors.Wrap(web.ErrInvalidInput, "endtime must be a millisecond epoch time after starttime")
+		}
+	}
+
+	format := query.Get("format")
+	if format != "" && format != reportFormatJSON && format != reportFormatCSV {
+		mInputErr.Update(1)
+		return errors.Wrapf(web.ErrInvalidInput, "unsupported format %s", format)
+	}
+
+	shrinkReport, err := report.Shrink(inve.MasterDB, query.Get("facility_id"), start, end)
+	if err != nil {
+		mRetrieveErr.Update(1)
+		return errors.Wrap(err, "error retrieving shrink report")
+	}
+
+	mSuccess.Update(1)
+	if format == reportFormatCSV {
+		writer.Header().Set("Content-Type", "text/csv")
+		writer.Header().Set("Content-Disposition", "attachment; filename=shrink.csv")
+		writer.WriteHeader(http.StatusOK)
+		return report.WriteShrinkCSV(writer, shrinkReport)
+	}
+
+	web.Respond(ctx, writer, shrinkReport, http.StatusOK)
+	return nil
+}
+
+// GetShippingNotice returns the receiving reconciliation of a single advance shipping notice
+func (inve *Inventory) GetShippingNotice(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.GetShippingNotice.Attempt", nil).Update(1)
+
+	startTime := time.Now()
+	mLatency := metrics.GetOrRegisterTimer("Inventory.GetShippingNotice.Latency", nil)
+	defer func() { mLatency.Update(time.Since(startTime)) }()
+
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.GetShippingNotice.Success", nil)
+	mRetrieveErr := metrics.GetOrRegisterGauge("Inventory.GetShippingNotice.Retrieve-Error", nil)
+
+	notice, err := shippingnotice.FindByID(inve.MasterDB, mux.Vars(request)["id"])
+	if err != nil {
+		mRetrieveErr.Update(1)
+		return errors.Wrap(err, "error retrieving shipping notice")
+	}
+
+	reconciliation, err := shippingnotice.Reconcile(inve.MasterDB, notice)
+	if err != nil {
+		mRetrieveErr.Update(1)
+		return errors.Wrap(err, "error reconciling shipping notice")
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, reconciliation, http.StatusOK)
+	return nil
+}
+
+// GetShippingNotices returns the receiving reconciliation of the advance shipping notices
+// of a site recorded within a time window
+func (inve *Inventory) GetShippingNotices(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.GetShippingNotices.Attempt", nil).Update(1)
+
+	startTime := time.Now()
+	mLatency := metrics.GetOrRegisterTimer("Inventory.GetShippingNotices.Latency", nil)
+	defer func() { mLatency.Update(time.Since(startTime)) }()
+
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.GetShippingNotices.Success", nil)
+	mInputErr := metrics.GetOrRegisterGauge("Inventory.GetShippingNotices.Input-Error", nil)
+	mRetrieveErr := metrics.GetOrRegisterGauge("Inventory.GetShippingNotices.Retrieve-Error", nil)
+
+	query := request.URL.Query()
+
+	var start, end int64
+	var err error
+	if query.Get("starttime") != "" {
+		if start, err = strconv.ParseInt(query.Get("starttime"), 10, 64); err != nil {
+			mInputErr.Update(1)
+			return errors.Wrap(web.ErrInvalidInput, "starttime must be a millisecond epoch time")
+		}
+	}
+	if query.Get("endtime") != "" {
+		if end, err = strconv.ParseInt(query.Get("endtime"), 10, 64); err != nil || end < start {
+			mInputErr.Update(1)
+			return errors.Wrap(web.ErrInvalidInput, "endtime must be a millisecond epoch time after starttime")
+		}
+	}
+
+	notices, err := shippingnotice.FindAll(inve.MasterDB, query.Get("site_id"), start, end)
+	if err != nil {
+		mRetrieveErr.Update(1)
+		return errors.Wrap(err, "error retrieving shipping notices")
+	}
+
+	results := make([]shippingnotice.Reconciliation, 0, len(notices))
+	for _, notice := range notices {
+		reconciliation, err := shippingnotice.Reconcile(inve.MasterDB, notice)
+		if err != nil {
+			mRetrieveErr.Update(1)
+			return errors.Wrap(err, "error reconciling shipping notice")
+		}
+		results = append(results, reconciliation)
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, shippingnotice.Response{Results: results}, http.StatusOK)
+	return nil
+}
+
+// PostShippingNotices processes advance shipping notices submitted over REST, the same way
+// as the ones received over the EdgeX bus, and returns the result of each notice
+func (inve *Inventory) PostShippingNotices(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.PostShippingNotices.Attempt", nil).Update(1)
+
+	startTime := time.Now()
+	mLatency := metrics.GetOrRegisterTimer("Inventory.PostShippingNotices.Latency", nil)
+	defer func() { mLatency.Update(time.Since(startTime)) }()
+
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.PostShippingNotices.Success", nil)
+	mValidationErr := metrics.GetOrRegisterGauge("Inventory.PostShippingNotices.Validation-Error", nil)
+	mProcessErr := metrics.GetOrRegisterGauge("Inventory.PostShippingNotices.Process-Error", nil)
+
+	var asnList []tag.AdvanceShippingNotice
+
+	validationErrors, err := readAndValidateRequest(request, schemas.ShippingNoticeSchema, &asnList)
+	if err != nil {
+		mValidationErr.Update(1)
+		return err
+	}
+	if validationErrors != nil {
+		mValidationErr.Update(1)
+		web.Respond(ctx, writer, validationErrors, http.StatusBadRequest)
+		return nil
+	}
+
+	// do this before inserting the data into the database
+	dailyturn.ProcessIncomingASNList(inve.MasterDB, asnList)
+
+	// When no notice could be processed the request fails, with the reason of each notice
+	processed := 0
+	failureCode := http.StatusBadRequest
+	results := make([]shippingnotice.ProcessResult, 0, len(asnList))
+	for _, asn := range asnList {
+		result, err := shippingnotice.Process(inve.MasterDB, asn)
+		if err != nil {
+			mProcessErr.Update(1)
+			log.WithFields(log.Fields{
+				"Method": "PostShippingNotices",
+				"Action": "Process ASN",
+				"ASN":    asn.ID,
+				"Error":  err.Error(),
+			}).Error("error processing ASN data")
+			result.Error = err.Error()
+			if errors.Cause(err) != web.ErrValidation {
+				failureCode = http.StatusInternalServerError
+			}
+		} else {
+			processed++
+		}
+		results = append(results, result)
+	}
+
+	if processed == 0 {
+		web.Respond(ctx, writer, shippingnotice.Response{Results: results}, failureCode)
+		return nil
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, shippingnotice.Response{Results: results}, http.StatusOK)
+	return nil
+}
+
+// InvalidateProductDataCache drops the cached product metadata of the mapping service,
+// so it is fetched again the next time confidence is calculated
+// 204 StatusNoContent
+func (inve *Inventory) InvalidateProductDataCache(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.InvalidateProductDataCache.Attempt", nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.InvalidateProductDataCache.Success", nil)
+
+	productdata.InvalidateCache()
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, nil, http.StatusNoContent)
+	return nil
+}
+
+// GetDailyTurn returns the daily turn of products per facility, along with the history of
+// daily turn records within a time window
+func (inve *Inventory) GetDailyTurn(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.GetDailyTurn.Attempt", nil).Update(1)
+
+	startTime := time.Now()
+	mLatency := metrics.GetOrRegisterTimer("Inventory.GetDailyTurn.Latency", nil)
+	defer func() { mLatency.Update(time.Since(startTime)) }()
+
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.GetDailyTurn.Success", nil)
+	mInputErr := metrics.GetOrRegisterGauge("Inventory.GetDailyTurn.Input-Error", nil)
+	mRetrieveErr := metrics.GetOrRegisterGauge("Inventory.GetDailyTurn.Retrieve-Error", nil)
+
+	query := request.URL.Query()
+
+	filter := dailyturn.Filter{
+		ProductID:  query.Get("product_id"),
+		FacilityID: query.Get("facility_id"),
+	}
+
+	var err error
+	if query.Get("starttime") != "" {
+		if filter.StartTime, err = strconv.ParseInt(query.Get("starttime"), 10, 64); err != nil {
+			mInputErr.Update(1)
+			return errors.Wrap(web.ErrInvalidInput, "starttime must be a millisecond epoch time")
+		}
+	}
+	if query.Get("endtime") != "" {
+		if filter.EndTime, err = strconv.ParseInt(query.Get("endtime"), 10, 64); err != nil || filter.EndTime < filter.StartTime {
+			mInputErr.Update(1)
+			return errors.Wrap(web.ErrInvalidInput, "endtime must be a millisecond epoch time after starttime")
+		}
+	}
+
+	histories, err := dailyturn.FindHistory(inve.MasterDB, filter)
+	if err != nil {
+		mRetrieveErr.Update(1)
+		return errors.Wrap(err, "error retrieving daily turn history")
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, dailyturn.Response{Results: histories}, http.StatusOK)
+	return nil
+}
+
+// GetInventoryAsOf returns the number of tags per facility, product and epc_state as it was
+// at a past point in time, optionally along with the EPCs of each count
+func (inve *Inventory) GetInventoryAsOf(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.GetInventoryAsOf.Attempt", nil).Update(1)
+
+	startTime := time.Now()
+	mLatency := metrics.GetOrRegisterTimer("Inventory.GetInventoryAsOf.Latency", nil)
+	defer func() { mLatency.Update(time.Since(startTime)) }()
+
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.GetInventoryAsOf.Success", nil)
+	mInputErr := metrics.GetOrRegisterGauge("Inventory.GetInventoryAsOf.Input-Error", nil)
+	mRetrieveErr := metrics.GetOrRegisterGauge("Inventory.GetInventoryAsOf.Retrieve-Error", nil)
+
+	query := request.URL.Query()
+
+	asOf, err := strconv.ParseInt(query.Get("time"), 10, 64)
+	if err != nil || asOf <= 0 {
+		mInputErr.Update(1)
+		return errors.Wrap(web.ErrInvalidInput, "time must be a millisecond epoch time")
+	}
+
+	withEPCs := false
+	if query.Get("epcs") != "" {
+		if withEPCs, err = strconv.ParseBool(query.Get("epcs")); err != nil {
+			mInputErr.Update(1)
+			return errors.Wrap(web.ErrInvalidInput, "epcs must be either true or false")
+		}
+	}
+
+	filter := snapshot.Filter{
+		AsOf:       asOf,
+		FacilityID: query.Get("facility_id"),
+		ProductID:  query.Get("product_id"),
+	}
+
+	counts, err := snapshot.FindAsOf(inve.MasterDB, filter, withEPCs)
+	if err != nil {
+		mRetrieveErr.Update(1)
+		return errors.Wrap(err, "error retrieving inventory snapshots")
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, snapshot.AsOfResponse{Time: asOf, Results: counts}, http.StatusOK)
+	return nil
+}
+
+// GetAggregate returns the number of tags, and their average confidence, grouped by the
+// requested fields. Tags are counted by the database, confidence is computed once per
+// product, facility and minute of last read rather than per tag.
+func (inve *Inventory) GetAggregate(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.GetAggregate.Attempt", nil).Update(1)
+
+	startTime := time.Now()
+	mLatency := metrics.GetOrRegisterTimer("Inventory.GetAggregate.Latency", nil)
+	defer func() { mLatency.Update(time.Since(startTime)) }()
+
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.GetAggregate.Success", nil)
+	mInputErr := metrics.GetOrRegisterGauge("Inventory.GetAggregate.Input-Error", nil)
+	mRetrieveErr := metrics.GetOrRegisterGauge("Inventory.GetAggregate.Retrieve-Error", nil)
+	mConfidenceErr := metrics.GetOrRegisterGauge("Inventory.GetAggregate.Confidence-Error", nil)
+
+	query := request.URL.Query()
+
+	if query.Get("group_by") == "" {
+		mInputErr.Update(1)
+		return errors.Wrap(web.ErrInvalidInput, "group_by is required")
+	}
+	groupBy := strings.Split(query.Get("group_by"), ",")
+	for _, field := range groupBy {
+		if !tag.IsAggregateField(field) {
+			mInputErr.Update(1)
+			return errors.Wrapf(web.ErrInvalidInput, "cannot group by %s", field)
+		}
+	}
+
+	withConfidence := true
+	if query.Get("confidence") != "" {
+		var err error
+		if withConfidence, err = strconv.ParseBool(query.Get("confidence")); err != nil {
+			mInputErr.Update(1)
+			return errors.Wrap(web.ErrInvalidInput, "confidence must be either true or false")
+		}
+	}
+
+	// Any field tags can be grouped by can also be filtered on
+	filter := make(map[string]string)
+	for field, values := range query {
+		if tag.IsAggregateField(field) && len(values) > 0 {
+			filter[field] = values[0]
+		}
+	}
+
+	var response tag.AggregateResponse
+	var err error
+	if withConfidence {
+		response, err = inve.aggregateWithConfidence(groupBy, filter)
+	} else {
+		response, err = tag.AggregateTags(inve.MasterDB, groupBy, filter, nil, nil)
+	}
+	if err != nil {
+		switch errors.Cause(err) {
+		case web.ErrInvalidInput:
+			mInputErr.Update(1)
+			return err
+		case errConfidence:
+			mConfidenceErr.Update(1)
+			return err
+		}
+		mRetrieveErr.Update(1)
+		return errors.Wrap(err, "error aggregating tags")
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, response, http.StatusOK)
+	return nil
+}
+
+// errConfidence is the cause of errors loading the coefficients of the confidence model
+var errConfidence = errors.New("error applying confidence")
+
+// aggregateWithConfidence aggregates tags along with their average confidence. Confidence
+// models the database can evaluate are averaged in the same query as the counts. Other
+// models are evaluated once per product, facility and minute of last read, and aggregates
+// spanning more than config.AppConfig.AggregateBucketLimit of these are rejected.
+func (inve *Inventory) aggregateWithConfidence(groupBy []string, filter map[string]string) (tag.AggregateResponse, error) {
+	coefficients, err := loadCoefficients(inve.MasterDB, inve.Url)
+	if err != nil {
+		return tag.AggregateResponse{}, errors.Wrap(errConfidence, err.Error())
+	}
+
+	if model, ok := confidenceModel.(SQLConfidenceModel); ok {
+		products, err := tag.AggregateProducts(inve.MasterDB, filter)
+		if err != nil {
+			return tag.AggregateResponse{}, err
+		}
+		now := helper.UnixMilliNow()
+		confidence := func(dailyInvPerc, probUnreadToRead, probInStore, probExitError, lastRead string) string {
+			return model.ConfidenceSQL(dailyInvPerc, probUnreadToRead, probInStore, probExitError, lastRead, now)
+		}
+		return tag.AggregateTags(inve.MasterDB, groupBy, filter, coefficients.forProducts(inve.MasterDB, products), confidence)
+	}
+
+	buckets, err := tag.AggregateBuckets(inve.MasterDB, groupBy, filter, config.AppConfig.AggregateBucketLimit)
+	if err != nil {
+		return tag.AggregateResponse{}, err
+	}
+
+	// Confidence only depends on the product, facility and last read of a tag
+	tags := make([]tag.Tag, len(buckets))
+	for i, bucket := range buckets {
+		tags[i] = tag.Tag{ProductID: bucket.ProductID, FacilityID: bucket.FacilityID, LastRead: bucket.LastRead}
+	}
+	coefficients.apply(inve.MasterDB, tags)
+	for i := range buckets {
+		buckets[i].Confidence = tags[i].Confidence
+	}
+	return tag.SummarizeBuckets(groupBy, buckets), nil
+}
+
+// GetExport streams the tags matching the OData query as CSV or NDJSON, optionally with
+// their confidence and gzip compressed. Tags are written in batches as they are read from
+// the database, so exports of whole stores are not held in memory.
+func (inve *Inventory) GetExport(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.GetExport.Attempt", nil).Update(1)
+
+	startTime := time.Now()
+	mLatency := metrics.GetOrRegisterTimer("Inventory.GetExport.Latency", nil)
+	defer func() { mLatency.Update(time.Since(startTime)) }()
+
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.GetExport.Success", nil)
+	mInputErr := metrics.GetOrRegisterGauge("Inventory.GetExport.Input-Error", nil)
+	mStreamErr := metrics.GetOrRegisterGauge("Inventory.GetExport.Stream-Error", nil)
+
+	query := request.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = export.FormatNDJSON
+	}
+	if export.ContentType(format) == "" {
+		mInputErr.Update(1)
+		return errors.Wrapf(web.ErrInvalidInput, "unsupported format %s", format)
+	}
+
+	withConfidence := false
+	if query.Get("confidence") != "" {
+		var err error
+		if withConfidence, err = strconv.ParseBool(query.Get("confidence")); err != nil {
+			mInputErr.Update(1)
+			return errors.Wrap(web.ErrInvalidInput, "confidence must be either true or false")
+		}
+	}
+
+	// Everything else is passed on as the OData query
+	query.Del("format")
+	query.Del("confidence")
+	if len(query[parser.Count]) > 0 || len(query[parser.InlineCount]) > 0 {
+		mInputErr.Update(1)
+		return errors.Wrap(web.ErrInvalidInput, "$count and $inlinecount are not supported by export")
+	}
+
+	// Confidence is calculated from the product, facility and last read of a tag
+	if withConfidence && query.Get(parser.Select) != "" {
+		query.Set(parser.Select, query.Get(parser.Select)+",product_id,facility_id,last_read")
+	}
+
+	compress := acceptsGzip(request.Header.Get("Accept-Encoding"))
+
+	// Coefficients are loaded once rather than for every batch
+	var confidence coefficients
+	if withConfidence {
+		var err error
+		if confidence, err = loadCoefficients(inve.MasterDB, inve.Url); err != nil {
+			mStreamErr.Update(1)
+			return errors.Wrap(err, "error loading confidence coefficients")
+		}
+	}
+
+	// Headers are only sent with the first batch, until then errors are reported as usual
+	var output io.Writer = writer
+	var gzipWriter *gzip.Writer
+	var exportWriter export.Writer
+	started := false
+
+	batch := make([]tag.Tag, 0, exportBatchSize)
+	writeBatch := func() error {
+		if withConfidence && len(batch) > 0 {
+			confidence.apply(inve.MasterDB, batch)
+		}
+
+		if !started {
+			writer.Header().Set("Content-Type", export.ContentType(format))
+			writer.Header().Set("Content-Disposition", "attachment; filename=inventory."+format)
+			if compress {
+				writer.Header().Set("Content-Encoding", "gzip")
+				gzipWriter = gzip.NewWriter(writer)
+				output = gzipWriter
+			}
+			writer.WriteHeader(http.StatusOK)
+			exportWriter, _ = export.NewWriter(format, output, withConfidence)
+			started = true
+		}
+
+		for _, tagData := range batch {
+			if err := exportWriter.Write(tagData); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+
+		if err := exportWriter.Flush(); err != nil {
+			return err
+		}
+		if gzipWriter != nil {
+			if err := gzipWriter.Flush(); err != nil {
+				return err
+			}
+		}
+		if flusher, ok := writer.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	err := tag.Stream(inve.MasterDB, query, func(tagData tag.Tag) error {
+		batch = append(batch, tagData)
+		if len(batch) < exportBatchSize {
+			return nil
+		}
+		return writeBatch()
+	})
+	if err == nil {
+		// Also sends the headers of an empty export
+		err = writeBatch()
+	}
+	if gzipWriter != nil {
+		if closeErr := gzipWriter.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	if err != nil {
+		mStreamErr.Update(1)
+		if !started {
+			return errors.Wrap(err, "error exporting tags")
+		}
+		// The status has been sent already, the client receives a truncated export
+		log.WithFields(log.Fields{
+			"Method": "GetExport",
+			"Error":  err.Error(),
+		}).Error("Error streaming export")
+		return nil
+	}
+
+	mSuccess.Update(1)
+	return nil
+}
+
+// PostAccessToken issues a short-lived access token granting the role of the caller, for
+// event stream clients such as browsers that cannot set authentication headers
+// 200 OK, 404 Not Found when authentication is disabled
+func (inve *Inventory) PostAccessToken(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.PostAccessToken.Attempt", nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.PostAccessToken.Success", nil)
+
+	principal, authenticated := middlewares.PrincipalFromContext(ctx)
+	if inve.AccessTokens == nil || !authenticated {
+		return errors.Wrap(web.ErrNotFound, "access tokens are only issued when authentication is enabled")
+	}
+
+	accessToken, err := inve.AccessTokens.Issue(principal)
+	if err != nil {
+		return errors.Wrap(err, "error issuing access token")
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, accessToken, http.StatusOK)
+	return nil
+}
+
+// GetEventStream streams tag events as they are processed, matching the facility_id,
+// product_id, event and epc_prefix query parameters. Events are sent over a WebSocket when
+// the request asks to upgrade, as Server-Sent Events otherwise. Clients that fall behind
+// are disconnected rather than slowing down tag processing.
+func (inve *Inventory) GetEventStream(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.GetEventStream.Attempt", nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.GetEventStream.Success", nil)
+	mSlowConsumer := metrics.GetOrRegisterGauge("Inventory.GetEventStream.SlowConsumer", nil)
+
+	query := request.URL.Query()
+	filter := eventstream.Filter{
+		FacilityID: query.Get("facility_id"),
+		ProductID:  query.Get("product_id"),
+		Event:      query.Get("event"),
+		EpcPrefix:  query.Get("epc_prefix"),
+	}
+
+	flusher, canFlush := writer.(http.Flusher)
+	isWebSocket := websocket.IsWebSocketUpgrade(request)
+	if !isWebSocket && !canFlush {
+		return errors.New("streaming is not supported by the connection")
+	}
+
+	// Subscribing before responding ensures no event is missed once the client is connected
+	subscription := eventstream.Subscribe(filter)
+	defer eventstream.Unsubscribe(subscription)
+
+	if isWebSocket {
+		// Upgrade responds with the error itself when the handshake fails
+		conn, err := eventStreamUpgrader.Upgrade(writer, request, nil)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"Method": "GetEventStream",
+				"Error":  err.Error(),
+			}).Debug("WebSocket handshake failed")
+			return nil
+		}
+		streamWebSocket(conn, subscription)
+	} else {
+		writer.Header().Set("Content-Type", "text/event-stream")
+		writer.Header().Set("Cache-Control", "no-cache")
+		writer.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		streamServerSentEvents(request.Context().Done(), writer, flusher, subscription)
+	}
+
+	if subscription.Err() == eventstream.ErrSlowConsumer {
+		mSlowConsumer.Update(1)
+	}
+	mSuccess.Update(1)
+	return nil
+}
+
+// streamServerSentEvents writes the events of the subscription until the client disconnects
+// or the subscription ends. Comments are sent while idle to keep the connection open.
+func streamServerSentEvents(closed <-chan struct{}, writer io.Writer, flusher http.Flusher, subscription *eventstream.Subscription) {
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+		select {
+		case <-closed:
+			return
+
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(writer, ": keep-alive\n\n")
+
+		case message, open := <-subscription.Messages():
+			if !open {
+				data, _ := json.Marshal(web.JSONError{Error: subscriptionError(subscription).Error()})
+				_, _ = fmt.Fprintf(writer, "event: error\ndata: %s\n\n", data)
+				flusher.Flush()
+				return
+			}
+			var data []byte
+			if data, err = json.Marshal(message.Tag); err == nil {
+				_, err = fmt.Fprintf(writer, "id: %d\ndata: %s\n\n", message.ID, data)
+			}
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// eventStreamUpgrader upgrades event stream requests to WebSockets. Origins are not
+// restricted, as for the rest of the API.
+var eventStreamUpgrader = websocket.Upgrader{
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// streamWebSocket sends the events of the subscription as JSON messages until the client
+// disconnects or the subscription ends. Pings are sent while idle to keep the connection open.
+func streamWebSocket(conn *websocket.Conn, subscription *eventstream.Subscription) {
+	defer conn.Close()
+
+	// Messages from the client are ignored, reading only detects when it disconnects
+	closed := make(chan struct{})
+	go func() {
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				break
+			}
+		}
+		close(closed)
+	}()
+
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+		select {
+		case <-closed:
+			return
+
+		case <-keepAlive.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventStreamWriteTimeout))
+
+		case message, open := <-subscription.Messages():
+			if !open {
+				_ = conn.SetWriteDeadline(time.Now().Add(eventStreamWriteTimeout))
+				_ = conn.WriteJSON(web.JSONError{Error: subscriptionError(subscription).Error()})
+				return
+			}
+			if err = conn.SetWriteDeadline(time.Now().Add(eventStreamWriteTimeout)); err == nil {
+				err = conn.WriteJSON(message.Tag)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func subscriptionError(subscription *eventstream.Subscription) error {
+	if subscription.Err() != nil {
+		return subscription.Err()
+	}
+	return errors.New("event stream closed")
+}
+
+// GetStockThresholds returns the minimum quantity thresholds of products, along with the
+// stock level of their last evaluation
+func (inve *Inventory) GetStockThresholds(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.GetStockThresholds.Attempt", nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.GetStockThresholds.Success", nil)
+	mRetrieveErr := metrics.GetOrRegisterGauge("Inventory.GetStockThresholds.Retrieve-Error", nil)
+
+	query := request.URL.Query()
+
+	thresholds, err := stocklevel.FindAll(inve.MasterDB, query.Get("facility_id"), query.Get("product_id"))
+	if err != nil {
+		mRetrieveErr.Update(1)
+		return errors.Wrap(err, "error retrieving stock thresholds")
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, stocklevel.Response{Results: thresholds}, http.StatusOK)
+	return nil
+}
+
+// PutStockThresholds sets the minimum quantity of products at facilities
+func (inve *Inventory) PutStockThresholds(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.PutStockThresholds.Attempt", nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.PutStockThresholds.Success", nil)
+	mValidationErr := metrics.GetOrRegisterGauge("Inventory.PutStockThresholds.Validation-Error", nil)
+	mUpsertErr := metrics.GetOrRegisterGauge("Inventory.PutStockThresholds.Upsert-Error", nil)
+
+	var thresholds []stocklevel.Threshold
+
+	validationErrors, err := readAndValidateRequest(request, schemas.StockThresholdSchema, &thresholds)
+	if err != nil {
+		mValidationErr.Update(1)
+		return err
+	}
+	if validationErrors != nil {
+		mValidationErr.Update(1)
+		web.Respond(ctx, writer, validationErrors, http.StatusBadRequest)
+		return nil
+	}
+
+	if err := stocklevel.Upsert(inve.MasterDB, thresholds); err != nil {
+		mUpsertErr.Update(1)
+		return errors.Wrap(err, "error updating stock thresholds")
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, nil, http.StatusOK)
+	return nil
+}
+
+// DeleteStockThreshold deletes the minimum quantity threshold of a product at a facility
+// 204 StatusNoContent, 400 Bad Request, 404 Not Found, 500 Internal
+func (inve *Inventory) DeleteStockThreshold(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.DeleteStockThreshold.Attempt", nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.DeleteStockThreshold.Success", nil)
+	mInputErr := metrics.GetOrRegisterGauge("Inventory.DeleteStockThreshold.Input-Error", nil)
+	mDeleteErr := metrics.GetOrRegisterGauge("Inventory.DeleteStockThreshold.Delete-Error", nil)
+
+	query := request.URL.Query()
+
+	productID := query.Get("product_id")
+	facilityID := query.Get("facility_id")
+	if productID == "" || facilityID == "" {
+		mInputErr.Update(1)
+		return errors.Wrap(web.ErrInvalidInput, "product_id and facility_id are required")
+	}
+
+	if err := stocklevel.Delete(inve.MasterDB, productID, facilityID); err != nil {
+		mDeleteErr.Update(1)
+		return err
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, nil, http.StatusNoContent)
+	return nil
+}
+
+// GetWebhooks returns all webhooks, without their secrets
+func (inve *Inventory) GetWebhooks(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.GetWebhooks.Attempt", nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.GetWebhooks.Success", nil)
+	mRetrieveErr := metrics.GetOrRegisterGauge("Inventory.GetWebhooks.Retrieve-Error", nil)
+
+	subscriptions, err := webhook.FindAll(inve.MasterDB)
+	if err != nil {
+		mRetrieveErr.Update(1)
+		return errors.Wrap(err, "error retrieving webhooks")
+	}
+	for i := range subscriptions {
+		subscriptions[i] = subscriptions[i].WithoutSecret()
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, webhook.Response{Results: subscriptions}, http.StatusOK)
+	return nil
+}
+
+// GetWebhook returns a webhook, without its secret
+func (inve *Inventory) GetWebhook(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.GetWebhook.Attempt", nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.GetWebhook.Success", nil)
+	mRetrieveErr := metrics.GetOrRegisterGauge("Inventory.GetWebhook.Retrieve-Error", nil)
+
+	subscription, err := webhook.FindByID(inve.MasterDB, mux.Vars(request)["id"])
+	if err != nil {
+		mRetrieveErr.Update(1)
+		return errors.Wrap(err, "error retrieving webhook")
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, subscription.WithoutSecret(), http.StatusOK)
+	return nil
+}
+
+// PostWebhook creates a webhook, returning it along with the secret its payloads are signed with
+// 201 StatusCreated, 400 Bad Request, 500 Internal
+func (inve *Inventory) PostWebhook(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.PostWebhook.Attempt", nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.PostWebhook.Success", nil)
+	mValidationErr := metrics.GetOrRegisterGauge("Inventory.PostWebhook.Validation-Error", nil)
+	mInsertErr := metrics.GetOrRegisterGauge("Inventory.PostWebhook.Insert-Error", nil)
+
+	var subscription webhook.Subscription
+
+	validationErrors, err := readAndValidateRequest(request, schemas.WebhookSchema, &subscription)
+	if err != nil {
+		mValidationErr.Update(1)
+		return err
+	}
+	if validationErrors != nil {
+		mValidationErr.Update(1)
+		web.Respond(ctx, writer, validationErrors, http.StatusBadRequest)
+		return nil
+	}
+
+	subscription, err = webhook.Insert(inve.MasterDB, subscription)
+	if err != nil {
+		mInsertErr.Update(1)
+		return errors.Wrap(err, "error creating webhook")
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, subscription, http.StatusCreated)
+	return nil
+}
+
+// PutWebhook replaces the URL, filters and enabled state of a webhook, and its secret when
+// one is provided. Enabling a webhook that was disabled after failing resets its failures.
+func (inve *Inventory) PutWebhook(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.PutWebhook.Attempt", nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.PutWebhook.Success", nil)
+	mValidationErr := metrics.GetOrRegisterGauge("Inventory.PutWebhook.Validation-Error", nil)
+	mUpdateErr := metrics.GetOrRegisterGauge("Inventory.PutWebhook.Update-Error", nil)
+
+	// Webhooks are enabled unless stated otherwise
+	changes := webhook.Subscription{Enabled: true}
+
+	validationErrors, err := readAndValidateRequest(request, schemas.WebhookSchema, &changes)
+	if err != nil {
+		mValidationErr.Update(1)
+		return err
+	}
+	if validationErrors != nil {
+		mValidationErr.Update(1)
+		web.Respond(ctx, writer, validationErrors, http.StatusBadRequest)
+		return nil
+	}
+
+	subscription, err := webhook.Update(inve.MasterDB, mux.Vars(request)["id"], changes)
+	if err != nil {
+		mUpdateErr.Update(1)
+		return errors.Wrap(err, "error updating webhook")
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, subscription.WithoutSecret(), http.StatusOK)
+	return nil
+}
+
+// DeleteWebhook deletes a webhook along with its pending deliveries and delivery history
+// 204 StatusNoContent, 404 Not Found, 500 Internal
+func (inve *Inventory) DeleteWebhook(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.DeleteWebhook.Attempt", nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.DeleteWebhook.Success", nil)
+	mDeleteErr := metrics.GetOrRegisterGauge("Inventory.DeleteWebhook.Delete-Error", nil)
+
+	if err := webhook.Delete(inve.MasterDB, mux.Vars(request)["id"]); err != nil {
+		mDeleteErr.Update(1)
+		return err
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, nil, http.StatusNoContent)
+	return nil
+}
+
+// GetWebhookDeliveries returns the most recent deliveries of a webhook, newest first
+func (inve *Inventory) GetWebhookDeliveries(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge("Inventory.GetWebhookDeliveries.Attempt", nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge("Inventory.GetWebhookDeliveries.Success", nil)
+	mInputErr := metrics.GetOrRegisterGauge("Inventory.GetWebhookDeliveries.Input-Error", nil)
+	mRetrieveErr := metrics.GetOrRegisterGauge("Inventory.GetWebhookDeliveries.Retrieve-Error", nil)
+
+	query := request.URL.Query()
+
+	status := query.Get("status")
+	switch status {
+	case "", webhook.DeliveryPending, webhook.DeliveryDelivered, webhook.DeliveryFailed:
+	default:
+		mInputErr.Update(1)
+		return errors.Wrapf(web.ErrInvalidInput, "status must be %s, %s or %s",
+			webhook.DeliveryPending, webhook.DeliveryDelivered, webhook.DeliveryFailed)
+	}
+
+	limit := webhookDeliveriesLimit
+	if query.Get("limit") != "" {
+		var err error
+		if limit, err = strconv.Atoi(query.Get("limit")); err != nil || limit < 1 || limit > inve.MaxSize {
+			mInputErr.Update(1)
+			return errors.Wrapf(web.ErrInvalidInput, "limit must be an integer between 1 and %d", inve.MaxSize)
+		}
+	}
+
+	id := mux.Vars(request)["id"]
+	// Distinguishes an unknown webhook from one without deliveries
+	if _, err := webhook.FindByID(inve.MasterDB, id); err != nil {
+		mRetrieveErr.Update(1)
+		return errors.Wrap(err, "error retrieving webhook")
+	}
+
+	deliveries, err := webhook.FindDeliveries(inve.MasterDB, id, status, limit)
+	if err != nil {
+		mRetrieveErr.Update(1)
+		return errors.Wrap(err, "error retrieving webhook deliveries")
+	}
+
+	mSuccess.Update(1)
+	web.Respond(ctx, writer, webhook.Response{Results: deliveries}, http.StatusOK)
+	return nil
+}
@@ -7,20 +7,38 @@
 package handlers
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/dailyturn"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/eventstream"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/facility"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/handheldevent"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/health"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/shippingnotice"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/sensor"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/snapshot"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/tag"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/webhook"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/encodingscheme"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/integrationtest"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/jsonrpc"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/prometheus"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/web"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
 	"github.com/lib/pq"
 	"github.com/pkg/errors"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"reflect"
 	"strings"
@@ -54,14 +72,11 @@ type inputTest struct {
 	queryStr string
 }
 
-var isProbabilisticPluginFound bool
-
 func TestMain(m *testing.M) {
 	dbHost = integrationtest.InitHost("handlers_test")
 
 	if err := loadConfidencePlugin(); err != nil {
-		isProbabilisticPluginFound = false
-		log.Printf("these tests lack confidence: %+v\n", err)
+		log.Printf("these tests use the default confidence model: %+v\n", err)
 		os.Exit(m.Run())
 	}
 
@@ -76,15 +91,22 @@ func TestGetIndex(t *testing.T) {
 		t.Errorf("Unable to create new HTTP request %s", err.Error())
 	}
 	recorder := httptest.NewRecorder()
-	inventory := Inventory{nil, 0, ""}
+	inventory := Inventory{MasterDB: nil, MaxSize: 0, Url: ""}
 	handler := web.Handler(inventory.Index)
 	handler.ServeHTTP(recorder, request)
 	if recorder.Code != http.StatusOK {
 		t.Errorf("Expected 200 response")
 	}
 	log.Print(recorder.Body.String())
-	if recorder.Body.String() != "\"Inventory Service\"" {
-		t.Errorf("Expected body to equal Inventory Service")
+	var index IndexResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &index); err != nil {
+		t.Fatalf("Unable to unmarshal index response %s", err.Error())
+	}
+	if index.Service != "Inventory Service" {
+		t.Errorf("Expected service to equal Inventory Service")
+	}
+	if index.ConfidenceModel != ActiveConfidenceModel() {
+		t.Errorf("Expected confidence model %s, received %s", ActiveConfidenceModel(), index.ConfidenceModel)
 	}
 }
 
@@ -120,7 +142,7 @@ func TestGetTags(t *testing.T) {
 
 	recorder := httptest.NewRecorder()
 
-	inventory := Inventory{testDB.DB, config.AppConfig.ResponseLimit, testServer.URL + "/skus"}
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: testServer.URL + "/skus"}
 
 	handler := web.Handler(inventory.GetTags)
 
@@ -182,7 +204,7 @@ func TestGetOdata(t *testing.T) {
 
 		recorder := httptest.NewRecorder()
 
-		inventory := Inventory{testDB.DB, config.AppConfig.ResponseLimit, testServer.URL + "/skus"}
+		inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: testServer.URL + "/skus"}
 
 		handler := web.Handler(inventory.GetTags)
 
@@ -308,7 +330,7 @@ func TestGetSelectTags(t *testing.T) {
 		},
 	}
 
-	inventory := Inventory{testDB.DB, config.AppConfig.ResponseLimit, testServer.URL + "/skus"}
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: testServer.URL + "/skus"}
 
 	handler := web.Handler(inventory.GetTags)
 	testHandlerHelper(selectTests, "GET", handler, testDB.DB, t)
@@ -365,7 +387,7 @@ func TestPostCurrentInventory(t *testing.T) {
 		},
 	}
 
-	inventory := Inventory{testDB.DB, config.AppConfig.ResponseLimit, testServer.URL + "/skus"}
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: testServer.URL + "/skus"}
 
 	handler := web.Handler(inventory.PostCurrentInventory)
 
@@ -498,7 +520,7 @@ func TestSearchByProductIdPositive(t *testing.T) {
 		},
 	}
 
-	inventory := Inventory{testDB.DB, config.AppConfig.ResponseLimit, testServer.URL + "/skus"}
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: testServer.URL + "/skus"}
 
 	handler := web.Handler(inventory.GetSearchByProductID)
 
@@ -571,7 +593,7 @@ func TestSearchByProductIdNegative(t *testing.T) {
 		},
 	}
 
-	inventory := Inventory{testDB.DB, config.AppConfig.ResponseLimit, testServer.URL + "/skus"}
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: testServer.URL + "/skus"}
 
 	handler := web.Handler(inventory.GetSearchByProductID)
 
@@ -810,7 +832,7 @@ func TestUpdateQualifiedState(t *testing.T) {
 		},
 	}
 
-	inventory := Inventory{testDB.DB, config.AppConfig.ResponseLimit, ""}
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: ""}
 
 	handler := web.Handler(inventory.UpdateQualifiedState)
 
@@ -830,7 +852,7 @@ func TestGetFacilities(t *testing.T) {
 
 	recorder := httptest.NewRecorder()
 
-	inventory := Inventory{testDB.DB, config.AppConfig.ResponseLimit, ""}
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: ""}
 
 	handler := web.Handler(inventory.GetFacilities)
 
@@ -854,7 +876,7 @@ func TestGetHandheldEvents(t *testing.T) {
 
 	recorder := httptest.NewRecorder()
 
-	inventory := Inventory{testDB.DB, config.AppConfig.ResponseLimit, ""}
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: ""}
 
 	handler := web.Handler(inventory.GetHandheldEvents)
 
@@ -866,235 +888,999 @@ func TestGetHandheldEvents(t *testing.T) {
 	}
 }
 
-func TestMapRequestToOdata(t *testing.T) {
-	var requestBody = tag.RequestBody{
-		QualifiedState: "sold",
-		FacilityID:     "store001",
-		EpcState:       "sold",
-		ProductID:      "12345678978945",
-		Time:           1483228800000,
-		StartTime:      1482624000000,
-		EndTime:        1483228800000,
-		Confidence:     0.75,
-		CountOnly:      false,
+// fakeProcessor stores the tags of each event it receives so the handler can
+// look them up afterwards, without requiring the full tag processing pipeline
+type fakeProcessor struct {
+	db     *sql.DB
+	source string
+	events []*jsonrpc.InventoryEvent
+}
+
+func (fp *fakeProcessor) ProcessTagData(invEvent *jsonrpc.InventoryEvent, source string) error {
+	fp.source = source
+	fp.events = append(fp.events, invEvent)
+
+	tags := make([]tag.Tag, 0, len(invEvent.Params.Data))
+	for _, tagEvent := range invEvent.Params.Data {
+		tags = append(tags, tag.Tag{
+			Epc:        tagEvent.EpcCode,
+			FacilityID: tagEvent.FacilityID,
+			Event:      tagEvent.EventType,
+			EpcState:   "present",
+		})
 	}
+	return tag.Replace(fp.db, tags)
+}
 
-	requestBody.CountOnly = false
+func TestPostHandheldReads(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
 
-	actualMap := make(map[string][]string)
-	filterArray := []string{"facility_id eq 'store001' and qualified_state eq 'sold' and epc_state eq 'sold'" +
-		" and confidence ge 0.75 and productId eq '12345678978945' and last_read ge 1482624000000" +
-		" and last_read le 1483228800000 and last_read le 1483228800000"}
-	expectedMap := map[string][]string{
-		"$filter": filterArray,
-	}
-	actualMap = mapRequestToOdata(actualMap, &requestBody)
-	if !reflect.DeepEqual(actualMap, expectedMap) {
-		t.Errorf("Actual map is %v but got %v", actualMap, expectedMap)
-	}
+	epc := "30143639F84191AD22900204"
+	facility := "test-facility"
 
-	requestBody.CountOnly = true
+	processor := &fakeProcessor{db: testDB.DB}
 
-	expectedMap["$inlinecount"] = []string{"allpages"}
-	actualMap = make(map[string][]string)
-	actualMap = mapRequestToOdata(actualMap, &requestBody)
-	if !reflect.DeepEqual(actualMap, expectedMap) {
-		t.Errorf("Actual map is %v but got %v", actualMap, expectedMap)
+	var handheldTests = []inputTest{
+		{
+			title: "Reads processed",
+			input: []byte(fmt.Sprintf(`{"facility_id": "%s", "location": "handheld-01", "reads": [{"epc": "%s"}]}`,
+				facility, epc)),
+			code:     []int{200},
+			validate: validateHandheldReads(processor, epc, facility),
+			destroy:  deleteTag(epc),
+		},
+		{
+			title: "No reads",
+			input: []byte(fmt.Sprintf(`{"facility_id": "%s", "location": "handheld-01", "reads": []}`, facility)),
+			code:  []int{400},
+		},
+		{
+			title: "Invalid epc",
+			input: []byte(fmt.Sprintf(`{"facility_id": "%s", "location": "handheld-01", "reads": [{"epc": "not-hex"}]}`,
+				facility)),
+			code: []int{400},
+		},
+		{
+			title: "Empty request body",
+			input: []byte(``),
+			code:  []int{400},
+		},
 	}
+
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: "", Processor: processor}
+
+	handler := web.Handler(inventory.PostHandheldReads)
+
+	testHandlerHelper(handheldTests, "POST", handler, testDB.DB, t)
 }
 
-func TestMapEpcRequestToOdata(t *testing.T) {
-	var requestBody = tag.RequestBody{
-		FacilityID: "store001",
-		Epc:        "0123456",
+func TestPostHandheldReadsNoProcessor(t *testing.T) {
+	request, err := http.NewRequest("POST", "/inventory/handheld/reads",
+		bytes.NewBufferString(`{"facility_id": "store001", "location": "handheld-01", "reads": [{"epc": "30143639F84191AD22900204"}]}`))
+	if err != nil {
+		t.Errorf("Unable to create new HTTP request %s", err.Error())
 	}
-	compareMaps(t, []string{"facility_id eq 'store001' and epc eq '0123456'"}, &requestBody)
 
-	requestBody.Epc = "*0123456"
-	compareMaps(t, []string{"facility_id eq 'store001' and endswith(epc, '0123456')"}, &requestBody)
+	recorder := httptest.NewRecorder()
 
-	requestBody.Epc = "0123456*"
-	compareMaps(t, []string{"facility_id eq 'store001' and startswith(epc, '0123456')"}, &requestBody)
+	inventory := Inventory{MasterDB: nil, MaxSize: 0, Url: ""}
+	handler := web.Handler(inventory.PostHandheldReads)
+	handler.ServeHTTP(recorder, request)
 
-	requestBody.Epc = "0123*456"
-	compareMaps(t, []string{"facility_id eq 'store001' and startswith(epc, '0123') and endswith(epc, '456')"},
-		&requestBody)
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status code %d, received %d", http.StatusInternalServerError, recorder.Code)
+	}
 }
 
-func compareMaps(t *testing.T, filterStrings []string, requestBody *tag.RequestBody) {
-	expectedMap := map[string][]string{
-		"$filter": filterStrings,
+func TestHandheldSession(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	epc := "30143639F84191AD22900204"
+	facility := "test-facility"
+
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: ""}
+
+	if err := tag.Replace(testDB.DB, []tag.Tag{{
+		Epc:        epc,
+		FacilityID: facility,
+		EpcState:   "present",
+		LastRead:   1,
+	}}); err != nil {
+		t.Fatalf("Unable to insert tag %s", err.Error())
 	}
-	actualMap := make(map[string][]string)
-	actualMap = mapRequestToOdata(actualMap, requestBody)
-	if !reflect.DeepEqual(actualMap, expectedMap) {
-		t.Errorf("Actual map is %v but got %v", actualMap, expectedMap)
+	defer deleteTag(epc)(testDB.DB, t)
+
+	request, err := http.NewRequest("POST", "/inventory/handheld/sessions/start",
+		bytes.NewBufferString(fmt.Sprintf(`{"facility_id": "%s"}`, facility)))
+	if err != nil {
+		t.Fatalf("Unable to create new HTTP request %s", err.Error())
+	}
+	recorder := httptest.NewRecorder()
+	web.Handler(inventory.StartHandheldSession).ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Success expected: %d, response body: %s", recorder.Code, recorder.Body.String())
 	}
-}
 
-func TestSearchByEpcPositive(t *testing.T) {
+	var session handheldevent.HandheldEvent
+	if err := json.Unmarshal(recorder.Body.Bytes(), &session); err != nil {
+		t.Fatal(err)
+	}
+	if session.SessionID == "" || session.Event != handheldevent.FullScanStart {
+		t.Fatalf("Unexpected session %+v", session)
+	}
 
-	testServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-		time.Sleep(1 * time.Second)
-		if request.URL.EscapedPath() != "/skus" {
-			t.Errorf("Expected request to be '/skus', received %s",
-				request.URL.EscapedPath())
-		}
-		if request.Method != "GET" {
-			t.Errorf("Expected 'GET' request, received '%s", request.Method)
-		}
-		var jsonData []byte
-		if request.URL.EscapedPath() == "/skus" {
-			result := buildProductData(0.2, 0.75, 0.2, 0.1, "00111111")
-			jsonData, _ = json.Marshal(result)
-		}
-		writer.Header().Set("Content-Type", "application/json")
-		_, _ = writer.Write(jsonData)
-	}))
+	completeBody := fmt.Sprintf(`{"session_id": "%s"}`, session.SessionID)
+	request, err = http.NewRequest("POST", "/inventory/handheld/sessions/complete", bytes.NewBufferString(completeBody))
+	if err != nil {
+		t.Fatalf("Unable to create new HTTP request %s", err.Error())
+	}
+	recorder = httptest.NewRecorder()
+	web.Handler(inventory.CompleteHandheldSession).ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Success expected: %d, response body: %s", recorder.Code, recorder.Body.String())
+	}
 
-	defer testServer.Close()
+	var report handheldevent.ReconciliationReport
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.MissingCount != 1 || report.Missing[0].Epc != epc {
+		t.Errorf("Expected tag %s to be reported missing, received %+v", epc, report)
+	}
+
+	// Completing the session twice is rejected
+	request, err = http.NewRequest("POST", "/inventory/handheld/sessions/complete", bytes.NewBufferString(completeBody))
+	if err != nil {
+		t.Fatalf("Unable to create new HTTP request %s", err.Error())
+	}
+	recorder = httptest.NewRecorder()
+	web.Handler(inventory.CompleteHandheldSession).ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, received %d", http.StatusConflict, recorder.Code)
+	}
+
+	// Unknown sessions are not found
+	request, err = http.NewRequest("POST", "/inventory/handheld/sessions/complete",
+		bytes.NewBufferString(`{"session_id": "unknown"}`))
+	if err != nil {
+		t.Fatalf("Unable to create new HTTP request %s", err.Error())
+	}
+	recorder = httptest.NewRecorder()
+	web.Handler(inventory.CompleteHandheldSession).ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, received %d", http.StatusNotFound, recorder.Code)
+	}
+}
 
+func TestGetCycleCountReport(t *testing.T) {
 	testDB := dbHost.CreateDB(t)
 	defer testDB.Close()
 
-	var searchEpcTests = []inputTest{
+	epc := "30143639F84191AD22900204"
+	facility := "test-facility"
+
+	var cycleCountTests = []inputTest{
 		{
-			input: []byte(`{
-						"facility_id":"store001",
-						"epc":"00012345678905",
-						"size":500
-						}`),
-			code: []int{200, 204},
+			title: "JSON report",
+			setup: insertTag(tag.Tag{
+				Epc:        epc,
+				ProductID:  "00888446671424",
+				FacilityID: facility,
+				EpcState:   "present",
+				Arrived:    100,
+				LastRead:   500,
+			}),
+			queryStr: "/inventory/reports/cyclecount?facility_id=" + facility + "&starttime=1000",
+			code:     []int{200},
+			validate: func(dbs *sql.DB, r *httptest.ResponseRecorder, t *testing.T) error {
+				if !strings.Contains(r.Body.String(), `"missing": [`) ||
+					!strings.Contains(r.Body.String(), epc) {
+					return errors.Errorf("expected %s to be reported missing", epc)
+				}
+				return nil
+			},
 		},
 		{
-			input: []byte(`{
-						"facility_id":"store001",
-						"epc":"000123*45678905",
-						"size":500
-						}`),
-			code: []int{200, 204},
+			title:    "CSV report",
+			queryStr: "/inventory/reports/cyclecount?facility_id=" + facility + "&starttime=1000&format=csv",
+			code:     []int{200},
+			validate: func(dbs *sql.DB, r *httptest.ResponseRecorder, t *testing.T) error {
+				if r.Header().Get("Content-Type") != "text/csv" {
+					return errors.Errorf("expected csv content type, received %s", r.Header().Get("Content-Type"))
+				}
+				if !strings.HasPrefix(r.Body.String(), "product_id,expected,counted,missing,unexpected") {
+					return errors.New("expected csv header")
+				}
+				return nil
+			},
+			destroy: deleteTag(epc),
 		},
 		{
-			input: []byte(`{
-						"facility_id":"store001",
-						"epc":"*00012345678905",
-						"size":500
-						}`),
-			code: []int{200, 204},
+			title:    "Missing facility",
+			queryStr: "/inventory/reports/cyclecount?starttime=1000",
+			code:     []int{400},
 		},
 		{
-			input: []byte(`{
-						"facility_id":"store001",
-						"epc":"00012345678905*",
-						"size":500
-						}`),
-			code: []int{200, 204},
+			title:    "Invalid starttime",
+			queryStr: "/inventory/reports/cyclecount?facility_id=" + facility + "&starttime=yesterday",
+			code:     []int{400},
+		},
+		{
+			title:    "Unsupported format",
+			queryStr: "/inventory/reports/cyclecount?facility_id=" + facility + "&starttime=1000&format=xml",
+			code:     []int{400},
+		},
+		{
+			title:    "Future starttime",
+			queryStr: "/inventory/reports/cyclecount?facility_id=" + facility + "&starttime=99999999999999",
+			code:     []int{400},
 		},
 	}
 
-	inventory := Inventory{testDB.DB, config.AppConfig.ResponseLimit, testServer.URL + "/skus"}
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: ""}
 
-	handler := web.Handler(inventory.GetSearchByEpc)
+	handler := web.Handler(inventory.GetCycleCountReport)
 
-	testHandlerHelper(searchEpcTests, "POST", handler, testDB.DB, t)
+	testHandlerHelper(cycleCountTests, "GET", handler, testDB.DB, t)
 }
 
-// nolint :dupl
-func TestSearchByEpcNegative(t *testing.T) {
-
+func TestGetAggregate(t *testing.T) {
 	testServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-		time.Sleep(1 * time.Second)
-		if request.URL.EscapedPath() != "/skus" {
-			t.Errorf("Expected request to be '/skus', received %s",
-				request.URL.EscapedPath())
-		}
-		if request.Method != "GET" {
-			t.Errorf("Expected 'GET' request, received '%s", request.Method)
-		}
-		var jsonData []byte
-		if request.URL.EscapedPath() == "/skus" {
-			result := buildProductData(0.2, 0.75, 0.2, 0.1, "00111111")
-			jsonData, _ = json.Marshal(result)
-		}
+		jsonData, _ := json.Marshal(buildProductData(0.2, 0.75, 0.2, 0.1, "00888446671424"))
 		writer.Header().Set("Content-Type", "application/json")
 		_, _ = writer.Write(jsonData)
 	}))
-
 	defer testServer.Close()
 
 	testDB := dbHost.CreateDB(t)
 	defer testDB.Close()
 
-	var searchEpcTests = []inputTest{
-		// No facility id
+	epc := "30143639F84191AD22900204"
+
+	var aggregateTests = []inputTest{
 		{
-			input: []byte(`{
-					"size":500,
-					"epc":"0001*"
-					}`),
-			code: []int{400},
+			title: "Group by product and state",
+			setup: insertTag(tag.Tag{
+				Epc:        epc,
+				ProductID:  "00888446671424",
+				FacilityID: "test-facility",
+				EpcState:   "present",
+				LastRead:   time.Now().UnixNano() / int64(time.Millisecond),
+			}),
+			queryStr: "/inventory/query/aggregate?group_by=product_id,epc_state&facility_id=test-facility",
+			code:     []int{200},
+			validate: func(dbs *sql.DB, r *httptest.ResponseRecorder, t *testing.T) error {
+				var response tag.AggregateResponse
+				if err := json.Unmarshal(r.Body.Bytes(), &response); err != nil {
+					return err
+				}
+				if response.Count != 1 || len(response.Results) != 1 ||
+					response.Results[0].Group["product_id"] != "00888446671424" ||
+					response.Results[0].Group["epc_state"] != "present" {
+					return errors.Errorf("expected a single present tag, received %+v", response)
+				}
+				// the tag was just read
+				if response.Results[0].AverageConfidence < 0.9 {
+					return errors.Errorf("expected a high confidence, received %f", response.Results[0].AverageConfidence)
+				}
+				return nil
+			},
 		},
-		// Empty request body
 		{
-			input: []byte(``),
-			code:  []int{400},
+			title:    "Counts only",
+			queryStr: "/inventory/query/aggregate?group_by=facility_id&confidence=false",
+			code:     []int{200},
+			validate: func(dbs *sql.DB, r *httptest.ResponseRecorder, t *testing.T) error {
+				var response tag.AggregateResponse
+				if err := json.Unmarshal(r.Body.Bytes(), &response); err != nil {
+					return err
+				}
+				if response.Count != 1 || len(response.Results) != 1 || response.Results[0].AverageConfidence != 0 {
+					return errors.Errorf("expected a single tag without confidence, received %+v", response)
+				}
+				return nil
+			},
 		},
-		// Invalid input type for facility_id
 		{
-			input: []byte(`{ "facility_id":10 }`),
-			code:  []int{400},
+			title:    "Invalid confidence",
+			queryStr: "/inventory/query/aggregate?group_by=facility_id&confidence=maybe",
+			code:     []int{400},
 		},
-		// No EPC field
 		{
-			input: []byte(`{ "facility_id":"store1" }`),
-			code:  []int{400},
+			title:    "Filtered out",
+			queryStr: "/inventory/query/aggregate?group_by=product_id&epc_state=departed",
+			code:     []int{200},
+			validate: func(dbs *sql.DB, r *httptest.ResponseRecorder, t *testing.T) error {
+				if !strings.Contains(r.Body.String(), `"results": []`) {
+					return errors.Errorf("expected no results, received %s", r.Body.String())
+				}
+				return nil
+			},
+			destroy: deleteTag(epc),
 		},
-		// Invalid characters in EPC field
 		{
-			input: []byte(`{
-					"size":500,
-					"epc":"0GHI-$",
-					"facility_id":"store1"
-					}`),
-			code: []int{400},
+			title:    "Missing group_by",
+			queryStr: "/inventory/query/aggregate",
+			code:     []int{400},
 		},
-		// More than one '*'
 		{
-			input: []byte(`{
-					"size":500,
-					"epc":"*01234*",
-					"facility_id":"store1"
-					}`),
-			code: []int{400},
+			title:    "Unsupported field",
+			queryStr: "/inventory/query/aggregate?group_by=epc",
+			code:     []int{400},
 		},
 	}
 
-	inventory := Inventory{testDB.DB, config.AppConfig.ResponseLimit, testServer.URL + "/skus"}
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: testServer.URL + "/skus"}
 
-	handler := web.Handler(inventory.GetSearchByEpc)
+	handler := web.Handler(inventory.GetAggregate)
 
-	testHandlerHelper(searchEpcTests, "POST", handler, testDB.DB, t)
+	testHandlerHelper(aggregateTests, "GET", handler, testDB.DB, t)
 }
 
-func TestUpdateCoefficientsPositive(t *testing.T) {
-
-	var searchGtinTests = []inputTest{
-		{
-			input: []byte(`{
-					"facility_id":"Tavern",
-					"dailyinventorypercentage":0.30,
-					"probunreadtoread":0.30,
-					"probinstoreread":0.30,
-					"probexiterror": 0.30
-				  }`),
-			code: []int{200, 404},
-		},
-	}
-
+func TestGetExport(t *testing.T) {
 	testDB := dbHost.CreateDB(t)
 	defer testDB.Close()
 
-	inventory := Inventory{testDB.DB, config.AppConfig.ResponseLimit, ""}
+	epcs := []string{"30143639F84191AD22900204", "30143639F84191AD66100107"}
+	for _, epc := range epcs {
+		insertTag(tag.Tag{Epc: epc, FacilityID: "test-facility", EpcState: "present"})(testDB.DB, t)
+	}
+	defer func() {
+		for _, epc := range epcs {
+			deleteTag(epc)(testDB.DB, t)
+		}
+	}()
+
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: 1, Url: ""}
+	handler := web.Handler(inventory.GetExport)
+
+	// CSV, not limited by MaxSize
+	request := httptest.NewRequest("GET", "/inventory/export?format=csv&$orderby=epc", nil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, received %d", http.StatusOK, recorder.Code)
+	}
+	lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], epcs[0]) || !strings.HasPrefix(lines[2], epcs[1]) {
+		t.Errorf("Expected a header and both tags, received %q", recorder.Body.String())
+	}
+
+	// Gzip compressed NDJSON, filtered
+	request = httptest.NewRequest("GET", "/inventory/export?$filter="+url.QueryEscape("epc eq '"+epcs[1]+"'"), nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected gzip encoded response, received %d %v", recorder.Code, recorder.Header())
+	}
+	reader, err := gzip.NewReader(recorder.Body)
+	if err != nil {
+		t.Fatalf("Unable to read gzip response %s", err.Error())
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Unable to read gzip response %s", err.Error())
+	}
+	var exported tag.Tag
+	if err := json.Unmarshal(body, &exported); err != nil || exported.Epc != epcs[1] {
+		t.Errorf("Expected a single tag %s, received %s", epcs[1], body)
+	}
+
+	for _, query := range []string{"format=xml", "confidence=maybe", "$count", "$filter=epc eq"} {
+		request = httptest.NewRequest("GET", "/inventory/export?"+query, nil)
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %s, received %d", http.StatusBadRequest, query, recorder.Code)
+		}
+	}
+}
+
+func TestGetShrinkReport(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	epc := "30143639F84191AD22900204"
+
+	var shrinkTests = []inputTest{
+		{
+			title: "JSON report",
+			setup: insertTag(tag.Tag{
+				Epc:               epc,
+				ProductID:         "00888446671424",
+				FacilityID:        "test-facility",
+				EpcState:          "departed",
+				LastRead:          1500,
+				DepartureReason:   "exit",
+				DepartureLocation: "front-door",
+			}),
+			queryStr: "/inventory/reports/shrink?starttime=1000&endtime=2000",
+			code:     []int{200},
+			validate: func(dbs *sql.DB, r *httptest.ResponseRecorder, t *testing.T) error {
+				if !strings.Contains(r.Body.String(), `"exit_alias": "front-door"`) {
+					return errors.New("expected departure through front-door to be reported")
+				}
+				return nil
+			},
+		},
+		{
+			title:    "CSV report",
+			queryStr: "/inventory/reports/shrink?facility_id=test-facility&starttime=1000&endtime=2000&format=csv",
+			code:     []int{200},
+			validate: func(dbs *sql.DB, r *httptest.ResponseRecorder, t *testing.T) error {
+				if r.Header().Get("Content-Type") != "text/csv" {
+					return errors.Errorf("expected csv content type, received %s", r.Header().Get("Content-Type"))
+				}
+				if !strings.Contains(r.Body.String(), "00888446671424,test-facility,front-door,0,1") {
+					return errors.Errorf("expected csv row, received %s", r.Body.String())
+				}
+				return nil
+			},
+			destroy: deleteTag(epc),
+		},
+		{
+			title:    "Missing starttime",
+			queryStr: "/inventory/reports/shrink",
+			code:     []int{400},
+		},
+		{
+			title:    "Invalid endtime",
+			queryStr: "/inventory/reports/shrink?starttime=1000&endtime=500",
+			code:     []int{400},
+		},
+	}
+
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: ""}
+
+	handler := web.Handler(inventory.GetShrinkReport)
+
+	testHandlerHelper(shrinkTests, "GET", handler, testDB.DB, t)
+}
+
+func TestGetShippingNotice(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: ""}
+
+	if err := shippingnotice.Upsert(testDB.DB, shippingnotice.ShippingNotice{
+		ASNID:   "AS876422",
+		SiteID:  "test-facility",
+		Created: 1000,
+		EPCs:    []string{"30143639F84191AD22900204"},
+	}); err != nil {
+		t.Fatalf("Unable to insert shipping notice %s", err.Error())
+	}
+
+	for id, code := range map[string]int{"AS876422": http.StatusOK, "unknown": http.StatusNotFound} {
+		request, err := http.NewRequest("GET", "/inventory/asn/"+id, nil)
+		if err != nil {
+			t.Fatalf("Unable to create new HTTP request %s", err.Error())
+		}
+		request = mux.SetURLVars(request, map[string]string{"id": id})
+
+		recorder := httptest.NewRecorder()
+		web.Handler(inventory.GetShippingNotice).ServeHTTP(recorder, request)
+		if recorder.Code != code {
+			t.Errorf("Expected status code %d for %s, received %d", code, id, recorder.Code)
+		}
+	}
+
+	testCases := []inputTest{
+		{
+			title:    "List by site",
+			queryStr: "/inventory/asn?site_id=test-facility&starttime=0",
+			code:     []int{200},
+			validate: func(dbs *sql.DB, r *httptest.ResponseRecorder, t *testing.T) error {
+				if !strings.Contains(r.Body.String(), `"status": "open"`) {
+					return errors.New("expected open shipping notice")
+				}
+				return nil
+			},
+		},
+		{
+			title:    "Invalid starttime",
+			queryStr: "/inventory/asn?starttime=yesterday",
+			code:     []int{400},
+		},
+	}
+
+	testHandlerHelper(testCases, "GET", web.Handler(inventory.GetShippingNotices), testDB.DB, t)
+}
+
+func TestGetInventoryAsOf(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: ""}
+
+	epc := "30143639F84191AD22900204"
+	if err := insertTag(tag.Tag{
+		Epc:        epc,
+		FacilityID: "store001",
+		ProductID:  "00888446671424",
+		EpcState:   "present",
+		Arrived:    500,
+		LastRead:   500,
+	})(testDB.DB, t); err != nil {
+		t.Fatalf("Unable to insert tag %s", err.Error())
+	}
+	if _, err := snapshot.Take(testDB.DB, 1000, 0, true); err != nil {
+		t.Fatalf("Unable to take snapshot %s", err.Error())
+	}
+
+	testCases := []inputTest{
+		{
+			title:    "Counts with EPCs",
+			queryStr: "/inventory/query/asof?time=1500&facility_id=store001&epcs=true",
+			code:     []int{200},
+			validate: func(dbs *sql.DB, r *httptest.ResponseRecorder, t *testing.T) error {
+				var response snapshot.AsOfResponse
+				if err := json.Unmarshal(r.Body.Bytes(), &response); err != nil {
+					return err
+				}
+				if len(response.Results) != 1 || response.Results[0].Count != 1 ||
+					!reflect.DeepEqual(response.Results[0].EPCs, []string{epc}) {
+					return errors.Errorf("unexpected as-of inventory %+v", response.Results)
+				}
+				return nil
+			},
+		},
+		{
+			title:    "Before first snapshot",
+			queryStr: "/inventory/query/asof?time=900",
+			code:     []int{200},
+			validate: func(dbs *sql.DB, r *httptest.ResponseRecorder, t *testing.T) error {
+				if !strings.Contains(r.Body.String(), `"results": []`) {
+					return errors.New("expected no counts before the first snapshot")
+				}
+				return nil
+			},
+		},
+		{
+			title:    "Missing time",
+			queryStr: "/inventory/query/asof",
+			code:     []int{400},
+		},
+	}
+
+	testHandlerHelper(testCases, "GET", web.Handler(inventory.GetInventoryAsOf), testDB.DB, t)
+}
+
+func TestStockThresholds(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: ""}
+
+	putTests := []inputTest{
+		{
+			title: "Set threshold",
+			input: []byte(`[{"product_id":"00888446671424", "facility_id":"store001", "min_quantity":5}]`),
+			code:  []int{200},
+		},
+		{
+			title: "Negative minimum quantity",
+			input: []byte(`[{"product_id":"00888446671424", "facility_id":"store001", "min_quantity":-5}]`),
+			code:  []int{400},
+		},
+	}
+	testHandlerHelper(putTests, "PUT", web.Handler(inventory.PutStockThresholds), testDB.DB, t)
+
+	getTests := []inputTest{
+		{
+			title:    "By facility",
+			queryStr: "/inventory/stock/thresholds?facility_id=store001",
+			code:     []int{200},
+			validate: func(dbs *sql.DB, r *httptest.ResponseRecorder, t *testing.T) error {
+				if !strings.Contains(r.Body.String(), `"min_quantity": 5`) {
+					return errors.New("expected threshold of store001")
+				}
+				return nil
+			},
+		},
+	}
+	testHandlerHelper(getTests, "GET", web.Handler(inventory.GetStockThresholds), testDB.DB, t)
+
+	deleteTests := []struct {
+		query string
+		code  int
+	}{
+		{"product_id=00888446671424&facility_id=store001", http.StatusNoContent},
+		{"product_id=00888446671424&facility_id=store001", http.StatusNotFound},
+		{"product_id=00888446671424", http.StatusBadRequest},
+	}
+	for _, test := range deleteTests {
+		request, err := http.NewRequest("DELETE", "/inventory/stock/thresholds?"+test.query, nil)
+		if err != nil {
+			t.Fatalf("Unable to create new HTTP request %s", err.Error())
+		}
+
+		recorder := httptest.NewRecorder()
+		web.Handler(inventory.DeleteStockThreshold).ServeHTTP(recorder, request)
+		if recorder.Code != test.code {
+			t.Errorf("Expected status code %d for %s, received %d", test.code, test.query, recorder.Code)
+		}
+	}
+}
+
+func TestPostShippingNotices(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	epc := "30143639F84191AD22900204"
+
+	var shippingNoticeTests = []inputTest{
+		{
+			title: "ASN processed",
+			input: []byte(fmt.Sprintf(`[{"asnId": "AS876422", "eventTime": "2019-03-12T10:58:07.000Z", "siteId": "store001",
+				"items": [{"itemGtin": "00888446671424", "itemId": "16023361", "itemEpcs": ["%s"]}]}]`, epc)),
+			code: []int{200},
+			validate: func(dbs *sql.DB, r *httptest.ResponseRecorder, t *testing.T) error {
+				if !strings.Contains(r.Body.String(), `"status": "processed"`) {
+					return errors.New("expected ASN to be processed")
+				}
+				notice, err := shippingnotice.FindByID(dbs, "AS876422")
+				if err != nil {
+					return err
+				}
+				if len(notice.EPCs) != 1 || notice.EPCs[0] != epc {
+					return errors.Errorf("unexpected shipping notice %+v", notice)
+				}
+				return nil
+			},
+			destroy: deleteTag(epc),
+		},
+		{
+			title: "Missing site",
+			input: []byte(fmt.Sprintf(`[{"asnId": "AS876422", "eventTime": "2019-03-12T10:58:07.000Z",
+				"items": [{"itemGtin": "00888446671424", "itemId": "16023361", "itemEpcs": ["%s"]}]}]`, epc)),
+			code: []int{400},
+		},
+		{
+			title: "Empty request body",
+			input: []byte(``),
+			code:  []int{400},
+		},
+	}
+
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: ""}
+
+	handler := web.Handler(inventory.PostShippingNotices)
+
+	testHandlerHelper(shippingNoticeTests, "POST", handler, testDB.DB, t)
+}
+
+func TestGetDailyTurn(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: ""}
+
+	for _, facilityID := range []string{"store001", "store002"} {
+		if err := dailyturn.Upsert(testDB.DB, dailyturn.History{
+			ProductID:  "00888446671424",
+			FacilityID: facilityID,
+			DailyTurn:  0.025,
+			Records:    []dailyturn.Record{{Present: 90, Departed: 10, DailyTurn: 0.025, Timestamp: 2000}},
+			Timestamp:  2000,
+		}); err != nil {
+			t.Fatalf("Unable to insert daily turn history %s", err.Error())
+		}
+	}
+
+	testCases := []inputTest{
+		{
+			title:    "By product and facility",
+			queryStr: "/inventory/dailyturn?product_id=00888446671424&facility_id=store002",
+			code:     []int{200},
+			validate: func(dbs *sql.DB, r *httptest.ResponseRecorder, t *testing.T) error {
+				var response struct {
+					Results []dailyturn.History `json:"results"`
+				}
+				if err := json.Unmarshal(r.Body.Bytes(), &response); err != nil {
+					return err
+				}
+				if len(response.Results) != 1 || response.Results[0].FacilityID != "store002" ||
+					len(response.Results[0].Records) != 1 {
+					return errors.Errorf("expected the history of store002, got %+v", response.Results)
+				}
+				return nil
+			},
+		},
+		{
+			title:    "Records outside time window",
+			queryStr: "/inventory/dailyturn?product_id=00888446671424&starttime=3000",
+			code:     []int{200},
+			validate: func(dbs *sql.DB, r *httptest.ResponseRecorder, t *testing.T) error {
+				if !strings.Contains(r.Body.String(), `"records": []`) {
+					return errors.New("expected records to be filtered by time window")
+				}
+				return nil
+			},
+		},
+		{
+			title:    "Invalid endtime",
+			queryStr: "/inventory/dailyturn?starttime=3000&endtime=2000",
+			code:     []int{400},
+		},
+	}
+
+	testHandlerHelper(testCases, "GET", web.Handler(inventory.GetDailyTurn), testDB.DB, t)
+}
+
+func validateHandheldReads(processor *fakeProcessor, epc string, facility string) validateFunc {
+	return func(dbs *sql.DB, r *httptest.ResponseRecorder, t *testing.T) error {
+		if processor.source != handheldSource {
+			return errors.Errorf("expected source %s, received %s", handheldSource, processor.source)
+		}
+		if len(processor.events) != 1 || len(processor.events[0].Params.Data) != 1 {
+			return errors.New("expected a single event with a single tag read")
+		}
+		if processor.events[0].Params.Data[0].FacilityID != facility {
+			return errors.Errorf("expected facility %s, received %s",
+				facility, processor.events[0].Params.Data[0].FacilityID)
+		}
+
+		var response struct {
+			Results []tag.HandheldReadResult `json:"results"`
+		}
+		if err := json.Unmarshal(r.Body.Bytes(), &response); err != nil {
+			return err
+		}
+		if len(response.Results) != 1 {
+			return errors.Errorf("expected 1 result, received %d", len(response.Results))
+		}
+		if response.Results[0].Epc != epc || response.Results[0].Status != handheldReadProcessed {
+			return errors.Errorf("unexpected result %+v", response.Results[0])
+		}
+		return nil
+	}
+}
+
+func TestMapRequestToOdata(t *testing.T) {
+	var requestBody = tag.RequestBody{
+		QualifiedState: "sold",
+		FacilityID:     "store001",
+		EpcState:       "sold",
+		ProductID:      "12345678978945",
+		Time:           1483228800000,
+		StartTime:      1482624000000,
+		EndTime:        1483228800000,
+		Confidence:     0.75,
+		CountOnly:      false,
+	}
+
+	requestBody.CountOnly = false
+
+	actualMap := make(map[string][]string)
+	filterArray := []string{"facility_id eq 'store001' and qualified_state eq 'sold' and epc_state eq 'sold'" +
+		" and confidence ge 0.75 and productId eq '12345678978945' and last_read ge 1482624000000" +
+		" and last_read le 1483228800000 and last_read le 1483228800000"}
+	expectedMap := map[string][]string{
+		"$filter": filterArray,
+	}
+	actualMap = mapRequestToOdata(actualMap, &requestBody)
+	if !reflect.DeepEqual(actualMap, expectedMap) {
+		t.Errorf("Actual map is %v but got %v", actualMap, expectedMap)
+	}
+
+	requestBody.CountOnly = true
+
+	expectedMap["$inlinecount"] = []string{"allpages"}
+	actualMap = make(map[string][]string)
+	actualMap = mapRequestToOdata(actualMap, &requestBody)
+	if !reflect.DeepEqual(actualMap, expectedMap) {
+		t.Errorf("Actual map is %v but got %v", actualMap, expectedMap)
+	}
+}
+
+func TestMapEpcRequestToOdata(t *testing.T) {
+	var requestBody = tag.RequestBody{
+		FacilityID: "store001",
+		Epc:        "0123456",
+	}
+	compareMaps(t, []string{"facility_id eq 'store001' and epc eq '0123456'"}, &requestBody)
+
+	requestBody.Epc = "*0123456"
+	compareMaps(t, []string{"facility_id eq 'store001' and endswith(epc, '0123456')"}, &requestBody)
+
+	requestBody.Epc = "0123456*"
+	compareMaps(t, []string{"facility_id eq 'store001' and startswith(epc, '0123456')"}, &requestBody)
+
+	requestBody.Epc = "0123*456"
+	compareMaps(t, []string{"facility_id eq 'store001' and startswith(epc, '0123') and endswith(epc, '456')"},
+		&requestBody)
+}
+
+func TestMapHostileRequestToOdata(t *testing.T) {
+	var requestBody = tag.RequestBody{
+		FacilityID:     "store001' or facility_id ne '",
+		QualifiedState: "sold') or (qualified_state ne 'sold",
+		ProductID:      "'",
+		Epc:            "30%*' or epc ne '",
+	}
+	compareMaps(t, []string{`facility_id eq 'store001'' or facility_id ne ''' and qualified_state eq 'sold'') or (qualified_state ne ''sold'` +
+		` and productId eq '''' and startswith(epc, '30\%') and endswith(epc, ''' or epc ne ''')`}, &requestBody)
+}
+
+func compareMaps(t *testing.T, filterStrings []string, requestBody *tag.RequestBody) {
+	expectedMap := map[string][]string{
+		"$filter": filterStrings,
+	}
+	actualMap := make(map[string][]string)
+	actualMap = mapRequestToOdata(actualMap, requestBody)
+	if !reflect.DeepEqual(actualMap, expectedMap) {
+		t.Errorf("Actual map is %v but got %v", actualMap, expectedMap)
+	}
+}
+
+func TestSearchByEpcPositive(t *testing.T) {
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		time.Sleep(1 * time.Second)
+		if request.URL.EscapedPath() != "/skus" {
+			t.Errorf("Expected request to be '/skus', received %s",
+				request.URL.EscapedPath())
+		}
+		if request.Method != "GET" {
+			t.Errorf("Expected 'GET' request, received '%s", request.Method)
+		}
+		var jsonData []byte
+		if request.URL.EscapedPath() == "/skus" {
+			result := buildProductData(0.2, 0.75, 0.2, 0.1, "00111111")
+			jsonData, _ = json.Marshal(result)
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write(jsonData)
+	}))
+
+	defer testServer.Close()
+
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	var searchEpcTests = []inputTest{
+		{
+			input: []byte(`{
+						"facility_id":"store001",
+						"epc":"00012345678905",
+						"size":500
+						}`),
+			code: []int{200, 204},
+		},
+		{
+			input: []byte(`{
+						"facility_id":"store001",
+						"epc":"000123*45678905",
+						"size":500
+						}`),
+			code: []int{200, 204},
+		},
+		{
+			input: []byte(`{
+						"facility_id":"store001",
+						"epc":"*00012345678905",
+						"size":500
+						}`),
+			code: []int{200, 204},
+		},
+		{
+			input: []byte(`{
+						"facility_id":"store001",
+						"epc":"00012345678905*",
+						"size":500
+						}`),
+			code: []int{200, 204},
+		},
+	}
+
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: testServer.URL + "/skus"}
+
+	handler := web.Handler(inventory.GetSearchByEpc)
+
+	testHandlerHelper(searchEpcTests, "POST", handler, testDB.DB, t)
+}
+
+// nolint :dupl
+func TestSearchByEpcNegative(t *testing.T) {
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		time.Sleep(1 * time.Second)
+		if request.URL.EscapedPath() != "/skus" {
+			t.Errorf("Expected request to be '/skus', received %s",
+				request.URL.EscapedPath())
+		}
+		if request.Method != "GET" {
+			t.Errorf("Expected 'GET' request, received '%s", request.Method)
+		}
+		var jsonData []byte
+		if request.URL.EscapedPath() == "/skus" {
+			result := buildProductData(0.2, 0.75, 0.2, 0.1, "00111111")
+			jsonData, _ = json.Marshal(result)
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write(jsonData)
+	}))
+
+	defer testServer.Close()
+
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	var searchEpcTests = []inputTest{
+		// No facility id
+		{
+			input: []byte(`{
+					"size":500,
+					"epc":"0001*"
+					}`),
+			code: []int{400},
+		},
+		// Empty request body
+		{
+			input: []byte(``),
+			code:  []int{400},
+		},
+		// Invalid input type for facility_id
+		{
+			input: []byte(`{ "facility_id":10 }`),
+			code:  []int{400},
+		},
+		// No EPC field
+		{
+			input: []byte(`{ "facility_id":"store1" }`),
+			code:  []int{400},
+		},
+		// Invalid characters in EPC field
+		{
+			input: []byte(`{
+					"size":500,
+					"epc":"0GHI-$",
+					"facility_id":"store1"
+					}`),
+			code: []int{400},
+		},
+		// More than one '*'
+		{
+			input: []byte(`{
+					"size":500,
+					"epc":"*01234*",
+					"facility_id":"store1"
+					}`),
+			code: []int{400},
+		},
+	}
+
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: testServer.URL + "/skus"}
+
+	handler := web.Handler(inventory.GetSearchByEpc)
+
+	testHandlerHelper(searchEpcTests, "POST", handler, testDB.DB, t)
+}
+
+func TestUpdateCoefficientsPositive(t *testing.T) {
+
+	var searchGtinTests = []inputTest{
+		{
+			input: []byte(`{
+					"facility_id":"Tavern",
+					"dailyinventorypercentage":0.30,
+					"probunreadtoread":0.30,
+					"probinstoreread":0.30,
+					"probexiterror": 0.30
+				  }`),
+			code: []int{200, 404},
+		},
+	}
+
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: ""}
 	handler := web.Handler(inventory.UpdateCoefficients)
 
 	testHandlerHelper(searchGtinTests, "PUT", handler, testDB.DB, t)
@@ -1137,7 +1923,7 @@ func TestUpdateCoefficientsNegative(t *testing.T) {
 	testDB := dbHost.CreateDB(t)
 	defer testDB.Close()
 
-	inventory := Inventory{testDB.DB, config.AppConfig.ResponseLimit, ""}
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: ""}
 	handler := web.Handler(inventory.UpdateCoefficients)
 
 	testHandlerHelper(searchGtinTests, "PUT", handler, testDB.DB, t)
@@ -1181,7 +1967,7 @@ func TestSetEpcContext(t *testing.T) {
 		},
 	}
 
-	inventory := Inventory{testDB.DB, config.AppConfig.ResponseLimit, ""}
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: ""}
 
 	handler := web.Handler(inventory.SetEpcContext)
 
@@ -1189,6 +1975,120 @@ func TestSetEpcContext(t *testing.T) {
 
 }
 
+func TestBulkUpdates(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	epcs := []string{"100683590000000000001106", "100683590000000000001107", "100683590000000000001108"}
+	facility := "test-facility"
+
+	setup := func(db *sql.DB, t *testing.T) error {
+		return tag.Replace(db, []tag.Tag{
+			{Epc: epcs[0], FacilityID: facility, QualifiedState: "received"},
+			{Epc: epcs[1], FacilityID: facility, QualifiedState: "received"},
+			{Epc: epcs[2], FacilityID: "other-facility", QualifiedState: "received"},
+		})
+	}
+	validateAffected := func(expected int64, dryRun bool) validateFunc {
+		return func(_ *sql.DB, r *httptest.ResponseRecorder, _ *testing.T) error {
+			var response tag.BulkUpdateResponse
+			if err := json.Unmarshal(r.Body.Bytes(), &response); err != nil {
+				return err
+			}
+			if response.Affected != expected || response.DryRun != dryRun {
+				return fmt.Errorf("expected %d tags affected with dry_run %t, got %+v", expected, dryRun, response)
+			}
+			return nil
+		}
+	}
+	validateQualifiedState := func(epc string, expected string) validateFunc {
+		return func(db *sql.DB, _ *httptest.ResponseRecorder, _ *testing.T) error {
+			tagInDb, err := tag.FindByEpc(db, epc)
+			if err != nil {
+				return err
+			}
+			if tagInDb.QualifiedState != expected {
+				return fmt.Errorf("expected qualified state %s of %s, got %s", expected, epc, tagInDb.QualifiedState)
+			}
+			return nil
+		}
+	}
+
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: ""}
+
+	qualifiedStateTests := []inputTest{
+		{
+			title: "Dry run",
+			setup: setup,
+			input: []byte(fmt.Sprintf(`{"facility_id": "%s", "epcs": ["%s", "%s", "%s"], "qualified_state": "damaged", "dry_run": true}`,
+				facility, epcs[0], epcs[1], epcs[2])),
+			code: []int{200},
+			validate: validateAll([]validateFunc{
+				validateAffected(2, true),
+				validateQualifiedState(epcs[0], "received"),
+			}),
+			destroy: deleteAllTags(),
+		},
+		{
+			title: "By EPC",
+			setup: setup,
+			input: []byte(fmt.Sprintf(`{"facility_id": "%s", "epcs": ["%s", "%s", "%s"], "qualified_state": "damaged"}`,
+				facility, epcs[0], epcs[1], epcs[2])),
+			code: []int{200},
+			validate: validateAll([]validateFunc{
+				validateAffected(2, false),
+				validateQualifiedState(epcs[0], "damaged"),
+				validateQualifiedState(epcs[1], "damaged"),
+				validateQualifiedState(epcs[2], "received"),
+			}),
+			destroy: deleteAllTags(),
+		},
+		{
+			title: "By filter",
+			setup: setup,
+			input: []byte(fmt.Sprintf(`{"facility_id": "%s", "filter": "endswith(epc, '1107') or endswith(epc, '1108')", "qualified_state": "damaged"}`,
+				facility)),
+			code: []int{200},
+			validate: validateAll([]validateFunc{
+				validateAffected(1, false),
+				validateQualifiedState(epcs[0], "received"),
+				validateQualifiedState(epcs[1], "damaged"),
+				validateQualifiedState(epcs[2], "received"),
+			}),
+			destroy: deleteAllTags(),
+		},
+		{
+			title: "Invalid filter",
+			input: []byte(fmt.Sprintf(`{"facility_id": "%s", "filter": "epc eq", "qualified_state": "damaged"}`, facility)),
+			code:  []int{400},
+		},
+		{
+			title: "EPCs and filter",
+			input: []byte(fmt.Sprintf(`{"facility_id": "%s", "epcs": ["%s"], "filter": "epc_state eq 'present'", "qualified_state": "damaged"}`,
+				facility, epcs[0])),
+			code: []int{400},
+		},
+	}
+	testHandlerHelper(qualifiedStateTests, "PUT", web.Handler(inventory.BulkUpdateQualifiedState), testDB.DB, t)
+
+	epcContextTests := []inputTest{
+		{
+			title: "Set context",
+			setup: setup,
+			input: []byte(fmt.Sprintf(`{"facility_id": "%s", "epcs": ["%s", "%s"], "epc_context": "it's returned"}`,
+				facility, epcs[0], epcs[1])),
+			code: []int{200},
+			validate: validateAll([]validateFunc{
+				validateAffected(2, false),
+				validateEpcContextSet(epcs[0], "it's returned"),
+				validateEpcContextSet(epcs[1], "it's returned"),
+			}),
+			destroy: deleteAllTags(),
+		},
+	}
+	testHandlerHelper(epcContextTests, "PUT", web.Handler(inventory.BulkSetEpcContext), testDB.DB, t)
+}
+
 func TestDeleteEpcContext(t *testing.T) {
 	testDB := dbHost.CreateDB(t)
 	defer testDB.Close()
@@ -1215,7 +2115,7 @@ func TestDeleteEpcContext(t *testing.T) {
 		},
 	}
 
-	inventory := Inventory{testDB.DB, config.AppConfig.ResponseLimit, ""}
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: ""}
 
 	handler := web.Handler(inventory.DeleteEpcContext)
 
@@ -1249,9 +2149,428 @@ func TestDeleteAllTags(t *testing.T) {
 		},
 	}
 
-	inventory := Inventory{testDB.DB, config.AppConfig.ResponseLimit, ""}
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: ""}
 
 	handler := web.Handler(inventory.DeleteAllTags)
 
 	testHandlerHelper(deleteAllTagTests, "DELETE", handler, testDB.DB, t)
 }
+
+func TestGetEventStream(t *testing.T) {
+	inventory := Inventory{}
+	server := httptest.NewServer(web.Handler(inventory.GetEventStream))
+	defer server.Close()
+
+	departed := tag.Tag{Epc: "30143639F84191AD22900204", FacilityID: "test-facility", Event: "departed"}
+	arrived := tag.Tag{Epc: "30143639F84191AD66100107", FacilityID: "test-facility", Event: "arrival"}
+
+	// Server-Sent Events
+	response, err := http.Get(server.URL + "?facility_id=test-facility&event=departed")
+	if err != nil {
+		t.Fatalf("Unable to connect to event stream: %s", err.Error())
+	}
+	defer response.Body.Close()
+	if contentType := response.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("Expected content type text/event-stream, received %s", contentType)
+	}
+
+	eventstream.Publish([]tag.Tag{arrived, departed})
+
+	reader := bufio.NewReader(response.Body)
+	var event tag.Tag
+	for event.Epc == "" {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Error reading event stream: %s", err.Error())
+		}
+		if strings.HasPrefix(line, "data: ") {
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+				t.Fatalf("Error unmarshaling event: %s", err.Error())
+			}
+		}
+	}
+	if event.Epc != departed.Epc {
+		t.Errorf("Expected filtered event for %s, received %s", departed.Epc, event.Epc)
+	}
+
+	// WebSocket
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "?epc_prefix=30143639F84191AD66"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Unable to connect to event stream WebSocket: %s", err.Error())
+	}
+	defer conn.Close()
+
+	eventstream.Publish([]tag.Tag{departed, arrived})
+
+	event = tag.Tag{}
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatalf("Error receiving event: %s", err.Error())
+	}
+	if event.Epc != arrived.Epc {
+		t.Errorf("Expected filtered event for %s, received %s", arrived.Epc, event.Epc)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: ""}
+
+	testCases := []inputTest{
+		{
+			title: "Create webhook",
+			input: []byte(`{"url":"http://localhost:8080/events", "events":["departed"], "facility_ids":["test-facility"]}`),
+			code:  []int{201},
+			validate: func(dbs *sql.DB, r *httptest.ResponseRecorder, t *testing.T) error {
+				var subscription webhook.Subscription
+				if err := json.Unmarshal(r.Body.Bytes(), &subscription); err != nil {
+					return err
+				}
+				if subscription.ID == "" || subscription.Secret == "" || !subscription.Enabled {
+					return errors.Errorf("expected an enabled webhook with a generated secret, received %+v", subscription)
+				}
+				return nil
+			},
+		},
+		{
+			title: "Unknown event type",
+			input: []byte(`{"url":"http://localhost:8080/events", "events":["shipped"]}`),
+			code:  []int{400},
+		},
+	}
+	testHandlerHelper(testCases, "POST", web.Handler(inventory.PostWebhook), testDB.DB, t)
+
+	subscriptions, err := webhook.FindAll(testDB.DB)
+	if err != nil || len(subscriptions) != 1 {
+		t.Fatalf("Expected a single webhook, received %+v %v", subscriptions, err)
+	}
+	id := subscriptions[0].ID
+
+	request, err := http.NewRequest("PUT", "/inventory/webhooks/"+id,
+		bytes.NewBufferString(`{"url":"http://localhost:8080/events", "events":["departed","arrival"], "enabled":false}`))
+	if err != nil {
+		t.Fatalf("Unable to create new HTTP request %s", err.Error())
+	}
+	recorder := httptest.NewRecorder()
+	web.Handler(inventory.PutWebhook).ServeHTTP(recorder, mux.SetURLVars(request, map[string]string{"id": id}))
+	if recorder.Code != http.StatusOK || strings.Contains(recorder.Body.String(), "secret") {
+		t.Errorf("Expected the webhook to be updated without returning its secret, received %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	updated, err := webhook.FindByID(testDB.DB, id)
+	if err != nil || updated.Enabled || len(updated.Events) != 2 || updated.Secret != subscriptions[0].Secret {
+		t.Errorf("Expected the webhook to be disabled with its secret kept, received %+v %v", updated, err)
+	}
+
+	deliveryTests := map[string]int{
+		"/inventory/webhooks/" + id + "/deliveries":                http.StatusOK,
+		"/inventory/webhooks/" + id + "/deliveries?status=unknown": http.StatusBadRequest,
+		"/inventory/webhooks/" + id + "/deliveries?limit=0":        http.StatusBadRequest,
+		"/inventory/webhooks/unknown/deliveries":                   http.StatusNotFound,
+	}
+	for url, code := range deliveryTests {
+		request, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatalf("Unable to create new HTTP request %s", err.Error())
+		}
+		webhookID := strings.Split(url, "/")[3]
+
+		recorder := httptest.NewRecorder()
+		web.Handler(inventory.GetWebhookDeliveries).ServeHTTP(recorder, mux.SetURLVars(request, map[string]string{"id": webhookID}))
+		if recorder.Code != code {
+			t.Errorf("Expected status code %d for %s, received %d", code, url, recorder.Code)
+		}
+	}
+}
+
+func TestFacilityManagement(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: ""}
+
+	testCases := []inputTest{
+		{
+			title: "Create facility",
+			input: []byte(`{"name":"store001", "display_name":"Store 1", "time_zone":"America/Los_Angeles"}`),
+			code:  []int{201},
+			validate: func(dbs *sql.DB, r *httptest.ResponseRecorder, t *testing.T) error {
+				created, err := facility.Find(dbs, "store001")
+				if err != nil {
+					return err
+				}
+				if created.Coefficients.ProbExitError != config.AppConfig.ProbExitError {
+					return errors.Errorf("expected the configured coefficients, received %+v", created.Coefficients)
+				}
+				return nil
+			},
+		},
+		{
+			title: "Facility already exists",
+			input: []byte(`{"name":"store001"}`),
+			code:  []int{409},
+		},
+		{
+			title: "Unknown time zone",
+			input: []byte(`{"name":"store002", "time_zone":"Mars/Olympus_Mons"}`),
+			code:  []int{400},
+		},
+	}
+	testHandlerHelper(testCases, "POST", web.Handler(inventory.PostFacility), testDB.DB, t)
+
+	if err := insertTag(tag.Tag{Epc: "30143639F8419105417AED6F", FacilityID: "store001"})(testDB.DB, t); err != nil {
+		t.Fatalf("Unable to insert tag %s", err.Error())
+	}
+
+	facilityTests := []struct {
+		method  string
+		handler web.Handler
+		url     string
+		body    string
+		code    int
+	}{
+		{"PUT", inventory.PutFacility, "/inventory/facilities/store001", `{"display_name":"Hillsboro Store"}`, http.StatusOK},
+		{"PUT", inventory.PutFacility, "/inventory/facilities/store001", `{"time_zone":"Local"}`, http.StatusBadRequest},
+		{"PUT", inventory.PutFacility, "/inventory/facilities/unknown", `{"display_name":"Unknown"}`, http.StatusNotFound},
+		{"GET", inventory.GetFacility, "/inventory/facilities/store001", "", http.StatusOK},
+		{"GET", inventory.GetFacility, "/inventory/facilities/unknown", "", http.StatusNotFound},
+		{"DELETE", inventory.DeleteFacility, "/inventory/facilities/store001", "", http.StatusConflict},
+		{"DELETE", inventory.DeleteFacility, "/inventory/facilities/store001?cascade=maybe", "", http.StatusBadRequest},
+		{"DELETE", inventory.DeleteFacility, "/inventory/facilities/store001?cascade=true", "", http.StatusNoContent},
+		{"GET", inventory.GetFacility, "/inventory/facilities/store001", "", http.StatusNotFound},
+	}
+	for _, test := range facilityTests {
+		request, err := http.NewRequest(test.method, test.url, bytes.NewBufferString(test.body))
+		if err != nil {
+			t.Fatalf("Unable to create new HTTP request %s", err.Error())
+		}
+		facilityID := strings.Split(strings.Split(test.url, "?")[0], "/")[3]
+
+		recorder := httptest.NewRecorder()
+		test.handler.ServeHTTP(recorder, mux.SetURLVars(request, map[string]string{"facilityId": facilityID}))
+		if recorder.Code != test.code {
+			t.Errorf("Expected status code %d for %s %s, received %d %s", test.code, test.method, test.url, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	if deleted, err := tag.FindByEpc(testDB.DB, "30143639F8419105417AED6F"); err != nil || deleted.Epc != "" {
+		t.Errorf("Expected the tags of the facility to be deleted, received %+v %v", deleted, err)
+	}
+}
+
+func TestSensors(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	inventory := Inventory{MasterDB: testDB.DB, MaxSize: config.AppConfig.ResponseLimit, Url: ""}
+
+	if err := sensor.Upsert(testDB.DB, sensor.NewRSP("RSP-150000")); err != nil {
+		t.Fatalf("Unable to insert sensor %s", err.Error())
+	}
+	for _, reads := range []int{3, 4} {
+		sensor.RecordInventoryData("RSP-150000", reads, 1501863300375)
+	}
+	if err := sensor.FlushInventoryData(testDB.DB); err != nil {
+		t.Fatalf("Unable to flush inventory_data %s", err.Error())
+	}
+	// upserting the sensor configuration keeps the statistics
+	if err := sensor.Upsert(testDB.DB, sensor.NewRSP("RSP-150000")); err != nil {
+		t.Fatalf("Unable to update sensor %s", err.Error())
+	}
+
+	request, err := http.NewRequest("GET", "/inventory/sensors", nil)
+	if err != nil {
+		t.Fatalf("Unable to create new HTTP request %s", err.Error())
+	}
+	recorder := httptest.NewRecorder()
+	web.Handler(inventory.GetSensors).ServeHTTP(recorder, request)
+
+	var response struct {
+		Results []sensor.Status `json:"results"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Unable to unmarshal sensors %s", err.Error())
+	}
+	if len(response.Results) != 1 {
+		t.Fatalf("Expected a single sensor, received %+v", response.Results)
+	}
+	status := response.Results[0]
+	if status.DeviceId != "RSP-150000" || status.LastInventoryData != 1501863300375 ||
+		status.InventoryDataCount != 2 || status.ReadCount != 7 {
+		t.Errorf("Expected the inventory_data statistics of the sensor, received %+v", status)
+	}
+
+	// the RSP Controller cannot be reached through the core command service
+	coreCommand := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer coreCommand.Close()
+	coreCommandURL := config.AppConfig.CoreCommandUrl
+	config.AppConfig.CoreCommandUrl = coreCommand.URL
+	defer func() { config.AppConfig.CoreCommandUrl = coreCommandURL }()
+
+	sensorTests := []struct {
+		method   string
+		handler  web.Handler
+		deviceID string
+		code     int
+	}{
+		{"GET", inventory.GetSensor, "RSP-150000", http.StatusOK},
+		{"GET", inventory.GetSensor, "RSP-999999", http.StatusNotFound},
+		{"POST", inventory.RefreshSensor, "RSP-150000", http.StatusBadGateway},
+		{"POST", inventory.RefreshSensor, "RSP-999999", http.StatusNotFound},
+	}
+	for _, test := range sensorTests {
+		request, err := http.NewRequest(test.method, "/inventory/sensors/"+test.deviceID, nil)
+		if err != nil {
+			t.Fatalf("Unable to create new HTTP request %s", err.Error())
+		}
+
+		recorder := httptest.NewRecorder()
+		test.handler.ServeHTTP(recorder, mux.SetURLVars(request, map[string]string{"deviceId": test.deviceID}))
+		if recorder.Code != test.code {
+			t.Errorf("Expected status code %d for %s %s, received %d %s", test.code, test.method, test.deviceID, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+type pipelineMonitorMock health.Pipeline
+
+func (pipeline pipelineMonitorMock) PipelineStatus() health.Pipeline {
+	return health.Pipeline(pipeline)
+}
+
+func TestHealth(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	inventory := Inventory{
+		MasterDB: testDB.DB,
+		MaxSize:  config.AppConfig.ResponseLimit,
+		Pipeline: pipelineMonitorMock{SdkContextGrabbed: true, EventQueueDepth: 2, EventQueueCapacity: 10},
+	}
+
+	notGrabbed := inventory
+	notGrabbed.Pipeline = pipelineMonitorMock{EventQueueCapacity: 10}
+
+	requiredServices := config.AppConfig.HealthRequiredServices
+	defer func() { config.AppConfig.HealthRequiredServices = requiredServices }()
+
+	healthTests := []struct {
+		title            string
+		handler          web.Handler
+		requiredServices []string
+		code             int
+		status           string
+		checks           bool
+	}{
+		{"Live", inventory.GetLiveness, nil, http.StatusOK, health.StatusUp, false},
+		{"Ready", inventory.GetReadiness, nil, http.StatusOK, health.StatusUp, true},
+		{"Required service not known", inventory.GetReadiness, []string{"unknown"}, http.StatusServiceUnavailable, health.StatusDown, true},
+		{"Pipeline down", notGrabbed.GetReadiness, nil, http.StatusServiceUnavailable, health.StatusDown, false},
+	}
+	for _, test := range healthTests {
+		config.AppConfig.HealthRequiredServices = test.requiredServices
+
+		request, err := http.NewRequest("GET", "/health", nil)
+		if err != nil {
+			t.Fatalf("Unable to create new HTTP request %s", err.Error())
+		}
+		recorder := httptest.NewRecorder()
+		test.handler.ServeHTTP(recorder, request)
+
+		var report health.Report
+		if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+			t.Fatalf("%s: unable to unmarshal report %s", test.title, err.Error())
+		}
+		if recorder.Code != test.code || report.Status != test.status {
+			t.Errorf("%s: expected %d %s, received %d %s", test.title, test.code, test.status, recorder.Code, recorder.Body.String())
+		}
+		if !test.checks {
+			continue
+		}
+		if report.Pipeline == nil || !report.Pipeline.SdkContextGrabbed || report.Pipeline.EventQueueDepth != 2 || report.Checks[0].Name != "database" {
+			t.Errorf("%s: expected the database and pipeline to be reported, received %s", test.title, recorder.Body.String())
+		}
+	}
+}
+
+func TestGetMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	metrics.GetOrRegisterGauge("Inventory.GetTags.Attempt", registry).Update(1)
+
+	metricsTests := []struct {
+		title    string
+		exporter *prometheus.Exporter
+		code     int
+	}{
+		{"Disabled", nil, http.StatusNotFound},
+		{"Enabled", prometheus.NewExporter(registry, true), http.StatusOK},
+	}
+	for _, test := range metricsTests {
+		inventory := Inventory{MetricsExporter: test.exporter}
+
+		request, err := http.NewRequest("GET", "/metrics", nil)
+		if err != nil {
+			t.Fatalf("Unable to create new HTTP request %s", err.Error())
+		}
+		recorder := httptest.NewRecorder()
+		web.Handler(inventory.GetMetrics).ServeHTTP(recorder, request)
+
+		if recorder.Code != test.code {
+			t.Errorf("%s: expected status code %d, received %d", test.title, test.code, recorder.Code)
+		}
+		if test.code == http.StatusOK && (recorder.Header().Get("Content-Type") != prometheus.ContentType ||
+			!strings.Contains(recorder.Body.String(), "inventory_gettags_attempt 1\n")) {
+			t.Errorf("%s: expected the metrics in the Prometheus text format, received %s", test.title, recorder.Body.String())
+		}
+	}
+}
+
+func TestPostDecode(t *testing.T) {
+	decoders := config.AppConfig.TagDecoders
+	defer func() { config.AppConfig.TagDecoders = decoders }()
+	config.AppConfig.TagDecoders = []encodingscheme.TagDecoder{encodingscheme.NewSGTINDecoder(true)}
+
+	validateResults := func(dbs *sql.DB, recorder *httptest.ResponseRecorder, t *testing.T) error {
+		var response struct {
+			Results []tag.DecodeResult `json:"results"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			return err
+		}
+		if len(response.Results) != 2 {
+			return errors.Errorf("expected 2 results, received %d", len(response.Results))
+		}
+		if decoded := response.Results[0]; decoded.Decoder == "" || decoded.ProductID != "00039307597746" ||
+			decoded.FilterValue == nil || *decoded.FilterValue != 1 {
+			return errors.Errorf("expected the first EPC to be decoded, received %+v", decoded)
+		}
+		if invalid := response.Results[1]; invalid.Decoder != "" || len(invalid.Errors) == 0 {
+			return errors.Errorf("expected the second EPC to be reported as invalid, received %+v", invalid)
+		}
+		return nil
+	}
+
+	decodeTests := []inputTest{
+		{
+			title:    "Decode valid and invalid EPCs",
+			input:    []byte(`{"epcs":["303402662C3A5F904C19939D", "0F00000000000C00000014D2"]}`),
+			code:     []int{http.StatusOK},
+			validate: validateResults,
+		},
+		{
+			title: "Empty EPC list",
+			input: []byte(`{"epcs":[]}`),
+			code:  []int{http.StatusBadRequest},
+		},
+	}
+
+	inventory := Inventory{}
+	testHandlerHelper(decodeTests, "POST", inventory.PostDecode, nil, t)
+}
@@ -11,10 +11,12 @@ import (
 	"database/sql"
 	"encoding/json"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/cloudconnector/event"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/jsonrpc"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/odatafilter"
 	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/helper"
 	"io"
 	"net/http"
-	"plugin"
 	"reflect"
 	"strconv"
 	"strings"
@@ -27,6 +29,7 @@ import (
 
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/config"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/facility"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/health"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/routes/schemas"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/tag"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/web"
@@ -35,6 +38,23 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	handheldSource        = "handheld"
+	handheldEncodeFormat  = "tbd"
+	handheldReadProcessed = "processed"
+	handheldReadFiltered  = "filtered"
+	reportFormatJSON      = "json"
+	reportFormatCSV       = "csv"
+	// exportBatchSize is the number of tags confidence is applied to and written at once
+	exportBatchSize = 500
+	// eventStreamKeepAlive is how long an event stream stays idle before a keep-alive is sent
+	eventStreamKeepAlive = 15 * time.Second
+	// eventStreamWriteTimeout is how long sending an event to a WebSocket client may take
+	eventStreamWriteTimeout = 10 * time.Second
+	// webhookDeliveriesLimit is the default number of deliveries returned per webhook
+	webhookDeliveriesLimit = 100
+)
+
 // ApplyConfidence calculates the confidence to each tag using the facility coefficients
 // this function can be reused by endpoints with odata for multiple facilities
 func ApplyConfidence(session *sql.DB, tags []tag.Tag, url string) error {
@@ -43,109 +63,155 @@ func ApplyConfidence(session *sql.DB, tags []tag.Tag, url string) error {
 		return nil
 	}
 
+	coefficients, err := loadCoefficients(session, url)
+	if err != nil {
+		return err
+	}
+	coefficients.apply(session, tags)
+	return nil
+}
+
+// coefficients are the facility and product coefficients confidence is calculated from,
+// loaded once and applied to any number of batches of tags
+type coefficients struct {
+	facilities     map[string]facility.Facility
+	productDataMap map[string]productdata.ProductMetadata
+}
+
+func loadCoefficients(session *sql.DB, url string) (coefficients, error) {
 	// Getting coefficients from database by facilityID
 	facilities, err := facility.CreateFacilityMap(session)
 	if err != nil {
-		return err
+		return coefficients{}, err
 	}
 
 	// Getting coefficients for gtin from sku-mapping service
-	productDataMap, err := productdata.CreateProductDataMap(url)
+	productDataMap, err := productdata.GetProductDataMap(url)
 	if err != nil {
-		return err
+		return coefficients{}, err
 	}
 
+	return coefficients{facilities: facilities, productDataMap: productDataMap}, nil
+}
+
+// apply calculates the confidence of each tag
+func (coefficients coefficients) apply(session *sql.DB, tags []tag.Tag) {
 	// Create lookup map for computed daily turn values
 	var computedDailyTurnMap map[string]dailyturn.History
 	if config.AppConfig.UseComputedDailyTurnInConfidence {
 		computedDailyTurnMap = dailyturn.CreateHistoryMap(session, tags)
 	}
 
-	var dailyInvPerc float64
-	var probUnreadToRead float64
-	var probInStore float64
-	var probExitError float64
-
 	for i := 0; i < len(tags); i++ {
-		// Get coefficients
-		facilityID := tags[i].FacilityID
-		tagFacility, foundFacility := facilities[facilityID]
-		lastRead := tags[i].LastRead
-		if foundFacility {
-			dailyInvPerc = tagFacility.Coefficients.DailyInventoryPercentage
-			probUnreadToRead = tagFacility.Coefficients.ProbUnreadToRead
-			probInStore = tagFacility.Coefficients.ProbInStoreRead
-			probExitError = tagFacility.Coefficients.ProbExitError
-		} else {
-			dailyInvPerc = config.AppConfig.DailyInventoryPercentage
-			probUnreadToRead = config.AppConfig.ProbUnreadToRead
-			probInStore = config.AppConfig.ProbInStoreRead
-			probExitError = config.AppConfig.ProbExitError
-		}
-		gtin := tags[i].ProductID
+		c := coefficients.of(tags[i].ProductID, tags[i].FacilityID, computedDailyTurnMap)
+		tags[i].Confidence = confidenceModel.Confidence(c.DailyInvPerc, c.ProbUnreadToRead, c.ProbInStore, c.ProbExitError, tags[i].LastRead)
+	}
+}
 
-		product, foundProduct := productDataMap[gtin]
-		if foundProduct {
-			log.Debugf("Found product: %s", product.ProductID)
+// forProducts returns the coefficients of the confidence model for the tags of each of the
+// products, which only need their ProductID and FacilityID set
+func (coefficients coefficients) forProducts(session *sql.DB, products []tag.Tag) []tag.ConfidenceCoefficients {
+	var computedDailyTurnMap map[string]dailyturn.History
+	if config.AppConfig.UseComputedDailyTurnInConfidence {
+		computedDailyTurnMap = dailyturn.CreateHistoryMap(session, products)
+	}
+
+	resolved := make([]tag.ConfidenceCoefficients, len(products))
+	for i, product := range products {
+		resolved[i] = coefficients.of(product.ProductID, product.FacilityID, computedDailyTurnMap)
+	}
+	return resolved
+}
+
+// of returns the coefficients of the confidence model for a tag of the product at the
+// facility: the facility coefficients, or the configured ones for unknown facilities,
+// overridden by the product data and the computed daily turn when available
+func (coefficients coefficients) of(productID string, facilityID string, computedDailyTurnMap map[string]dailyturn.History) tag.ConfidenceCoefficients {
+	c := tag.ConfidenceCoefficients{ProductID: productID, FacilityID: facilityID}
+
+	// Get coefficients
+	tagFacility, foundFacility := coefficients.facilities[facilityID]
+	if foundFacility {
+		c.DailyInvPerc = tagFacility.Coefficients.DailyInventoryPercentage
+		c.ProbUnreadToRead = tagFacility.Coefficients.ProbUnreadToRead
+		c.ProbInStore = tagFacility.Coefficients.ProbInStoreRead
+		c.ProbExitError = tagFacility.Coefficients.ProbExitError
+	} else {
+		c.DailyInvPerc = config.AppConfig.DailyInventoryPercentage
+		c.ProbUnreadToRead = config.AppConfig.ProbUnreadToRead
+		c.ProbInStore = config.AppConfig.ProbInStoreRead
+		c.ProbExitError = config.AppConfig.ProbExitError
+	}
+
+	product, foundProduct := coefficients.productDataMap[productID]
+	if foundProduct {
+		log.Debugf("Found product: %s", product.ProductID)
+		// Only override if value isn't 0
+		if product.BecomingReadable != 0 {
+			c.ProbUnreadToRead = product.BecomingReadable
+		}
+		if product.BeingRead != 0 {
 			// Only override if value isn't 0
-			if product.BecomingReadable != 0 {
-				probUnreadToRead = product.BecomingReadable
-			}
-			if product.BeingRead != 0 {
-				// Only override if value isn't 0
-				probInStore = product.BeingRead
-			}
-			if product.ExitError != 0 {
-				// Only override if value isn't 0
-				probExitError = product.ExitError
-			}
-			if product.DailyTurn != 0 {
-				// Only override if value isn't 0
-				dailyInvPerc = product.DailyTurn
-			}
+			c.ProbInStore = product.BeingRead
 		}
-
-		// Only override if enabled in config
-		if config.AppConfig.UseComputedDailyTurnInConfidence {
-			history, foundHistory := computedDailyTurnMap[gtin]
-			if foundHistory && history.DailyTurn != 0 {
-				// Only override if value isn't 0
-				dailyInvPerc = history.DailyTurn
-			}
+		if product.ExitError != 0 {
+			// Only override if value isn't 0
+			c.ProbExitError = product.ExitError
+		}
+		if product.DailyTurn != 0 {
+			// Only override if value isn't 0
+			c.DailyInvPerc = product.DailyTurn
 		}
+	}
 
-		log.Tracef("DailyInvPerc = %f, probUnreadToRead = %f, probInStore = %f, probExitError = %f",
-			dailyInvPerc, probUnreadToRead, probInStore, probExitError)
-		tags[i].Confidence = confidenceCalc(dailyInvPerc, probUnreadToRead, probInStore, probExitError, lastRead)
+	// Only override if enabled in config
+	if config.AppConfig.UseComputedDailyTurnInConfidence {
+		history, foundHistory := computedDailyTurnMap[dailyturn.HistoryKey(productID, facilityID)]
+		if foundHistory && history.DailyTurn != 0 {
+			// Only override if value isn't 0
+			c.DailyInvPerc = history.DailyTurn
+		}
 	}
-	return nil
-}
 
-type confidenceFunc func(float64, float64, float64, float64, int64) float64
+	log.Tracef("DailyInvPerc = %f, probUnreadToRead = %f, probInStore = %f, probExitError = %f",
+		c.DailyInvPerc, c.ProbUnreadToRead, c.ProbInStore, c.ProbExitError)
+	return c
+}
 
-var confidenceCalc = confidenceFunc(zeroConfidence)
+// acceptsGzip reports whether an Accept-Encoding header allows gzip, honoring q-values:
+// "gzip;q=0" refuses it, as does "*;q=0" unless gzip is listed explicitly
+func acceptsGzip(acceptEncoding string) bool {
+	accepted := false
+	for _, entry := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(entry, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
 
-func zeroConfidence(_, _, _, _ float64, _ int64) float64 {
-	return 0.0
-}
+		quality := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				value, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+				if err != nil {
+					value = 0
+				}
+				quality = value
+			}
+		}
 
-func loadConfidencePlugin() error {
-	confidencePlugin, err := plugin.Open("/plugin/inventory-probabilistic-algo")
-	if err != nil {
-		return errors.New("Intel Probabilistic Algorithm plugin not found; all Confidence values will be set to 0.")
-	}
-	calculateConfidence, err := confidencePlugin.Lookup("CalculateConfidence")
-	if err != nil {
-		return errors.New("Unable to find CalculateConfidence function in plugin")
+		if coding == "gzip" {
+			return quality > 0
+		}
+		accepted = quality > 0
 	}
-	// panics if this plugin & function exists but signature doesn't match
-	confidenceCalc = calculateConfidence.(func(float64, float64, float64, float64, int64) float64)
-	return nil
+	return accepted
 }
 
 func init() {
 	if err := loadConfidencePlugin(); err != nil {
-		log.Error(err)
+		log.Info(err)
 	}
 }
 
@@ -157,6 +223,54 @@ func UpdateForCycleCount(tags []tag.Tag) {
 	}
 }
 
+// buildHandheldEvent converts a batch of handheld reads into an inventory event, applying the
+// batch location and timestamp to reads that do not provide their own. Reads that do not match
+// the configured epc filters are left out of the event and reported as filtered
+func buildHandheldEvent(body *tag.HandheldReadsBody) (*jsonrpc.InventoryEvent, []tag.HandheldReadResult) {
+	invEvent := jsonrpc.NewInventoryEvent()
+	results := make([]tag.HandheldReadResult, 0, len(body.Reads))
+
+	batchTimestamp := body.Timestamp
+	if batchTimestamp == 0 {
+		batchTimestamp = helper.UnixMilliNow()
+	}
+
+	for _, read := range body.Reads {
+		result := tag.HandheldReadResult{Epc: read.Epc}
+
+		if len(config.AppConfig.EpcFilters) > 0 &&
+			!statemodel.IsTagWhitelisted(read.Epc, config.AppConfig.EpcFilters) {
+			result.Status = handheldReadFiltered
+			results = append(results, result)
+			continue
+		}
+
+		location := read.Location
+		if location == "" {
+			location = body.Location
+		}
+		timestamp := read.Timestamp
+		if timestamp == 0 {
+			timestamp = batchTimestamp
+		}
+
+		invEvent.AddTagEvent(jsonrpc.TagEvent{
+			EpcCode:         read.Epc,
+			Tid:             read.Tid,
+			EpcEncodeFormat: handheldEncodeFormat,
+			FacilityID:      body.FacilityID,
+			Location:        location,
+			EventType:       statemodel.ArrivalEvent,
+			Timestamp:       timestamp,
+		})
+
+		result.Status = handheldReadProcessed
+		results = append(results, result)
+	}
+
+	return invEvent, results
+}
+
 // processGetRequest handles the request for retrieving tags
 //nolint:lll
 func processGetRequest(ctx context.Context, schema string, masterDB *sql.DB, request *http.Request, writer http.ResponseWriter, url string) error {
@@ -185,7 +299,7 @@ func processGetRequest(ctx context.Context, schema string, masterDB *sql.DB, req
 
 	odataMap := make(map[string][]string)
 	odataMap = mapRequestToOdata(odataMap, &mapping)
-	tags, count, err := tag.Retrieve(masterDB, odataMap, 250) // Per RRS documentation, size limit of 250
+	tags, count, paging, err := tag.Retrieve(masterDB, odataMap, 250) // Per RRS documentation, size limit of 250
 	if err != nil {
 		mRetrieveErr.Update(1)
 		return errors.Wrap(err, "Error retrieving Tag")
@@ -217,11 +331,7 @@ func processGetRequest(ctx context.Context, schema string, masterDB *sql.DB, req
 	if count != nil {
 		results.Count = count.Count
 	}
-
-	// For the upcoming release cursor is not a priority
-	/*if cursor != nil && cursor.Cursor != "" {
-		results.PagingType = cursor
-	}*/
+	results.PagingType = paging
 
 	web.Respond(ctx, writer, results, http.StatusOK)
 	mSuccess.Update(1)
@@ -240,12 +350,11 @@ func processPostRequest(ctx context.Context, schema string, masterDB *sql.DB, re
 
 	var tags []tag.Tag
 	var err error
+	var mapping tag.RequestBody
 	odataMap := make(map[string][]string)
 
 	// if there is a request body validate the request
 	if request.ContentLength > 0 {
-		var mapping tag.RequestBody
-
 		validationErrors, err := readAndValidateRequest(request, schema, &mapping)
 		if err != nil {
 			return err
@@ -256,7 +365,19 @@ func processPostRequest(ctx context.Context, schema string, masterDB *sql.DB, re
 		}
 		odataMap = mapRequestToOdata(odataMap, &mapping)
 	}
-	tags, err = tag.RetrieveOdataAll(masterDB, odataMap)
+
+	// When paging is requested only a page of tags is sent, and returned along with the
+	// cursor of the next page
+	var paging *tag.PagingType
+	if mapping.Size > 0 || mapping.Cursor != "" {
+		var page interface{}
+		page, _, paging, err = tag.Retrieve(masterDB, odataMap, config.AppConfig.ResponseLimit)
+		if err == nil {
+			tags, err = unmarshalTagsInterface(page)
+		}
+	} else {
+		tags, err = tag.RetrieveOdataAll(masterDB, odataMap)
+	}
 	if err != nil {
 		mRetrieveErr.Update(1)
 		return err
@@ -271,6 +392,15 @@ func processPostRequest(ctx context.Context, schema string, masterDB *sql.DB, re
 		}
 	}
 
+	if mapping.Size > 0 || mapping.Cursor != "" {
+		if tags == nil {
+			tags = []tag.Tag{}
+		}
+		web.Respond(ctx, writer, tag.Response{PagingType: paging, Results: tags}, http.StatusOK)
+		mSuccess.Update(1)
+		return nil
+	}
+
 	web.Respond(ctx, writer, nil, http.StatusOK)
 	mSuccess.Update(1)
 	return nil
@@ -364,57 +494,130 @@ func processUpdateRequest(ctx context.Context, masterDB *sql.DB, writer http.Res
 	return nil
 }
 
+// processBulkUpdateRequest sets field to value on the tags of the bulk update body, or
+// counts them on a dry run
+func processBulkUpdateRequest(ctx context.Context, masterDB *sql.DB, writer http.ResponseWriter,
+	body *tag.BulkUpdateBody, field string, value string) error {
+
+	var affected int64
+	if len(body.Epcs) > 0 || body.Filter != "" {
+		var err error
+		if affected, err = tag.BulkUpdate(masterDB, body.FacilityID, body.Epcs, body.Filter, field, value, body.DryRun); err != nil {
+			return errors.Wrap(err, "Error updating Tags")
+		}
+	}
+
+	web.Respond(ctx, writer, tag.BulkUpdateResponse{Affected: affected, DryRun: body.DryRun}, http.StatusOK)
+	return nil
+}
+
+// healthServices returns the services checked by the readiness endpoint. Optional services
+// are only checked when configured, required services are always checked.
+func healthServices() []health.Service {
+	configured := []health.Service{
+		{Name: "mapping-sku", URL: config.AppConfig.MappingSkuUrl},
+		{Name: "core-command", URL: config.AppConfig.CoreCommandUrl},
+		{Name: "cloud-connector", URL: config.AppConfig.CloudConnectorUrl},
+		{Name: "rules", URL: config.AppConfig.RulesUrl},
+		{Name: "rfid-alert", URL: config.AppConfig.RfidAlertURL},
+	}
+
+	required := make(map[string]bool, len(config.AppConfig.HealthRequiredServices))
+	for _, name := range config.AppConfig.HealthRequiredServices {
+		required[name] = true
+	}
+
+	var services []health.Service
+	for _, service := range configured {
+		service.Required = required[service.Name]
+		delete(required, service.Name)
+		if service.URL != "" || service.Required {
+			services = append(services, service)
+		}
+	}
+	// a required service that is not known can never be reached, so it is reported down
+	for _, name := range config.AppConfig.HealthRequiredServices {
+		if required[name] {
+			services = append(services, health.Service{Name: name, Required: true})
+		}
+	}
+	return services
+}
+
+// defaultCoefficients returns the configured coefficients that facilities are created with
+func defaultCoefficients() facility.Coefficients {
+	return facility.Coefficients{
+		DailyInventoryPercentage: config.AppConfig.DailyInventoryPercentage,
+		ProbUnreadToRead:         config.AppConfig.ProbUnreadToRead,
+		ProbInStoreRead:          config.AppConfig.ProbInStoreRead,
+		ProbExitError:            config.AppConfig.ProbExitError,
+	}
+}
+
+// validateTimeZone returns web.ErrInvalidInput unless the time zone is a known IANA time zone
+func validateTimeZone(timeZone string) error {
+	// LoadLocation accepts "" and "Local", which are not the time zone of a facility
+	if timeZone == "" || timeZone == "Local" {
+		return errors.Wrapf(web.ErrInvalidInput, "unknown time zone %q", timeZone)
+	}
+	if _, err := time.LoadLocation(timeZone); err != nil {
+		return errors.Wrapf(web.ErrInvalidInput, "unknown time zone %q", timeZone)
+	}
+	return nil
+}
+
+// mapRequestToOdata maps the fields of a request body to an odata query. Values are
+// escaped by the filter builder, so they cannot alter the filter.
 // nolint :gocyclo
 func mapRequestToOdata(odataMap map[string][]string, request *tag.RequestBody) map[string][]string {
 
-	var filterSlice []string
+	filter := odatafilter.New()
 	if request.Cursor != "" {
-		filterSlice = append(filterSlice, "_id gt '"+request.Cursor+"'")
+		odataMap[tag.CursorParameter] = []string{request.Cursor}
 	}
 	if request.Size > 0 {
 		odataMap["$top"] = append(odataMap["$top"], strconv.Itoa(request.Size))
 	}
 	if request.FacilityID != "" {
-		filterSlice = append(filterSlice, "facility_id eq '"+request.FacilityID+"'")
+		filter.Eq("facility_id", request.FacilityID)
 	}
 	if request.QualifiedState != "" {
-		filterSlice = append(filterSlice, "qualified_state eq '"+request.QualifiedState+"'")
+		filter.Eq("qualified_state", request.QualifiedState)
 	}
 	if request.EpcState != "" {
-		filterSlice = append(filterSlice, "epc_state eq '"+request.EpcState+"'")
+		filter.Eq("epc_state", request.EpcState)
 	}
 	if request.Confidence != 0 {
-		// nolint :lll
-		filterSlice = append(filterSlice, "confidence ge "+strconv.FormatFloat(request.Confidence, 'f', -1, 64))
+		filter.GeFloat("confidence", request.Confidence)
 	}
 	if request.ProductID != "" {
-		filterSlice = append(filterSlice, "productId eq '"+request.ProductID+"'")
+		filter.Eq("productId", request.ProductID)
 	}
 	if request.StartTime != 0 {
-		filterSlice = append(filterSlice, "last_read ge "+strconv.FormatInt(request.StartTime, 10))
+		filter.GeInt("last_read", request.StartTime)
 	}
 	if request.EndTime != 0 {
-		filterSlice = append(filterSlice, "last_read le "+strconv.FormatInt(request.EndTime, 10))
+		filter.LeInt("last_read", request.EndTime)
 	}
 	if request.Time != 0 {
-		filterSlice = append(filterSlice, "last_read le "+strconv.FormatInt(request.Time, 10))
+		filter.LeInt("last_read", request.Time)
 	}
 	if request.Epc != "" {
 		epcParts := strings.Split(request.Epc, "*")
 		if len(epcParts) == 2 {
 			// Note:json schema ensures at most one '*'
 			if epcParts[0] != "" {
-				filterSlice = append(filterSlice, "startswith(epc, '"+epcParts[0]+"')")
+				filter.StartsWith("epc", epcParts[0])
 			}
 			if epcParts[1] != "" {
-				filterSlice = append(filterSlice, "endswith(epc, '"+epcParts[1]+"')")
+				filter.EndsWith("epc", epcParts[1])
 			}
 		} else {
-			filterSlice = append(filterSlice, "epc eq '"+request.Epc+"'")
+			filter.Eq("epc", request.Epc)
 		}
 	}
 
-	odataMap["$filter"] = append(odataMap["$filter"], strings.Join(filterSlice, " and "))
+	odataMap["$filter"] = append(odataMap["$filter"], filter.String())
 
 	if request.CountOnly {
 		odataMap["$inlinecount"] = append(odataMap["$inlinecount"], "allpages")
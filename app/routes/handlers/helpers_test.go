@@ -51,22 +51,16 @@ func TestApplyConfidenceFacilitiesDontExist(t *testing.T) {
 		t.Fatalf("Error returned from applyConfidence %v", err)
 	}
 	for _, val := range tags {
-		if !isProbabilisticPluginFound {
-			if val.Confidence != 0 {
-				t.Errorf("Confidence not set correctly when probabilistic plugin doesn't exit")
-			}
-		} else {
-			configConf := confidenceCalc(dailyInvPercConfig,
-				probUnreadToReadConfig,
-				probInStoreConfig,
-				probExitErrorConfig, val.LastRead)
+		configConf := confidenceModel.Confidence(dailyInvPercConfig,
+			probUnreadToReadConfig,
+			probInStoreConfig,
+			probExitErrorConfig, val.LastRead)
 
-			log.Warn(configConf)
-			log.Warn(val.Confidence)
+		log.Warn(configConf)
+		log.Warn(val.Confidence)
 
-			if val.Confidence != configConf {
-				t.Errorf("Confidence not set correctly for handheld data")
-			}
+		if val.Confidence != configConf {
+			t.Errorf("Confidence not set correctly for handheld data")
 		}
 
 	}
@@ -99,20 +93,14 @@ func TestApplyConfidenceFacilitiesDontMatch(t *testing.T) {
 	}
 
 	for _, val := range tags {
-		if !isProbabilisticPluginFound {
-			if val.Confidence != 0 {
-				t.Errorf("Confidence not set correctly when probabilistic plugin doesn't exit")
-			}
-		} else {
-			configConf := confidenceCalc(
-				dailyInvPercConfig,
-				probUnreadToReadConfig,
-				probInStoreConfig,
-				probExitErrorConfig, val.LastRead)
-
-			if val.Confidence != configConf {
-				t.Errorf("Confidence not set correctly when no facility found")
-			}
+		configConf := confidenceModel.Confidence(
+			dailyInvPercConfig,
+			probUnreadToReadConfig,
+			probInStoreConfig,
+			probExitErrorConfig, val.LastRead)
+
+		if val.Confidence != configConf {
+			t.Errorf("Confidence not set correctly when no facility found")
 		}
 	}
 
@@ -158,22 +146,16 @@ func TestApplyConfidenceProductIdCoeffOverridesFacilityCoeffMatch(t *testing.T)
 			t.Fatalf("Couldn't create facilityItem map %v", err)
 		}
 
-		if !isProbabilisticPluginFound {
-			if val.Confidence != 0 {
-				t.Errorf("Confidence not set correctly when probabilistic plugin doesn't exit")
-			}
-		} else {
-			facilityItem := facilities[val.FacilityID]
-			facilityConf := confidenceCalc(
-				facilityItem.Coefficients.DailyInventoryPercentage,
-				facilityItem.Coefficients.ProbUnreadToRead,
-				facilityItem.Coefficients.ProbInStoreRead,
-				facilityItem.Coefficients.ProbExitError, val.LastRead)
+		facilityItem := facilities[val.FacilityID]
+		facilityConf := confidenceModel.Confidence(
+			facilityItem.Coefficients.DailyInventoryPercentage,
+			facilityItem.Coefficients.ProbUnreadToRead,
+			facilityItem.Coefficients.ProbInStoreRead,
+			facilityItem.Coefficients.ProbExitError, val.LastRead)
 
-			if val.Confidence == facilityConf {
-				// product identifier coefficients should override facility coefficients, thus confidence should not be equal
-				t.Error("Confidence not set correctly when product identifier has different coefficients than facility")
-			}
+		if val.Confidence == facilityConf {
+			// product identifier coefficients should override facility coefficients, thus confidence should not be equal
+			t.Error("Confidence not set correctly when product identifier has different coefficients than facility")
 		}
 	}
 }
@@ -218,22 +200,16 @@ func TestApplyConfidenceProductIdCoeffNull(t *testing.T) {
 			t.Fatalf("Couldn't create facilityItem map %v", err)
 		}
 
-		if !isProbabilisticPluginFound {
-			if val.Confidence != 0 {
-				t.Errorf("Confidence not set correctly when probabilistic plugin doesn't exit")
-			}
-		} else {
-			facilityItem := facilities[val.FacilityID]
-			facilityConf := confidenceCalc(
-				facilityItem.Coefficients.DailyInventoryPercentage,
-				facilityItem.Coefficients.ProbUnreadToRead,
-				facilityItem.Coefficients.ProbInStoreRead,
-				facilityItem.Coefficients.ProbExitError, val.LastRead)
-
-			if val.Confidence != facilityConf {
-				// product identifier coefficients should override facility coefficients, thus confidence should not be equal
-				t.Error("Confidence not set correctly when product identifier has different coefficients than facility")
-			}
+		facilityItem := facilities[val.FacilityID]
+		facilityConf := confidenceModel.Confidence(
+			facilityItem.Coefficients.DailyInventoryPercentage,
+			facilityItem.Coefficients.ProbUnreadToRead,
+			facilityItem.Coefficients.ProbInStoreRead,
+			facilityItem.Coefficients.ProbExitError, val.LastRead)
+
+		if val.Confidence != facilityConf {
+			// product identifier coefficients should override facility coefficients, thus confidence should not be equal
+			t.Error("Confidence not set correctly when product identifier has different coefficients than facility")
 		}
 	}
 }
@@ -277,22 +253,16 @@ func TestApplyConfidenceProductIdCoeffOverridesSomeNull(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Couldn't create facilityItem map %v", err)
 		}
-		if !isProbabilisticPluginFound {
-			if val.Confidence != 0 {
-				t.Errorf("Confidence not set correctly when probabilistic plugin doesn't exit")
-			}
-		} else {
-			facilityItem := facilities[val.FacilityID]
-			facilityConf := confidenceCalc(
-				facilityItem.Coefficients.DailyInventoryPercentage,
-				facilityItem.Coefficients.ProbUnreadToRead,
-				facilityItem.Coefficients.ProbInStoreRead,
-				facilityItem.Coefficients.ProbExitError, val.LastRead)
-
-			if val.Confidence == facilityConf {
-				// product identifier coefficients should override facility coefficients, thus confidence should not be equal
-				t.Error("Confidence not set correctly when product identifier has different coefficients than facility")
-			}
+		facilityItem := facilities[val.FacilityID]
+		facilityConf := confidenceModel.Confidence(
+			facilityItem.Coefficients.DailyInventoryPercentage,
+			facilityItem.Coefficients.ProbUnreadToRead,
+			facilityItem.Coefficients.ProbInStoreRead,
+			facilityItem.Coefficients.ProbExitError, val.LastRead)
+
+		if val.Confidence == facilityConf {
+			// product identifier coefficients should override facility coefficients, thus confidence should not be equal
+			t.Error("Confidence not set correctly when product identifier has different coefficients than facility")
 		}
 
 	}
@@ -338,24 +308,17 @@ func TestApplyConfidenceFacilityCoeffMatch(t *testing.T) {
 			t.Fatalf("Couldn't create facilityItem map %v", err)
 		}
 
-		if !isProbabilisticPluginFound {
-			if val.Confidence != 0 {
-				t.Errorf("Confidence not set correctly when probabilistic plugin doesn't exit")
-			}
-		} else {
-
-			facilityItem := facilities[val.FacilityID]
-			facilityConf := confidenceCalc(
-				facilityItem.Coefficients.DailyInventoryPercentage,
-				facilityItem.Coefficients.ProbUnreadToRead,
-				facilityItem.Coefficients.ProbInStoreRead,
-				facilityItem.Coefficients.ProbExitError, val.LastRead)
-
-			if val.Confidence != facilityConf {
-				// product identifier coefficients should not override facility coefficients when they are equal to 0
-				// thus confidence should be equal
-				t.Error("Confidence not set correctly when product identifier has different coefficients than facility")
-			}
+		facilityItem := facilities[val.FacilityID]
+		facilityConf := confidenceModel.Confidence(
+			facilityItem.Coefficients.DailyInventoryPercentage,
+			facilityItem.Coefficients.ProbUnreadToRead,
+			facilityItem.Coefficients.ProbInStoreRead,
+			facilityItem.Coefficients.ProbExitError, val.LastRead)
+
+		if val.Confidence != facilityConf {
+			// product identifier coefficients should not override facility coefficients when they are equal to 0
+			// thus confidence should be equal
+			t.Error("Confidence not set correctly when product identifier has different coefficients than facility")
 		}
 
 	}
@@ -400,29 +363,22 @@ func TestApplyConfidenceMixedTags(t *testing.T) {
 	}
 	for _, val := range tags {
 
-		if !isProbabilisticPluginFound {
-			if val.Confidence != 0 {
-				t.Errorf("Confidence not set correctly when probabilistic plugin doesn't exit")
-			}
+		fac, foundFacility := facilities[val.FacilityID]
+		if foundFacility {
+			facilityConf = confidenceModel.Confidence(
+				fac.Coefficients.DailyInventoryPercentage,
+				fac.Coefficients.ProbUnreadToRead,
+				fac.Coefficients.ProbInStoreRead,
+				fac.Coefficients.ProbExitError, val.LastRead)
 		} else {
-
-			fac, foundFacility := facilities[val.FacilityID]
-			if foundFacility {
-				facilityConf = confidenceCalc(
-					fac.Coefficients.DailyInventoryPercentage,
-					fac.Coefficients.ProbUnreadToRead,
-					fac.Coefficients.ProbInStoreRead,
-					fac.Coefficients.ProbExitError, val.LastRead)
-			} else {
-				facilityConf = confidenceCalc(
-					dailyInvPercConfig,
-					probUnreadToReadConfig,
-					probInStoreConfig,
-					probExitErrorConfig, val.LastRead)
-			}
-			if val.Confidence != facilityConf {
-				t.Error("Confidence not set correctly when facility found")
-			}
+			facilityConf = confidenceModel.Confidence(
+				dailyInvPercConfig,
+				probUnreadToReadConfig,
+				probInStoreConfig,
+				probExitErrorConfig, val.LastRead)
+		}
+		if val.Confidence != facilityConf {
+			t.Error("Confidence not set correctly when facility found")
 		}
 
 	}
@@ -493,61 +449,55 @@ func TestApplyConfidenceWithDailyTurn(t *testing.T) {
 	}
 
 	for _, val := range tags {
-		if !isProbabilisticPluginFound {
-			if val.Confidence != 0 {
-				t.Errorf("Confidence not set correctly when probabilistic plugin doesn't exit")
+		fac, foundFacility := facilities[val.FacilityID]
+		if foundFacility {
+			facilityConf := confidenceModel.Confidence(
+				fac.Coefficients.DailyInventoryPercentage,
+				fac.Coefficients.ProbUnreadToRead,
+				fac.Coefficients.ProbInStoreRead,
+				fac.Coefficients.ProbExitError,
+				val.LastRead)
+
+			if val.Confidence == facilityConf {
+				t.Error("Confidence not set correctly when computed daily turn is present and facility is found")
+			}
+
+			expectedConf := confidenceModel.Confidence(
+				computedDailyTurn,
+				fac.Coefficients.ProbUnreadToRead,
+				fac.Coefficients.ProbInStoreRead,
+				fac.Coefficients.ProbExitError,
+				val.LastRead)
+
+			if val.Confidence != expectedConf {
+				t.Error("Confidence not set correctly when computed daily turn is present and facility is found")
 			}
 		} else {
-			fac, foundFacility := facilities[val.FacilityID]
-			if foundFacility {
-				facilityConf := confidenceCalc(
-					fac.Coefficients.DailyInventoryPercentage,
-					fac.Coefficients.ProbUnreadToRead,
-					fac.Coefficients.ProbInStoreRead,
-					fac.Coefficients.ProbExitError,
-					val.LastRead)
-
-				if val.Confidence == facilityConf {
-					t.Error("Confidence not set correctly when computed daily turn is present and facility is found")
-				}
+			dailyTurnConfidence := confidenceModel.Confidence(
+				computedDailyTurn,
+				probUnreadToReadConfig,
+				probInStoreConfig,
+				probExitErrorConfig,
+				val.LastRead)
+
+			defaultConfidence := confidenceModel.Confidence(
+				dailyInvPercConfig,
+				probUnreadToReadConfig,
+				probInStoreConfig,
+				probExitErrorConfig,
+				val.LastRead)
 
-				expectedConf := confidenceCalc(
-					computedDailyTurn,
-					fac.Coefficients.ProbUnreadToRead,
-					fac.Coefficients.ProbInStoreRead,
-					fac.Coefficients.ProbExitError,
-					val.LastRead)
+			if defaultConfidence == dailyTurnConfidence {
+				t.Error("Daily turn confidence and default confidence are the same value. This should not happen and means the test is invalid")
+			}
 
-				if val.Confidence != expectedConf {
-					t.Error("Confidence not set correctly when computed daily turn is present and facility is found")
+			if val.ProductID == productId {
+				if val.Confidence != dailyTurnConfidence {
+					t.Error("Confidence not set correctly when computed daily turn is present and no facility found")
 				}
 			} else {
-				dailyTurnConfidence := confidenceCalc(
-					computedDailyTurn,
-					probUnreadToReadConfig,
-					probInStoreConfig,
-					probExitErrorConfig,
-					val.LastRead)
-
-				defaultConfidence := confidenceCalc(
-					dailyInvPercConfig,
-					probUnreadToReadConfig,
-					probInStoreConfig,
-					probExitErrorConfig,
-					val.LastRead)
-
-				if defaultConfidence == dailyTurnConfidence {
-					t.Error("Daily turn confidence and default confidence are the same value. This should not happen and means the test is invalid")
-				}
-
-				if val.ProductID == productId {
-					if val.Confidence != dailyTurnConfidence {
-						t.Error("Confidence not set correctly when computed daily turn is present and no facility found")
-					}
-				} else {
-					if val.Confidence != defaultConfidence {
-						t.Error("Confidence not set correctly when no facility found and no computed daily turn is present")
-					}
+				if val.Confidence != defaultConfidence {
+					t.Error("Confidence not set correctly when no facility found and no computed daily turn is present")
 				}
 			}
 		}
@@ -619,3 +569,25 @@ func buildProductData(becomingReadable float64, beingRead float64, dailyTurn flo
 	}
 	return result
 }
+
+func TestAcceptsGzip(t *testing.T) {
+	testCases := map[string]bool{
+		"":                     false,
+		"gzip":                 true,
+		"deflate, gzip;q=0.5":  true,
+		"gzip;q=0":             false,
+		"gzip; q=0.0, deflate": false,
+		"*":                    true,
+		"*;q=0":                false,
+		"*;q=0, gzip":          true,
+		"gzip;q=0, *":          false,
+		"identity, br":         false,
+		"GZIP":                 true,
+		"gzip;q=invalid":       false,
+	}
+	for header, expected := range testCases {
+		if acceptsGzip(header) != expected {
+			t.Errorf("Expected %v accepting gzip for '%s'", expected, header)
+		}
+	}
+}
@@ -8,33 +8,81 @@ package routes
 
 import (
 	"database/sql"
+	"net/http"
+	"time"
+
 	"github.com/gorilla/mux"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/config"
 
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/routes/handlers"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/middlewares"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/prometheus"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/web"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
 )
 
+// requestTimeout bounds the time to read a request and write its response. Streaming
+// routes respond for as long as the client reads, so they are not bound by it.
+const requestTimeout = 900 * time.Second
+
+// streamingRoutes are the names of the routes not bound by requestTimeout
+var streamingRoutes = map[string]bool{
+	"GetExport":      true,
+	"GetEventStream": true,
+}
+
+// accessTokenRoutes are the names of the routes also accepting an access token in the
+// access_token query parameter, for browser clients that cannot set headers
+var accessTokenRoutes = map[string]bool{
+	"GetEventStream": true,
+}
+
 // Route struct holds attributes to declare routes
 type Route struct {
 	Name        string
 	Method      string
 	Pattern     string
 	HandlerFunc web.Handler
+	// Role is the minimum role required to call the route when authentication is enabled
+	Role middlewares.Role
 }
 
 // NewRouter creates the routes for GET and POST
-func NewRouter(masterDB *sql.DB, maxSize int) *mux.Router {
+func NewRouter(masterDB *sql.DB, maxSize int, processor handlers.DataProcessor, pipeline handlers.PipelineMonitor) *mux.Router {
+
+	inventory := handlers.Inventory{MasterDB: masterDB, MaxSize: maxSize, Url: config.AppConfig.MappingSkuUrl, Processor: processor, Pipeline: pipeline}
+	if config.AppConfig.PrometheusEnabled {
+		// gauge collections are cleared by the InfluxDB reporter when telemetry is reported,
+		// otherwise by the exporter so they do not grow without bounds
+		inventory.MetricsExporter = prometheus.NewExporter(metrics.DefaultRegistry, config.AppConfig.TelemetryEndpoint == "")
+	}
 
-	inventory := handlers.Inventory{MasterDB: masterDB, MaxSize: maxSize, Url: config.AppConfig.MappingSkuUrl}
+	authenticator := &middlewares.Authenticator{
+		APIKeys:      config.AppConfig.AuthAPIKeys,
+		KeySet:       config.AppConfig.AuthJWTKeySet,
+		Issuer:       config.AppConfig.AuthJWTIssuer,
+		Audience:     config.AppConfig.AuthJWTAudience,
+		RoleClaim:    config.AppConfig.AuthJWTRoleClaim,
+		AccessTokens: config.AppConfig.AuthAccessTokens,
+	}
+	if config.AppConfig.AuthEnabled {
+		inventory.AccessTokens = config.AppConfig.AuthAccessTokens
+	}
 
 	var routes = []Route{
 		//swagger:operation GET / default Healthcheck
 		//
 		// Healthcheck Endpoint
 		//
-		// Endpoint that is used to determine if the application is ready to take web requests
+		// Endpoint that is used to determine if the application is ready to take web requests. It also reports which model is used to calculate the confidence of tags, either 'default' for the built-in model or 'plugin' for the Intel Probabilistic Algorithm plugin.
+		//
+		// Example Response:
+		// ```
+		// {
+		// "service":"Inventory Service",
+		// "confidence_model":"default"
+		// }
+		// ```
 		//
 		// ---
 		// consumes:
@@ -55,6 +103,101 @@ func NewRouter(masterDB *sql.DB, maxSize int) *mux.Router {
 			"GET",
 			"/",
 			inventory.Index,
+			middlewares.RolePublic,
+		},
+		//swagger:route GET /health/live default getLiveness
+		//
+		// Liveness Endpoint
+		//
+		// Endpoint that is used to determine if the application is running. It does not check any dependency, so a failing dependency does not get the application restarted.<br><br>
+		//
+		// Example Response:
+		// ```
+		// {
+		// "status":"up",
+		// "checks":[]
+		// }
+		// ```
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:resultsResponse
+		//
+		{
+			"GetLiveness",
+			"GET",
+			"/health/live",
+			inventory.GetLiveness,
+			middlewares.RolePublic,
+		},
+		//swagger:route GET /health/ready default getReadiness
+		//
+		// Readiness Endpoint
+		//
+		// Endpoint that is used to determine if the application is ready to take web requests. It reports the database ping latency, whether the EdgeX pipeline has received its first event, the time since the last inventory_data and the number of inventory events waiting to be processed. The configured services (mapping-sku, core-command, cloud-connector, rules and rfid-alert) are checked for accepting connections.<br><br>
+		//
+		// The application is not ready, and responds with 503, when the database or a service listed in healthRequiredServices is down, or when the pipeline is down: before the EdgeX pipeline has received its first event, as events cannot be pushed to core data until then, and while the inventory event queue is full.<br><br>
+		//
+		// Example Response:
+		// ```
+		// {
+		// "status":"up",
+		// "checks":[
+		// {"name":"database","required":true,"status":"up","latency_ms":0.8},
+		// {"name":"mapping-sku","required":false,"status":"down","latency_ms":2000.4,"error":"dial tcp 172.18.0.5:8080: i/o timeout"},
+		// {"name":"pipeline","required":true,"status":"up","latency_ms":0}
+		// ],
+		// "pipeline":{
+		// "sdk_context_grabbed":true,
+		// "last_inventory_data":1501863360375,
+		// "seconds_since_inventory_data":1.2,
+		// "event_queue_depth":0,
+		// "event_queue_capacity":10
+		// }
+		// }
+		// ```
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:resultsResponse
+		//       503: body:resultsResponse
+		//
+		{
+			"GetReadiness",
+			"GET",
+			"/health/ready",
+			inventory.GetReadiness,
+			middlewares.RolePublic,
+		},
+		//swagger:route GET /metrics default getMetrics
+		//
+		// Metrics Endpoint
+		//
+		// Endpoint that is used to scrape the metrics of the application in the Prometheus text format. It is only served when prometheusEnabled is true. Metric names are the go-metrics names in lower case with dots and dashes replaced by underscores, such as inventory_gettags_attempt. Timers are summaries in seconds. Gauge collections, such as inventory_processalert_alertdetails, are a gauge of their last reading and a counter, suffixed _total, of the sum of their readings, labelled by their tag. Tag and stock events are counted by inventory_events, labelled by event_type and facility_id. When authentication is enabled, the scraper needs the reader role.<br><br>
+		//
+		//     Produces:
+		//     - text/plain
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:resultsResponse
+		//       404: internalError
+		//
+		{
+			"GetMetrics",
+			"GET",
+			"/metrics",
+			inventory.GetMetrics,
+			middlewares.RoleReader,
 		},
 		//swagger:route GET /inventory/tags tags getTags
 		//
@@ -69,10 +212,16 @@ func NewRouter(masterDB *sql.DB, maxSize int) *mux.Router {
 		// /inventory/tags?$count - Shows how many records are in the database
 		// /inventory/tags?$filter=(epc eq 'example') and (tid ne '1000030404') - Filters on a particular epc whose tid does not match the one specified
 		// /inventory/tags?$filter=startswith(epc,'100') or endswith(epc,'003') or contains(epc,'2') - Allows you to filter based on only certain portions of an epc
+		// /inventory/tags?$top=10&cursor=eyJ2IjoxLCJlIjoiMzAxNDM2MzlGODQxOTFBRDIyOTAwMjA0IiwiZiI6MjE2NjEzNjI2MX0 - Retrieves the page following the previous response
+		//
+		// Results are returned in epc order, one page of $top tags (up to responseLimit) at a time. When more tags match, paging.cursor is set; passing it as the cursor query parameter with the same $filter retrieves the next page. Results are not paged when $orderby or $skip is set; paging.truncated is set instead when more tags match than were returned.<br><br>
 		//
 		// Example of one object being returned:<br><br>
 		// ```
 		// {
+		// "paging":{
+		// "cursor":"eyJ2IjoxLCJlIjoiMzAxNDM2MzlGODQxOTFBRDIyOTAwMjA0IiwiZiI6MjE2NjEzNjI2MX0"
+		// },
 		// "results":[
 		// {
 		// 	"arrived": 1501863300375,
@@ -143,6 +292,7 @@ func NewRouter(masterDB *sql.DB, maxSize int) *mux.Router {
 			"GET",
 			"/inventory/tags",
 			inventory.GetTags,
+			middlewares.RoleReader,
 		},
 		//swagger:operation GET /inventory/facilities facilities getFacilities
 		//
@@ -209,122 +359,1467 @@ func NewRouter(masterDB *sql.DB, maxSize int) *mux.Router {
 			"GET",
 			"/inventory/facilities",
 			inventory.GetFacilities,
+			middlewares.RoleReader,
+		},
+		//swagger:route POST /inventory/facilities facilities postFacility
+		//
+		// Create Facility
+		//
+		// This API call is used to create a facility before any sensor reports it, along with its display name, time zone and address. The coefficients default to the configured coefficients when not provided.<br><br>
+		//
+		// Example Request Input:
+		// ```
+		// {
+		// "name":"store001",
+		// "display_name":"Hillsboro Store",
+		// "time_zone":"America/Los_Angeles",
+		// "address":{"street":"2111 NE 25th Ave","city":"Hillsboro","region":"OR","postal_code":"97124","country":"US"}
+		// }
+		// ```
+		//
+		// + name  - Facility ID that sensors and tags refer to the facility by, it cannot be changed
+		// + display_name  - Human readable name of the facility
+		// + time_zone  - IANA time zone of the facility
+		// + address  - Postal address of the facility
+		// + coefficients  - Coefficients of the confidence algorithm, the configured coefficients when not provided
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       201: body:Facility
+		//       400: schemaValidation
+		//       409: internalError
+		//       500: internalError
+		//
+		{
+			"PostFacility",
+			"POST",
+			"/inventory/facilities",
+			inventory.PostFacility,
+			middlewares.RoleAdmin,
+		},
+		//swagger:route GET /inventory/facilities/{facilityId} facilities getFacility
+		//
+		// Retrieve Facility
+		//
+		// This API call is used to retrieve a facility along with the number of sensors and tags referring to it.<br><br>
+		//
+		// Example Result:
+		// ```
+		// {
+		// "name":"store001",
+		// "display_name":"Hillsboro Store",
+		// "time_zone":"America/Los_Angeles",
+		// "coefficients":{"dailyinventorypercentage":0.01,"probexiterror":0.1,"probinstoreread":0.75,"probunreadtoread":0.2},
+		// "sensor_count":4,
+		// "tag_count":1250
+		// }
+		// ```
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:FacilityDetails
+		//       404: internalError
+		//       500: internalError
+		//
+		{
+			"GetFacility",
+			"GET",
+			"/inventory/facilities/{facilityId}",
+			inventory.GetFacility,
+			middlewares.RoleReader,
+		},
+		//swagger:route PUT /inventory/facilities/{facilityId} facilities putFacility
+		//
+		// Update Facility
+		//
+		// This API call is used to change the display name, time zone, address or coefficients of a facility. Fields that are not provided are not changed. The facility ID is not changed: it is assigned by the RSP Controller, which reports it with every read, and sensors and tags refer to it.<br><br>
+		//
+		// Example Request Input:
+		// ```
+		// {
+		// "display_name":"Hillsboro Outlet",
+		// "time_zone":"America/Los_Angeles"
+		// }
+		// ```
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:Facility
+		//       400: schemaValidation
+		//       404: internalError
+		//       500: internalError
+		//
+		{
+			"PutFacility",
+			"PUT",
+			"/inventory/facilities/{facilityId}",
+			inventory.PutFacility,
+			middlewares.RoleAdmin,
+		},
+		//swagger:route DELETE /inventory/facilities/{facilityId} facilities deleteFacility
+		//
+		// Delete Facility
+		//
+		// This API call is used to delete a facility, along with its stock thresholds, daily turn history, inventory snapshots and shipping notices. A facility that sensors or tags still refer to is not deleted unless cascade is true, in which case its tags are deleted and its sensors are moved to DEFAULT_FACILITY. DEFAULT_FACILITY cannot be deleted.<br><br>
+		//
+		// Sensors are assigned to the facility they report, so a sensor that still reports the deleted facility moves back to it with its next reads, and its tags come back. Reconfigure such sensors before deleting their facility.<br><br>
+		//
+		// Query parameters:
+		//
+		// + cascade  - Delete the tags and move the sensors of the facility, false when not provided
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       204: body:resultsResponse
+		//       400: internalError
+		//       404: internalError
+		//       409: internalError
+		//       500: internalError
+		//
+		{
+			"DeleteFacility",
+			"DELETE",
+			"/inventory/facilities/{facilityId}",
+			inventory.DeleteFacility,
+			middlewares.RoleAdmin,
+		},
+		//swagger:route GET /inventory/sensors sensors getSensors
+		//
+		// Retrieve Sensors
+		//
+		// This API call is used to retrieve the RSP sensors that have reported to the service, ordered by device ID, along with when they last sent inventory_data and how many reads they sent. These statistics are written every few seconds, so they can lag behind the latest inventory_data. An updated_on of 0 means the basic info of the sensor has not been retrieved from the RSP Controller yet.<br><br>
+		//
+		// Example Result:
+		// ```
+		// {
+		// "results":[
+		// {
+		// "device_id":"RSP-150000",
+		// "facility_id":"store001",
+		// "personality":"EXIT",
+		// "aliases":["RSP-150000-0","RSP-150000-1","RSP-150000-2","RSP-150000-3"],
+		// "updated_on":1501863300375,
+		// "last_inventory_data":1501863360375,
+		// "inventory_data_count":1440,
+		// "read_count":51200
+		// }
+		// ]
+		// }
+		// ```
+		//
+		// + last_inventory_data  - Time in milliseconds the last inventory_data of the sensor was received, 0 if none was
+		// + inventory_data_count  - Number of inventory_data messages received from the sensor
+		// + read_count  - Number of tag reads received from the sensor
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:resultsResponse
+		//       500: internalError
+		//
+		{
+			"GetSensors",
+			"GET",
+			"/inventory/sensors",
+			inventory.GetSensors,
+			middlewares.RoleReader,
+		},
+		//swagger:route GET /inventory/sensors/{deviceId} sensors getSensor
+		//
+		// Retrieve Sensor
+		//
+		// This API call is used to retrieve an RSP sensor along with when it last sent inventory_data and how many reads it sent.<br><br>
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:Sensor
+		//       404: internalError
+		//       500: internalError
+		//
+		{
+			"GetSensor",
+			"GET",
+			"/inventory/sensors/{deviceId}",
+			inventory.GetSensor,
+			middlewares.RoleReader,
+		},
+		//swagger:route POST /inventory/sensors/{deviceId}/refresh sensors refreshSensor
+		//
+		// Refresh Sensor
+		//
+		// This API call is used to retrieve the facility, personality and aliases of an RSP sensor from the RSP Controller again, such as after it was reconfigured. Only sensors that have reported to the service can be refreshed. A 502 is returned when the RSP Controller cannot be reached.<br><br>
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:Sensor
+		//       404: internalError
+		//       500: internalError
+		//       502: internalError
+		//
+		{
+			"RefreshSensor",
+			"POST",
+			"/inventory/sensors/{deviceId}/refresh",
+			inventory.RefreshSensor,
+			middlewares.RoleOperator,
+		},
+		//swagger:operation GET /inventory/handheldevents handheldevents getHandheldevents
+		//
+		// Retrieves Handheld Event Data
+		//
+		// This API call is used to retrieve handheld events that have been received.<br><br>
+		//
+		// + `/inventory/handheldevents`
+		// + `/inventory/handheldevents?$filter=(event eq 'FullScanStart')`
+		// + `/inventory/handheldevents?$filter=(event eq 'FullScanComplete')`
+		// + `/inventory/handheldevents?$filter=(event eq 'Calculate')`
+		//
+		// Example Result:
+		// ```
+		// {
+		// "results": [
+		// {
+		// "_id": "59d2818dd0cb6260bf85e3cf",
+		// "timestamp": 1506967944919,
+		// "event": "FullScanStart"
+		// },
+		// {
+		// "_id": "59d28294d0cb6260bf85f70e",
+		// "timestamp": 1506968207311,
+		// "event": "FullScanComplete"
+		// },
+		// {
+		// "_id": "59d28294d0cb6260bf85f710",
+		// "timestamp": 1506968212265,
+		// "event": "Calculate"
+		// }]
+		// }
+		// ```
+		//
+		// ---
+		// consumes:
+		// - application/json
+		//
+		// produces:
+		// - application/json
+		//
+		// schemes:
+		// - http
+		//
+		// responses:
+		//   200:
+		//     description: OK
+		//     schema:
+		//       description: Results Response
+		//       type: object
+		//       properties:
+		//         results:
+		//           type: array
+		//           description: Array containing results of query
+		//           items:
+		//             "$ref": "#/definitions/HandheldEvent"
+		//         count:
+		//           description: Count of records for query
+		//           type: integer
+		//   400:
+		//     "$ref": "#/responses/schemaValidation"
+		//   500:
+		//     "$ref": "#/responses/internalError"
+		//
+		{
+			"GetHandheldEvents",
+			"GET",
+			"/inventory/handheldevents",
+			inventory.GetHandheldEvents,
+			middlewares.RoleReader,
+		},
+		//swagger:route POST /inventory/handheld/reads handheld postHandheldReads
+		//
+		// Ingest handheld reads
+		//
+		// This API call is used to submit a batch of EPC reads taken by a handheld RFID reader. The reads are processed through the same tag state model as reads from fixed RSP sensors, giving newer handheld reads priority when newerHandheldHavePriority is enabled.<br><br>
+		//
+		// Example Request Input:
+		// ```
+		// {
+		// "facility_id":"store001",
+		// "location":"handheld-01",
+		// "timestamp":1501863300375,
+		// "reads":[
+		// {
+		// "epc":"30143639F84191AD22900204",
+		// "tid":"E28011606000020C4B5A1F8D"
+		// },
+		// {
+		// "epc":"30143639F84191AD66100107",
+		// "location":"back-room",
+		// "timestamp":1501863300999
+		// }
+		// ]
+		// }
+		// ```
+		//
+		// + facility_id  - Facility code or identifier where the reads took place
+		// + location  - Location of the handheld reader
+		// + timestamp  - Millisecond epoch time of the reads, defaults to the current time
+		// + reads  - Array of EPC reads, at most 1000
+		//    + epc  - SGTIN EPC code
+		//    + tid  - Tag manufacturer ID
+		//    + location  - Location of this read, overrides the batch location
+		//    + timestamp  - Millisecond epoch time of this read, overrides the batch timestamp
+		//
+		// Example Response:
+		// ```
+		// {
+		// "results":[
+		// {
+		// "epc":"30143639F84191AD22900204",
+		// "status":"processed",
+		// "product_id":"00888446671424",
+		// "event":"arrival",
+		// "epc_state":"present"
+		// }
+		// ]
+		// }
+		// ```
+		//
+		// + epc  - SGTIN EPC code
+		// + status  - 'processed', or 'filtered' when the EPC does not match the configured epc filters
+		// + product_id  - Product ID decoded from the EPC
+		// + event  - Last event recorded for tag after processing
+		// + epc_state  - Current state of tag after processing, either 'present' or 'departed'
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:resultsResponse
+		//       400: schemaValidation
+		//       500: internalError
+		//
+		{
+			"PostHandheldReads",
+			"POST",
+			"/inventory/handheld/reads",
+			inventory.PostHandheldReads,
+			middlewares.RoleOperator,
+		},
+		//swagger:route POST /inventory/handheld/sessions/start handheld startHandheldSession
+		//
+		// Start Handheld Full Scan Session
+		//
+		// This API call is used to start a handheld full scan session for a facility, or for a single zone of a facility. Reads submitted after the session starts count towards the session.<br><br>
+		//
+		// Example Request Input:
+		// ```
+		// {
+		// "facility_id":"store001",
+		// "zone":"back-room"
+		// }
+		// ```
+		//
+		// + facility_id  - Facility to scan
+		// + zone  - Zone (location) to scan, leave empty to scan the whole facility
+		// + timestamp  - Millisecond epoch time the session started, defaults to the current time
+		//
+		// Example Response:
+		// ```
+		// {
+		// "event":"FullScanStart",
+		// "timestamp":1501863300375,
+		// "session_id":"8a6b9c3e-6f0c-4f1d-9f8c-2f1a7c1f4b2e",
+		// "facility_id":"store001",
+		// "zone":"back-room"
+		// }
+		// ```
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:HandheldEvent
+		//       400: schemaValidation
+		//       500: internalError
+		//
+		{
+			"StartHandheldSession",
+			"POST",
+			"/inventory/handheld/sessions/start",
+			inventory.StartHandheldSession,
+			middlewares.RoleOperator,
+		},
+		//swagger:route POST /inventory/handheld/sessions/complete handheld completeHandheldSession
+		//
+		// Complete Handheld Full Scan Session
+		//
+		// This API call is used to complete a handheld full scan session. Tags believed present in the scanned facility or zone that were not read since the session started are marked as missing candidates and returned in a reconciliation report. A tag stops being a missing candidate as soon as it is read again. A session can only be completed once.<br><br>
+		//
+		// Example Request Input:
+		// ```
+		// {
+		// "session_id":"8a6b9c3e-6f0c-4f1d-9f8c-2f1a7c1f4b2e"
+		// }
+		// ```
+		//
+		// Example Response:
+		// ```
+		// {
+		// "session_id":"8a6b9c3e-6f0c-4f1d-9f8c-2f1a7c1f4b2e",
+		// "facility_id":"store001",
+		// "zone":"back-room",
+		// "started":1501863300375,
+		// "completed":1501863900375,
+		// "missing_count":1,
+		// "missing":[
+		// {
+		// "epc":"30143639F84191AD66100107",
+		// "facility_id":"store001",
+		// "epc_state":"present",
+		// "missing_candidate":true,
+		// ...
+		// }
+		// ]
+		// }
+		// ```
+		//
+		// + session_id  - Full scan session identifier
+		// + facility_id  - Facility that was scanned
+		// + zone  - Zone that was scanned
+		// + started  - Millisecond epoch time the session started
+		// + completed  - Millisecond epoch time the session completed
+		// + missing_count  - Number of tags that were not read during the session
+		// + missing  - Tags that were not read during the session
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:ReconciliationReport
+		//       400: schemaValidation
+		//       404: internalError
+		//       409: internalError
+		//       500: internalError
+		//
+		{
+			"CompleteHandheldSession",
+			"POST",
+			"/inventory/handheld/sessions/complete",
+			inventory.CompleteHandheldSession,
+			middlewares.RoleOperator,
+		},
+		//swagger:route GET /inventory/reports/cyclecount reports getCycleCountReport
+		//
+		// Cycle Count Accuracy Report
+		//
+		// This API call is used to report how well a cycle count of a facility matched the expected inventory, per product. Tags believed present before starttime are expected, tags read since starttime are counted. Only the last read of each tag is kept, so the count always runs up to the time of the request; request the report while the count is running or right after it ends.<br><br>
+		//
+		// Query parameters:
+		//
+		// + facility_id  - Facility to report on (required)
+		// + starttime  - Millisecond epoch time the count started (required)
+		// + format  - Output format, either 'json' (default) or 'csv'
+		//
+		// Example query:
+		//
+		// /inventory/reports/cyclecount?facility_id=store001&starttime=1501863300375&format=csv
+		//
+		// Example Response:
+		// ```
+		// {
+		// "facility_id":"store001",
+		// "starttime":1501863300375,
+		// "endtime":1501866900375,
+		// "results":[
+		// {
+		// "product_id":"00888446671424",
+		// "expected":3,
+		// "counted":3,
+		// "missing":["30143639F84191AD22900204"],
+		// "unexpected":["30143639F84191AD66100107"]
+		// }
+		// ]
+		// }
+		// ```
+		//
+		// + product_id  - Product ID
+		// + expected  - Number of tags believed present when the count started
+		// + counted  - Number of tags read during the count
+		// + missing  - EPCs believed present that were not read
+		// + unexpected  - EPCs read that were not believed present
+		//
+		//     Produces:
+		//     - application/json
+		//     - text/csv
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:CycleCountReport
+		//       400: schemaValidation
+		//       500: internalError
+		//
+		{
+			"GetCycleCountReport",
+			"GET",
+			"/inventory/reports/cyclecount",
+			inventory.GetCycleCountReport,
+			middlewares.RoleReader,
+		},
+		//swagger:route GET /inventory/reports/shrink reports getShrinkReport
+		//
+		// Shrink Report
+		//
+		// This API call is used to report tags that departed through an exit without being sold, grouped by product, facility, exit and hour of the day, so loss prevention can target hotspots. Results are sorted by count, highest first.<br><br>
+		//
+		// Query parameters:
+		//
+		// + facility_id  - Facility to report on, defaults to all facilities
+		// + starttime  - Millisecond epoch start time of the report window (required)
+		// + endtime  - Millisecond epoch end time of the report window, defaults to the current time
+		// + format  - Output format, either 'json' (default) or 'csv'
+		//
+		// Example query:
+		//
+		// /inventory/reports/shrink?facility_id=store001&starttime=1501863300375&format=csv
+		//
+		// Example Response:
+		// ```
+		// {
+		// "facility_id":"store001",
+		// "starttime":1501863300375,
+		// "endtime":1501866900375,
+		// "results":[
+		// {
+		// "product_id":"00888446671424",
+		// "facility_id":"store001",
+		// "exit_alias":"front-door",
+		// "hour":17,
+		// "count":3
+		// }
+		// ]
+		// }
+		// ```
+		//
+		// + product_id  - Product ID
+		// + facility_id  - Facility the tags departed from
+		// + exit_alias  - Alias of the exit sensor the tags departed through
+		// + hour  - Hour of the day (0-23) the tags departed, in the time zone of the facility or UTC when it has none
+		// + count  - Number of tags that departed
+		//
+		//     Produces:
+		//     - application/json
+		//     - text/csv
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:ShrinkReport
+		//       400: schemaValidation
+		//       500: internalError
+		//
+		{
+			"GetShrinkReport",
+			"GET",
+			"/inventory/reports/shrink",
+			inventory.GetShrinkReport,
+			middlewares.RoleReader,
+		},
+		//swagger:route POST /inventory/asn asn postShippingNotices
+		//
+		// Submit Advance Shipping Notices
+		//
+		// This API call is used to submit advance shipping notices directly, for example from an ERP system, instead of through the EdgeX ASN_data reading. The notices are processed synchronously and the result of each notice is returned. When none of the notices could be processed the request fails with the same body, 400 when all of them were invalid and 500 otherwise.<br><br>
+		//
+		// Example Request Input:
+		// ```
+		// [
+		// {
+		// "asnId":"AS876422",
+		// "eventTime":"2019-03-12T10:58:07.000Z",
+		// "siteId":"store001",
+		// "items":[
+		// {
+		// "itemGtin":"00888446671424",
+		// "itemId":"16023361",
+		// "itemEpcs":["30143639F84191AD22900204","30143639F84191AD66100107"]
+		// }
+		// ]
+		// }
+		// ]
+		// ```
+		//
+		// + asnId  - ID of the shipment
+		// + eventTime  - Time the ASN was updated
+		// + siteId  - Site the shipment is sent to
+		// + items  - Items of the shipment
+		//    + itemGtin  - Company identifier of the item
+		//    + itemId  - Company identifier of the item
+		//    + itemEpcs  - EPCs of the item
+		//
+		// Example Response:
+		// ```
+		// {
+		// "results":[
+		// {
+		// "asn_id":"AS876422",
+		// "status":"processed",
+		// "epcs":2,
+		// "filtered":0
+		// }
+		// ]
+		// }
+		// ```
+		//
+		// + asn_id  - ID of the shipment
+		// + status  - Either 'processed' or 'error'
+		// + epcs  - Number of EPCs recorded
+		// + filtered  - Number of EPCs ignored because they do not match the configured epc filters
+		// + error  - Reason the shipment could not be processed
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:resultsResponse
+		//       400: schemaValidation
+		//       500: internalError
+		//
+		{
+			"PostShippingNotices",
+			"POST",
+			"/inventory/asn",
+			inventory.PostShippingNotices,
+			middlewares.RoleOperator,
+		},
+		//swagger:route GET /inventory/dailyturn dailyturn getDailyTurn
+		//
+		// Retrieve Daily Turn
+		//
+		// This API call is used to retrieve the daily turn computed per product per facility, along with the history of daily turn records, so the sell-through of each store can be compared.<br><br>
+		//
+		// The daily turn is computed when an advance shipping notice is received for the product at the facility. Histories with an empty facility_id were computed across all facilities.<br><br>
+		//
+		// Query parameters:
+		//
+		// + product_id  - Product to return the daily turn of, all products when not provided
+		// + facility_id  - Facility to return the daily turn of, all facilities when not provided
+		// + starttime  - Millisecond epoch time, only records computed at or after this time are returned
+		// + endtime  - Millisecond epoch time, only records computed at or before this time are returned
+		//
+		// Example query:
+		//
+		// /inventory/dailyturn?product_id=00888446671424&facility_id=store001&starttime=1501863300375
+		//
+		// Example Response:
+		// ```
+		// {
+		// "results":[
+		// {
+		// "product_id":"00888446671424",
+		// "facility_id":"store001",
+		// "daily_turn":0.025,
+		// "records":[
+		// {
+		// "present":90,
+		// "departed":10,
+		// "daily_turn":0.025,
+		// "previous_timestamp":1552042687000,
+		// "timestamp":1552388287000
+		// }
+		// ],
+		// "last_timestamp":1552388287000
+		// }
+		// ]
+		// }
+		// ```
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:resultsResponse
+		//       400: schemaValidation
+		//       500: internalError
+		//
+		{
+			"GetDailyTurn",
+			"GET",
+			"/inventory/dailyturn",
+			inventory.GetDailyTurn,
+			middlewares.RoleReader,
+		},
+		//swagger:route GET /inventory/stock/thresholds stock getStockThresholds
+		//
+		// Retrieve Stock Thresholds
+		//
+		// This API call is used to list the minimum quantity of products per facility, along with the stock level of their last evaluation.<br><br>
+		//
+		// The stock level of a product is evaluated whenever one of its tags is processed, as the sum of the confidence of its present tags at the facility. A product is 'out_of_stock' below 1, 'low_stock' below its min_quantity and 'in_stock' otherwise. On every change a 'low_stock', 'out_of_stock' or 'restocked' event is sent to the rules service (rule types lowStock, outOfStock and restocked) and to core-data (stock_level_event).<br><br>
+		//
+		// Query parameters:
+		//
+		// + facility_id  - Facility to return the thresholds of, all facilities when not provided
+		// + product_id  - Product to return the thresholds of, all products when not provided
+		//
+		// Example Response:
+		// ```
+		// {
+		// "results":[
+		// {
+		// "product_id":"00888446671424",
+		// "facility_id":"store001",
+		// "min_quantity":5,
+		// "status":"low_stock",
+		// "quantity":3.6,
+		// "evaluated":1552388287000
+		// }
+		// ]
+		// }
+		// ```
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:resultsResponse
+		//       500: internalError
+		//
+		{
+			"GetStockThresholds",
+			"GET",
+			"/inventory/stock/thresholds",
+			inventory.GetStockThresholds,
+			middlewares.RoleReader,
+		},
+		//swagger:route PUT /inventory/stock/thresholds stock putStockThresholds
+		//
+		// Set Stock Thresholds
+		//
+		// This API call is used to set the minimum quantity of products per facility. Products below their minimum quantity are low on stock.<br><br>
+		//
+		// Example Request Input:
+		// ```
+		// [
+		// {
+		// "product_id":"00888446671424",
+		// "facility_id":"store001",
+		// "min_quantity":5
+		// }
+		// ]
+		// ```
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:resultsResponse
+		//       400: schemaValidation
+		//       500: internalError
+		//
+		{
+			"PutStockThresholds",
+			"PUT",
+			"/inventory/stock/thresholds",
+			inventory.PutStockThresholds,
+			middlewares.RoleOperator,
+		},
+		//swagger:route DELETE /inventory/stock/thresholds stock deleteStockThreshold
+		//
+		// Delete Stock Threshold
+		//
+		// This API call is used to stop evaluating the stock level of a product at a facility.<br><br>
+		//
+		// Query parameters:
+		//
+		// + product_id  - Product of the threshold, required
+		// + facility_id  - Facility of the threshold, required
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       204: body:resultsResponse
+		//       400: schemaValidation
+		//       500: internalError
+		//
+		{
+			"DeleteStockThreshold",
+			"DELETE",
+			"/inventory/stock/thresholds",
+			inventory.DeleteStockThreshold,
+			middlewares.RoleOperator,
+		},
+		//swagger:route GET /inventory/webhooks webhooks getWebhooks
+		//
+		// Retrieve Webhooks
+		//
+		// This API call is used to list the webhooks notified of inventory events. Secrets are not returned.<br><br>
+		//
+		// Example Response:
+		// ```
+		// {
+		// "results":[
+		// {
+		// "id":"7c9e6679-7425-40de-944b-e07fc1f90ae7",
+		// "url":"https://erp.example.com/inventory/events",
+		// "events":["departed","low_stock"],
+		// "facility_ids":["store001"],
+		// "enabled":true,
+		// "consecutive_failures":0,
+		// "created":1501863300375
+		// }
+		// ]
+		// }
+		// ```
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:resultsResponse
+		//       500: internalError
+		//
+		{
+			"GetWebhooks",
+			"GET",
+			"/inventory/webhooks",
+			inventory.GetWebhooks,
+			middlewares.RoleAdmin,
+		},
+		//swagger:route POST /inventory/webhooks webhooks postWebhook
+		//
+		// Create Webhook
+		//
+		// This API call is used to notify an endpoint of inventory events. Events are queued in the database and posted as they occur, tag events being batched per event type and facility. Events are delivered to a webhook in the order they occur: when an attempt fails, the later events wait for its retry. Failed deliveries are retried with an exponential backoff, up to webhookMaxAttempts attempts, and a webhook failing webhookDisableAfterFailures consecutive attempts is disabled until it is enabled again.<br><br>
+		//
+		// Every request is signed with the secret of the webhook. The X-Inventory-Signature header is 'sha256=' followed by the hex encoded HMAC-SHA256 of the X-Inventory-Timestamp header, a dot, and the body. The X-Inventory-Delivery header identifies the delivery across retries. The secret is generated when not provided, and is only returned by this call.<br><br>
+		//
+		// Example Request Input:
+		// ```
+		// {
+		// "url":"https://erp.example.com/inventory/events",
+		// "events":["departed","low_stock"],
+		// "facility_ids":["store001"]
+		// }
+		// ```
+		//
+		// + url  - Endpoint the events are posted to
+		// + events  - Event types to notify: arrival, moved, departed, returned, cycle_count, low_stock, out_of_stock or restocked
+		// + facility_ids  - Facilities to notify events of, all facilities when not provided
+		// + secret  - Secret of at least 16 characters to sign requests with, generated when not provided
+		//
+		// Example Request Body Posted to the Endpoint:
+		// ```
+		// {
+		// "id":"0b5b9e5d-3c4b-4a0c-a8b5-2f6f0e0c6f43",
+		// "event":"departed",
+		// "facility_id":"store001",
+		// "created":1501863300375,
+		// "data":[{"epc":"30143639F84191AD22900204","facility_id":"store001","event":"departed",...}]
+		// }
+		// ```
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       201: body:Webhook
+		//       400: schemaValidation
+		//       500: internalError
+		//
+		{
+			"PostWebhook",
+			"POST",
+			"/inventory/webhooks",
+			inventory.PostWebhook,
+			middlewares.RoleAdmin,
+		},
+		//swagger:route GET /inventory/webhooks/{id} webhooks getWebhook
+		//
+		// Retrieve Webhook
+		//
+		// This API call is used to retrieve a webhook, including why it was disabled if it failed too many consecutive attempts. The secret is not returned.<br><br>
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:Webhook
+		//       500: internalError
+		//
+		{
+			"GetWebhook",
+			"GET",
+			"/inventory/webhooks/{id}",
+			inventory.GetWebhook,
+			middlewares.RoleAdmin,
+		},
+		//swagger:route PUT /inventory/webhooks/{id} webhooks putWebhook
+		//
+		// Update Webhook
+		//
+		// This API call is used to replace the URL and filters of a webhook, or to disable and enable it. Enabling a webhook that was disabled after failing resets its failures. The secret is only replaced when provided.<br><br>
+		//
+		// Example Request Input:
+		// ```
+		// {
+		// "url":"https://erp.example.com/inventory/events",
+		// "events":["departed","low_stock","out_of_stock"],
+		// "enabled":true
+		// }
+		// ```
+		//
+		// + enabled  - Whether events are delivered to the webhook, true when not provided
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:Webhook
+		//       400: schemaValidation
+		//       500: internalError
+		//
+		{
+			"PutWebhook",
+			"PUT",
+			"/inventory/webhooks/{id}",
+			inventory.PutWebhook,
+			middlewares.RoleAdmin,
+		},
+		//swagger:route DELETE /inventory/webhooks/{id} webhooks deleteWebhook
+		//
+		// Delete Webhook
+		//
+		// This API call is used to stop notifying a webhook. Its pending deliveries and delivery history are deleted.<br><br>
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       204: body:resultsResponse
+		//       500: internalError
+		//
+		{
+			"DeleteWebhook",
+			"DELETE",
+			"/inventory/webhooks/{id}",
+			inventory.DeleteWebhook,
+			middlewares.RoleAdmin,
+		},
+		//swagger:route GET /inventory/webhooks/{id}/deliveries webhooks getWebhookDeliveries
+		//
+		// Retrieve Webhook Deliveries
+		//
+		// This API call is used to review the most recent deliveries of a webhook, newest first. The history of delivered and failed deliveries is kept for webhookDeliveryRetentionDays days.<br><br>
+		//
+		// Query parameters:
+		//
+		// + status  - Only return deliveries of the status: pending, delivered or failed
+		// + limit  - Number of deliveries to return, 100 when not provided
+		//
+		// Example Response:
+		// ```
+		// {
+		// "results":[
+		// {
+		// "id":"0b5b9e5d-3c4b-4a0c-a8b5-2f6f0e0c6f43",
+		// "subscription_id":"7c9e6679-7425-40de-944b-e07fc1f90ae7",
+		// "event":"departed",
+		// "facility_id":"store001",
+		// "payload":[{"epc":"30143639F84191AD22900204",...}],
+		// "status":"pending",
+		// "attempts":2,
+		// "next_attempt":1501863420375,
+		// "last_attempt":1501863360375,
+		// "last_status_code":503,
+		// "last_error":"webhook responded with status 503",
+		// "created":1501863300375
+		// }
+		// ]
+		// }
+		// ```
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:resultsResponse
+		//       400: schemaValidation
+		//       500: internalError
+		//
+		{
+			"GetWebhookDeliveries",
+			"GET",
+			"/inventory/webhooks/{id}/deliveries",
+			inventory.GetWebhookDeliveries,
+			middlewares.RoleAdmin,
+		},
+		//swagger:route GET /inventory/asn asn getShippingNotices
+		//
+		// Retrieve Advance Shipping Notices
+		//
+		// This API call is used to list the advance shipping notices recorded for a site within a time window, along with how much of each shipment was received.<br><br>
+		//
+		// Query parameters:
+		//
+		// + site_id  - Site the shipments are sent to, all sites when not provided
+		// + starttime  - Millisecond epoch time, only ASNs recorded at or after this time are returned
+		// + endtime  - Millisecond epoch time, only ASNs recorded at or before this time are returned
+		//
+		// Example query:
+		//
+		// /inventory/asn?site_id=store001&starttime=1501863300375
+		//
+		// Example Response:
+		// ```
+		// {
+		// "results":[
+		// {
+		// "asn_id":"AS876422",
+		// "site_id":"store001",
+		// "event_time":"2019-03-12T10:58:07.000Z",
+		// "created":1552388287000,
+		// "status":"partially_received",
+		// "expected":2,
+		// "received":["30143639F84191AD22900204"],
+		// "missing":["30143639F84191AD66100107"],
+		// "overage":[]
+		// }
+		// ]
+		// }
+		// ```
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:resultsResponse
+		//       400: schemaValidation
+		//       500: internalError
+		//
+		{
+			"GetShippingNotices",
+			"GET",
+			"/inventory/asn",
+			inventory.GetShippingNotices,
+			middlewares.RoleReader,
+		},
+		//swagger:route GET /inventory/asn/{id} asn getShippingNotice
+		//
+		// Retrieve Advance Shipping Notice Reconciliation
+		//
+		// This API call is used to check whether a shipment was fully received. The EPCs of the advance shipping notice are compared against the tags read since the ASN was recorded.<br><br>
+		//
+		// Example Response:
+		// ```
+		// {
+		// "asn_id":"AS876422",
+		// "site_id":"store001",
+		// "event_time":"2019-03-12T10:58:07.000Z",
+		// "created":1552388287000,
+		// "status":"partially_received",
+		// "expected":2,
+		// "received":["30143639F84191AD22900204"],
+		// "missing":["30143639F84191AD66100107"],
+		// "overage":["30143639F84191AD66100999"]
+		// }
+		// ```
+		//
+		// + status  - 'open' when nothing was received, 'partially_received' or 'received'
+		// + expected  - Number of EPCs listed in the shipment
+		// + received  - EPCs of the shipment read since the ASN was recorded
+		// + missing  - EPCs of the shipment not read yet
+		// + overage  - EPCs of shipped products that arrived at the site since the ASN was recorded, but are not listed in it
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:Reconciliation
+		//       500: internalError
+		//
+		{
+			"GetShippingNotice",
+			"GET",
+			"/inventory/asn/{id}",
+			inventory.GetShippingNotice,
+			middlewares.RoleReader,
+		},
+		//swagger:route POST /inventory/query/current current postCurrentInventory
+		//
+		// Post current inventory snapshot to the cloud connector
+		//
+		// Example Request Input:
+		// ```
+		// {
+		// 	"qualified_state":"sold",
+		// 	"facility_id":"store001"
+		// }
+		// ```
+		//
+		//
+		//
+		// + __qualified_state__ - User set qualified state for the item
+		// + __facility_id__ - Return only facilities provided
+		// + __epc_state__ - EPC state of 'present' or 'departed'
+		// + __starttime__ - Millisecond epoch start time
+		// + __endtime__ - Millisecond epoch stop time
+		// + __size__ - Only send one page of this many tags, in epc order
+		// + __cursor__ - Cursor from previous response used to send the next page
+		//
+		// When size or cursor is set, the tags sent are returned along with paging.cursor when more tags remain to be sent.
+		//
+		//
+		//
+		// ---
+		// consumes:
+		// - application/json
+		//
+		// produces:
+		// - application/json
+		//
+		// schemes:
+		// - http
+		//
+		// responses:
+		//   200: body:resultsResponse
+		//   400: schemaValidation
+		//   403: forbidden
+		//   500: internalError
+		//   502: externalError
+		//   503: serviceUnavailable
+		//   504: externalServiceTimeout
+		//
+		{
+			"PostCurrentInventory",
+			"POST",
+			"/inventory/query/current",
+			inventory.PostCurrentInventory,
+			middlewares.RoleReader,
+		},
+		//swagger:route GET /inventory/query/asof inventory getInventoryAsOf
+		//
+		// Retrieve Inventory As Of A Past Time
+		//
+		// This API call is used to retrieve the number of tags per facility, product and epc_state as it was at a past point in time.<br><br>
+		//
+		// Counts are taken from the latest snapshot of each facility recorded at or before the requested time. Snapshots are taken every snapshotIntervalMinutes and kept for snapshotRetentionDays. Present counts are the tags present when the snapshot was taken, departed counts the tags that departed in the interval ending with it.<br><br>
+		//
+		// When epcs=true, the EPCs recorded by the same snapshot are returned with each count of present tags. EPCs are only recorded when snapshotRecordEpcs is enabled, which is off by default; requesting them from a snapshot that did not record them fails with 400.<br><br>
+		//
+		// Query parameters:
+		//
+		// + time  - Millisecond epoch time to return the inventory of, required
+		// + facility_id  - Facility to return the inventory of, all facilities when not provided
+		// + product_id  - Product to return the inventory of, all products when not provided
+		// + epcs  - 'true' to return the EPCs of each count
+		//
+		// Example query:
+		//
+		// /inventory/query/asof?time=1552388287000&facility_id=store001&product_id=00888446671424&epcs=true
+		//
+		// Example Response:
+		// ```
+		// {
+		// "time":1552388287000,
+		// "results":[
+		// {
+		// "facility_id":"store001",
+		// "product_id":"00888446671424",
+		// "epc_state":"present",
+		// "count":1,
+		// "snapshot_time":1552386000000,
+		// "epcs":["30143639F84191AD22900204"]
+		// }
+		// ]
+		// }
+		// ```
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:AsOfResponse
+		//       400: schemaValidation
+		//       500: internalError
+		//
+		{
+			"GetInventoryAsOf",
+			"GET",
+			"/inventory/query/asof",
+			inventory.GetInventoryAsOf,
+			middlewares.RoleReader,
+		},
+		//swagger:route GET /inventory/query/aggregate inventory getAggregate
+		//
+		// Retrieve Aggregated Tag Counts
+		//
+		// This API call is used to retrieve the number of tags and their average confidence grouped by product_id, facility_id, epc_state, qualified_state and/or location, without retrieving the tags themselves. Counts and average confidences are computed by the database and are not limited by responseLimit. With the probabilistic algorithm plugin, which the database cannot evaluate, confidence is instead computed once per product, facility and minute the tags were last read; such queries spanning more than aggregateBucketLimit of these are rejected with 400 and should be narrowed with the filters below or sent with confidence=false.<br><br>
+		//
+		// Query parameters:
+		//
+		// + group_by  - Comma separated fields to group by, any of product_id, facility_id, epc_state, qualified_state and location (required)
+		// + product_id  - Only count tags of this product
+		// + facility_id  - Only count tags at this facility
+		// + epc_state  - Only count tags in this state
+		// + qualified_state  - Only count tags in this qualified state
+		// + location  - Only count tags last read at this location
+		// + confidence  - 'false' to only count the tags, without their average confidence, defaults to 'true'
+		//
+		// Example query:
+		//
+		// /inventory/query/aggregate?group_by=product_id,location&facility_id=store001&epc_state=present
+		//
+		// Example Response:
+		// ```
+		// {
+		// "group_by":["product_id","location"],
+		// "count":12,
+		// "results":[
+		// {
+		// "group":{"product_id":"00888446671424","location":"RSP-150000-0"},
+		// "count":12,
+		// "average_confidence":0.93
+		// }
+		// ]
+		// }
+		// ```
+		//
+		// + group  - Values of the grouped fields, location is the most recent location of the tags
+		// + count  - Number of tags
+		// + average_confidence  - Average confidence of the tags, 0 when confidence=false
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:AggregateResponse
+		//       400: schemaValidation
+		//       500: internalError
+		//
+		{
+			"GetAggregate",
+			"GET",
+			"/inventory/query/aggregate",
+			inventory.GetAggregate,
+			middlewares.RoleReader,
 		},
-		//swagger:operation GET /inventory/handheldevents handheldevents getHandheldevents
+		//swagger:route GET /inventory/export inventory getExport
 		//
-		// Retrieves Handheld Event Data
+		// Export Tags
 		//
-		// This API call is used to retrieve handheld events that have been received.<br><br>
+		// This API call is used to export all tags matching an OData query, for example for nightly ERP extracts. Tags are streamed as they are read from the database rather than collected first, so exports are not limited by responseLimit. The response is gzip compressed when the Accept-Encoding header of the request accepts gzip with a non-zero q-value. Exports are not cut off by the server write timeout.<br><br>
 		//
-		// + `/inventory/handheldevents`
-		// + `/inventory/handheldevents?$filter=(event eq 'FullScanStart')`
-		// + `/inventory/handheldevents?$filter=(event eq 'FullScanComplete')`
-		// + `/inventory/handheldevents?$filter=(event eq 'Calculate')`
+		// Query parameters:
 		//
-		// Example Result:
+		// + format  - Output format, either 'ndjson' (default), one JSON tag per line, or 'csv'
+		// + confidence  - 'true' to export the confidence of each tag
+		// + $filter, $select, $orderby, $top, $skip  - OData query options, as for /inventory/tags
+		//
+		// Example query:
+		//
+		// /inventory/export?format=csv&confidence=true&$filter=facility_id eq 'store001' and epc_state eq 'present'
+		//
+		// Example CSV Response:
 		// ```
-		// {
-		// "results": [
-		// {
-		// "_id": "59d2818dd0cb6260bf85e3cf",
-		// "timestamp": 1506967944919,
-		// "event": "FullScanStart"
-		// },
-		// {
-		// "_id": "59d28294d0cb6260bf85f70e",
-		// "timestamp": 1506968207311,
-		// "event": "FullScanComplete"
-		// },
-		// {
-		// "_id": "59d28294d0cb6260bf85f710",
-		// "timestamp": 1506968212265,
-		// "event": "Calculate"
-		// }]
-		// }
+		// epc,product_id,uri,tid,facility_id,location,epc_state,qualified_state,epc_context,event,source,arrived,last_read,confidence
+		// 30143639F84191AD22900204,00888446671424,,,store001,RSP-150000-0,present,unknown,,arrival,fixed,1501863300375,1501863300375,0.93
 		// ```
 		//
-		// ---
-		// consumes:
-		// - application/json
+		// + location  - Most recent location of the tag
 		//
-		// produces:
-		// - application/json
+		//     Produces:
+		//     - application/x-ndjson
+		//     - text/csv
 		//
-		// schemes:
-		// - http
+		//     Schemes: http
 		//
-		// responses:
-		//   200:
-		//     description: OK
-		//     schema:
-		//       description: Results Response
-		//       type: object
-		//       properties:
-		//         results:
-		//           type: array
-		//           description: Array containing results of query
-		//           items:
-		//             "$ref": "#/definitions/HandheldEvent"
-		//         count:
-		//           description: Count of records for query
-		//           type: integer
-		//   400:
-		//     "$ref": "#/responses/schemaValidation"
-		//   500:
-		//     "$ref": "#/responses/internalError"
+		//     Responses:
+		//       200: description:Exported tags
+		//       400: schemaValidation
+		//       500: internalError
 		//
 		{
-			"GetHandheldEvents",
+			"GetExport",
 			"GET",
-			"/inventory/handheldevents",
-			inventory.GetHandheldEvents,
+			"/inventory/export",
+			inventory.GetExport,
+			middlewares.RoleReader,
 		},
-		//swagger:route POST /inventory/query/current current postCurrentInventory
+		//swagger:route GET /inventory/events/stream inventory getEventStream
 		//
-		// Post current inventory snapshot to the cloud connector
+		// Stream Tag Events
 		//
-		// Example Request Input:
+		// This API call is used to receive tag events as they are processed, instead of polling /inventory/tags. Events are sent as Server-Sent Events, or as WebSocket messages when the request asks to upgrade to a WebSocket. Each event is the tag as updated by the event, with the confidence at the time it was processed.<br><br>
+		//
+		// Every client buffers a limited number of events (eventStreamBufferSize). A client that does not keep up is sent an error and disconnected, so tag processing is never slowed down by clients. Streams are not closed by the server request timeout, but clients are expected to reconnect when a connection drops.<br><br>
+		//
+		// Query parameters:
+		//
+		// + facility_id  - Only stream events of the facility
+		// + product_id  - Only stream events of the product
+		// + event  - Only stream events of the type, such as arrival, moved or departed
+		// + epc_prefix  - Only stream events of EPCs starting with the prefix
+		//
+		// Example query:
+		//
+		// /inventory/events/stream?facility_id=store001&event=departed
+		//
+		// Example Server-Sent Event:
 		// ```
-		// {
-		// 	"qualified_state":"sold",
-		// 	"facility_id":"store001"
-		// }
+		// id: 42
+		// data: {"epc":"30143639F84191AD22900204","facility_id":"store001","event":"departed","epc_state":"departed","last_read":1501863300375,...}
+		//
 		// ```
 		//
+		// When a client is disconnected for falling behind, an error event is sent:
+		// ```
+		// event: error
+		// data: {"error":"subscriber did not keep up with the event stream"}
 		//
+		// ```
 		//
-		// + __qualified_state__ - User set qualified state for the item
-		// + __facility_id__ - Return only facilities provided
-		// + __epc_state__ - EPC state of 'present' or 'departed'
-		// + __starttime__ - Millisecond epoch start time
-		// + __endtime__ - Millisecond epoch stop time
+		// WebSocket clients receive each tag, and the error, as a JSON text message. Messages sent by WebSocket clients are ignored.<br><br>
 		//
+		// When authentication is enabled, clients that cannot set the Authorization or X-API-Key headers, such as browser EventSource and WebSocket clients, pass an access token from POST /inventory/events/stream/token in the access_token query parameter instead. The token is only checked when connecting, so the stream stays open after it expires.
 		//
+		// Example query:
 		//
-		// ---
-		// consumes:
-		// - application/json
+		// /inventory/events/stream?event=departed&access_token=eyJhbGciOiJIUzI1NiJ9...
 		//
-		// produces:
-		// - application/json
+		//     Produces:
+		//     - text/event-stream
 		//
-		// schemes:
-		// - http
+		//     Schemes: http
 		//
-		// responses:
-		//   200: body:resultsResponse
-		//   400: schemaValidation
-		//   403: forbidden
-		//   500: internalError
-		//   502: externalError
-		//   503: serviceUnavailable
-		//   504: externalServiceTimeout
+		//     Responses:
+		//       200: description:Stream of tag events
+		//       500: internalError
 		//
 		{
-			"PostCurrentInventory",
+			"GetEventStream",
+			"GET",
+			"/inventory/events/stream",
+			inventory.GetEventStream,
+			middlewares.RoleReader,
+		},
+		//swagger:route POST /inventory/events/stream/token inventory postAccessToken
+		//
+		// Issue Event Stream Access Token
+		//
+		// This API call is used to get a short-lived access token for the event stream, for clients such as browser EventSource and WebSocket clients that cannot set the Authorization or X-API-Key headers. The token is requested with those headers, grants the role of the caller, and is passed in the access_token query parameter of /inventory/events/stream.<br><br>
+		//
+		// Tokens expire after authAccessTokenLifetimeSeconds. They are signed with authAccessTokenSecret, which should be shared by all instances of the service behind a load balancer; without it, a token is only accepted by the instance that issued it. Tokens are not issued when authentication is disabled.<br><br>
+		//
+		// Example Response:
+		// ```
+		// {
+		// "access_token":"eyJhbGciOiJIUzI1NiJ9...",
+		// "expires":1501863360375
+		// }
+		// ```
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:AccessToken
+		//       401: internalError
+		//       404: internalError
+		//       500: internalError
+		//
+		{
+			"PostAccessToken",
 			"POST",
-			"/inventory/query/current",
-			inventory.PostCurrentInventory,
+			"/inventory/events/stream/token",
+			inventory.PostAccessToken,
+			middlewares.RoleReader,
 		},
 		//swagger:route POST /inventory/query/searchByProductID searchByProductID GetSearchByProductID
 		//
@@ -387,6 +1882,7 @@ func NewRouter(masterDB *sql.DB, maxSize int) *mux.Router {
 		//
 		// + paging  - Paging object
 		//    + cursor  - Cursor used to get next page of results
+		//    + truncated  - Set when more tags match than were returned and they cannot be paged by cursor
 		// + results  - Array of result objects
 		//    + epc  - SGTIN EPC code
 		//    + facility_id  - Facility ID
@@ -426,6 +1922,7 @@ func NewRouter(masterDB *sql.DB, maxSize int) *mux.Router {
 			"POST",
 			"/inventory/query/searchByProductID",
 			inventory.GetSearchByProductID,
+			middlewares.RoleReader,
 		},
 		//swagger:route PUT /inventory/update/coefficients update updateCoefficients
 		//
@@ -470,6 +1967,7 @@ func NewRouter(masterDB *sql.DB, maxSize int) *mux.Router {
 			"PUT",
 			"/inventory/update/coefficients",
 			inventory.UpdateCoefficients,
+			middlewares.RoleAdmin,
 		},
 		//swagger:route PUT /inventory/update/qualifiedstate update updateQualifiedState
 		//
@@ -513,6 +2011,7 @@ func NewRouter(masterDB *sql.DB, maxSize int) *mux.Router {
 			"PUT",
 			"/inventory/update/qualifiedstate",
 			inventory.UpdateQualifiedState,
+			middlewares.RoleOperator,
 		},
 		//swagger:route POST /inventory/search epc getSearchByEpc
 		//
@@ -607,6 +2106,124 @@ func NewRouter(masterDB *sql.DB, maxSize int) *mux.Router {
 			"POST",
 			"/inventory/search",
 			inventory.GetSearchByEpc,
+			middlewares.RoleReader,
+		},
+		//swagger:route POST /inventory/decode epc postDecode
+		//
+		// Decode EPCs
+		//
+		// This endpoint decodes a list of EPCs with the configured tag decoders, the SGTIN decoder followed by the proprietary decoder when proprietaryTagBitBoundary is set, without storing anything. It is meant for verifying tag encodings and the proprietary bit-boundary configuration before deploying. Each EPC is reported with the decoder that matched it, or with the errors of every decoder when none did. Body parameters shall be provided in request body in JSON format.<br><br>
+		//
+		// Example Request Input:
+		// ```
+		// {
+		// "epcs":["303402662C3A5F904C19939D", "0F00000000000C00000014D2"]
+		// }
+		// ```
+		//
+		// + epcs  - List of EPCs in hex, at most 1000
+		//
+		// Example Response:
+		// ```
+		// {
+		// 	"results":[
+		// 	{
+		// 	"epc":"303402662C3A5F904C19939D",
+		// 	"decoder":"sgtin (strict)",
+		// 	"product_id":"00039307597746",
+		// 	"uri":"urn:epc:id:sgtin:0039307.059774.69996221341",
+		// 	"filter_value":1
+		// 	},
+		// 	{
+		// 	"epc":"0F00000000000C00000014D2",
+		// 	"decoder":"proprietary",
+		// 	"product_id":"00000014D2",
+		// 	"uri":"tag:example.com,2019-01-01:15.12.5330",
+		// 	"errors":["decoder 1 (sgtin (strict)) unable to decode tag data: SGTIN headers are 0x30 and 0x36, but this is: 0XF"]
+		// 	}
+		// 	]
+		// }
+		// ```
+		//
+		// + results  - Array of result objects, in the order of the request
+		//    + epc  - EPC as given in the request
+		//    + decoder  - Decoder that matched the EPC, omitted if none did
+		//    + product_id  - Product ID decoded from the EPC
+		//    + uri  - Tag URI decoded from the EPC
+		//    + filter_value  - Packaging level of the item, only for encodings that carry one
+		//    + errors  - Errors of the decoders that were unable to decode the EPC
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:resultsResponse
+		//       400: schemaValidation
+		//       403: forbidden
+		//       500: internalError
+		//
+		{
+			"PostDecode",
+			"POST",
+			"/inventory/decode",
+			inventory.PostDecode,
+			middlewares.RoleReader,
+		},
+		//swagger:route PUT /inventory/update/qualifiedstate/bulk update bulkUpdateQualifiedState
+		//
+		// Bulk update qualified state
+		//
+		// This endpoint sets the qualified state of many tags of a facility at once, such as marking a whole delivery damaged. Tags are selected either by a list of EPCs or by an odata filter, and are updated in one transaction. Body parameters shall be provided in request body in JSON format.<br><br>
+		//
+		// Example Request Input:
+		// ```
+		// {
+		// "facility_id":"store001",
+		// "epcs":["3038E511C6E9A6400012D687","3038E511C6E9A6400012D688"],
+		// "qualified_state":"damaged",
+		// "dry_run":true
+		// }
+		// ```
+		//
+		// + facility_id  - Facility code or identifier, only tags of the facility are updated
+		// + epcs  - EPCs of the tags to update, cannot be combined with filter
+		// + filter  - Odata filter selecting the tags to update, such as "epc_state eq 'present' and startswith(epc,'3038')", cannot be combined with epcs
+		// + qualified_state  - User-defined state
+		// + dry_run  - When true nothing is updated, but the number of tags that would be updated is returned
+		//
+		// Example Response:
+		// ```
+		// {
+		// "affected":2,
+		// "dry_run":true
+		// }
+		// ```
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:resultsResponse
+		//       400: schemaValidation
+		//       403: forbidden
+		//       500: internalError
+		//
+		{
+			"BulkUpdateQualifiedState",
+			"PUT",
+			"/inventory/update/qualifiedstate/bulk",
+			inventory.BulkUpdateQualifiedState,
+			middlewares.RoleOperator,
 		},
 		//swagger:route PUT /inventory/update/epccontext epc setEpcContext
 		//
@@ -650,6 +2267,57 @@ func NewRouter(masterDB *sql.DB, maxSize int) *mux.Router {
 			"PUT",
 			"/inventory/update/epccontext",
 			inventory.SetEpcContext,
+			middlewares.RoleOperator,
+		},
+		//swagger:route PUT /inventory/update/epccontext/bulk epc bulkSetEpcContext
+		//
+		// Bulk set EPC context
+		//
+		// This endpoint sets the context of many tags of a facility at once. Tags are selected either by a list of EPCs or by an odata filter, and are updated in one transaction. Setting an empty epc_context clears it. Body parameters shall be provided in request body in JSON format.<br><br>
+		//
+		// Example Request Input:
+		// ```
+		// {
+		// "facility_id":"store001",
+		// "filter":"qualified_state eq 'damaged'",
+		// "epc_context":"returned to vendor"
+		// }
+		// ```
+		//
+		// + facility_id  - Facility code or identifier, only tags of the facility are updated
+		// + epcs  - EPCs of the tags to update, cannot be combined with filter
+		// + filter  - Odata filter selecting the tags to update, cannot be combined with epcs
+		// + epc_context  - User-defined context, empty to clear it
+		// + dry_run  - When true nothing is updated, but the number of tags that would be updated is returned
+		//
+		// Example Response:
+		// ```
+		// {
+		// "affected":12,
+		// "dry_run":false
+		// }
+		// ```
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: body:resultsResponse
+		//       400: schemaValidation
+		//       403: forbidden
+		//       500: internalError
+		//
+		{
+			"BulkSetEpcContext",
+			"PUT",
+			"/inventory/update/epccontext/bulk",
+			inventory.BulkSetEpcContext,
+			middlewares.RoleOperator,
 		},
 		//swagger:route DELETE /inventory/update/epccontext epc deleteEpcContext
 		//
@@ -691,6 +2359,7 @@ func NewRouter(masterDB *sql.DB, maxSize int) *mux.Router {
 			"DELETE",
 			"/inventory/update/epccontext",
 			inventory.DeleteEpcContext,
+			middlewares.RoleOperator,
 		},
 		//swagger:route DELETE /inventory/tags tags deleteAllTags
 		//
@@ -720,6 +2389,31 @@ func NewRouter(masterDB *sql.DB, maxSize int) *mux.Router {
 			"DELETE",
 			"/inventory/tags",
 			inventory.DeleteAllTags,
+			middlewares.RoleAdmin,
+		},
+		//swagger:route DELETE /inventory/productdata/cache productdata invalidateProductDataCache
+		//
+		// Invalidate Product Data Cache
+		//
+		// This endpoint drops the cached product metadata of the SKU mapping service, so it is fetched again the next time confidence is calculated.<br><br>
+		//
+		// Product metadata is cached for productDataCacheTTLSeconds and refreshed in the background. When the mapping service is slow or down, the cached data keeps being used.<br><br>
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       204: body:resultsResponse
+		//       500: internalError
+		//
+		{
+			"InvalidateProductDataCache",
+			"DELETE",
+			"/inventory/productdata/cache",
+			inventory.InvalidateProductDataCache,
+			middlewares.RoleOperator,
 		},
 	}
 
@@ -730,15 +2424,28 @@ func NewRouter(masterDB *sql.DB, maxSize int) *mux.Router {
 		handler = middlewares.Recover(handler)
 		handler = middlewares.Logger(handler)
 		handler = middlewares.Bodylimiter(handler)
+		if config.AppConfig.AuthEnabled {
+			if accessTokenRoutes[route.Name] {
+				handler = middlewares.AuthWithAccessToken(authenticator, route.Role, handler)
+			} else {
+				handler = middlewares.Auth(authenticator, route.Role, handler)
+			}
+		}
 		if config.AppConfig.EnableCORS {
 			handler = middlewares.CORS(config.AppConfig.CORSOrigin, handler)
 		}
 
+		// The timeout handler buffers responses, so it cannot stream
+		var httpHandler http.Handler = handler
+		if !streamingRoutes[route.Name] {
+			httpHandler = http.TimeoutHandler(handler, requestTimeout, "request timed out")
+		}
+
 		router.
 			Methods(route.Method).
 			Path(route.Pattern).
 			Name(route.Name).
-			Handler(handler)
+			Handler(httpHandler)
 	}
 
 	return router
@@ -0,0 +1,80 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package schemas
+
+// BulkUpdateQualifiedStateSchema defines the body which sets the qualified state of the
+// tags listed by EPC or matching a filter
+const BulkUpdateQualifiedStateSchema = `{
+	"type": "object",
+	"required": ["facility_id", "qualified_state"],
+	"oneOf": [
+		{"required": ["epcs"]},
+		{"required": ["filter"]}
+	],
+	"properties": {
+		"facility_id": {
+			"type": "string",
+			"minLength": 1
+		},
+		"epcs": {
+			"type": "array",
+			"minItems": 1,
+			"items": {
+				"type": "string",
+				"pattern": "^[a-fA-F0-9]{1,}$"
+			}
+		},
+		"filter": {
+			"type": "string",
+			"minLength": 1
+		},
+		"qualified_state": {
+			"type": "string",
+			"pattern": "^[-a-zA-Z0-9_ ]{1,}$"
+		},
+		"dry_run": {
+			"type": "boolean"
+		}
+	},
+	"additionalProperties": false
+}`
+
+// BulkSetEpcContextSchema defines the body which sets, or clears when empty, the epc
+// context of the tags listed by EPC or matching a filter
+const BulkSetEpcContextSchema = `{
+	"type": "object",
+	"required": ["facility_id", "epc_context"],
+	"oneOf": [
+		{"required": ["epcs"]},
+		{"required": ["filter"]}
+	],
+	"properties": {
+		"facility_id": {
+			"type": "string",
+			"minLength": 1
+		},
+		"epcs": {
+			"type": "array",
+			"minItems": 1,
+			"items": {
+				"type": "string",
+				"pattern": "^[a-fA-F0-9]{1,}$"
+			}
+		},
+		"filter": {
+			"type": "string",
+			"minLength": 1
+		},
+		"epc_context": {
+			"type": "string"
+		},
+		"dry_run": {
+			"type": "boolean"
+		}
+	},
+	"additionalProperties": false
+}`
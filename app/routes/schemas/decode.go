@@ -0,0 +1,26 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package schemas
+
+// DecodeSchema defines the request body for decoding a list of EPCs. EPCs are not
+// checked for hex here so that encoding problems are reported per EPC.
+const DecodeSchema = `{
+	"type": "object",
+	"required": ["epcs"],
+	"properties": {
+		"epcs": {
+			"type": "array",
+			"minItems": 1,
+			"maxItems": 1000,
+			"items": {
+				"type": "string",
+				"minLength": 1
+			}
+		}
+	},
+	"additionalProperties": false
+}`
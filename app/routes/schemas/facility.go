@@ -0,0 +1,91 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package schemas
+
+// facilityMetadataProperties are the properties of a facility that can be set on
+// creation and updated afterwards
+const facilityMetadataProperties = `
+		"display_name": {
+			"type": "string",
+			"maxLength": 256
+		},
+		"time_zone": {
+			"type": "string",
+			"minLength": 1,
+			"maxLength": 64
+		},
+		"address": {
+			"type": "object",
+			"properties": {
+				"street": {
+					"type": "string"
+				},
+				"city": {
+					"type": "string"
+				},
+				"region": {
+					"type": "string"
+				},
+				"postal_code": {
+					"type": "string"
+				},
+				"country": {
+					"type": "string"
+				}
+			},
+			"additionalProperties": false
+		},
+		"coefficients": {
+			"type": "object",
+			"required": [
+				"dailyinventorypercentage",
+				"probunreadtoread",
+				"probinstoreread",
+				"probexiterror"
+			],
+			"properties": {
+				"dailyinventorypercentage": {
+					"type": "number"
+				},
+				"probunreadtoread": {
+					"type": "number"
+				},
+				"probinstoreread": {
+					"type": "number"
+				},
+				"probexiterror": {
+					"type": "number"
+				}
+			},
+			"additionalProperties": false
+		}`
+
+// CreateFacilitySchema defines the request body for creating a facility. Coefficients
+// default to the configured coefficients when left out.
+const CreateFacilitySchema = `{
+	"type": "object",
+	"required": ["name"],
+	"properties": {
+		"name": {
+			"type": "string",
+			"minLength": 1,
+			"maxLength": 128,
+			"pattern": "^\\S+$"
+		},` + facilityMetadataProperties + `
+	},
+	"additionalProperties": false
+}`
+
+// UpdateFacilitySchema defines the request body for updating the metadata of a facility.
+// Properties that are left out are not changed.
+const UpdateFacilitySchema = `{
+	"type": "object",
+	"minProperties": 1,
+	"properties": {` + facilityMetadataProperties + `
+	},
+	"additionalProperties": false
+}`
@@ -0,0 +1,87 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package schemas
+
+// HandheldReadsSchema defines the request body for submitting a batch of handheld reads
+const HandheldReadsSchema = `{
+	"type": "object",
+	"required": ["facility_id", "location", "reads"],
+	"properties": {
+		"facility_id": {
+			"type": "string",
+			"minLength": 1
+		},
+		"location": {
+			"type": "string",
+			"minLength": 1
+		},
+		"timestamp": {
+			"type": "integer",
+			"minimum": 0
+		},
+		"reads": {
+			"type": "array",
+			"minItems": 1,
+			"maxItems": 1000,
+			"items": {
+				"type": "object",
+				"required": ["epc"],
+				"properties": {
+					"epc": {
+						"type": "string",
+						"pattern": "^[a-fA-F0-9]{1,}$"
+					},
+					"tid": {
+						"type": "string"
+					},
+					"location": {
+						"type": "string"
+					},
+					"timestamp": {
+						"type": "integer",
+						"minimum": 0
+					}
+				},
+				"additionalProperties": false
+			}
+		}
+	},
+	"additionalProperties": false
+}`
+
+// HandheldSessionStartSchema defines the request body for starting a handheld full scan session
+const HandheldSessionStartSchema = `{
+	"type": "object",
+	"required": ["facility_id"],
+	"properties": {
+		"facility_id": {
+			"type": "string",
+			"minLength": 1
+		},
+		"zone": {
+			"type": "string"
+		},
+		"timestamp": {
+			"type": "integer",
+			"minimum": 0
+		}
+	},
+	"additionalProperties": false
+}`
+
+// HandheldSessionCompleteSchema defines the request body for completing a handheld full scan session
+const HandheldSessionCompleteSchema = `{
+	"type": "object",
+	"required": ["session_id"],
+	"properties": {
+		"session_id": {
+			"type": "string",
+			"minLength": 1
+		}
+	},
+	"additionalProperties": false
+}`
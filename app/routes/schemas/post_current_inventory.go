@@ -23,6 +23,13 @@ const PostCurrentInventorySchema = `{
 		},
 		"endtime": {
 			"type": "integer"
+		},
+		"size": {
+			"type": "integer",
+			"minimum": 1
+		},
+		"cursor": {
+			"type": "string"
 		}
 	},
 	"additionalProperties": false
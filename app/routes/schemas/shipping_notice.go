@@ -0,0 +1,59 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package schemas
+
+// ShippingNoticeSchema defines the request body for submitting advance shipping notices
+const ShippingNoticeSchema = `{
+	"type": "array",
+	"minItems": 1,
+	"items": {
+		"type": "object",
+		"required": ["asnId", "eventTime", "siteId", "items"],
+		"properties": {
+			"asnId": {
+				"type": "string",
+				"minLength": 1
+			},
+			"eventTime": {
+				"type": "string",
+				"minLength": 1
+			},
+			"siteId": {
+				"type": "string",
+				"minLength": 1
+			},
+			"items": {
+				"type": "array",
+				"minItems": 1,
+				"items": {
+					"type": "object",
+					"required": ["itemEpcs", "itemGtin", "itemId"],
+					"properties": {
+						"itemEpcs": {
+							"type": "array",
+							"minItems": 1,
+							"items": {
+								"type": "string",
+								"pattern": "^[a-fA-F0-9]{1,}$"
+							}
+						},
+						"itemGtin": {
+							"type": "string",
+							"minLength": 1
+						},
+						"itemId": {
+							"type": "string",
+							"minLength": 1
+						}
+					},
+					"additionalProperties": false
+				}
+			}
+		},
+		"additionalProperties": false
+	}
+}`
@@ -0,0 +1,32 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package schemas
+
+// StockThresholdSchema defines the request body for setting the minimum quantity of products
+const StockThresholdSchema = `{
+	"type": "array",
+	"minItems": 1,
+	"items": {
+		"type": "object",
+		"required": ["product_id", "facility_id", "min_quantity"],
+		"properties": {
+			"product_id": {
+				"type": "string",
+				"minLength": 1
+			},
+			"facility_id": {
+				"type": "string",
+				"minLength": 1
+			},
+			"min_quantity": {
+				"type": "integer",
+				"minimum": 0
+			}
+		},
+		"additionalProperties": false
+	}
+}`
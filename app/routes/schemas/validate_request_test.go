@@ -105,3 +105,303 @@ func TestValidateDeleteEpcContextRequest(t *testing.T) {
 		t.Fatal("Failed to catch json schema validation error, additional properties")
 	}
 }
+
+func TestValidateHandheldReadsRequest(t *testing.T) {
+	requestJSON := []byte(`{
+		"facility_id":"store001",
+		"location":"handheld-01",
+		"timestamp":1501863300375,
+		"reads":[
+			{"epc":"30143639F84191AD22900204", "tid":"E28011606000020C4B5A1F8D"},
+			{"epc":"30143639F84191AD66100107", "location":"back-room", "timestamp":1501863300999}
+		]
+	  }`)
+	result, err := ValidateSchemaRequest(requestJSON, HandheldReadsSchema)
+	if err != nil {
+		t.Errorf("Error validating the json schema %s", err)
+	}
+	if !result.Valid() {
+		t.Errorf("Validation of Json schema failed %s", result.Errors())
+	}
+
+	invalidRequest := []byte(`{
+		"facility_id":"store001",
+		"location":"handheld-01",
+		"reads":[]
+	  }`)
+	result, err = ValidateSchemaRequest(invalidRequest, HandheldReadsSchema)
+	if err != nil {
+		t.Errorf("Error validating the json schema %s", err)
+	}
+	if result.Valid() {
+		t.Fatal("Failed to catch json schema validation error, reads cannot be empty")
+	}
+
+	invalidRequest = []byte(`{
+		"facility_id":"store001",
+		"location":"handheld-01",
+		"reads":[{"epc":"not-hex"}]
+	  }`)
+	result, err = ValidateSchemaRequest(invalidRequest, HandheldReadsSchema)
+	if err != nil {
+		t.Errorf("Error validating the json schema %s", err)
+	}
+	if result.Valid() {
+		t.Fatal("Failed to catch json schema validation error, epc must be hex")
+	}
+
+	reads := strings.Repeat(`{"epc":"30143639F84191AD22900204"},`, 1000)
+	invalidRequest = []byte(`{
+		"facility_id":"store001",
+		"location":"handheld-01",
+		"reads":[` + reads + `{"epc":"30143639F84191AD66100107"}]
+	  }`)
+	result, err = ValidateSchemaRequest(invalidRequest, HandheldReadsSchema)
+	if err != nil {
+		t.Errorf("Error validating the json schema %s", err)
+	}
+	if result.Valid() {
+		t.Fatal("Failed to catch json schema validation error, at most 1000 reads per request")
+	}
+}
+
+func TestValidateHandheldSessionRequests(t *testing.T) {
+	requestJSON := []byte(`{"facility_id":"store001", "zone":"back-room"}`)
+	result, err := ValidateSchemaRequest(requestJSON, HandheldSessionStartSchema)
+	if err != nil {
+		t.Errorf("Error validating the json schema %s", err)
+	}
+	if !result.Valid() {
+		t.Errorf("Validation of Json schema failed %s", result.Errors())
+	}
+
+	invalidRequest := []byte(`{"zone":"back-room"}`)
+	result, err = ValidateSchemaRequest(invalidRequest, HandheldSessionStartSchema)
+	if err != nil {
+		t.Errorf("Error validating the json schema %s", err)
+	}
+	if result.Valid() {
+		t.Fatal("Failed to catch json schema validation error, facility_id is required")
+	}
+
+	requestJSON = []byte(`{"session_id":"8a6b9c3e-6f0c-4f1d-9f8c-2f1a7c1f4b2e"}`)
+	result, err = ValidateSchemaRequest(requestJSON, HandheldSessionCompleteSchema)
+	if err != nil {
+		t.Errorf("Error validating the json schema %s", err)
+	}
+	if !result.Valid() {
+		t.Errorf("Validation of Json schema failed %s", result.Errors())
+	}
+
+	invalidRequest = []byte(`{"session_id":""}`)
+	result, err = ValidateSchemaRequest(invalidRequest, HandheldSessionCompleteSchema)
+	if err != nil {
+		t.Errorf("Error validating the json schema %s", err)
+	}
+	if result.Valid() {
+		t.Fatal("Failed to catch json schema validation error, session_id cannot be empty")
+	}
+}
+
+func TestValidateShippingNoticeRequest(t *testing.T) {
+	requestJSON := []byte(`[{
+		"asnId":"AS876422",
+		"eventTime":"2019-03-12T10:58:07.000Z",
+		"siteId":"store001",
+		"items":[{"itemGtin":"00888446671424", "itemId":"16023361", "itemEpcs":["30143639F84191AD22900204"]}]
+	  }]`)
+	result, err := ValidateSchemaRequest(requestJSON, ShippingNoticeSchema)
+	if err != nil {
+		t.Errorf("Error validating the json schema %s", err)
+	}
+	if !result.Valid() {
+		t.Errorf("Validation of Json schema failed %s", result.Errors())
+	}
+
+	invalidRequest := []byte(`[{
+		"asnId":"AS876422",
+		"eventTime":"2019-03-12T10:58:07.000Z",
+		"items":[{"itemGtin":"00888446671424", "itemId":"16023361", "itemEpcs":["30143639F84191AD22900204"]}]
+	  }]`)
+	result, err = ValidateSchemaRequest(invalidRequest, ShippingNoticeSchema)
+	if err != nil {
+		t.Errorf("Error validating the json schema %s", err)
+	}
+	if result.Valid() {
+		t.Fatal("Failed to catch json schema validation error, siteId is required")
+	}
+
+	invalidRequest = []byte(`[]`)
+	result, err = ValidateSchemaRequest(invalidRequest, ShippingNoticeSchema)
+	if err != nil {
+		t.Errorf("Error validating the json schema %s", err)
+	}
+	if result.Valid() {
+		t.Fatal("Failed to catch json schema validation error, at least one ASN is required")
+	}
+}
+
+func TestValidateStockThresholdRequest(t *testing.T) {
+	requestJSON := []byte(`[{"product_id":"00888446671424", "facility_id":"store001", "min_quantity":5}]`)
+	result, err := ValidateSchemaRequest(requestJSON, StockThresholdSchema)
+	if err != nil {
+		t.Errorf("Error validating the json schema %s", err)
+	}
+	if !result.Valid() {
+		t.Errorf("Validation of Json schema failed %s", result.Errors())
+	}
+
+	invalidRequest := []byte(`[{"product_id":"00888446671424", "facility_id":"store001", "min_quantity":-1}]`)
+	result, err = ValidateSchemaRequest(invalidRequest, StockThresholdSchema)
+	if err != nil {
+		t.Errorf("Error validating the json schema %s", err)
+	}
+	if result.Valid() {
+		t.Fatal("Failed to catch json schema validation error, min_quantity must not be negative")
+	}
+
+	invalidRequest = []byte(`[{"product_id":"00888446671424", "min_quantity":5}]`)
+	result, err = ValidateSchemaRequest(invalidRequest, StockThresholdSchema)
+	if err != nil {
+		t.Errorf("Error validating the json schema %s", err)
+	}
+	if result.Valid() {
+		t.Fatal("Failed to catch json schema validation error, facility_id is required")
+	}
+}
+
+func TestValidateWebhookRequest(t *testing.T) {
+	requestJSON := []byte(`{"url":"https://erp.example.com/events", "events":["departed","low_stock"], "facility_ids":["store001"]}`)
+	result, err := ValidateSchemaRequest(requestJSON, WebhookSchema)
+	if err != nil {
+		t.Errorf("Error validating the json schema %s", err)
+	}
+	if !result.Valid() {
+		t.Errorf("Validation of Json schema failed %s", result.Errors())
+	}
+
+	invalidRequest := []byte(`{"url":"https://erp.example.com/events", "events":["shipped"]}`)
+	result, err = ValidateSchemaRequest(invalidRequest, WebhookSchema)
+	if err != nil {
+		t.Errorf("Error validating the json schema %s", err)
+	}
+	if result.Valid() {
+		t.Fatal("Failed to catch json schema validation error, events must be known event types")
+	}
+
+	invalidRequest = []byte(`{"url":"ftp://erp.example.com/events", "events":["departed"]}`)
+	result, err = ValidateSchemaRequest(invalidRequest, WebhookSchema)
+	if err != nil {
+		t.Errorf("Error validating the json schema %s", err)
+	}
+	if result.Valid() {
+		t.Fatal("Failed to catch json schema validation error, url must be http or https")
+	}
+
+	invalidRequest = []byte(`{"url":"https://erp.example.com/events", "events":["departed"], "secret":"short"}`)
+	result, err = ValidateSchemaRequest(invalidRequest, WebhookSchema)
+	if err != nil {
+		t.Errorf("Error validating the json schema %s", err)
+	}
+	if result.Valid() {
+		t.Fatal("Failed to catch json schema validation error, secret must be at least 16 characters")
+	}
+}
+
+func TestValidateBulkUpdateRequest(t *testing.T) {
+	validRequests := map[string][]byte{
+		BulkUpdateQualifiedStateSchema: []byte(`{"facility_id":"store001", "epcs":["30143639F8419105417AED6F"], "qualified_state":"damaged", "dry_run":true}`),
+		BulkSetEpcContextSchema:        []byte(`{"facility_id":"store001", "filter":"qualified_state eq 'damaged'", "epc_context":""}`),
+	}
+	for schema, requestJSON := range validRequests {
+		result, err := ValidateSchemaRequest(requestJSON, schema)
+		if err != nil {
+			t.Errorf("Error validating the json schema %s", err)
+		}
+		if !result.Valid() {
+			t.Errorf("Validation of Json schema failed %s", result.Errors())
+		}
+	}
+
+	invalidRequests := map[string][]byte{
+		"epcs and filter are exclusive": []byte(`{"facility_id":"store001", "epcs":["30143639F8419105417AED6F"], "filter":"epc_state eq 'present'", "qualified_state":"damaged"}`),
+		"epcs or filter is required":    []byte(`{"facility_id":"store001", "qualified_state":"damaged"}`),
+		"epcs must not be empty":        []byte(`{"facility_id":"store001", "epcs":[], "qualified_state":"damaged"}`),
+		"epcs must be hex":              []byte(`{"facility_id":"store001", "epcs":["' or 1=1"], "qualified_state":"damaged"}`),
+		"facility_id is required":       []byte(`{"epcs":["30143639F8419105417AED6F"], "qualified_state":"damaged"}`),
+	}
+	for reason, requestJSON := range invalidRequests {
+		result, err := ValidateSchemaRequest(requestJSON, BulkUpdateQualifiedStateSchema)
+		if err != nil {
+			t.Errorf("Error validating the json schema %s", err)
+		}
+		if result.Valid() {
+			t.Errorf("Failed to catch json schema validation error, %s", reason)
+		}
+	}
+}
+
+func TestValidateFacilityRequest(t *testing.T) {
+	validRequests := map[string][]byte{
+		CreateFacilitySchema: []byte(`{"name":"store001", "display_name":"Store 1", "time_zone":"America/Los_Angeles", "address":{"city":"Hillsboro", "country":"US"}}`),
+		UpdateFacilitySchema: []byte(`{"coefficients":{"dailyinventorypercentage":0.01, "probunreadtoread":0.2, "probinstoreread":0.75, "probexiterror":0.1}}`),
+	}
+	for schema, requestJSON := range validRequests {
+		result, err := ValidateSchemaRequest(requestJSON, schema)
+		if err != nil {
+			t.Errorf("Error validating the json schema %s", err)
+		}
+		if !result.Valid() {
+			t.Errorf("Validation of Json schema failed %s", result.Errors())
+		}
+	}
+
+	invalidRequests := map[string]struct {
+		schema      string
+		requestJSON []byte
+	}{
+		"name is required":              {CreateFacilitySchema, []byte(`{"display_name":"Store 1"}`)},
+		"name must not have whitespace": {CreateFacilitySchema, []byte(`{"name":"store 001"}`)},
+		"address must be known fields":  {CreateFacilitySchema, []byte(`{"name":"store001", "address":{"planet":"Earth"}}`)},
+		"coefficients must be complete": {UpdateFacilitySchema, []byte(`{"coefficients":{"probexiterror":0.1}}`)},
+		"name cannot be updated":        {UpdateFacilitySchema, []byte(`{"name":"store002"}`)},
+		"update must not be empty":      {UpdateFacilitySchema, []byte(`{}`)},
+	}
+	for reason, test := range invalidRequests {
+		result, err := ValidateSchemaRequest(test.requestJSON, test.schema)
+		if err != nil {
+			t.Errorf("Error validating the json schema %s", err)
+		}
+		if result.Valid() {
+			t.Errorf("Failed to catch json schema validation error, %s", reason)
+		}
+	}
+}
+
+func TestValidateDecodeRequest(t *testing.T) {
+	requestJSON := []byte(`{"epcs":["303402662C3A5F904C19939D", "not-hex"]}`)
+	result, err := ValidateSchemaRequest(requestJSON, DecodeSchema)
+	if err != nil {
+		t.Errorf("Error validating the json schema %s", err)
+	}
+	if !result.Valid() {
+		t.Errorf("Validation of Json schema failed %s", result.Errors())
+	}
+
+	invalidRequests := map[string][]byte{
+		"epcs are required":      []byte(`{}`),
+		"epcs cannot be empty":   []byte(`{"epcs":[]}`),
+		"epcs must be strings":   []byte(`{"epcs":[1234]}`),
+		"epcs must not be blank": []byte(`{"epcs":[""]}`),
+		"additional properties":  []byte(`{"epcs":["303402662C3A5F904C19939D"], "test":10}`),
+	}
+	for reason, requestJSON := range invalidRequests {
+		result, err := ValidateSchemaRequest(requestJSON, DecodeSchema)
+		if err != nil {
+			t.Errorf("Error validating the json schema %s", err)
+		}
+		if result.Valid() {
+			t.Errorf("Failed to catch json schema validation error, %s", reason)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package schemas
+
+// WebhookSchema defines the request body for creating or replacing a webhook. Enabled is
+// ignored when creating a webhook, which is always created enabled.
+const WebhookSchema = `{
+	"type": "object",
+	"required": ["url", "events"],
+	"properties": {
+		"url": {
+			"type": "string",
+			"pattern": "^https?://[^\\s]+$"
+		},
+		"secret": {
+			"type": "string",
+			"minLength": 16,
+			"maxLength": 256
+		},
+		"events": {
+			"type": "array",
+			"minItems": 1,
+			"uniqueItems": true,
+			"items": {
+				"type": "string",
+				"enum": ["arrival", "moved", "departed", "returned", "cycle_count", "low_stock", "out_of_stock", "restocked"]
+			}
+		},
+		"facility_ids": {
+			"type": "array",
+			"uniqueItems": true,
+			"items": {
+				"type": "string",
+				"minLength": 1
+			}
+		},
+		"enabled": {
+			"type": "boolean"
+		}
+	},
+	"additionalProperties": false
+}`
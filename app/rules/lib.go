@@ -10,6 +10,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/stocklevel"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/tag"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -32,6 +33,28 @@ func ApplyRules(source string, tagStateChangeList []tag.TagStateChange) error {
 	}
 }
 
+// ApplyStockRules triggers the rules of the rule type of each stock level event
+func ApplyStockRules(events []stocklevel.Event) error {
+	ruleTypes := map[string]string{
+		stocklevel.EventOutOfStock: tag.OutOfStockEvent,
+		stocklevel.EventLowStock:   tag.LowStockEvent,
+		stocklevel.EventRestocked:  tag.RestockedEvent,
+	}
+
+	eventsByRuleType := make(map[string][]stocklevel.Event)
+	for _, event := range events {
+		ruleType := ruleTypes[event.Event]
+		eventsByRuleType[ruleType] = append(eventsByRuleType[ruleType], event)
+	}
+
+	for ruleType, ruleEvents := range eventsByRuleType {
+		if err := TriggerRules(config.AppConfig.RulesUrl+config.AppConfig.TriggerRulesEndpoint+"?ruletype="+ruleType, ruleEvents); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func TriggerRules(triggerRulesEndpoint string, data interface{}) error {
 	timeout := time.Duration(config.AppConfig.EndpointConnectionTimedOutSeconds) * time.Second
 	client := &http.Client{
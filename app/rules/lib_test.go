@@ -9,6 +9,7 @@ package rules
 import (
 	"encoding/json"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/stocklevel"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/tag"
 	"io/ioutil"
 	"net/http"
@@ -117,3 +118,41 @@ func TestTriggerRules_TimeOut(t *testing.T) {
 		t.Errorf("Expecting timeout, but error was nil")
 	}
 }
+
+func TestApplyStockRules(t *testing.T) {
+	ruleTypes := make(map[string]int)
+	testServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var events []stocklevel.Event
+		body, err := ioutil.ReadAll(request.Body)
+		if err != nil {
+			t.Errorf(err.Error())
+		}
+		if err := json.Unmarshal(body, &events); err != nil {
+			t.Errorf(err.Error())
+		}
+		ruleTypes[request.URL.Query().Get("ruletype")] += len(events)
+		writer.WriteHeader(http.StatusOK)
+	}))
+
+	defer testServer.Close()
+
+	config.AppConfig.RulesUrl = testServer.URL
+	config.AppConfig.TriggerRulesEndpoint = "/triggerrules"
+
+	events := []stocklevel.Event{
+		{Event: stocklevel.EventLowStock, ProductID: "00111111"},
+		{Event: stocklevel.EventLowStock, ProductID: "00222222"},
+		{Event: stocklevel.EventOutOfStock, ProductID: "00333333"},
+		{Event: stocklevel.EventRestocked, ProductID: "00444444"},
+	}
+	if err := ApplyStockRules(events); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]int{tag.LowStockEvent: 2, tag.OutOfStockEvent: 1, tag.RestockedEvent: 1}
+	for ruleType, count := range expected {
+		if ruleTypes[ruleType] != count {
+			t.Errorf("Expected %d events for rule type %s, got %d", count, ruleType, ruleTypes[ruleType])
+		}
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
 	"github.com/lib/pq"
 	"github.com/pkg/errors"
+	"sync"
 	"time"
 )
 
@@ -21,6 +22,12 @@ const (
 	rspConfigTable = "rspconfig"
 	jsonb          = "data"
 	deviceIdColumn = "device_id"
+
+	// statistics kept alongside the RSP, Upsert leaves them untouched since RSP does
+	// not marshal them
+	lastInventoryDataColumn  = "last_inventory_data"
+	inventoryDataCountColumn = "inventory_data_count"
+	readCountColumn          = "read_count"
 )
 
 // Value implements driver.Valuer interfaces
@@ -38,6 +45,16 @@ func (rsp *RSP) Scan(value interface{}) error {
 	return json.Unmarshal(b, rsp)
 }
 
+// Scan implements sql.Scanner interfaces
+func (status *Status) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, status)
+}
+
 // FindRSP searches DB for RSP based on the device_id value
 // Returns the RSP if found or empty RSP if it does not exist
 func FindRSP(dbs *sql.DB, deviceId string) (*RSP, error) {
@@ -112,3 +129,176 @@ func Upsert(dbs *sql.DB, rsp *RSP) error {
 	mSuccess.Add(1)
 	return nil
 }
+
+// FindAllStatus returns all sensors along with their inventory_data statistics, ordered by device_id
+func FindAllStatus(dbs *sql.DB) ([]Status, error) {
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`Sensor.FindAllStatus.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`Sensor.FindAllStatus.Success`, nil)
+	mFindErr := metrics.GetOrRegisterGauge("Sensor.FindAllStatus.Find-Error", nil)
+
+	selectQuery := fmt.Sprintf(`SELECT %s FROM %s ORDER BY %s ->> %s`,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteIdentifier(rspConfigTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(deviceIdColumn),
+	)
+
+	rows, err := dbs.Query(selectQuery)
+	if err != nil {
+		mFindErr.Update(1)
+		return nil, errors.Wrap(err, "error in finding rsps")
+	}
+	defer rows.Close()
+
+	statuses := make([]Status, 0)
+	for rows.Next() {
+		var status Status
+		if err := rows.Scan(&status); err != nil {
+			mFindErr.Update(1)
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	if err = rows.Err(); err != nil {
+		mFindErr.Update(1)
+		return nil, err
+	}
+
+	mSuccess.Update(1)
+	return statuses, nil
+}
+
+// FindStatus returns the sensor along with its inventory_data statistics, or nil if it does not exist
+func FindStatus(dbs *sql.DB, deviceId string) (*Status, error) {
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`Sensor.FindStatus.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`Sensor.FindStatus.Success`, nil)
+	mFindErr := metrics.GetOrRegisterGauge("Sensor.FindStatus.Find-Error", nil)
+
+	selectQuery := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ->> %s = $1 LIMIT 1`,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteIdentifier(rspConfigTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(deviceIdColumn),
+	)
+
+	status := new(Status)
+	if err := dbs.QueryRow(selectQuery, deviceId).Scan(status); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+
+		mFindErr.Update(1)
+		return nil, errors.Wrapf(err, "error in finding rsp")
+	}
+
+	mSuccess.Update(1)
+	return status, nil
+}
+
+// inventoryDataStats are the inventory_data statistics of a sensor not yet flushed
+type inventoryDataStats struct {
+	lastInventoryData  int64
+	inventoryDataCount int64
+	readCount          int64
+}
+
+// pendingStats holds the statistics recorded since the last flush, by device id
+var pendingStats = struct {
+	sync.Mutex
+	bySensor map[string]*inventoryDataStats
+}{bySensor: make(map[string]*inventoryDataStats)}
+
+// RecordInventoryData records an inventory_data message of the sensor holding the given
+// number of reads, received at receivedOn. Statistics are kept in memory and written to
+// the database by FlushInventoryData, so recording does not cost a statement per message.
+func RecordInventoryData(deviceId string, reads int, receivedOn int64) {
+	pendingStats.Lock()
+	defer pendingStats.Unlock()
+
+	stats, ok := pendingStats.bySensor[deviceId]
+	if !ok {
+		stats = new(inventoryDataStats)
+		pendingStats.bySensor[deviceId] = stats
+	}
+	if receivedOn > stats.lastInventoryData {
+		stats.lastInventoryData = receivedOn
+	}
+	stats.inventoryDataCount++
+	stats.readCount += int64(reads)
+}
+
+// FlushInventoryData adds the statistics recorded since the last flush to those of the
+// sensors in the database, in a single statement. Statistics that could not be written
+// are kept for the next flush.
+func FlushInventoryData(dbs *sql.DB) error {
+
+	// Metrics
+	mFlushErr := metrics.GetOrRegisterGauge("Sensor.FlushInventoryData.Error", nil)
+
+	pendingStats.Lock()
+	flushing := pendingStats.bySensor
+	pendingStats.bySensor = make(map[string]*inventoryDataStats)
+	pendingStats.Unlock()
+
+	if len(flushing) == 0 {
+		return nil
+	}
+
+	deviceIds := make([]string, 0, len(flushing))
+	lastInventoryData := make([]int64, 0, len(flushing))
+	inventoryDataCounts := make([]int64, 0, len(flushing))
+	readCounts := make([]int64, 0, len(flushing))
+	for deviceId, stats := range flushing {
+		deviceIds = append(deviceIds, deviceId)
+		lastInventoryData = append(lastInventoryData, stats.lastInventoryData)
+		inventoryDataCounts = append(inventoryDataCounts, stats.inventoryDataCount)
+		readCounts = append(readCounts, stats.readCount)
+	}
+
+	updateStmt := fmt.Sprintf(`UPDATE %[1]s SET %[2]s = %[1]s.%[2]s || jsonb_build_object(
+			%[3]s, GREATEST(COALESCE((%[1]s.%[2]s ->> %[3]s)::bigint, 0), pending.last_inventory_data),
+			%[4]s, COALESCE((%[1]s.%[2]s ->> %[4]s)::bigint, 0) + pending.inventory_data_count,
+			%[5]s, COALESCE((%[1]s.%[2]s ->> %[5]s)::bigint, 0) + pending.read_count)
+		FROM unnest($1::text[], $2::bigint[], $3::bigint[], $4::bigint[])
+			AS pending(device_id, last_inventory_data, inventory_data_count, read_count)
+		WHERE %[1]s.%[2]s ->> %[6]s = pending.device_id`,
+		pq.QuoteIdentifier(rspConfigTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(lastInventoryDataColumn),
+		pq.QuoteLiteral(inventoryDataCountColumn),
+		pq.QuoteLiteral(readCountColumn),
+		pq.QuoteLiteral(deviceIdColumn),
+	)
+
+	if _, err := dbs.Exec(updateStmt, pq.Array(deviceIds), pq.Array(lastInventoryData),
+		pq.Array(inventoryDataCounts), pq.Array(readCounts)); err != nil {
+		mFlushErr.Update(1)
+		restorePendingStats(flushing)
+		return errors.Wrap(err, "error in flushing inventory_data statistics")
+	}
+	return nil
+}
+
+// restorePendingStats merges statistics that could not be flushed back into those
+// recorded since
+func restorePendingStats(unflushed map[string]*inventoryDataStats) {
+	pendingStats.Lock()
+	defer pendingStats.Unlock()
+
+	for deviceId, stats := range unflushed {
+		pending, ok := pendingStats.bySensor[deviceId]
+		if !ok {
+			pendingStats.bySensor[deviceId] = stats
+			continue
+		}
+		if stats.lastInventoryData > pending.lastInventoryData {
+			pending.lastInventoryData = stats.lastInventoryData
+		}
+		pending.inventoryDataCount += stats.inventoryDataCount
+		pending.readCount += stats.readCount
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/edgexfoundry/go-mod-core-contracts/models"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/config"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/jsonrpc"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/web"
 	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/helper"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -58,6 +59,34 @@ func refreshSensorBasicInfo(dbs *sql.DB, deviceId string, insertDefaultsOnError
 	return rsp, nil
 }
 
+// RefreshBasicInfo retrieves the basic info of a known sensor from the RSP Controller and
+// stores it. Returns web.ErrNotFound for a sensor that is not stored, and web.ErrBadGateway
+// when the RSP Controller cannot be reached.
+func RefreshBasicInfo(dbs *sql.DB, deviceId string) (*RSP, error) {
+	rsp, err := FindRSP(dbs, deviceId)
+	if err != nil {
+		return nil, err
+	}
+	if rsp == nil {
+		return nil, errors.Wrapf(web.ErrNotFound, "no sensor %s", deviceId)
+	}
+
+	info, err := QueryBasicInfo(deviceId)
+	if err != nil {
+		return nil, errors.Wrapf(web.ErrBadGateway,
+			"unable to query sensor basic info from RSP Controller for sensor %s: %v", deviceId, err)
+	}
+	rsp.Personality = Personality(info.Personality)
+	rsp.Aliases = info.Aliases
+	rsp.FacilityId = info.FacilityId
+	rsp.UpdatedOn = helper.UnixMilliNow()
+
+	if err = Upsert(dbs, rsp); err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
+
 // GetOrCreateRSP returns a pointer to an RSP if found in the DB, and if
 // not found in the DB, a record will be created and added, then returned to the caller
 // error is only non-nil when there is an issue communicating with the DB
@@ -33,6 +33,23 @@ type RSP struct {
 	IsInDeepScan bool        `json:"-" db:"-"`
 }
 
+// Response is the model used to return the query response
+type Response struct {
+	Results interface{} `json:"results"`
+}
+
+// Status is an RSP along with statistics of the inventory_data it has sent
+//swagger:model Sensor
+type Status struct {
+	RSP
+	// Time in milliseconds the last inventory_data of the sensor was received
+	LastInventoryData int64 `json:"last_inventory_data"`
+	// Number of inventory_data messages received from the sensor
+	InventoryDataCount int64 `json:"inventory_data_count"`
+	// Number of tag reads received from the sensor
+	ReadCount int64 `json:"read_count"`
+}
+
 func NewRSP(deviceId string) *RSP {
 	rsp := RSP{
 		DeviceId:    deviceId,
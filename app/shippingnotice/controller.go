@@ -0,0 +1,412 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package shippingnotice
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/tag"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/statemodel"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/web"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/helper"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+const (
+	shippingNoticesTable = "shippingnotices"
+	tagsTable            = "tags"
+	jsonb                = "data"
+	asnIDColumn          = "asn_id"
+	siteIDColumn         = "site_id"
+	createdColumn        = "created"
+	epcColumn            = "epc"
+	facilityColumn       = "facility_id"
+	productIDColumn      = "product_id"
+	arrivedColumn        = "arrived"
+)
+
+// Upsert records a shipping notice. When the ASN was already recorded its EPCs and event
+// time are replaced, while the time it was first recorded is kept.
+func Upsert(dbs *sql.DB, notice ShippingNotice) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`Inventory.ShippingNotice.Upsert.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`Inventory.ShippingNotice.Upsert.Success`, nil)
+	mUpsertErr := metrics.GetOrRegisterGauge(`Inventory.ShippingNotice.Upsert.Error`, nil)
+	mUpsertLatency := metrics.GetOrRegisterTimer(`Inventory.ShippingNotice.Upsert.Latency`, nil)
+
+	obj, err := json.Marshal(notice)
+	if err != nil {
+		return err
+	}
+
+	upsertStmt := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)
+									 ON CONFLICT (( %s ->> %s ))
+									 DO UPDATE SET %s = %s || jsonb_build_object(%s, %s.%s -> %s); `,
+		pq.QuoteIdentifier(shippingNoticesTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(string(obj)),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(asnIDColumn),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(string(obj)),
+		pq.QuoteLiteral(createdColumn),
+		pq.QuoteIdentifier(shippingNoticesTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(createdColumn),
+	)
+
+	upsertTimer := time.Now()
+	_, err = dbs.Exec(upsertStmt)
+	mUpsertLatency.Update(time.Since(upsertTimer))
+	if err != nil {
+		mUpsertErr.Update(1)
+		return errors.Wrap(err, "error upserting shipping notice")
+	}
+
+	mSuccess.Update(1)
+	return nil
+}
+
+// Process processes the list of epcs of a shipping notice. If the epc does not exist in the DB
+// an entry is created with a default facility config.AppConfig.AdvancedShippingNoticeFacilityID
+// and an epc context identifying it as a shipping notice. If the epc does exist, then only the
+// epc context value is updated. The shipment is then recorded so it can be reconciled.
+func Process(dbs *sql.DB, asn tag.AdvanceShippingNotice) (ProcessResult, error) {
+
+	result := ProcessResult{ASNID: asn.ID, Status: ProcessStatusError}
+
+	if asn.ID == "" || asn.EventTime == "" || asn.SiteID == "" || asn.Items == nil {
+		return result, errors.Wrap(web.ErrValidation, "ASN is missing data")
+	}
+
+	var tagData []tag.Tag
+	var asnEpcs []string
+
+	for _, asnItem := range asn.Items {
+		for _, asnEpc := range asnItem.EPCs {
+			// create a temporary tag so we can check if it's whitelisted
+			tempTag := tag.Tag{}
+			tempTag.Epc = asnEpc
+			tempTag.ProductID, tempTag.URI, _ = tag.DecodeTagData(asnEpc)
+			// TODO: why aren't we checking for invalid tag encodings?
+
+			if len(config.AppConfig.EpcFilters) > 0 {
+				// ignore tags that don't match our filters
+				if !statemodel.IsTagWhitelisted(tempTag.Epc, config.AppConfig.EpcFilters) {
+					result.Filtered++
+					continue
+				}
+			}
+			asnEpcs = append(asnEpcs, asnEpc)
+
+			// marshal the ASNContext
+			asnContextBytes, err := json.Marshal(tag.ASNContext{
+				ASNID:     asn.ID,
+				EventTime: asn.EventTime,
+				SiteID:    asn.SiteID,
+				ItemGTIN:  asnItem.ItemGTIN,
+				ItemID:    asnItem.ItemID,
+			})
+			if err != nil {
+				return result, errors.Wrap(err, "Unable to marshal ASNContext")
+			}
+
+			// If the tag exists, update it with the new EPCContext.
+			// If it is new, insert it with default FacilityID
+			// Note: If bottlenecks may need to redesign to eliminate large number
+			// of queries to DB currently this will make a call to the DB PER tag
+			tagFromDB, err := tag.FindByEpc(dbs, tempTag.Epc)
+			if err != nil {
+				return result, errors.Wrap(err, "error retrieving tag from database")
+			}
+			if tagFromDB.IsEmpty() {
+				// Tag is not in database, add with defaults
+				tempTag.FacilityID = config.AppConfig.AdvancedShippingNoticeFacilityID
+				tempTag.EpcContext = string(asnContextBytes)
+				tagData = append(tagData, tempTag)
+			} else {
+				// Found tag, only update the epc context
+				tagFromDB.EpcContext = string(asnContextBytes)
+				tagData = append(tagData, tagFromDB)
+			}
+		}
+	}
+
+	if len(tagData) > 0 {
+		if err := tag.Replace(dbs, tagData); err != nil {
+			return result, errors.Wrap(err, "error replacing tags")
+		}
+	}
+
+	// track the shipment so it can be reconciled against the tags that are received
+	if err := Upsert(dbs, ShippingNotice{
+		ASNID:     asn.ID,
+		SiteID:    asn.SiteID,
+		EventTime: asn.EventTime,
+		Created:   helper.UnixMilliNow(),
+		EPCs:      asnEpcs,
+	}); err != nil {
+		return result, errors.Wrap(err, "error recording shipping notice")
+	}
+
+	result.Status = ProcessStatusProcessed
+	result.EPCs = len(asnEpcs)
+	return result, nil
+}
+
+// FindByID retrieves a shipping notice by ASN ID, returning web.ErrNotFound when it does not exist
+func FindByID(dbs *sql.DB, asnID string) (ShippingNotice, error) {
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`Inventory.ShippingNotice.FindByID.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`Inventory.ShippingNotice.FindByID.Success`, nil)
+	mFindErr := metrics.GetOrRegisterGauge(`Inventory.ShippingNotice.FindByID.Find-Error`, nil)
+
+	selectQuery := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ->> %s = %s LIMIT 1`,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteIdentifier(shippingNoticesTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(asnIDColumn),
+		pq.QuoteLiteral(asnID),
+	)
+
+	var notice ShippingNotice
+	if err := dbs.QueryRow(selectQuery).Scan(&notice); err != nil {
+		if err == sql.ErrNoRows {
+			return ShippingNotice{}, errors.Wrapf(web.ErrNotFound, "shipping notice %s not found", asnID)
+		}
+		mFindErr.Update(1)
+		return ShippingNotice{}, err
+	}
+
+	mSuccess.Update(1)
+	return notice, nil
+}
+
+// FindAll retrieves the shipping notices of a site recorded between start and end. An empty
+// site matches all sites and a zero end time means no upper bound.
+func FindAll(dbs *sql.DB, siteID string, start int64, end int64) ([]ShippingNotice, error) {
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`Inventory.ShippingNotice.FindAll.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`Inventory.ShippingNotice.FindAll.Success`, nil)
+	mFindErr := metrics.GetOrRegisterGauge(`Inventory.ShippingNotice.FindAll.Find-Error`, nil)
+
+	conditions := []string{
+		fmt.Sprintf(`(%s ->> %s)::bigint >= %d`, pq.QuoteIdentifier(jsonb), pq.QuoteLiteral(createdColumn), start),
+	}
+	if end > 0 {
+		conditions = append(conditions,
+			fmt.Sprintf(`(%s ->> %s)::bigint <= %d`, pq.QuoteIdentifier(jsonb), pq.QuoteLiteral(createdColumn), end))
+	}
+	if siteID != "" {
+		conditions = append(conditions,
+			fmt.Sprintf(`%s ->> %s = %s`, pq.QuoteIdentifier(jsonb), pq.QuoteLiteral(siteIDColumn), pq.QuoteLiteral(siteID)))
+	}
+
+	selectQuery := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ORDER BY (%s ->> %s)::bigint`,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteIdentifier(shippingNoticesTable),
+		strings.Join(conditions, " AND "),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(createdColumn),
+	)
+
+	rows, err := dbs.Query(selectQuery)
+	if err != nil {
+		mFindErr.Update(1)
+		return nil, errors.Wrap(err, "error retrieving shipping notices")
+	}
+	defer rows.Close()
+
+	notices := make([]ShippingNotice, 0)
+	for rows.Next() {
+		var notice ShippingNotice
+		if err := rows.Scan(&notice); err != nil {
+			mFindErr.Update(1)
+			return nil, err
+		}
+		notices = append(notices, notice)
+	}
+	if err := rows.Err(); err != nil {
+		mFindErr.Update(1)
+		return nil, err
+	}
+
+	mSuccess.Update(1)
+	return notices, nil
+}
+
+// Reconcile compares the EPCs of a shipping notice against the tags in the database.
+// An EPC is received once it has been read at or after the time the ASN was recorded.
+// Tags of the shipped products that arrived at the site since then, but are not listed
+// in the shipment, are reported as overage.
+func Reconcile(dbs *sql.DB, notice ShippingNotice) (Reconciliation, error) {
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`Inventory.ShippingNotice.Reconcile.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`Inventory.ShippingNotice.Reconcile.Success`, nil)
+	mFindErr := metrics.GetOrRegisterGauge(`Inventory.ShippingNotice.Reconcile.Find-Error`, nil)
+	mReconcileLatency := metrics.GetOrRegisterTimer(`Inventory.ShippingNotice.Reconcile.Latency`, nil)
+
+	reconcileTimer := time.Now()
+
+	shippedTags, err := findTags(dbs, fmt.Sprintf(`%s ->> %s IN (%s)`,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(epcColumn),
+		quoteLiterals(notice.EPCs),
+	))
+	if err != nil {
+		mFindErr.Update(1)
+		return Reconciliation{}, err
+	}
+
+	productIDs := make(map[string]bool)
+	for _, epc := range notice.EPCs {
+		if productID, _, err := tag.DecodeTagData(epc); err == nil {
+			productIDs[productID] = true
+		}
+	}
+	products := make([]string, 0, len(productIDs))
+	for productID := range productIDs {
+		products = append(products, productID)
+	}
+
+	arrivedTags, err := findTags(dbs, fmt.Sprintf(`%s ->> %s = %s AND %s ->> %s IN (%s) AND (%s ->> %s)::bigint >= %d`,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(facilityColumn),
+		pq.QuoteLiteral(notice.SiteID),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(productIDColumn),
+		quoteLiterals(products),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(arrivedColumn),
+		notice.Created,
+	))
+	if err != nil {
+		mFindErr.Update(1)
+		return Reconciliation{}, err
+	}
+
+	mReconcileLatency.Update(time.Since(reconcileTimer))
+	mSuccess.Update(1)
+	return reconcile(notice, shippedTags, arrivedTags), nil
+}
+
+// reconcile builds the reconciliation of a shipping notice from the tags of its EPCs
+// and the tags of its products that arrived at the site after it was recorded
+func reconcile(notice ShippingNotice, shippedTags []tag.Tag, arrivedTags []tag.Tag) Reconciliation {
+	result := Reconciliation{
+		ASNID:     notice.ASNID,
+		SiteID:    notice.SiteID,
+		EventTime: notice.EventTime,
+		Created:   notice.Created,
+		Expected:  len(notice.EPCs),
+		Received:  []string{},
+		Missing:   []string{},
+		Overage:   []string{},
+	}
+
+	shipped := make(map[string]tag.Tag, len(shippedTags))
+	for _, shippedTag := range shippedTags {
+		shipped[shippedTag.Epc] = shippedTag
+	}
+
+	listed := make(map[string]bool, len(notice.EPCs))
+	for _, epc := range notice.EPCs {
+		listed[epc] = true
+		shippedTag, ok := shipped[epc]
+		if ok && shippedTag.IsTagReadByRspController() && shippedTag.LastRead >= notice.Created {
+			result.Received = append(result.Received, epc)
+		} else {
+			result.Missing = append(result.Missing, epc)
+		}
+	}
+
+	for _, arrivedTag := range arrivedTags {
+		if !listed[arrivedTag.Epc] {
+			result.Overage = append(result.Overage, arrivedTag.Epc)
+		}
+	}
+
+	sort.Strings(result.Received)
+	sort.Strings(result.Missing)
+	sort.Strings(result.Overage)
+
+	switch {
+	case len(result.Received) == 0:
+		result.Status = StatusOpen
+	case len(result.Missing) > 0:
+		result.Status = StatusPartiallyReceived
+	default:
+		result.Status = StatusReceived
+	}
+
+	return result
+}
+
+func findTags(dbs *sql.DB, condition string) ([]tag.Tag, error) {
+	selectQuery := fmt.Sprintf(`SELECT %s FROM %s WHERE %s`,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteIdentifier(tagsTable),
+		condition,
+	)
+
+	rows, err := dbs.Query(selectQuery)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving tags for shipping notice")
+	}
+	defer rows.Close()
+
+	var tags []tag.Tag
+	for rows.Next() {
+		var tagData tag.Tag
+		if err := rows.Scan(&tagData); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tagData)
+	}
+	return tags, rows.Err()
+}
+
+// quoteLiterals quotes values for use in an IN clause. An empty list yields NULL,
+// which matches nothing.
+func quoteLiterals(values []string) string {
+	if len(values) == 0 {
+		return "NULL"
+	}
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = pq.QuoteLiteral(value)
+	}
+	return strings.Join(quoted, ",")
+}
+
+// Value implements driver.Valuer interfaces
+func (notice ShippingNotice) Value() (driver.Value, error) {
+	return json.Marshal(notice)
+}
+
+// Scan implements sql.Scanner interfaces
+func (notice *ShippingNotice) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, notice)
+}
@@ -0,0 +1,132 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package shippingnotice
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/tag"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/integrationtest"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/web"
+	"github.com/pkg/errors"
+)
+
+var dbHost integrationtest.DBHost
+
+func TestMain(m *testing.M) {
+	dbHost = integrationtest.InitHost("shippingnotice_test")
+	exitCode := m.Run()
+	dbHost.Close()
+	os.Exit(exitCode)
+}
+
+func TestReconcile(t *testing.T) {
+	notice := ShippingNotice{
+		ASNID:   "AS876422",
+		SiteID:  "store001",
+		Created: 1000,
+		EPCs:    []string{"received", "not-read", "read-before", "unknown"},
+	}
+
+	shippedTags := []tag.Tag{
+		{Epc: "received", FacilityID: "store001", LastRead: 1500, EpcState: "present"},
+		// only exists because of the ASN
+		{Epc: "not-read", EpcContext: `{"asnId":"AS876422","eventTime":"t","siteId":"store001","itemGtin":"g","itemId":"i"}`},
+		{Epc: "read-before", FacilityID: "store001", LastRead: 500, EpcState: "present"},
+	}
+	arrivedTags := []tag.Tag{
+		{Epc: "received", FacilityID: "store001", Arrived: 1500},
+		{Epc: "extra", FacilityID: "store001", Arrived: 1600},
+	}
+
+	expected := Reconciliation{
+		ASNID:    "AS876422",
+		SiteID:   "store001",
+		Created:  1000,
+		Status:   StatusPartiallyReceived,
+		Expected: 4,
+		Received: []string{"received"},
+		Missing:  []string{"not-read", "read-before", "unknown"},
+		Overage:  []string{"extra"},
+	}
+
+	result := reconcile(notice, shippedTags, arrivedTags)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %+v, received %+v", expected, result)
+	}
+
+	if result := reconcile(notice, nil, nil); result.Status != StatusOpen {
+		t.Errorf("Expected status %s, received %s", StatusOpen, result.Status)
+	}
+
+	notice.EPCs = []string{"received"}
+	if result := reconcile(notice, shippedTags, nil); result.Status != StatusReceived {
+		t.Errorf("Expected status %s, received %s", StatusReceived, result.Status)
+	}
+}
+
+func TestUpsertAndFind(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	notice := ShippingNotice{
+		ASNID:     "AS876422",
+		SiteID:    "store001",
+		EventTime: "2019-03-12T10:58:07.000Z",
+		Created:   1000,
+		EPCs:      []string{"30143639F84191AD22900204"},
+	}
+	if err := Upsert(testDB.DB, notice); err != nil {
+		t.Fatalf("Error upserting shipping notice %s", err.Error())
+	}
+
+	// Updating the ASN keeps the time it was first recorded
+	updated := notice
+	updated.Created = 5000
+	updated.EPCs = []string{"30143639F84191AD22900204", "30143639F84191AD66100107"}
+	if err := Upsert(testDB.DB, updated); err != nil {
+		t.Fatalf("Error upserting shipping notice %s", err.Error())
+	}
+
+	found, err := FindByID(testDB.DB, notice.ASNID)
+	if err != nil {
+		t.Fatalf("Error finding shipping notice %s", err.Error())
+	}
+	if found.Created != notice.Created || len(found.EPCs) != 2 {
+		t.Errorf("Unexpected shipping notice %+v", found)
+	}
+
+	if _, err := FindByID(testDB.DB, "unknown"); errors.Cause(err) != web.ErrNotFound {
+		t.Errorf("Expected not found error, received %v", err)
+	}
+
+	notices, err := FindAll(testDB.DB, "store001", 0, 2000)
+	if err != nil {
+		t.Fatalf("Error finding shipping notices %s", err.Error())
+	}
+	if len(notices) != 1 {
+		t.Errorf("Expected 1 shipping notice, received %d", len(notices))
+	}
+
+	notices, err = FindAll(testDB.DB, "store002", 0, 0)
+	if err != nil {
+		t.Fatalf("Error finding shipping notices %s", err.Error())
+	}
+	if len(notices) != 0 {
+		t.Errorf("Expected no shipping notices, received %d", len(notices))
+	}
+
+	reconciliation, err := Reconcile(testDB.DB, found)
+	if err != nil {
+		t.Fatalf("Error reconciling shipping notice %s", err.Error())
+	}
+	if reconciliation.Status != StatusOpen || len(reconciliation.Missing) != 2 {
+		t.Errorf("Unexpected reconciliation %+v", reconciliation)
+	}
+}
@@ -0,0 +1,77 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package shippingnotice
+
+const (
+	// StatusOpen is the status of a shipment of which no items were received
+	StatusOpen = "open"
+	// StatusPartiallyReceived is the status of a shipment of which some items were received
+	StatusPartiallyReceived = "partially_received"
+	// StatusReceived is the status of a shipment of which all items were received
+	StatusReceived = "received"
+	// ProcessStatusProcessed is the result of a shipping notice that was processed
+	ProcessStatusProcessed = "processed"
+	// ProcessStatusError is the result of a shipping notice that could not be processed
+	ProcessStatusError = "error"
+)
+
+// ShippingNotice is an advance shipping notice tracked for receiving reconciliation
+type ShippingNotice struct {
+	// ID of the shipment
+	ASNID string `json:"asn_id"`
+	// Site the shipment is sent to, matched against the facility of received tags
+	SiteID string `json:"site_id"`
+	// Time provided by the ASN indicating when it was updated
+	EventTime string `json:"event_time"`
+	// Millisecond epoch time the ASN was first recorded
+	Created int64 `json:"created"`
+	// EPCs listed in the shipment
+	EPCs []string `json:"epcs"`
+}
+
+// Reconciliation compares the EPCs of a shipment against the tags that were received
+//swagger:model Reconciliation
+type Reconciliation struct {
+	// ID of the shipment
+	ASNID string `json:"asn_id"`
+	// Site the shipment is sent to
+	SiteID string `json:"site_id"`
+	// Time provided by the ASN indicating when it was updated
+	EventTime string `json:"event_time"`
+	// Millisecond epoch time the ASN was first recorded
+	Created int64 `json:"created"`
+	// Either 'open', 'partially_received' or 'received'
+	Status string `json:"status"`
+	// Number of EPCs listed in the shipment
+	Expected int `json:"expected"`
+	// EPCs of the shipment that were read since the ASN was recorded
+	Received []string `json:"received"`
+	// EPCs of the shipment that were not read since the ASN was recorded
+	Missing []string `json:"missing"`
+	// EPCs of shipped products that arrived at the site since the ASN was recorded
+	// but are not listed in the shipment
+	Overage []string `json:"overage"`
+}
+
+// ProcessResult is the outcome of processing a single advance shipping notice
+type ProcessResult struct {
+	// ID of the shipment
+	ASNID string `json:"asn_id"`
+	// Either 'processed' or 'error'
+	Status string `json:"status"`
+	// Number of EPCs of the shipment that were recorded
+	EPCs int `json:"epcs"`
+	// Number of EPCs of the shipment ignored because they do not match the configured epc filters
+	Filtered int `json:"filtered"`
+	// Reason the shipment could not be processed
+	Error string `json:"error,omitempty"`
+}
+
+// Response is the model used to return the query response
+type Response struct {
+	Results interface{} `json:"results"`
+}
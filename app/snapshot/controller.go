@@ -0,0 +1,222 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package snapshot
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/web"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+const (
+	snapshotsTable  = "snapshots"
+	tagsTable       = "tags"
+	jsonb           = "data"
+	timestampColumn = "timestamp"
+	facilityColumn  = "facility_id"
+	productIDColumn = "product_id"
+	epcStateColumn  = "epc_state"
+	epcColumn       = "epc"
+	epcsColumn      = "epcs"
+	lastReadColumn  = "last_read"
+	departedColumn  = "departed_at"
+	presentState    = "present"
+	departedState   = "departed"
+)
+
+// Take records the current number of present tags per facility and product, and the number
+// of tags that departed since the previous snapshot, taken at since. The EPCs of the present
+// tags are recorded when withEPCs is set. It returns the number of snapshot rows recorded.
+func Take(dbs *sql.DB, timestamp int64, since int64, withEPCs bool) (int64, error) {
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`Inventory.Snapshot.Take.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`Inventory.Snapshot.Take.Success`, nil)
+	mInsertErr := metrics.GetOrRegisterGauge(`Inventory.Snapshot.Take.Insert-Error`, nil)
+	mInsertLatency := metrics.GetOrRegisterTimer(`Inventory.Snapshot.Take.Insert-Latency`, nil)
+
+	epcsField := ""
+	if withEPCs {
+		// Departed tags are counted for the interval only, listing them would grow without bound
+		epcsField = fmt.Sprintf(`, %s, CASE WHEN state = %s THEN jsonb_agg(epc ORDER BY epc) END`,
+			pq.QuoteLiteral(epcsColumn), pq.QuoteLiteral(presentState))
+	}
+
+	// Tags that departed before departed_at was recorded only have their last read
+	insertStmt := fmt.Sprintf(`INSERT INTO %s (%s)
+		SELECT jsonb_strip_nulls(jsonb_build_object(%s, %d::bigint, %s, facility, %s, product, %s, state, %s, count(*)%s))
+		FROM (SELECT COALESCE(%s ->> %s, '') AS facility, COALESCE(%s ->> %s, '') AS product, %s ->> %s AS state,
+				%s ->> %s AS epc
+			FROM %s WHERE COALESCE(%s ->> %s, '') <> ''
+				AND (%s ->> %s <> %s OR COALESCE(%s ->> %s, %s ->> %s)::bigint > %d)) AS current
+		GROUP BY facility, product, state`,
+		pq.QuoteIdentifier(snapshotsTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(timestampColumn),
+		timestamp,
+		pq.QuoteLiteral(facilityColumn),
+		pq.QuoteLiteral(productIDColumn),
+		pq.QuoteLiteral(epcStateColumn),
+		pq.QuoteLiteral("count"),
+		epcsField,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(facilityColumn),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(productIDColumn),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(epcStateColumn),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(epcColumn),
+		pq.QuoteIdentifier(tagsTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(epcStateColumn),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(epcStateColumn),
+		pq.QuoteLiteral(departedState),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(departedColumn),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(lastReadColumn),
+		since,
+	)
+
+	insertTimer := time.Now()
+	result, err := dbs.Exec(insertStmt)
+	mInsertLatency.Update(time.Since(insertTimer))
+	if err != nil {
+		mInsertErr.Update(1)
+		return 0, errors.Wrap(err, "db.snapshots.Take()")
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		mInsertErr.Update(1)
+		return 0, err
+	}
+
+	mSuccess.Update(1)
+	return rows, nil
+}
+
+// Purge deletes the snapshots taken before the timestamp
+func Purge(dbs *sql.DB, before int64) error {
+	deleteStmt := fmt.Sprintf(`DELETE FROM %s WHERE (%s ->> %s)::bigint < %d`,
+		pq.QuoteIdentifier(snapshotsTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(timestampColumn),
+		before,
+	)
+
+	if _, err := dbs.Exec(deleteStmt); err != nil {
+		metrics.GetOrRegisterGauge(`Inventory.Snapshot.Purge.Delete-Error`, nil).Update(1)
+		return errors.Wrap(err, "db.snapshots.Purge()")
+	}
+	return nil
+}
+
+// FindAsOf returns the counts of the latest snapshot of each facility taken at or before
+// the time of the filter. When withEPCs is set, the EPCs recorded by the snapshot are
+// returned with each count of present tags, and web.ErrInvalidInput when the snapshot did
+// not record them.
+func FindAsOf(dbs *sql.DB, filter Filter, withEPCs bool) ([]AsOfCount, error) {
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`Inventory.Snapshot.FindAsOf.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`Inventory.Snapshot.FindAsOf.Success`, nil)
+	mFindErr := metrics.GetOrRegisterGauge(`Inventory.Snapshot.FindAsOf.Find-Error`, nil)
+	mFindLatency := metrics.GetOrRegisterTimer(`Inventory.Snapshot.FindAsOf.Find-Latency`, nil)
+
+	latestConditions := []string{
+		fmt.Sprintf(`(%s ->> %s)::bigint <= %d`, pq.QuoteIdentifier(jsonb), pq.QuoteLiteral(timestampColumn), filter.AsOf),
+	}
+	if filter.FacilityID != "" {
+		latestConditions = append(latestConditions,
+			fmt.Sprintf(`%s ->> %s = %s`, pq.QuoteIdentifier(jsonb), pq.QuoteLiteral(facilityColumn), pq.QuoteLiteral(filter.FacilityID)))
+	}
+	productCondition := "TRUE"
+	if filter.ProductID != "" {
+		productCondition = fmt.Sprintf(`snapshot.%s ->> %s = %s`,
+			pq.QuoteIdentifier(jsonb), pq.QuoteLiteral(productIDColumn), pq.QuoteLiteral(filter.ProductID))
+	}
+
+	selectQuery := fmt.Sprintf(`SELECT snapshot.%s FROM %s AS snapshot
+		JOIN (SELECT %s ->> %s AS facility, MAX((%s ->> %s)::bigint) AS latest FROM %s WHERE %s GROUP BY facility) AS latest
+		ON snapshot.%s ->> %s = latest.facility AND (snapshot.%s ->> %s)::bigint = latest.latest
+		WHERE %s`,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteIdentifier(snapshotsTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(facilityColumn),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(timestampColumn),
+		pq.QuoteIdentifier(snapshotsTable),
+		strings.Join(latestConditions, " AND "),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(facilityColumn),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(timestampColumn),
+		productCondition,
+	)
+
+	retrieveTimer := time.Now()
+	rows, err := dbs.Query(selectQuery)
+	if err != nil {
+		mFindErr.Update(1)
+		return nil, errors.Wrap(err, "db.snapshots.FindAsOf()")
+	}
+	defer rows.Close()
+
+	counts := make([]AsOfCount, 0)
+	for rows.Next() {
+		var snapshot Snapshot
+		if err := rows.Scan(&snapshot); err != nil {
+			mFindErr.Update(1)
+			return nil, err
+		}
+		if withEPCs && snapshot.EpcState == presentState && snapshot.EPCs == nil {
+			mFindErr.Update(1)
+			return nil, errors.Wrapf(web.ErrInvalidInput,
+				"EPCs were not recorded by the snapshot of facility %s taken at %d", snapshot.FacilityID, snapshot.Timestamp)
+		}
+		count := AsOfCount{
+			FacilityID:   snapshot.FacilityID,
+			ProductID:    snapshot.ProductID,
+			EpcState:     snapshot.EpcState,
+			Count:        snapshot.Count,
+			SnapshotTime: snapshot.Timestamp,
+		}
+		if withEPCs {
+			count.EPCs = snapshot.EPCs
+		}
+		counts = append(counts, count)
+	}
+	if err := rows.Err(); err != nil {
+		mFindErr.Update(1)
+		return nil, err
+	}
+	mFindLatency.Update(time.Since(retrieveTimer))
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].FacilityID != counts[j].FacilityID {
+			return counts[i].FacilityID < counts[j].FacilityID
+		}
+		if counts[i].ProductID != counts[j].ProductID {
+			return counts[i].ProductID < counts[j].ProductID
+		}
+		return counts[i].EpcState < counts[j].EpcState
+	})
+
+	mSuccess.Update(1)
+	return counts, nil
+}
@@ -0,0 +1,107 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package snapshot
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/tag"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/integrationtest"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/web"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+var dbHost integrationtest.DBHost
+
+func TestMain(m *testing.M) {
+	dbHost = integrationtest.InitHost("snapshot_test")
+	exitCode := m.Run()
+	dbHost.Close()
+	os.Exit(exitCode)
+}
+
+func TestTakeAndFindAsOf(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	insertTags(t, testDB.DB, []tag.Tag{
+		{Epc: "EPC1", FacilityID: "store001", ProductID: "00111111", Arrived: 500, LastRead: 500, EpcState: presentState},
+		{Epc: "EPC2", FacilityID: "store001", ProductID: "00111111", Arrived: 500, LastRead: 500, EpcState: departedState, DepartedAt: 800},
+		{Epc: "EPC3", FacilityID: "store002", ProductID: "00222222", Arrived: 500, LastRead: 500, EpcState: presentState},
+		// departed before the interval of the snapshot
+		{Epc: "EPC5", FacilityID: "store002", ProductID: "00222222", Arrived: 100, LastRead: 200, EpcState: departedState},
+	})
+
+	if rows, err := Take(testDB.DB, 1000, 500, true); err != nil || rows != 3 {
+		t.Fatalf("Expected 3 snapshot rows, got %d: %v", rows, err)
+	}
+
+	insertTags(t, testDB.DB, []tag.Tag{
+		{Epc: "EPC4", FacilityID: "store001", ProductID: "00111111", Arrived: 1500, LastRead: 1500, EpcState: presentState},
+	})
+
+	if _, err := Take(testDB.DB, 2000, 1000, false); err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := FindAsOf(testDB.DB, Filter{AsOf: 1500, FacilityID: "store001"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []AsOfCount{
+		{FacilityID: "store001", ProductID: "00111111", EpcState: departedState, Count: 1, SnapshotTime: 1000},
+		{FacilityID: "store001", ProductID: "00111111", EpcState: presentState, Count: 1, SnapshotTime: 1000, EPCs: []string{"EPC1"}},
+	}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, counts)
+	}
+
+	counts, err = FindAsOf(testDB.DB, Filter{AsOf: 2500, ProductID: "00111111"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// EPC2 departed before the interval of the latest snapshot
+	if len(counts) != 1 || counts[0].Count != 2 || counts[0].SnapshotTime != 2000 {
+		t.Errorf("Expected counts of the latest snapshot, got %+v", counts)
+	}
+
+	// The latest snapshot did not record EPCs
+	if _, err = FindAsOf(testDB.DB, Filter{AsOf: 2500, ProductID: "00111111"}, true); errors.Cause(err) != web.ErrInvalidInput {
+		t.Errorf("Expected invalid input without recorded EPCs, got %v", err)
+	}
+
+	if err := Purge(testDB.DB, 1500); err != nil {
+		t.Fatal(err)
+	}
+	if counts, err = FindAsOf(testDB.DB, Filter{AsOf: 1500}, false); err != nil || len(counts) != 0 {
+		t.Errorf("Expected purged snapshots, got %+v: %v", counts, err)
+	}
+}
+
+func insertTags(t *testing.T, db *sql.DB, tags []tag.Tag) {
+	for _, tagData := range tags {
+		obj, err := json.Marshal(tagData)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		insertStmt := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)`,
+			pq.QuoteIdentifier(tagsTable),
+			pq.QuoteIdentifier(jsonb),
+			pq.QuoteLiteral(string(obj)),
+		)
+		if _, err := db.Exec(insertStmt); err != nil {
+			t.Fatalf("Unable to insert tag: %s", err)
+		}
+	}
+}
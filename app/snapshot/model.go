@@ -0,0 +1,80 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package snapshot
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// Snapshot is the number of tags of a product in an epc_state at a facility at a point in
+// time. Present tags are counted as of that time, departed tags over the snapshot interval.
+type Snapshot struct {
+	// Millisecond epoch time the snapshot was taken
+	Timestamp int64 `json:"timestamp"`
+	// Facility of the tags
+	FacilityID string `json:"facility_id"`
+	// Product ID of the tags
+	ProductID string `json:"product_id"`
+	// Either 'present' or 'departed'
+	EpcState string `json:"epc_state"`
+	// Number of tags
+	Count int `json:"count"`
+	// EPCs of the present tags, only recorded when config.AppConfig.SnapshotRecordEpcs is set
+	EPCs []string `json:"epcs,omitempty"`
+}
+
+// Filter restricts the counts returned by an as-of query. Empty fields are not filtered on.
+type Filter struct {
+	// Millisecond epoch time the counts are returned for
+	AsOf       int64
+	FacilityID string
+	ProductID  string
+}
+
+// AsOfResponse is the inventory as it was at a past point in time
+//swagger:model AsOfResponse
+type AsOfResponse struct {
+	// Millisecond epoch time the inventory was requested for
+	Time int64 `json:"time"`
+	// Counts per facility, product and epc_state
+	Results []AsOfCount `json:"results"`
+}
+
+// AsOfCount is the number of tags of a product in an epc_state at a facility at a past point in time
+type AsOfCount struct {
+	// Facility of the tags
+	FacilityID string `json:"facility_id"`
+	// Product ID of the tags
+	ProductID string `json:"product_id"`
+	// Either 'present' or 'departed'
+	EpcState string `json:"epc_state"`
+	// Number of tags recorded by the latest snapshot taken at or before the requested time.
+	// Departed tags are those that departed in the interval ending with that snapshot.
+	Count int `json:"count"`
+	// Millisecond epoch time of the snapshot the count is taken from
+	SnapshotTime int64 `json:"snapshot_time"`
+	// EPCs of the present tags recorded by the snapshot, only returned when requested
+	EPCs []string `json:"epcs,omitempty"`
+}
+
+// Value implements driver.Valuer interfaces
+func (snapshot Snapshot) Value() (driver.Value, error) {
+	return json.Marshal(snapshot)
+}
+
+// Scan implements sql.Scanner interfaces
+func (snapshot *Snapshot) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, snapshot)
+}
@@ -0,0 +1,288 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package stocklevel
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/tag"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/web"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/helper"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+const (
+	thresholdsTable   = "stockthresholds"
+	tagsTable         = "tags"
+	jsonb             = "data"
+	productIDColumn   = "product_id"
+	facilityColumn    = "facility_id"
+	minQuantityColumn = "min_quantity"
+	epcStateColumn    = "epc_state"
+	presentState      = "present"
+)
+
+// ConfidenceFunc sets the confidence of tags
+type ConfidenceFunc func(tags []tag.Tag) error
+
+// evaluateMutex serializes evaluations so a status change raises a single event
+var evaluateMutex sync.Mutex
+
+// Upsert creates or updates the minimum quantity of the thresholds, keeping the
+// stock level of their last evaluation
+func Upsert(dbs *sql.DB, thresholds []Threshold) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`Inventory.StockLevel.Upsert.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`Inventory.StockLevel.Upsert.Success`, nil)
+	mUpsertErr := metrics.GetOrRegisterGauge(`Inventory.StockLevel.Upsert.Error`, nil)
+
+	for _, threshold := range thresholds {
+		obj, err := json.Marshal(Threshold{
+			ProductID:   threshold.ProductID,
+			FacilityID:  threshold.FacilityID,
+			MinQuantity: threshold.MinQuantity,
+		})
+		if err != nil {
+			return err
+		}
+
+		upsertStmt := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)
+									ON CONFLICT (( %s ->> %s ), ( %s ->> %s ))
+									DO UPDATE SET %s = %s.%s || jsonb_build_object(%s, %d);`,
+			pq.QuoteIdentifier(thresholdsTable),
+			pq.QuoteIdentifier(jsonb),
+			pq.QuoteLiteral(string(obj)),
+			pq.QuoteIdentifier(jsonb),
+			pq.QuoteLiteral(productIDColumn),
+			pq.QuoteIdentifier(jsonb),
+			pq.QuoteLiteral(facilityColumn),
+			pq.QuoteIdentifier(jsonb),
+			pq.QuoteIdentifier(thresholdsTable),
+			pq.QuoteIdentifier(jsonb),
+			pq.QuoteLiteral(minQuantityColumn),
+			threshold.MinQuantity,
+		)
+
+		if _, err := dbs.Exec(upsertStmt); err != nil {
+			mUpsertErr.Update(1)
+			return errors.Wrap(err, "db.stockthresholds.Upsert()")
+		}
+	}
+
+	mSuccess.Update(1)
+	return nil
+}
+
+// FindAll returns the thresholds of a facility and product, empty values matching all
+func FindAll(dbs *sql.DB, facilityID string, productID string) ([]Threshold, error) {
+	conditions := []string{"TRUE"}
+	if facilityID != "" {
+		conditions = append(conditions, matchCondition(facilityColumn, facilityID))
+	}
+	if productID != "" {
+		conditions = append(conditions, matchCondition(productIDColumn, productID))
+	}
+
+	return findThresholds(dbs, strings.Join(conditions, " AND "))
+}
+
+// Delete deletes the threshold of a product at a facility, returning web.ErrNotFound
+// when it does not exist
+func Delete(dbs *sql.DB, productID string, facilityID string) error {
+	deleteStmt := fmt.Sprintf(`DELETE FROM %s WHERE %s AND %s`,
+		pq.QuoteIdentifier(thresholdsTable),
+		matchCondition(productIDColumn, productID),
+		matchCondition(facilityColumn, facilityID),
+	)
+
+	result, err := dbs.Exec(deleteStmt)
+	if err != nil {
+		return errors.Wrap(err, "db.stockthresholds.Delete()")
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return errors.Wrapf(web.ErrNotFound, "no threshold for product %s at facility %s", productID, facilityID)
+	}
+	return nil
+}
+
+// Evaluate computes the stock level of the products of the tags that have a threshold at
+// the facility of the tag, and returns an event for each product whose status changed.
+// The stock level is the sum of the confidence of the present tags of the product.
+func Evaluate(dbs *sql.DB, tags []tag.Tag, applyConfidence ConfidenceFunc) ([]Event, error) {
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`Inventory.StockLevel.Evaluate.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`Inventory.StockLevel.Evaluate.Success`, nil)
+	mEvaluateErr := metrics.GetOrRegisterGauge(`Inventory.StockLevel.Evaluate.Error`, nil)
+	mEvents := metrics.GetOrRegisterGauge(`Inventory.StockLevel.Evaluate.Events`, nil)
+	mLatency := metrics.GetOrRegisterTimer(`Inventory.StockLevel.Evaluate.Latency`, nil)
+
+	// product and facility pairs of the tags
+	seen := make(map[[2]string]bool)
+	var pairs []string
+	for _, tagData := range tags {
+		key := [2]string{tagData.ProductID, tagData.FacilityID}
+		if tagData.ProductID == "" || tagData.FacilityID == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		pairs = append(pairs, fmt.Sprintf("(%s AND %s)",
+			matchCondition(productIDColumn, tagData.ProductID),
+			matchCondition(facilityColumn, tagData.FacilityID)))
+	}
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+
+	evaluateMutex.Lock()
+	defer evaluateMutex.Unlock()
+
+	evaluateTimer := time.Now()
+	defer func() { mLatency.Update(time.Since(evaluateTimer)) }()
+
+	thresholds, err := findThresholds(dbs, strings.Join(pairs, " OR "))
+	if err != nil {
+		mEvaluateErr.Update(1)
+		return nil, err
+	}
+
+	var events []Event
+	for _, threshold := range thresholds {
+		presentTags, err := findPresentTags(dbs, threshold.ProductID, threshold.FacilityID)
+		if err != nil {
+			mEvaluateErr.Update(1)
+			return events, err
+		}
+		if len(presentTags) > 0 {
+			if err := applyConfidence(presentTags); err != nil {
+				mEvaluateErr.Update(1)
+				return events, errors.Wrap(err, "error applying confidence")
+			}
+		}
+
+		quantity := 0.0
+		for _, presentTag := range presentTags {
+			quantity += presentTag.Confidence
+		}
+
+		previous := threshold.Status
+		threshold.Status = statusFor(quantity, threshold.MinQuantity)
+		threshold.Quantity = quantity
+		threshold.Evaluated = helper.UnixMilliNow()
+
+		if err := updateLevel(dbs, threshold); err != nil {
+			mEvaluateErr.Update(1)
+			return events, err
+		}
+
+		if event := eventFor(previous, threshold.Status); event != "" {
+			events = append(events, Event{
+				Event:          event,
+				ProductID:      threshold.ProductID,
+				FacilityID:     threshold.FacilityID,
+				MinQuantity:    threshold.MinQuantity,
+				Quantity:       quantity,
+				PreviousStatus: previous,
+				Timestamp:      threshold.Evaluated,
+			})
+		}
+	}
+
+	mEvents.Update(int64(len(events)))
+	mSuccess.Update(1)
+	return events, nil
+}
+
+// updateLevel records the stock level of the last evaluation of a threshold
+func updateLevel(dbs *sql.DB, threshold Threshold) error {
+	updateStmt := fmt.Sprintf(`UPDATE %s SET %s = %s || jsonb_build_object('status', $1::text, 'quantity', $2::float8, 'evaluated', $3::bigint)
+								WHERE %s AND %s`,
+		pq.QuoteIdentifier(thresholdsTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteIdentifier(jsonb),
+		matchCondition(productIDColumn, threshold.ProductID),
+		matchCondition(facilityColumn, threshold.FacilityID),
+	)
+
+	if _, err := dbs.Exec(updateStmt, threshold.Status, threshold.Quantity, threshold.Evaluated); err != nil {
+		return errors.Wrap(err, "db.stockthresholds.updateLevel()")
+	}
+	return nil
+}
+
+func findThresholds(dbs *sql.DB, condition string) ([]Threshold, error) {
+	selectQuery := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ORDER BY %s ->> %s, %s ->> %s`,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteIdentifier(thresholdsTable),
+		condition,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(facilityColumn),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(productIDColumn),
+	)
+
+	rows, err := dbs.Query(selectQuery)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving stock thresholds")
+	}
+	defer rows.Close()
+
+	thresholds := make([]Threshold, 0)
+	for rows.Next() {
+		var threshold Threshold
+		if err := rows.Scan(&threshold); err != nil {
+			return nil, err
+		}
+		thresholds = append(thresholds, threshold)
+	}
+
+	return thresholds, rows.Err()
+}
+
+func findPresentTags(dbs *sql.DB, productID string, facilityID string) ([]tag.Tag, error) {
+	selectQuery := fmt.Sprintf(`SELECT %s FROM %s WHERE %s AND %s AND %s`,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteIdentifier(tagsTable),
+		matchCondition(productIDColumn, productID),
+		matchCondition(facilityColumn, facilityID),
+		matchCondition(epcStateColumn, presentState),
+	)
+
+	rows, err := dbs.Query(selectQuery)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving present tags")
+	}
+	defer rows.Close()
+
+	var tags []tag.Tag
+	for rows.Next() {
+		var tagData tag.Tag
+		if err := rows.Scan(&tagData); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tagData)
+	}
+
+	return tags, rows.Err()
+}
+
+func matchCondition(column string, value string) string {
+	return fmt.Sprintf(`%s ->> %s = %s`, pq.QuoteIdentifier(jsonb), pq.QuoteLiteral(column), pq.QuoteLiteral(value))
+}
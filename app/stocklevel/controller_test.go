@@ -0,0 +1,139 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package stocklevel
+
+import (
+	"os"
+	"testing"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/tag"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/integrationtest"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/web"
+	"github.com/pkg/errors"
+)
+
+var dbHost integrationtest.DBHost
+
+func TestMain(m *testing.M) {
+	dbHost = integrationtest.InitHost("stocklevel_test")
+	exitCode := m.Run()
+	dbHost.Close()
+	os.Exit(exitCode)
+}
+
+func TestStatusFor(t *testing.T) {
+	tests := []struct {
+		quantity float64
+		expected string
+	}{
+		{0, StatusOutOfStock},
+		{0.9, StatusOutOfStock},
+		{1, StatusLowStock},
+		{4.5, StatusLowStock},
+		{5, StatusInStock},
+		{12, StatusInStock},
+	}
+
+	for _, test := range tests {
+		if status := statusFor(test.quantity, 5); status != test.expected {
+			t.Errorf("Expected status %s for quantity %f, got %s", test.expected, test.quantity, status)
+		}
+	}
+}
+
+func TestEventFor(t *testing.T) {
+	tests := []struct {
+		previous string
+		current  string
+		expected string
+	}{
+		{"", StatusInStock, ""},
+		{"", StatusLowStock, EventLowStock},
+		{"", StatusOutOfStock, EventOutOfStock},
+		{StatusInStock, StatusInStock, ""},
+		{StatusInStock, StatusLowStock, EventLowStock},
+		{StatusLowStock, StatusLowStock, ""},
+		{StatusLowStock, StatusOutOfStock, EventOutOfStock},
+		{StatusOutOfStock, StatusLowStock, EventLowStock},
+		{StatusOutOfStock, StatusInStock, EventRestocked},
+		{StatusLowStock, StatusInStock, EventRestocked},
+	}
+
+	for _, test := range tests {
+		if event := eventFor(test.previous, test.current); event != test.expected {
+			t.Errorf("Expected event '%s' from '%s' to '%s', got '%s'", test.expected, test.previous, test.current, event)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	productID := "00888446671424"
+	facilityID := "store001"
+
+	if err := Upsert(testDB.DB, []Threshold{{ProductID: productID, FacilityID: facilityID, MinQuantity: 2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	fullConfidence := func(tags []tag.Tag) error {
+		for i := range tags {
+			tags[i].Confidence = 1
+		}
+		return nil
+	}
+
+	presentTag := tag.Tag{Epc: "EPC1", ProductID: productID, FacilityID: facilityID, EpcState: presentState}
+	if err := tag.Replace(testDB.DB, []tag.Tag{presentTag}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := Evaluate(testDB.DB, []tag.Tag{presentTag}, fullConfidence)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Event != EventLowStock || events[0].Quantity != 1 {
+		t.Fatalf("Expected a low stock event, got %+v", events)
+	}
+
+	// no change, no event
+	if events, err = Evaluate(testDB.DB, []tag.Tag{presentTag}, fullConfidence); err != nil || len(events) != 0 {
+		t.Fatalf("Expected no event, got %+v: %v", events, err)
+	}
+
+	secondTag := tag.Tag{Epc: "EPC2", ProductID: productID, FacilityID: facilityID, EpcState: presentState}
+	if err := tag.Replace(testDB.DB, []tag.Tag{secondTag}); err != nil {
+		t.Fatal(err)
+	}
+	events, err = Evaluate(testDB.DB, []tag.Tag{secondTag}, fullConfidence)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Event != EventRestocked || events[0].PreviousStatus != StatusLowStock {
+		t.Fatalf("Expected a restocked event, got %+v", events)
+	}
+
+	// updating the minimum quantity keeps the status
+	if err := Upsert(testDB.DB, []Threshold{{ProductID: productID, FacilityID: facilityID, MinQuantity: 5}}); err != nil {
+		t.Fatal(err)
+	}
+	thresholds, err := FindAll(testDB.DB, facilityID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(thresholds) != 1 || thresholds[0].MinQuantity != 5 || thresholds[0].Status != StatusInStock {
+		t.Fatalf("Unexpected thresholds %+v", thresholds)
+	}
+
+	if err := Delete(testDB.DB, productID, facilityID); err != nil {
+		t.Fatal(err)
+	}
+	if err := Delete(testDB.DB, productID, facilityID); errors.Cause(err) != web.ErrNotFound {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+}
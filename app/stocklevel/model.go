@@ -0,0 +1,118 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package stocklevel
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// StatusInStock is the status of a product with at least the minimum quantity
+	StatusInStock = "in_stock"
+	// StatusLowStock is the status of a product below the minimum quantity
+	StatusLowStock = "low_stock"
+	// StatusOutOfStock is the status of a product with less than one item expected present
+	StatusOutOfStock = "out_of_stock"
+
+	// EventLowStock is raised when a product falls below its minimum quantity
+	EventLowStock = "low_stock"
+	// EventOutOfStock is raised when a product runs out of stock
+	EventOutOfStock = "out_of_stock"
+	// EventRestocked is raised when a low or out of stock product is back at its minimum quantity
+	EventRestocked = "restocked"
+)
+
+// Threshold is the minimum quantity of a product at a facility, along with the
+// stock level of the last evaluation
+//swagger:model StockThreshold
+type Threshold struct {
+	// Product ID
+	ProductID string `json:"product_id"`
+	// Facility of the product
+	FacilityID string `json:"facility_id"`
+	// Quantity below which the product is low on stock
+	MinQuantity int `json:"min_quantity"`
+	// Status of the last evaluation, either 'in_stock', 'low_stock' or 'out_of_stock'
+	Status string `json:"status,omitempty"`
+	// Confidence-weighted present count of the last evaluation
+	Quantity float64 `json:"quantity"`
+	// Millisecond epoch time of the last evaluation
+	Evaluated int64 `json:"evaluated,omitempty"`
+}
+
+// Event is raised when the stock status of a product at a facility changes
+type Event struct {
+	// Either 'low_stock', 'out_of_stock' or 'restocked'
+	Event string `json:"event"`
+	// Product ID
+	ProductID string `json:"product_id"`
+	// Facility of the product
+	FacilityID string `json:"facility_id"`
+	// Quantity below which the product is low on stock
+	MinQuantity int `json:"min_quantity"`
+	// Confidence-weighted present count
+	Quantity float64 `json:"quantity"`
+	// Status before the change
+	PreviousStatus string `json:"previous_status,omitempty"`
+	// Millisecond epoch time of the evaluation
+	Timestamp int64 `json:"timestamp"`
+}
+
+// Response is the model used to return the query response
+type Response struct {
+	Results interface{} `json:"results"`
+}
+
+// Value implements driver.Valuer interfaces
+func (threshold Threshold) Value() (driver.Value, error) {
+	return json.Marshal(threshold)
+}
+
+// Scan implements sql.Scanner interfaces
+func (threshold *Threshold) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, threshold)
+}
+
+// statusFor returns the stock status of a confidence-weighted present quantity
+func statusFor(quantity float64, minQuantity int) string {
+	switch {
+	case quantity < 1:
+		return StatusOutOfStock
+	case quantity < float64(minQuantity):
+		return StatusLowStock
+	default:
+		return StatusInStock
+	}
+}
+
+// eventFor returns the event raised when the status changes from previous to current,
+// or an empty string when no event is raised
+func eventFor(previous string, current string) string {
+	if previous == current {
+		return ""
+	}
+
+	switch current {
+	case StatusOutOfStock:
+		return EventOutOfStock
+	case StatusLowStock:
+		return EventLowStock
+	default:
+		if previous == StatusLowStock || previous == StatusOutOfStock {
+			return EventRestocked
+		}
+		return ""
+	}
+}
@@ -14,11 +14,14 @@ import (
 	"fmt"
 	odata "github.com/intel/rsp-sw-toolkit-im-suite-go-odata/postgresql"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/encodingscheme"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/odatafilter"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/web"
 	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
 	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -29,6 +32,9 @@ const (
 	jsonb          = "data"
 	epcColumn      = "epc"
 	facilityColumn = "facility_id"
+	presentState   = "present"
+	// millisPerMinute is the resolution of last read when aggregating tags
+	millisPerMinute = 60 * 1000
 	// UndefinedProductID is the constant to set the product id when it cannot be decoded
 	UndefinedProductID = "undefined"
 	// encodingInvalid is the constant to set when epc encoding cannot be decoded
@@ -40,9 +46,12 @@ type tagsDataWrapper struct {
 	Data Tag     `db:"data" json:"data"`
 }
 
-// Retrieve retrieves tags from database based on Odata query and a size limit
+// Retrieve retrieves tags from database based on Odata query and a size limit. Unless
+// the query sets $orderby or $skip, tags are returned in EPC order and the paging cursor
+// is set when more tags match; passing it as the cursor query parameter returns the next
+// page. Otherwise paging is flagged as truncated when more tags match.
 //nolint:dupl
-func Retrieve(dbs *sql.DB, query url.Values, maxSize int) (interface{}, *CountType, error) {
+func Retrieve(dbs *sql.DB, query url.Values, maxSize int) (interface{}, *CountType, *PagingType, error) {
 
 	// Metrics
 	metrics.GetOrRegisterGauge(`Inventory.Retrieve.Attempt`, nil).Update(1)
@@ -51,40 +60,59 @@ func Retrieve(dbs *sql.DB, query url.Values, maxSize int) (interface{}, *CountTy
 	mInputErr := metrics.GetOrRegisterGauge("Inventory.Retrieve.Input-Error", nil)
 	mFindLatency := metrics.GetOrRegisterTimer(`Inventory.Retrieve.Find-Latency`, nil)
 
-	/* Cursor is not a priority for the upcoming release it will be added in future if required */
-	//var paging PagingType
+	// The cursor is not an odata keyword
+	cursor := query.Get(CursorParameter)
+	query.Del(CursorParameter)
 
 	// If count is true, and only $count is set return total count of the collection
 	if len(query["$count"]) > 0 && len(query) < 2 {
 
-		return countHandler(dbs)
+		count, countType, err := countHandler(dbs)
+		return count, countType, nil, err
 	}
 
+	pageSize := maxSize
 	if len(query["$top"]) > 0 {
 
 		topVal, err := strconv.Atoi(query["$top"][0])
 		if err != nil {
-			return nil, nil, errors.Wrap(web.ErrValidation, "invalid $top value")
+			return nil, nil, nil, errors.Wrap(web.ErrValidation, "invalid $top value")
 		}
 
-		if topVal > maxSize {
-			query["$top"][0] = strconv.Itoa(maxSize)
+		if topVal < maxSize {
+			pageSize = topVal
 		}
+	}
+	query["$top"] = []string{strconv.Itoa(pageSize)} // Apply size limit to the odata query
 
-	} else {
-		query["$top"] = []string{strconv.Itoa(maxSize)} // Apply size limit to the odata query
+	paged := canPage(query) && len(query["$count"]) == 0 && pageSize > 0
+	if cursor != "" && !paged {
+		mInputErr.Update(1)
+		return nil, nil, nil, errors.Wrap(web.ErrInvalidInput,
+			"cursor cannot be combined with $count, $orderby or $skip")
+	}
+
+	filter := query.Get("$filter")
+	if paged {
+		if err := applyPaging(query, cursor, filter, pageSize); err != nil {
+			mInputErr.Update(1)
+			return nil, nil, nil, err
+		}
+	} else if len(query["$count"]) == 0 && pageSize > 0 {
+		// One more tag tells whether the results were truncated
+		query.Set("$top", strconv.Itoa(pageSize+1))
 	}
 
 	// Else, run filter query and return slice of Tag
 	retrieveTimer := time.Now()
 
-	rows, err := odata.ODataSQLQuery(query, tagsTable, jsonb, dbs)
+	rows, err := odatafilter.SQLQuery(query, tagsTable, jsonb, dbs)
 	if err != nil {
 		if errors.Cause(err) == odata.ErrInvalidInput {
 			mInputErr.Update(1)
-			return nil, nil, errors.Wrap(web.ErrInvalidInput, err.Error())
+			return nil, nil, nil, errors.Wrap(web.ErrInvalidInput, err.Error())
 		}
-		return nil, nil, errors.Wrap(err, "error in retrieving tags")
+		return nil, nil, nil, errors.Wrap(err, "error in retrieving tags")
 	}
 
 	mFindLatency.Update(time.Since(retrieveTimer))
@@ -92,8 +120,6 @@ func Retrieve(dbs *sql.DB, query url.Values, maxSize int) (interface{}, *CountTy
 
 	tagSlice := make([]Tag, 0)
 
-	inlineCount := 0
-
 	// Loop through the results and append them to a slice
 	for rows.Next() {
 
@@ -101,36 +127,79 @@ func Retrieve(dbs *sql.DB, query url.Values, maxSize int) (interface{}, *CountTy
 		err := rows.Scan(&tagsDataWrapper.ID, &tagsDataWrapper.Data)
 		if err != nil {
 			mFindErr.Update(1)
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
 		tagSlice = append(tagSlice, tagsDataWrapper.Data)
-		inlineCount++
 
 	}
 	if err = rows.Err(); err != nil {
 		mFindErr.Update(1)
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
+	// One more tag than the page size is retrieved to know whether there is a next page
+	var paging *PagingType
+	if len(tagSlice) > pageSize {
+		tagSlice = tagSlice[:pageSize]
+		paging = &PagingType{Truncated: true}
+		if paged {
+			next, err := encodeCursor(tagSlice[pageSize-1].Epc, filter)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			paging = &PagingType{Cursor: next}
+		}
+	}
+
+	inlineCount := len(tagSlice)
+
 	// Check if inlinecount is set
 	isInlineCount := query["$inlinecount"]
 	countQuery := query["$count"]
 
 	if len(isInlineCount) > 0 && isInlineCount[0] == "allpages" {
 		mSuccess.Update(1)
-		return tagSlice, &CountType{Count: &inlineCount}, nil
+		return tagSlice, &CountType{Count: &inlineCount}, paging, nil
 	} else if len(countQuery) > 0 {
 		mSuccess.Update(1)
-		return nil, &CountType{Count: &inlineCount}, nil
+		return nil, &CountType{Count: &inlineCount}, nil, nil
 	}
 
-	/*var pagingType *PagingType
-	if len(query["$top"]) > 0 {
-		pagingType = &paging
-	}*/
-
 	mSuccess.Update(1)
-	return tagSlice, nil, nil
+	return tagSlice, nil, paging, nil
+}
+
+// applyPaging orders the query by EPC, starting after the EPC of the cursor if set, and
+// retrieves one more tag than the page size
+func applyPaging(query url.Values, cursor string, filter string, pageSize int) error {
+	if cursor != "" {
+		epc, err := decodeCursor(cursor, filter)
+		if err != nil {
+			return err
+		}
+		after := odatafilter.New().Gt(epcColumn, epc).String()
+		if filter != "" {
+			after += " and (" + filter + ")"
+		}
+		query.Set("$filter", after)
+	}
+
+	// The EPC of the last tag is needed for the cursor
+	if selectQuery := query.Get("$select"); selectQuery != "" {
+		selected := false
+		for _, field := range strings.Split(selectQuery, ",") {
+			if strings.TrimSpace(field) == epcColumn {
+				selected = true
+			}
+		}
+		if !selected {
+			query.Set("$select", selectQuery+","+epcColumn)
+		}
+	}
+
+	query.Set("$orderby", epcColumn)
+	query.Set("$top", strconv.Itoa(pageSize+1))
+	return nil
 }
 
 // RetrieveOdataAll retrieves all tags from the database that matches the query without any size limit
@@ -145,7 +214,7 @@ func RetrieveOdataAll(dbs *sql.DB, query url.Values) ([]Tag, error) {
 	// Else, run filter query and return slice of Tag
 	retrieveTimer := time.Now()
 
-	rows, err := odata.ODataSQLQuery(query, tagsTable, jsonb, dbs)
+	rows, err := odatafilter.SQLQuery(query, tagsTable, jsonb, dbs)
 	if err != nil {
 		if errors.Cause(err) == odata.ErrInvalidInput {
 			mFindErr.Update(1)
@@ -177,6 +246,54 @@ func RetrieveOdataAll(dbs *sql.DB, query url.Values) ([]Tag, error) {
 	return tagSlice, nil
 }
 
+// Stream retrieves all tags from the database that match the Odata query without any size
+// limit, passing them to fn one at a time as they are read instead of loading them all.
+// Errors running the query are returned before fn is first called; an error returned by fn
+// stops the stream and is returned.
+func Stream(dbs *sql.DB, query url.Values, fn func(Tag) error) error {
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`Inventory.Stream.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`Inventory.Stream.Success`, nil)
+	mFindErr := metrics.GetOrRegisterGauge("Inventory.Stream.Find-Error", nil)
+	mStreamLatency := metrics.GetOrRegisterTimer(`Inventory.Stream.Stream-Latency`, nil)
+	mStreamed := metrics.GetOrRegisterGauge(`Inventory.Stream.Streamed`, nil)
+
+	streamTimer := time.Now()
+
+	rows, err := odatafilter.SQLQuery(query, tagsTable, jsonb, dbs)
+	if err != nil {
+		if errors.Cause(err) == odata.ErrInvalidInput {
+			return errors.Wrap(web.ErrInvalidInput, err.Error())
+		}
+		mFindErr.Update(1)
+		return errors.Wrap(err, "error streaming tags")
+	}
+	defer rows.Close()
+
+	var streamed int64
+	for rows.Next() {
+		tagsDataWrapper := new(tagsDataWrapper)
+		if err := rows.Scan(&tagsDataWrapper.ID, &tagsDataWrapper.Data); err != nil {
+			mFindErr.Update(1)
+			return err
+		}
+		if err := fn(tagsDataWrapper.Data); err != nil {
+			return err
+		}
+		streamed++
+	}
+	if err := rows.Err(); err != nil {
+		mFindErr.Update(1)
+		return err
+	}
+	mStreamLatency.Update(time.Since(streamTimer))
+	mStreamed.Update(streamed)
+
+	mSuccess.Update(1)
+	return nil
+}
+
 func countHandler(dbs *sql.DB) (interface{}, *CountType, error) {
 
 	mSuccess := metrics.GetOrRegisterGauge(`Inventory.Retrieve.Success`, nil)
@@ -388,6 +505,49 @@ func DecodeTagData(tagData string) (productID string, URI string, err error) {
 		strings.Join(decodingErrors, "\n\t"))
 }
 
+// Decode decodes tag data with the configured tag decoders, in order, and reports
+// which decoder matched along with the errors of those that did not.
+func Decode(tagData string) DecodeResult {
+	result := DecodeResult{Epc: tagData}
+	tagDataBytes, err := hex.DecodeString(tagData)
+	if err != nil {
+		result.Errors = []string{errors.Wrap(err, "tag data is not valid hex").Error()}
+		return result
+	}
+
+	for idx, decoder := range config.AppConfig.TagDecoders {
+		productID, URI, err := decoder.Decode(tagDataBytes)
+		if err != nil {
+			result.Errors = append(result.Errors,
+				fmt.Sprintf("decoder %d (%s) unable to decode tag data: %s",
+					idx+1, decoderName(decoder), err))
+			continue
+		}
+
+		result.Decoder = decoderName(decoder)
+		result.ProductID, result.URI = productID, URI
+		if filterDecoder, ok := decoder.(encodingscheme.FilterDecoder); ok {
+			if filterValue, err := filterDecoder.DecodeFilter(tagDataBytes); err == nil {
+				result.FilterValue = &filterValue
+			}
+		}
+		return result
+	}
+
+	if len(config.AppConfig.TagDecoders) == 0 {
+		result.Errors = append(result.Errors, "no tag decoders are configured")
+	}
+	return result
+}
+
+// decoderName returns the description of a decoder, or its type if it has none
+func decoderName(decoder encodingscheme.TagDecoder) string {
+	if stringer, ok := decoder.(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return fmt.Sprintf("%T", decoder)
+}
+
 // Update updates a tag in the database
 func Update(dbs *sql.DB, epc string, facilityId string, object map[string]string) error {
 
@@ -439,3 +599,460 @@ func Update(dbs *sql.DB, epc string, facilityId string, object map[string]string
 	mSuccess.Update(1)
 	return nil
 }
+
+// BulkUpdate sets field to value on the tags of the facility that either have one of the
+// given EPCs or, when filter is not empty, match the odata filter, and returns how many
+// tags were updated. The tags are selected and updated by a single statement. When dryRun
+// is set the matching tags are only counted, so nothing changes, and the number of tags
+// that would be updated is returned.
+func BulkUpdate(dbs *sql.DB, facilityID string, epcs []string, filter string, field string, value string, dryRun bool) (int64, error) {
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`Inventory.BulkUpdate.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`Inventory.BulkUpdate.Success`, nil)
+	mInputErr := metrics.GetOrRegisterGauge(`Inventory.BulkUpdate.Input-Error`, nil)
+	mUpdateErr := metrics.GetOrRegisterGauge(`Inventory.BulkUpdate.Update-Error`, nil)
+	mUpdateLatency := metrics.GetOrRegisterTimer(`Inventory.BulkUpdate.Update-Latency`, nil)
+	mUpdated := metrics.GetOrRegisterGauge(`Inventory.BulkUpdate.Updated`, nil)
+
+	args := []interface{}{facilityID}
+	var selection string
+	if filter != "" {
+		var err error
+		if selection, args, err = odatafilter.Condition(filter, jsonb, args); err != nil {
+			mInputErr.Update(1)
+			return 0, errors.Wrap(web.ErrInvalidInput, err.Error())
+		}
+	} else {
+		args = append(args, pq.Array(epcs))
+		selection = fmt.Sprintf(`%s ->> %s = ANY($2)`, pq.QuoteIdentifier(jsonb), pq.QuoteLiteral(epcColumn))
+	}
+	where := fmt.Sprintf(`%s ->> %s = $1 AND %s`,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(facilityColumn),
+		selection,
+	)
+
+	if dryRun {
+		countQuery := fmt.Sprintf(`SELECT count(*) FROM %s WHERE %s;`,
+			pq.QuoteIdentifier(tagsTable),
+			where,
+		)
+
+		var count int64
+		if err := dbs.QueryRow(countQuery, args...).Scan(&count); err != nil {
+			mUpdateErr.Update(1)
+			return 0, errors.Wrap(err, "error counting tags")
+		}
+
+		mSuccess.Update(1)
+		return count, nil
+	}
+
+	// the field and value follow the bind parameters of the selection
+	args = append(args, pq.Array([]string{field}), value)
+	updateStmt := fmt.Sprintf(`UPDATE %s SET %s = jsonb_set(%s, $%d, to_jsonb($%d::text))
+					WHERE %s;`,
+		pq.QuoteIdentifier(tagsTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteIdentifier(jsonb),
+		len(args)-1,
+		len(args),
+		where,
+	)
+
+	updateTimer := time.Now()
+	result, err := dbs.Exec(updateStmt, args...)
+	if err != nil {
+		mUpdateErr.Update(1)
+		return 0, errors.Wrap(err, "error updating tags")
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		mUpdateErr.Update(1)
+		return 0, err
+	}
+	mUpdateLatency.Update(time.Since(updateTimer))
+	mUpdated.Update(updated)
+
+	mSuccess.Update(1)
+	return updated, nil
+}
+
+// MarkMissingCandidates flags the tags believed present in the facility, and zone when
+// provided, that have not been read since the given time. Zone is matched against the
+// most recent location of the tag. Tags are flagged in a single statement, so either all
+// of them or none are. Returns the tags that were flagged.
+func MarkMissingCandidates(dbs *sql.DB, facilityID string, zone string, since int64) ([]Tag, error) {
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`Inventory.MarkMissingCandidates.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`Inventory.MarkMissingCandidates.Success`, nil)
+	mUpdateErr := metrics.GetOrRegisterGauge(`Inventory.MarkMissingCandidates.Update-Error`, nil)
+	mMissing := metrics.GetOrRegisterGauge(`Inventory.MarkMissingCandidates.Missing`, nil)
+
+	updateStmt := fmt.Sprintf(`UPDATE %[1]s SET %[2]s = jsonb_set(%[2]s, '{missing_candidate}', 'true')
+								WHERE %[2]s ->> 'facility_id' = $1 AND %[2]s ->> 'epc_state' = $2
+								AND (%[2]s ->> 'last_read')::bigint < $3
+								AND ($4 = '' OR %[2]s -> 'location_history' -> 0 ->> 'location' = $4)
+								RETURNING %[2]s`,
+		pq.QuoteIdentifier(tagsTable),
+		pq.QuoteIdentifier(jsonb),
+	)
+
+	rows, err := dbs.Query(updateStmt, facilityID, presentState, since, zone)
+	if err != nil {
+		mUpdateErr.Update(1)
+		return nil, errors.Wrap(err, "error marking missing candidates")
+	}
+	defer rows.Close()
+
+	missing := make([]Tag, 0)
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag); err != nil {
+			mUpdateErr.Update(1)
+			return nil, err
+		}
+		missing = append(missing, tag)
+	}
+	if err := rows.Err(); err != nil {
+		mUpdateErr.Update(1)
+		return nil, errors.Wrap(err, "error marking missing candidates")
+	}
+
+	mMissing.Update(int64(len(missing)))
+	mSuccess.Update(1)
+	return missing, nil
+}
+
+// aggregateExpressions maps the fields tags can be aggregated by to their SQL expressions
+var aggregateExpressions = map[string]string{
+	AggregateByProductID:      fmt.Sprintf(`%s ->> 'product_id'`, pq.QuoteIdentifier(jsonb)),
+	AggregateByFacilityID:     fmt.Sprintf(`%s ->> 'facility_id'`, pq.QuoteIdentifier(jsonb)),
+	AggregateByEpcState:       fmt.Sprintf(`%s ->> 'epc_state'`, pq.QuoteIdentifier(jsonb)),
+	AggregateByQualifiedState: fmt.Sprintf(`%s ->> 'qualified_state'`, pq.QuoteIdentifier(jsonb)),
+	AggregateByLocation:       fmt.Sprintf(`%s -> 'location_history' -> 0 ->> 'location'`, pq.QuoteIdentifier(jsonb)),
+}
+
+// IsAggregateField reports whether tags can be aggregated by the given field
+func IsAggregateField(field string) bool {
+	_, ok := aggregateExpressions[field]
+	return ok
+}
+
+// aggregateConditions renders the filter of an aggregate, which maps aggregate fields to
+// the value they must equal, as SQL conditions
+func aggregateConditions(filter map[string]string) ([]string, error) {
+	conditions := make([]string, 0, len(filter))
+	for field, value := range filter {
+		expression, ok := aggregateExpressions[field]
+		if !ok {
+			return nil, errors.Wrapf(web.ErrInvalidInput, "cannot filter by %s", field)
+		}
+		conditions = append(conditions, fmt.Sprintf(`%s = %s`, expression, pq.QuoteLiteral(value)))
+	}
+	return conditions, nil
+}
+
+// AggregateProducts returns the distinct products and facilities of the tags matching the
+// filter of an aggregate, which are what the coefficients of the confidence model are
+// resolved for. Only the ProductID and FacilityID of the tags returned are set.
+func AggregateProducts(dbs *sql.DB, filter map[string]string) ([]Tag, error) {
+	conditions, err := aggregateConditions(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	selectQuery := fmt.Sprintf(`SELECT DISTINCT COALESCE(%s, ''), COALESCE(%s, '') FROM %s`,
+		aggregateExpressions[AggregateByProductID],
+		aggregateExpressions[AggregateByFacilityID],
+		pq.QuoteIdentifier(tagsTable),
+	)
+	if len(conditions) > 0 {
+		selectQuery += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := dbs.Query(selectQuery)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving products to aggregate")
+	}
+	defer rows.Close()
+
+	var products []Tag
+	for rows.Next() {
+		var product Tag
+		if err := rows.Scan(&product.ProductID, &product.FacilityID); err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+	return products, rows.Err()
+}
+
+// AggregateTags counts the tags matching filter, grouped by the groupBy fields, in a single
+// query. When confidence is set, the database also averages the confidence of the tags
+// of each group, evaluated with the coefficients of their product and facility. Tags
+// without coefficients, such as tags of products first read after they were resolved,
+// are left out of the average. Results are sorted by count, largest first.
+func AggregateTags(dbs *sql.DB, groupBy []string, filter map[string]string, coefficients []ConfidenceCoefficients, confidence ConfidenceSQL) (AggregateResponse, error) {
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`Inventory.AggregateTags.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`Inventory.AggregateTags.Success`, nil)
+	mFindErr := metrics.GetOrRegisterGauge(`Inventory.AggregateTags.Find-Error`, nil)
+	mFindLatency := metrics.GetOrRegisterTimer(`Inventory.AggregateTags.Find-Latency`, nil)
+
+	columns := make([]string, 0, len(groupBy)+2)
+	for _, field := range groupBy {
+		expression, ok := aggregateExpressions[field]
+		if !ok {
+			return AggregateResponse{}, errors.Wrapf(web.ErrInvalidInput, "cannot aggregate by %s", field)
+		}
+		columns = append(columns, fmt.Sprintf(`COALESCE(%s, '')`, expression))
+	}
+	groupColumns := make([]string, len(columns))
+	for i := range columns {
+		groupColumns[i] = strconv.Itoa(i + 1)
+	}
+
+	conditions, err := aggregateConditions(filter)
+	if err != nil {
+		return AggregateResponse{}, err
+	}
+
+	var args []interface{}
+	from := pq.QuoteIdentifier(tagsTable)
+	columns = append(columns, `COUNT(*)`)
+	if confidence != nil {
+		productIDs := make([]string, len(coefficients))
+		facilityIDs := make([]string, len(coefficients))
+		dailyInvPercs := make([]float64, len(coefficients))
+		probUnreadToReads := make([]float64, len(coefficients))
+		probInStores := make([]float64, len(coefficients))
+		probExitErrors := make([]float64, len(coefficients))
+		for i, c := range coefficients {
+			productIDs[i] = c.ProductID
+			facilityIDs[i] = c.FacilityID
+			dailyInvPercs[i] = c.DailyInvPerc
+			probUnreadToReads[i] = c.ProbUnreadToRead
+			probInStores[i] = c.ProbInStore
+			probExitErrors[i] = c.ProbExitError
+		}
+		args = append(args, pq.Array(productIDs), pq.Array(facilityIDs), pq.Array(dailyInvPercs),
+			pq.Array(probUnreadToReads), pq.Array(probInStores), pq.Array(probExitErrors))
+
+		from += fmt.Sprintf(` LEFT JOIN unnest($1::text[], $2::text[], $3::float8[], $4::float8[], $5::float8[], $6::float8[])
+			AS coefficients (product_id, facility_id, daily_inv_perc, prob_unread_to_read, prob_in_store, prob_exit_error)
+			ON coefficients.product_id = COALESCE(%s, '') AND coefficients.facility_id = COALESCE(%s, '')`,
+			aggregateExpressions[AggregateByProductID],
+			aggregateExpressions[AggregateByFacilityID],
+		)
+		columns = append(columns, `COALESCE(AVG(`+confidence(
+			"coefficients.daily_inv_perc",
+			"coefficients.prob_unread_to_read",
+			"coefficients.prob_in_store",
+			"coefficients.prob_exit_error",
+			fmt.Sprintf(`COALESCE((%s.%s ->> 'last_read')::bigint, 0)`, pq.QuoteIdentifier(tagsTable), pq.QuoteIdentifier(jsonb)),
+		)+`), 0)`)
+	}
+
+	selectQuery := fmt.Sprintf(`SELECT %s FROM %s`, strings.Join(columns, ", "), from)
+	if len(conditions) > 0 {
+		selectQuery += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if len(groupColumns) > 0 {
+		selectQuery += " GROUP BY " + strings.Join(groupColumns, ", ")
+	}
+
+	retrieveTimer := time.Now()
+	rows, err := dbs.Query(selectQuery, args...)
+	if err != nil {
+		mFindErr.Update(1)
+		return AggregateResponse{}, errors.Wrap(err, "error aggregating tags")
+	}
+	defer rows.Close()
+
+	response := AggregateResponse{GroupBy: groupBy, Results: []Aggregate{}}
+	for rows.Next() {
+		values := make([]string, len(groupBy))
+		aggregate := Aggregate{Group: make(map[string]string, len(groupBy))}
+
+		destinations := make([]interface{}, 0, len(groupBy)+2)
+		for i := range values {
+			destinations = append(destinations, &values[i])
+		}
+		destinations = append(destinations, &aggregate.Count)
+		if confidence != nil {
+			destinations = append(destinations, &aggregate.AverageConfidence)
+		}
+
+		if err := rows.Scan(destinations...); err != nil {
+			mFindErr.Update(1)
+			return AggregateResponse{}, err
+		}
+		for i, field := range groupBy {
+			aggregate.Group[field] = values[i]
+		}
+		response.Count += aggregate.Count
+		response.Results = append(response.Results, aggregate)
+	}
+	if err := rows.Err(); err != nil {
+		mFindErr.Update(1)
+		return AggregateResponse{}, err
+	}
+	mFindLatency.Update(time.Since(retrieveTimer))
+
+	sortAggregates(groupBy, response.Results)
+	mSuccess.Update(1)
+	return response, nil
+}
+
+// AggregateBuckets counts the tags matching filter, grouped by the groupBy fields. Filter
+// maps aggregate fields to the value they must equal. Tags are additionally grouped by
+// product, facility and minute of last read, which is all the confidence of a tag depends
+// on, so the confidence of every tag in a bucket is the same. It is used for confidence
+// models the database cannot evaluate. Queries producing more than limit buckets are
+// rejected, as the number of buckets grows with the time span of the reads.
+func AggregateBuckets(dbs *sql.DB, groupBy []string, filter map[string]string, limit int) ([]AggregateBucket, error) {
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`Inventory.AggregateTags.uckets.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`Inventory.AggregateTags.uckets.Success`, nil)
+	mFindErr := metrics.GetOrRegisterGauge(`Inventory.AggregateTags.uckets.Find-Error`, nil)
+	mFindLatency := metrics.GetOrRegisterTimer(`Inventory.AggregateTags.uckets.Find-Latency`, nil)
+	mBuckets := metrics.GetOrRegisterGauge(`Inventory.AggregateTags.uckets.Buckets`, nil)
+
+	columns := make([]string, 0, len(groupBy)+3)
+	for _, field := range groupBy {
+		expression, ok := aggregateExpressions[field]
+		if !ok {
+			return nil, errors.Wrapf(web.ErrInvalidInput, "cannot aggregate by %s", field)
+		}
+		columns = append(columns, fmt.Sprintf(`COALESCE(%s, '')`, expression))
+	}
+	columns = append(columns,
+		`COALESCE(`+aggregateExpressions[AggregateByProductID]+`, '')`,
+		`COALESCE(`+aggregateExpressions[AggregateByFacilityID]+`, '')`,
+		fmt.Sprintf(`COALESCE((%s ->> 'last_read')::bigint, 0) / %d * %d`,
+			pq.QuoteIdentifier(jsonb), millisPerMinute, millisPerMinute),
+	)
+
+	conditions, err := aggregateConditions(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	groupColumns := make([]string, len(columns))
+	for i := range columns {
+		groupColumns[i] = strconv.Itoa(i + 1)
+	}
+
+	selectQuery := fmt.Sprintf(`SELECT %s, COUNT(*) FROM %s`,
+		strings.Join(columns, ", "),
+		pq.QuoteIdentifier(tagsTable),
+	)
+	if len(conditions) > 0 {
+		selectQuery += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	selectQuery += " GROUP BY " + strings.Join(groupColumns, ", ")
+	// One more than the limit tells a query at the limit from one beyond it
+	selectQuery += fmt.Sprintf(" LIMIT %d", limit+1)
+
+	retrieveTimer := time.Now()
+	rows, err := dbs.Query(selectQuery)
+	if err != nil {
+		mFindErr.Update(1)
+		return nil, errors.Wrap(err, "error aggregating tags")
+	}
+	defer rows.Close()
+
+	var buckets []AggregateBucket
+	for rows.Next() {
+		values := make([]string, len(groupBy))
+		bucket := AggregateBucket{Group: make(map[string]string, len(groupBy))}
+
+		destinations := make([]interface{}, 0, len(groupBy)+4)
+		for i := range values {
+			destinations = append(destinations, &values[i])
+		}
+		destinations = append(destinations, &bucket.ProductID, &bucket.FacilityID, &bucket.LastRead, &bucket.Count)
+
+		if err := rows.Scan(destinations...); err != nil {
+			mFindErr.Update(1)
+			return nil, err
+		}
+		for i, field := range groupBy {
+			bucket.Group[field] = values[i]
+		}
+		buckets = append(buckets, bucket)
+	}
+	if err := rows.Err(); err != nil {
+		mFindErr.Update(1)
+		return nil, err
+	}
+	mFindLatency.Update(time.Since(retrieveTimer))
+
+	mBuckets.Update(int64(len(buckets)))
+	if len(buckets) > limit {
+		return nil, errors.Wrapf(web.ErrInvalidInput,
+			"aggregate spans more than %d buckets, filter by product_id, facility_id, epc_state, qualified_state or location", limit)
+	}
+	mSuccess.Update(1)
+	return buckets, nil
+}
+
+// SummarizeBuckets merges buckets sharing the values of the aggregated fields, averaging
+// their confidence weighted by count. Results are sorted by count, largest first.
+func SummarizeBuckets(groupBy []string, buckets []AggregateBucket) AggregateResponse {
+	type summary struct {
+		aggregate       Aggregate
+		totalConfidence float64
+	}
+	summaries := make(map[string]*summary)
+
+	response := AggregateResponse{GroupBy: groupBy, Results: []Aggregate{}}
+	for _, bucket := range buckets {
+		values := make([]string, len(groupBy))
+		for i, field := range groupBy {
+			values[i] = bucket.Group[field]
+		}
+		key := fmt.Sprintf("%q", values)
+
+		entry, ok := summaries[key]
+		if !ok {
+			entry = &summary{aggregate: Aggregate{Group: bucket.Group}}
+			summaries[key] = entry
+		}
+		entry.aggregate.Count += bucket.Count
+		entry.totalConfidence += bucket.Confidence * float64(bucket.Count)
+		response.Count += bucket.Count
+	}
+
+	for _, entry := range summaries {
+		if entry.aggregate.Count > 0 {
+			entry.aggregate.AverageConfidence = entry.totalConfidence / float64(entry.aggregate.Count)
+		}
+		response.Results = append(response.Results, entry.aggregate)
+	}
+	sortAggregates(groupBy, response.Results)
+
+	return response
+}
+
+// sortAggregates sorts aggregates by count, largest first, then by the values of the
+// aggregated fields
+func sortAggregates(groupBy []string, aggregates []Aggregate) {
+	sort.Slice(aggregates, func(i, j int) bool {
+		a, b := aggregates[i], aggregates[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		for _, field := range groupBy {
+			if a.Group[field] != b.Group[field] {
+				return a.Group[field] < b.Group[field]
+			}
+		}
+		return false
+	})
+}
@@ -71,7 +71,7 @@ func TestNoDataRetrieve(t *testing.T) {
 		t.Error("failed to parse test url")
 	}
 
-	_, _, err = Retrieve(testDB.DB, testURL.Query(), config.AppConfig.ResponseLimit)
+	_, _, _, err = Retrieve(testDB.DB, testURL.Query(), config.AppConfig.ResponseLimit)
 	if err != nil {
 		t.Error("Unable to retrieve tags")
 	}
@@ -91,16 +91,12 @@ func TestWithDataRetrieve(t *testing.T) {
 		t.Error("failed to parse test url")
 	}
 
-	tags, _, err := Retrieve(testDB.DB, testURL.Query(), config.AppConfig.ResponseLimit)
+	tags, _, _, err := Retrieve(testDB.DB, testURL.Query(), config.AppConfig.ResponseLimit)
 
 	if err != nil {
 		t.Error("Unable to retrieve tags")
 	}
 
-	//if paging.Cursor == "" {
-	//	t.Error("Cursor is empty")
-	//}
-
 	tagSlice := reflect.ValueOf(tags)
 
 	if tagSlice.Len() <= 0 {
@@ -108,67 +104,80 @@ func TestWithDataRetrieve(t *testing.T) {
 	}
 }
 
-/*func TestCursor(t *testing.T) {
+func TestCursor(t *testing.T) {
 
-	testDB := dbTestSetup(t)
+	testDB := dbHost.CreateDB(t)
 	defer testDB.Close()
 
 	clearAllData(t, testDB.DB)
-	insertSample(t, testDB.DB)
 
-	testURL, err := url.Parse("http://localhost/test?$top=10")
-	if err != nil {
-		t.Error("failed to parse test url")
+	epcs := []string{"30143639F84191AD22900104", "30143639F84191AD22900204", "30143639F84191AD22900304"}
+	for _, epc := range epcs {
+		if err := insert(testDB.DB, Tag{Epc: epc, FacilityID: "store001"}); err != nil {
+			t.Fatalf("Unable to insert tag %s", err.Error())
+		}
 	}
 
-	tags, _, pagingfirst, err := Retrieve(testDB.DB, testURL.Query(), config.AppConfig.ResponseLimit)
-
+	query := url.Values{"$top": {"2"}, "$filter": {"facility_id eq 'store001'"}}
+	tags, _, pagingFirst, err := Retrieve(testDB.DB, query, config.AppConfig.ResponseLimit)
 	if err != nil {
-		t.Error("Unable to retrieve tags")
+		t.Fatalf("Unable to retrieve tags %s", err.Error())
 	}
-
-	if pagingfirst.Cursor == "" {
-		t.Error("Cursor is empty")
+	firstPage := tags.([]Tag)
+	if len(firstPage) != 2 || firstPage[0].Epc != epcs[0] || firstPage[1].Epc != epcs[1] {
+		t.Fatalf("Expected the first two tags in epc order, received %v", firstPage)
 	}
-
-	cFirst := pagingfirst.Cursor
-	tagSlice := reflect.ValueOf(tags)
-
-	if tagSlice.Len() <= 0 {
-		t.Error("Unable to retrieve tags")
+	if pagingFirst == nil || pagingFirst.Cursor == "" {
+		t.Fatal("Expected a cursor as more tags match")
 	}
 
-	// Initiating second http request to check if first sceond cursor or not same
-	insertSampleCustom(t, testDB.DB, "cursor")
-
-	cursorTestURL, err := url.Parse("http://localhost/test?$filter=_id gt '" + url.QueryEscape(cFirst) + "'&$top=10")
-	if err != nil {
-		t.Error("failed to parse test url")
+	// Tags inserted before the cursor do not shift the next page
+	if err := insert(testDB.DB, Tag{Epc: "30143639F84191AD22900004", FacilityID: "store001"}); err != nil {
+		t.Fatalf("Unable to insert tag %s", err.Error())
 	}
 
-	ctags, _, pagingnext, err := Retrieve(testDB.DB, cursorTestURL.Query(), config.AppConfig.ResponseLimit)
-
+	query = url.Values{"$top": {"2"}, "$filter": {"facility_id eq 'store001'"}, CursorParameter: {pagingFirst.Cursor}}
+	tags, _, pagingNext, err := Retrieve(testDB.DB, query, config.AppConfig.ResponseLimit)
 	if err != nil {
-		t.Error("Unable to retrieve tags")
-		fmt.Println(err.Error())
+		t.Fatalf("Unable to retrieve tags %s", err.Error())
 	}
-
-	if pagingnext.Cursor == "" {
-		t.Error("Cursor is empty")
+	nextPage := tags.([]Tag)
+	if len(nextPage) != 1 || nextPage[0].Epc != epcs[2] {
+		t.Errorf("Expected the last tag, received %v", nextPage)
+	}
+	if pagingNext != nil {
+		t.Errorf("Expected no cursor on the last page, received %s", pagingNext.Cursor)
 	}
 
-	cSecond := pagingnext.Cursor
-	tagSlice2 := reflect.ValueOf(ctags)
+	// The cursor is bound to its filter
+	query = url.Values{"$top": {"2"}, CursorParameter: {pagingFirst.Cursor}}
+	if _, _, _, err := Retrieve(testDB.DB, query, config.AppConfig.ResponseLimit); errors.Cause(err) != web.ErrInvalidInput {
+		t.Errorf("Expected invalid input using the cursor with another filter, received %v", err)
+	}
 
-	if tagSlice2.Len() <= 0 {
-		t.Error("Unable to retrieve tags")
+	// Filters using or are paged as well, the cursor does not widen them
+	orFilter := "epc eq '" + epcs[0] + "' or epc eq '" + epcs[2] + "'"
+	query = url.Values{"$top": {"1"}, "$filter": {orFilter}}
+	if _, _, pagingFirst, err = Retrieve(testDB.DB, query, config.AppConfig.ResponseLimit); err != nil || pagingFirst == nil {
+		t.Fatalf("Expected a cursor filtering with or, received %v", err)
+	}
+	query = url.Values{"$top": {"2"}, "$filter": {orFilter}, CursorParameter: {pagingFirst.Cursor}}
+	tags, _, _, err = Retrieve(testDB.DB, query, config.AppConfig.ResponseLimit)
+	if err != nil {
+		t.Fatalf("Unable to retrieve tags %s", err.Error())
+	}
+	if nextPage := tags.([]Tag); len(nextPage) != 1 || nextPage[0].Epc != epcs[2] {
+		t.Errorf("Expected only the second tag matching the filter, received %v", nextPage)
 	}
 
-	if cFirst == cSecond {
-		t.Error("paging failed ")
+	// Results that cannot be paged are flagged when truncated
+	query = url.Values{"$top": {"2"}, "$orderby": {"epc"}}
+	if _, _, paging, err := Retrieve(testDB.DB, query, config.AppConfig.ResponseLimit); err != nil || paging == nil || !paging.Truncated {
+		t.Errorf("Expected truncated results ordering by epc, received %+v %v", paging, err)
 	}
 
-}*/
+	clearAllData(t, testDB.DB)
+}
 
 //nolint:dupl
 func TestRetrieveCount(t *testing.T) {
@@ -191,7 +200,7 @@ func TestRetrieveCount(t *testing.T) {
 }
 
 func retrieveCountTest(t *testing.T, testURL *url.URL, session *sql.DB) {
-	results, count, err := Retrieve(session, testURL.Query(), config.AppConfig.ResponseLimit)
+	results, count, _, err := Retrieve(session, testURL.Query(), config.AppConfig.ResponseLimit)
 	if results != nil {
 		t.Error("expecting results to be nil")
 	}
@@ -213,7 +222,7 @@ func TestRetrieveInlineCount(t *testing.T) {
 	testDB := dbHost.CreateDB(t)
 	defer testDB.Close()
 
-	results, count, err := Retrieve(testDB.DB, testURL.Query(), config.AppConfig.ResponseLimit)
+	results, count, _, err := Retrieve(testDB.DB, testURL.Query(), config.AppConfig.ResponseLimit)
 
 	if results == nil {
 		t.Error("expecting results to not be nil")
@@ -397,7 +406,7 @@ func TestRetrieveSizeLimitWithTop(t *testing.T) {
 		t.Errorf("Unable to replace tags: %s", replaceErr.Error())
 	}
 
-	results, count, err := Retrieve(testDB.DB, testURL.Query(), sizeLimit)
+	results, count, _, err := Retrieve(testDB.DB, testURL.Query(), sizeLimit)
 	if err != nil {
 		t.Errorf("Retrieve failed with error %v", err.Error())
 	}
@@ -423,7 +432,7 @@ func TestRetrieveSizeLimitInvalidTop(t *testing.T) {
 	testDB := dbHost.CreateDB(t)
 	defer testDB.Close()
 
-	_, _, err = Retrieve(testDB.DB, testURL.Query(), sizeLimit)
+	_, _, _, err = Retrieve(testDB.DB, testURL.Query(), sizeLimit)
 	if err == nil {
 		t.Errorf("Expecting an error for invalid $top value")
 	}
@@ -554,6 +563,79 @@ func TestUpdate(t *testing.T) {
 	}
 }
 
+func TestBulkUpdate(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	facilityID := "TestFacility"
+	epcs := []string{"30143639F8419105417AED6F", "30143639F8419105417AED70", "30143639F8419105417AED71"}
+	err := Replace(testDB.DB, []Tag{
+		{Epc: epcs[0], FacilityID: facilityID},
+		{Epc: epcs[1], FacilityID: facilityID},
+		{Epc: epcs[2], FacilityID: "OtherFacility"},
+	})
+	if err != nil {
+		t.Fatal("Unable to insert tags", err.Error())
+	}
+
+	// a dry run counts the tags but leaves them unchanged
+	updated, err := BulkUpdate(testDB.DB, facilityID, epcs, "", "qualified_state", "damaged", true)
+	if err != nil {
+		t.Fatal("Unable to update the tags", err.Error())
+	}
+	if updated != 2 {
+		t.Errorf("Expected 2 tags to be updated on a dry run, got %d", updated)
+	}
+	tag, err := FindByEpc(testDB.DB, epcs[0])
+	if err != nil {
+		t.Fatalf("Error trying to find tag by epc %s", err.Error())
+	}
+	if tag.QualifiedState == "damaged" {
+		t.Error("Dry run updated the tag")
+	}
+
+	// the value is bound, so quotes are kept as is
+	updated, err = BulkUpdate(testDB.DB, facilityID, epcs, "", "qualified_state", "it's damaged", false)
+	if err != nil {
+		t.Fatal("Unable to update the tags", err.Error())
+	}
+	if updated != 2 {
+		t.Errorf("Expected 2 tags to be updated, got %d", updated)
+	}
+	for i, expected := range []string{"it's damaged", "it's damaged", ""} {
+		tag, err := FindByEpc(testDB.DB, epcs[i])
+		if err != nil {
+			t.Fatalf("Error trying to find tag by epc %s", err.Error())
+		}
+		if tag.QualifiedState != expected {
+			t.Errorf("Expected qualified state %q of %s, got %q", expected, epcs[i], tag.QualifiedState)
+		}
+	}
+
+	// the facility applies to the whole filter, including both sides of or
+	updated, err = BulkUpdate(testDB.DB, facilityID, nil, "qualified_state eq 'it''s damaged' or startswith(epc, '30143639')",
+		"qualified_state", "received", false)
+	if err != nil {
+		t.Fatal("Unable to update the tags", err.Error())
+	}
+	if updated != 2 {
+		t.Errorf("Expected the 2 tags of the facility to be updated, got %d", updated)
+	}
+	tag, err = FindByEpc(testDB.DB, epcs[2])
+	if err != nil {
+		t.Fatalf("Error trying to find tag by epc %s", err.Error())
+	}
+	if tag.QualifiedState != "" {
+		t.Errorf("Expected the tag of the other facility to be unchanged, got %q", tag.QualifiedState)
+	}
+
+	if _, err := BulkUpdate(testDB.DB, facilityID, nil, "epc eq", "qualified_state", "received", false); errors.Cause(err) != web.ErrInvalidInput {
+		t.Errorf("Expected invalid input error for an invalid filter, got %v", err)
+	}
+
+	clearAllData(t, testDB.DB)
+}
+
 func TestFindByEpc_found(t *testing.T) {
 	testDB := dbHost.CreateDB(t)
 	defer testDB.Close()
@@ -597,6 +679,229 @@ func TestFindByEpc_notFound(t *testing.T) {
 	}
 }
 
+func TestMarkMissingCandidates(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+	clearAllData(t, testDB.DB)
+
+	sessionStart := int64(1000)
+	facility := "store001"
+
+	tags := []Tag{
+		// read before the session in the scanned zone
+		{Epc: "missing", FacilityID: facility, EpcState: "present", LastRead: 500,
+			LocationHistory: []LocationHistory{{Location: "back-room"}}},
+		// read during the session
+		{Epc: "read", FacilityID: facility, EpcState: "present", LastRead: 1500,
+			LocationHistory: []LocationHistory{{Location: "back-room"}}},
+		// last seen in a different zone
+		{Epc: "other-zone", FacilityID: facility, EpcState: "present", LastRead: 500,
+			LocationHistory: []LocationHistory{{Location: "front"}}},
+		// not believed present
+		{Epc: "departed", FacilityID: facility, EpcState: "departed", LastRead: 500,
+			LocationHistory: []LocationHistory{{Location: "back-room"}}},
+		// different facility
+		{Epc: "other-facility", FacilityID: "store002", EpcState: "present", LastRead: 500,
+			LocationHistory: []LocationHistory{{Location: "back-room"}}},
+	}
+	for _, tag := range tags {
+		if err := insert(testDB.DB, tag); err != nil {
+			t.Fatalf("Unable to insert tag %s", err.Error())
+		}
+	}
+
+	missing, err := MarkMissingCandidates(testDB.DB, facility, "back-room", sessionStart)
+	if err != nil {
+		t.Fatalf("Error marking missing candidates %s", err.Error())
+	}
+	if len(missing) != 1 || missing[0].Epc != "missing" {
+		t.Fatalf("Expected only the missing tag to be flagged, received %v", missing)
+	}
+
+	tag, err := FindByEpc(testDB.DB, "missing")
+	if err != nil {
+		t.Fatalf("Error trying to find tag by epc %s", err.Error())
+	}
+	if !tag.MissingCandidate {
+		t.Error("Expected stored tag to be flagged as missing candidate")
+	}
+
+	tag, err = FindByEpc(testDB.DB, "other-zone")
+	if err != nil {
+		t.Fatalf("Error trying to find tag by epc %s", err.Error())
+	}
+	if tag.MissingCandidate {
+		t.Error("Expected tag outside the zone not to be flagged")
+	}
+
+	// Without a zone the whole facility is reconciled
+	missing, err = MarkMissingCandidates(testDB.DB, facility, "", sessionStart)
+	if err != nil {
+		t.Fatalf("Error marking missing candidates %s", err.Error())
+	}
+	if len(missing) != 2 {
+		t.Errorf("Expected 2 missing candidates for the facility, received %d", len(missing))
+	}
+
+	clearAllData(t, testDB.DB)
+}
+
+func TestAggregateBuckets(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+	clearAllData(t, testDB.DB)
+
+	tags := []Tag{
+		{Epc: "e1", ProductID: "A", FacilityID: "store001", EpcState: "present", LastRead: 60000,
+			LocationHistory: []LocationHistory{{Location: "front"}}},
+		// same minute as e1
+		{Epc: "e2", ProductID: "A", FacilityID: "store001", EpcState: "present", LastRead: 90000,
+			LocationHistory: []LocationHistory{{Location: "back"}}},
+		{Epc: "e3", ProductID: "A", FacilityID: "store001", EpcState: "present", LastRead: 180000},
+		{Epc: "e4", ProductID: "B", FacilityID: "store001", EpcState: "departed", LastRead: 60000},
+		{Epc: "e5", ProductID: "A", FacilityID: "store002", EpcState: "present", LastRead: 60000},
+	}
+	for _, tag := range tags {
+		if err := insert(testDB.DB, tag); err != nil {
+			t.Fatalf("Unable to insert tag %s", err.Error())
+		}
+	}
+
+	buckets, err := AggregateBuckets(testDB.DB, []string{AggregateByEpcState},
+		map[string]string{AggregateByFacilityID: "store001"}, 3)
+	if err != nil {
+		t.Fatalf("Error aggregating tags %s", err.Error())
+	}
+
+	// e1 and e2 share a bucket
+	if len(buckets) != 3 {
+		t.Fatalf("Expected 3 buckets, received %+v", buckets)
+	}
+	for _, bucket := range buckets {
+		if bucket.ProductID == "A" && bucket.LastRead == 60000 &&
+			(bucket.Count != 2 || bucket.Group[AggregateByEpcState] != "present") {
+			t.Errorf("Expected 2 present tags last read at 60000, received %+v", bucket)
+		}
+	}
+
+	buckets, err = AggregateBuckets(testDB.DB, []string{AggregateByLocation}, nil, 10)
+	if err != nil {
+		t.Fatalf("Error aggregating tags %s", err.Error())
+	}
+	response := SummarizeBuckets([]string{AggregateByLocation}, buckets)
+	if response.Count != len(tags) || len(response.Results) != 3 ||
+		response.Results[0].Group[AggregateByLocation] != "" || response.Results[0].Count != 3 {
+		t.Errorf("Expected 3 tags without a location first, received %+v", response)
+	}
+
+	if _, err := AggregateBuckets(testDB.DB, []string{"epc"}, nil, 10); errors.Cause(err) != web.ErrInvalidInput {
+		t.Errorf("Expected invalid input aggregating by epc, received %v", err)
+	}
+
+	// 4 buckets without the facility filter
+	if _, err := AggregateBuckets(testDB.DB, []string{AggregateByEpcState}, nil, 3); errors.Cause(err) != web.ErrInvalidInput {
+		t.Errorf("Expected invalid input exceeding the bucket limit, received %v", err)
+	}
+
+	clearAllData(t, testDB.DB)
+}
+
+func TestAggregateTags(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+	clearAllData(t, testDB.DB)
+
+	tags := []Tag{
+		{Epc: "e1", ProductID: "A", FacilityID: "store001", EpcState: "present", LastRead: 60000},
+		{Epc: "e2", ProductID: "A", FacilityID: "store001", EpcState: "present", LastRead: 90000},
+		{Epc: "e3", ProductID: "B", FacilityID: "store001", EpcState: "present", LastRead: 180000},
+		{Epc: "e4", ProductID: "B", FacilityID: "store001", EpcState: "departed", LastRead: 60000},
+		{Epc: "e5", ProductID: "A", FacilityID: "store002", EpcState: "present", LastRead: 60000},
+	}
+	for _, tag := range tags {
+		if err := insert(testDB.DB, tag); err != nil {
+			t.Fatalf("Unable to insert tag %s", err.Error())
+		}
+	}
+
+	filter := map[string]string{AggregateByFacilityID: "store001"}
+	products, err := AggregateProducts(testDB.DB, filter)
+	if err != nil {
+		t.Fatalf("Error retrieving products %s", err.Error())
+	}
+	if len(products) != 2 {
+		t.Fatalf("Expected products A and B at store001, received %+v", products)
+	}
+
+	// The confidence of a tag is the probability of it being read in store of its product
+	coefficients := []ConfidenceCoefficients{
+		{ProductID: "A", FacilityID: "store001", ProbInStore: 0.5},
+		{ProductID: "B", FacilityID: "store001", ProbInStore: 0.25},
+	}
+	confidence := func(_, _, probInStore, _, _ string) string {
+		return probInStore
+	}
+
+	response, err := AggregateTags(testDB.DB, []string{AggregateByEpcState}, filter, coefficients, confidence)
+	if err != nil {
+		t.Fatalf("Error aggregating tags %s", err.Error())
+	}
+	expected := AggregateResponse{
+		GroupBy: []string{AggregateByEpcState},
+		Count:   4,
+		Results: []Aggregate{
+			{Group: map[string]string{AggregateByEpcState: "present"}, Count: 3, AverageConfidence: 1.25 / 3},
+			{Group: map[string]string{AggregateByEpcState: "departed"}, Count: 1, AverageConfidence: 0.25},
+		},
+	}
+	if !reflect.DeepEqual(response, expected) {
+		t.Errorf("Expected %+v, received %+v", expected, response)
+	}
+
+	// Counts only
+	response, err = AggregateTags(testDB.DB, []string{AggregateByFacilityID}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Error aggregating tags %s", err.Error())
+	}
+	if response.Count != len(tags) || len(response.Results) != 2 || response.Results[0].Count != 4 ||
+		response.Results[0].AverageConfidence != 0 {
+		t.Errorf("Expected 4 tags at store001 first, received %+v", response)
+	}
+
+	if _, err := AggregateTags(testDB.DB, []string{"epc"}, nil, nil, nil); errors.Cause(err) != web.ErrInvalidInput {
+		t.Errorf("Expected invalid input aggregating by epc, received %v", err)
+	}
+
+	clearAllData(t, testDB.DB)
+}
+
+func TestSummarizeBuckets(t *testing.T) {
+	groupBy := []string{AggregateByProductID}
+	buckets := []AggregateBucket{
+		{Group: map[string]string{AggregateByProductID: "A"}, ProductID: "A", LastRead: 0, Count: 3, Confidence: 1},
+		{Group: map[string]string{AggregateByProductID: "A"}, ProductID: "A", LastRead: 60000, Count: 1, Confidence: 0.2},
+		{Group: map[string]string{AggregateByProductID: "B"}, ProductID: "B", LastRead: 0, Count: 5, Confidence: 0.5},
+	}
+
+	expected := AggregateResponse{
+		GroupBy: groupBy,
+		Count:   9,
+		Results: []Aggregate{
+			{Group: map[string]string{AggregateByProductID: "B"}, Count: 5, AverageConfidence: 0.5},
+			{Group: map[string]string{AggregateByProductID: "A"}, Count: 4, AverageConfidence: 0.8},
+		},
+	}
+
+	response := SummarizeBuckets(groupBy, buckets)
+	if !reflect.DeepEqual(response, expected) {
+		t.Errorf("Expected %+v, received %+v", expected, response)
+	}
+
+	if empty := SummarizeBuckets(groupBy, nil); empty.Count != 0 || empty.Results == nil {
+		t.Errorf("Expected empty results, received %+v", empty)
+	}
+}
+
 func TestCalculateGtin(t *testing.T) {
 	config.AppConfig.TagDecoders = []encodingscheme.TagDecoder{encodingscheme.NewSGTINDecoder(true)}
 	validEpc := "303402662C3A5F904C19939D"
@@ -648,6 +953,32 @@ func TestCalculateProductCode(t *testing.T) {
 	}
 }
 
+func TestDecode(t *testing.T) {
+	setMixedDecoderConfig(t)
+
+	sgtin := Decode("303402662C3A5F904C19939D")
+	if sgtin.Decoder != "sgtin (strict)" || sgtin.ProductID == "" || sgtin.URI == "" || len(sgtin.Errors) != 0 {
+		t.Errorf("Expected the SGTIN decoder to match, received %+v", sgtin)
+	}
+	if sgtin.FilterValue == nil || *sgtin.FilterValue != 1 {
+		t.Errorf("Expected filter value 1, received %+v", sgtin.FilterValue)
+	}
+
+	proprietary := Decode("0F00000000000C00000014D2")
+	if proprietary.Decoder != "proprietary" || proprietary.ProductID != "00000014D2" || proprietary.FilterValue != nil {
+		t.Errorf("Expected the proprietary decoder to match, received %+v", proprietary)
+	}
+	if len(proprietary.Errors) != 1 || !strings.Contains(proprietary.Errors[0], "decoder 1 (sgtin (strict))") {
+		t.Errorf("Expected the SGTIN decoder error, received %v", proprietary.Errors)
+	}
+
+	setSGTINOnlyDecoderConfig()
+	invalid := Decode("not-hex")
+	if invalid.Decoder != "" || invalid.ProductID != "" || len(invalid.Errors) != 1 {
+		t.Errorf("Expected an invalid hex error, received %+v", invalid)
+	}
+}
+
 func insertSample(t *testing.T, db *sql.DB) {
 	insertSampleCustom(t, db, t.Name())
 }
@@ -0,0 +1,77 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package tag
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"hash/fnv"
+	"net/url"
+	"strings"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-go-odata/parser"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/web"
+	"github.com/pkg/errors"
+)
+
+const (
+	// CursorParameter is the query parameter carrying the cursor of the next page of tags
+	CursorParameter = "cursor"
+	cursorVersion   = 1
+)
+
+// pageCursor is the position the next page of tags starts after. Tags are paged in EPC
+// order, and a cursor is only valid for the filter of the query it was issued for.
+type pageCursor struct {
+	Version int    `json:"v"`
+	Epc     string `json:"e"`
+	Filter  uint32 `json:"f"`
+}
+
+// encodeCursor returns the opaque cursor of the page following the tag with the given EPC
+func encodeCursor(epc string, filter string) (string, error) {
+	data, err := json.Marshal(pageCursor{Version: cursorVersion, Epc: epc, Filter: filterHash(filter)})
+	if err != nil {
+		return "", errors.Wrap(err, "error encoding cursor")
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor returns the EPC the page of the cursor starts after, validating the cursor
+// was issued for the given filter
+func decodeCursor(value string, filter string) (string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return "", errors.Wrap(web.ErrInvalidInput, "malformed cursor")
+	}
+
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return "", errors.Wrap(web.ErrInvalidInput, "malformed cursor")
+	}
+	// The EPC ends up quoted in an odata filter
+	if cursor.Version != cursorVersion || cursor.Epc == "" || strings.ContainsAny(cursor.Epc, `'\`) {
+		return "", errors.Wrap(web.ErrInvalidInput, "invalid cursor")
+	}
+	if cursor.Filter != filterHash(filter) {
+		return "", errors.Wrap(web.ErrInvalidInput, "cursor was issued for a different query")
+	}
+
+	return cursor.Epc, nil
+}
+
+func filterHash(filter string) uint32 {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(filter))
+	return hash.Sum32()
+}
+
+// canPage reports whether the results of the query can be paged by EPC. Paging imposes the
+// order of the results, so it cannot be combined with $orderby or $skip.
+func canPage(query url.Values) bool {
+	return len(query[parser.OrderBy]) == 0 && len(query[parser.Skip]) == 0
+}
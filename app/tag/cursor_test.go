@@ -0,0 +1,68 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package tag
+
+import (
+	"encoding/base64"
+	"net/url"
+	"testing"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/web"
+	"github.com/pkg/errors"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	filter := "facility_id eq 'store001'"
+	cursor, err := encodeCursor(testEpc, filter)
+	if err != nil {
+		t.Fatalf("Error encoding cursor %s", err.Error())
+	}
+
+	epc, err := decodeCursor(cursor, filter)
+	if err != nil || epc != testEpc {
+		t.Errorf("Expected cursor to decode to %s, received %s, %v", testEpc, epc, err)
+	}
+
+	quoted, _ := encodeCursor("3014' or 1=1", filter)
+	invalid := map[string]string{
+		"malformed":        "not a cursor!",
+		"not json":         base64.RawURLEncoding.EncodeToString([]byte("epc")),
+		"unknown version":  base64.RawURLEncoding.EncodeToString([]byte(`{"v":2,"e":"3014"}`)),
+		"quote in epc":     quoted,
+		"different filter": cursor,
+	}
+	for name, value := range invalid {
+		decodeFilter := filter
+		if name == "different filter" {
+			decodeFilter = "facility_id eq 'store002'"
+		}
+		if _, err := decodeCursor(value, decodeFilter); errors.Cause(err) != web.ErrInvalidInput {
+			t.Errorf("Expected invalid input decoding %s cursor, received %v", name, err)
+		}
+	}
+}
+
+func TestCanPage(t *testing.T) {
+	testCases := map[string]bool{
+		"$top=10":                           true,
+		"$filter=facility_id eq 'store001'": true,
+		"$filter=epc eq 'a' and tid eq 'b'": true,
+		"$filter=epc eq 'a' or epc eq 'b'":  true,
+		"$orderby=last_read":                false,
+		"$skip=10":                          false,
+	}
+
+	for rawQuery, expected := range testCases {
+		query, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			t.Fatalf("Unable to parse query %s", rawQuery)
+		}
+		if canPage(query) != expected {
+			t.Errorf("Expected paging %s to be %v", rawQuery, expected)
+		}
+	}
+}
@@ -50,6 +50,14 @@ type Tag struct {
 	Confidence float64 `json:"confidence,omitempty"` //omitempty - confidence is not stored in the db
 	// Cycle Count indicator
 	CycleCount bool `json:"-"`
+	// Set when a handheld full scan did not read the tag while it was believed present
+	MissingCandidate bool `json:"missing_candidate,omitempty"`
+	// Why the tag departed, either 'exit', 'pos', 'facility_change' or 'age_out'. Empty unless departed
+	DepartureReason string `json:"departure_reason,omitempty"`
+	// Location the tag was last seen at when it departed. Empty unless departed
+	DepartureLocation string `json:"departure_location,omitempty"`
+	// Millisecond epoch time the departure was detected. Zero unless departed
+	DepartedAt int64 `json:"departed_at,omitempty"`
 }
 
 // LocationHistory is the model to record the whereabouts history of a tag
@@ -75,7 +83,11 @@ func (tag Tag) IsEqual(target Tag) bool {
 		tag.QualifiedState == target.QualifiedState &&
 		tag.EpcState == target.EpcState &&
 		tag.EpcContext == target.EpcContext &&
-		tag.ProductID == target.ProductID {
+		tag.ProductID == target.ProductID &&
+		tag.MissingCandidate == target.MissingCandidate &&
+		tag.DepartureReason == target.DepartureReason &&
+		tag.DepartureLocation == target.DepartureLocation &&
+		tag.DepartedAt == target.DepartedAt {
 		return true
 	}
 	return false
@@ -117,9 +129,74 @@ type doc_RequestBody struct {
 	Body RequestBody `json:"datadata"`
 }
 
+// BulkUpdateBody is the model for the request body used to update many tags of a facility
+// at once. Tags are selected either by EPC or by an odata filter.
+type BulkUpdateBody struct {
+	// Facility of the tags to update
+	FacilityID string `json:"facility_id"`
+	// EPCs of the tags to update
+	Epcs []string `json:"epcs"`
+	// Odata filter selecting the tags to update, such as qualified_state eq 'received'
+	Filter string `json:"filter"`
+	// User-defined state to set
+	QualifiedState string `json:"qualified_state"`
+	// EPC context to set, empty to clear it
+	EpcContext string `json:"epc_context"`
+	// Only count the tags that would be updated
+	DryRun bool `json:"dry_run"`
+}
+
+// BulkUpdateResponse is the result of a bulk update
+type BulkUpdateResponse struct {
+	// Number of tags updated, or that would be updated on a dry run
+	Affected int64 `json:"affected"`
+	DryRun   bool  `json:"dry_run"`
+}
+
+// HandheldReadsBody is the model for the request body used to submit a batch of handheld reads
+type HandheldReadsBody struct {
+	// Facility where the reads took place
+	FacilityID string `json:"facility_id"`
+	// Location of the handheld reader, used for reads that do not provide one
+	Location string `json:"location"`
+	// Millisecond epoch time of the reads, used for reads that do not provide one
+	Timestamp int64 `json:"timestamp"`
+	// List of EPC reads
+	Reads []HandheldRead `json:"reads"`
+}
+
+// HandheldRead is a single EPC read taken by a handheld reader
+type HandheldRead struct {
+	// SGTIN EPC code
+	Epc string `json:"epc"`
+	// Tag manufacturer ID
+	Tid string `json:"tid"`
+	// Optional location overriding the batch location
+	Location string `json:"location"`
+	// Optional millisecond epoch time overriding the batch timestamp
+	Timestamp int64 `json:"timestamp"`
+}
+
+// HandheldReadResult is the outcome of processing a single handheld read
+type HandheldReadResult struct {
+	// SGTIN EPC code
+	Epc string `json:"epc"`
+	// Result of processing the read, either 'processed' or 'filtered'
+	Status string `json:"status"`
+	// ProductID decoded from the EPC
+	ProductID string `json:"product_id,omitempty"`
+	// Last event recorded for tag after processing
+	Event string `json:"event,omitempty"`
+	// State of tag after processing, either 'present' or 'departed'
+	EpcState string `json:"epc_state,omitempty"`
+}
+
 // PagingType is the model used for paging that is returned in the query response
 type PagingType struct {
 	Cursor string `json:"cursor,omitempty"`
+	// Set when more tags match than were returned and the results cannot be paged by
+	// cursor, as the query sets $orderby or $skip
+	Truncated bool `json:"truncated,omitempty"`
 }
 
 // Response is the model used to return the query response
@@ -134,6 +211,66 @@ type CountType struct {
 	Count *int `json:"count"`
 }
 
+// Fields tags can be aggregated by
+const (
+	AggregateByProductID      = "product_id"
+	AggregateByFacilityID     = "facility_id"
+	AggregateByEpcState       = "epc_state"
+	AggregateByQualifiedState = "qualified_state"
+	// AggregateByLocation groups tags by their most recent location
+	AggregateByLocation = "location"
+)
+
+// AggregateBucket is the number of tags of a product at a facility sharing the values of
+// the aggregated fields and last read during the same minute. Buckets are what the
+// database groups tags into; confidence is computed once per bucket.
+type AggregateBucket struct {
+	Group      map[string]string
+	ProductID  string
+	FacilityID string
+	// Millisecond epoch time of the start of the minute the tags were last read
+	LastRead   int64
+	Count      int
+	Confidence float64
+}
+
+// ConfidenceCoefficients are the coefficients of the confidence model for the tags of a
+// product at a facility
+type ConfidenceCoefficients struct {
+	ProductID        string
+	FacilityID       string
+	DailyInvPerc     float64
+	ProbUnreadToRead float64
+	ProbInStore      float64
+	ProbExitError    float64
+}
+
+// ConfidenceSQL renders the confidence of a tag as a SQL expression, given the SQL
+// expressions of its coefficients and of its millisecond epoch last read
+type ConfidenceSQL func(dailyInvPerc, probUnreadToRead, probInStore, probExitError, lastRead string) string
+
+// Aggregate is the number of tags, and their average confidence, sharing the values of
+// the aggregated fields
+type Aggregate struct {
+	// Values of the aggregated fields
+	Group map[string]string `json:"group"`
+	// Number of tags
+	Count int `json:"count"`
+	// Average confidence of the tags, 0 when it was not requested
+	AverageConfidence float64 `json:"average_confidence"`
+}
+
+// AggregateResponse is the model used to return the aggregate query response
+//swagger:model AggregateResponse
+type AggregateResponse struct {
+	// Fields the tags were aggregated by
+	GroupBy []string `json:"group_by"`
+	// Total number of tags
+	Count int `json:"count"`
+	// Aggregates, largest count first
+	Results []Aggregate `json:"results"`
+}
+
 // IsEmpty determines if a tag is empty
 func (tag Tag) IsEmpty() bool {
 	return reflect.DeepEqual(tag, Tag{})
@@ -221,6 +358,29 @@ type AdvanceShippingNotice struct {
 	Items []ASNInputItem `json:"items"`
 }
 
+// DecodeBody is the model for the request body used to decode a list of EPCs
+type DecodeBody struct {
+	// EPCs to decode, in hex
+	Epcs []string `json:"epcs"`
+}
+
+// DecodeResult is the outcome of decoding a single EPC with the configured tag decoders
+//swagger:model DecodeResult
+type DecodeResult struct {
+	// EPC as given in the request
+	Epc string `json:"epc"`
+	// Decoder that matched the EPC, empty if none of the configured decoders did
+	Decoder string `json:"decoder,omitempty"`
+	// ProductID decoded from the EPC
+	ProductID string `json:"product_id,omitempty"`
+	// URI decoded from the EPC
+	URI string `json:"uri,omitempty"`
+	// Part of EPC, denotes packaging level of the item. Only set for encodings that carry one
+	FilterValue *int `json:"filter_value,omitempty"`
+	// Errors from the decoders that were unable to decode the EPC
+	Errors []string `json:"errors,omitempty"`
+}
+
 // PurgingRequest is the model for request body of the api used for purging the collection periodically
 type PurgingRequest struct {
 	Days int `json:"days"`
@@ -231,4 +391,8 @@ const (
 	StateChangeEvent = "stateChange"
 	// OutOfStockEvent is constant for out of stock trigger rule
 	OutOfStockEvent = "outOfStock"
+	// LowStockEvent is constant for low stock trigger rule
+	LowStockEvent = "lowStock"
+	// RestockedEvent is constant for restocked trigger rule
+	RestockedEvent = "restocked"
 )
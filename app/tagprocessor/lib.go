@@ -53,6 +53,8 @@ func ProcessInventoryData(dbs *sql.DB, invData *jsonrpc.InventoryData) (*jsonrpc
 		}
 	}
 
+	sensor.RecordInventoryData(rsp.DeviceId, len(invData.Params.Data), helper.UnixMilliNow())
+
 	invEvent := jsonrpc.NewInventoryEvent()
 
 	for _, read := range invData.Params.Data {
@@ -144,7 +146,7 @@ func checkDepartPOS(invEvent *jsonrpc.InventoryEvent, tag *Tag) bool {
 
 	if tag.LastArrived < expiration {
 		tag.setState(DepartedPos)
-		addEvent(invEvent, tag, Departed)
+		addDepartedEvent(invEvent, tag, jsonrpc.DepartureReasonPOS, tag.LastRead)
 		logrus.Debugf("Departed POS: %v", tag)
 		return true
 	}
@@ -156,7 +158,8 @@ func checkMovement(invEvent *jsonrpc.InventoryEvent, tag *Tag, prev *previousTag
 	if prev.location != "" && prev.location != tag.Location {
 		if prev.facilityId != "" && prev.facilityId != tag.FacilityId {
 			// change facility (depart old facility, arrive new facility)
-			addEventDetails(invEvent, tag.Epc, tag.Tid, prev.location, prev.facilityId, Departed, prev.lastRead)
+			addEventDetails(invEvent, tag.Epc, tag.Tid, prev.location, prev.facilityId, Departed, prev.lastRead,
+				jsonrpc.DepartureReasonFacilityChange, tag.LastRead)
 			addEvent(invEvent, tag, Arrival)
 		} else {
 			addEvent(invEvent, tag, Moved)
@@ -255,7 +258,7 @@ func DoAggregateDepartedTask() *jsonrpc.InventoryEvent {
 			if tag.LastRead < expiration {
 				tag.setStateAt(DepartedExit, now)
 				logrus.Debugf("Departed %v", tag)
-				addEvent(invEvent, tag, Departed)
+				addDepartedEvent(invEvent, tag, jsonrpc.DepartureReasonExit, now)
 			} else {
 				// if the tag is to be kept, put it back in the slice
 				tags[keepIndex] = tag
@@ -270,12 +273,17 @@ func DoAggregateDepartedTask() *jsonrpc.InventoryEvent {
 }
 
 func addEvent(invEvent *jsonrpc.InventoryEvent, tag *Tag, event Event) {
-	addEventDetails(invEvent, tag.Epc, tag.Tid, tag.Location, tag.FacilityId, event, tag.LastRead)
+	addEventDetails(invEvent, tag.Epc, tag.Tid, tag.Location, tag.FacilityId, event, tag.LastRead, "", 0)
+}
+
+// addDepartedEvent adds a departed event of the tag, departedAt being when the departure was detected
+func addDepartedEvent(invEvent *jsonrpc.InventoryEvent, tag *Tag, reason string, departedAt int64) {
+	addEventDetails(invEvent, tag.Epc, tag.Tid, tag.Location, tag.FacilityId, Departed, tag.LastRead, reason, departedAt)
 }
 
-func addEventDetails(invEvent *jsonrpc.InventoryEvent, epc string, tid string, location string, facilityId string, event Event, timestamp int64) {
-	logrus.Infof("Sending event {epc: %s, tid: %s, event_type: %s, facility_id: %s, location: %s, timestamp: %d}",
-		epc, tid, event, facilityId, location, timestamp)
+func addEventDetails(invEvent *jsonrpc.InventoryEvent, epc string, tid string, location string, facilityId string, event Event, timestamp int64, departureReason string, departedAt int64) {
+	logrus.Infof("Sending event {epc: %s, tid: %s, event_type: %s, facility_id: %s, location: %s, timestamp: %d, departure_reason: %s}",
+		epc, tid, event, facilityId, location, timestamp, departureReason)
 
 	invEvent.AddTagEvent(jsonrpc.TagEvent{
 		Timestamp:       timestamp,
@@ -285,5 +293,7 @@ func addEventDetails(invEvent *jsonrpc.InventoryEvent, epc string, tid string, l
 		EpcEncodeFormat: epcEncodeFormat,
 		EventType:       string(event),
 		FacilityID:      facilityId,
+		DepartureReason: departureReason,
+		DepartedAt:      departedAt,
 	})
 }
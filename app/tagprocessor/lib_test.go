@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/config"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/sensor"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/jsonrpc"
 	"testing"
 )
 
@@ -201,6 +202,9 @@ func TestMoveDifferentFacility(t *testing.T) {
 	if err := ds.verifyEventPattern(2*ds.size(), Departed, Arrival); err != nil {
 		t.Error(err)
 	}
+	if err := ds.verifyDepartureReason(jsonrpc.DepartureReasonFacilityChange); err != nil {
+		t.Error(err)
+	}
 	ds.resetEvents()
 }
 
@@ -265,6 +269,49 @@ func TestBasicExit(t *testing.T) {
 	ds.resetEvents()
 }
 
+func TestExitDepartureReason(t *testing.T) {
+	ds := newTestDataset(3)
+
+	back := generateTestSensor(backStock, sensor.NoPersonality)
+	frontExit := generateTestSensor(salesFloor, sensor.Exit)
+
+	ds.readAll(back, rssiMin, 4)
+	ds.updateTagRefs()
+	ds.readAll(frontExit, rssiMax, 20)
+	if err := ds.verifyAll(Exiting, frontExit); err != nil {
+		t.Fatal(err)
+	}
+	ds.resetEvents()
+
+	// not read since long enough to be departed
+	inventoryMutex.Lock()
+	for _, tag := range ds.tags {
+		tag.LastRead = 1
+	}
+	inventoryMutex.Unlock()
+
+	invEvent := DoAggregateDepartedTask()
+
+	departed := 0
+	for _, item := range invEvent.Params.Data {
+		for _, tag := range ds.tags {
+			if item.EpcCode != tag.Epc {
+				continue
+			}
+			departed++
+			if item.EventType != string(Departed) || item.DepartureReason != jsonrpc.DepartureReasonExit {
+				t.Errorf("Expected departed event through exit, got %#v", item)
+			}
+		}
+	}
+	if departed != ds.size() {
+		t.Errorf("Expected %d departed events, got %d", ds.size(), departed)
+	}
+	if err := ds.verifyStateAll(DepartedExit); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestExitingArrivalDepartures(t *testing.T) {
 	ds := newTestDataset(5)
 
@@ -393,6 +440,9 @@ func TestTagDepartAndReturnPOS(t *testing.T) {
 	if err := ds.verifyEventPattern(ds.size(), Departed); err != nil {
 		t.Error(err)
 	}
+	if err := ds.verifyDepartureReason(jsonrpc.DepartureReasonPOS); err != nil {
+		t.Error(err)
+	}
 	ds.resetEvents()
 
 	// and it should stay gone for a while (but not long enough to return)
@@ -156,6 +156,18 @@ func (ds *testDataset) verifyEventPattern(expectedCount int, expectedEvents ...E
 	return nil
 }
 
+func (ds *testDataset) verifyDepartureReason(expectedReason string) error {
+	for _, item := range ds.inventoryEvent.Params.Data {
+		if item.EventType == string(Departed) && item.DepartureReason != expectedReason {
+			return fmt.Errorf("excpected departure reason %s but was %s. events:\n%#v", expectedReason, item.DepartureReason, ds.inventoryEvent.Params.Data)
+		}
+		if item.EventType != string(Departed) && item.DepartureReason != "" {
+			return fmt.Errorf("excpected no departure reason for %s event but was %s", item.EventType, item.DepartureReason)
+		}
+	}
+	return nil
+}
+
 func (ds *testDataset) verifyNoEvents() error {
 	if !ds.inventoryEvent.IsEmpty() {
 		return fmt.Errorf("excpected no events to be generated, but %d were generated. events:\n%#v", len(ds.inventoryEvent.Params.Data), ds.inventoryEvent.Params.Data)
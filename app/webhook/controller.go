@@ -0,0 +1,643 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/stocklevel"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/tag"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/web"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/helper"
+	"github.com/lib/pq"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	subscriptionsTable   = "webhooks"
+	deliveriesTable      = "webhookdeliveries"
+	jsonb                = "data"
+	idColumn             = "id"
+	subscriptionIDColumn = "subscription_id"
+	statusColumn         = "status"
+	nextAttemptColumn    = "next_attempt"
+	createdColumn        = "created"
+
+	// maxRetryDelay caps the exponential backoff between attempts of a delivery
+	maxRetryDelay = time.Hour
+	// deliveryBatchSize is the number of due deliveries attempted by a call to Deliver
+	deliveryBatchSize = 100
+	// secretBytes is the number of random bytes of generated secrets
+	secretBytes = 32
+	// maxResponseBytes is the number of bytes of a response body read before the connection is reused
+	maxResponseBytes = 4096
+)
+
+// Insert creates an enabled subscription, generating its ID and, when none is provided,
+// its secret. The created subscription is returned along with its secret.
+func Insert(dbs *sql.DB, subscription Subscription) (Subscription, error) {
+	subscription.ID = uuid.New()
+	subscription.Enabled = true
+	subscription.ConsecutiveFailures = 0
+	subscription.DisabledReason = ""
+	subscription.Created = helper.UnixMilliNow()
+
+	if subscription.Secret == "" {
+		secret := make([]byte, secretBytes)
+		if _, err := rand.Read(secret); err != nil {
+			return subscription, errors.Wrap(err, "error generating webhook secret")
+		}
+		subscription.Secret = hex.EncodeToString(secret)
+	}
+
+	obj, err := json.Marshal(subscription)
+	if err != nil {
+		return subscription, err
+	}
+
+	insertStmt := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)`,
+		pq.QuoteIdentifier(subscriptionsTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(string(obj)),
+	)
+	if _, err := dbs.Exec(insertStmt); err != nil {
+		return subscription, errors.Wrap(err, "db.webhooks.Insert()")
+	}
+
+	return subscription, nil
+}
+
+// FindAll returns all subscriptions, in the order they were created
+func FindAll(dbs *sql.DB) ([]Subscription, error) {
+	return findSubscriptions(dbs, "TRUE")
+}
+
+// FindByID returns the subscription with the ID, or web.ErrNotFound if it does not exist
+func FindByID(dbs *sql.DB, id string) (Subscription, error) {
+	subscriptions, err := findSubscriptions(dbs, matchCondition(idColumn, id))
+	if err != nil {
+		return Subscription{}, err
+	}
+	if len(subscriptions) == 0 {
+		return Subscription{}, errors.Wrapf(web.ErrNotFound, "no webhook with id %s", id)
+	}
+	return subscriptions[0], nil
+}
+
+// Update replaces the URL, filters and enabled state of a subscription, and its secret when
+// one is provided. Enabling a disabled subscription resets its failures.
+func Update(dbs *sql.DB, id string, changes Subscription) (Subscription, error) {
+	subscription, err := FindByID(dbs, id)
+	if err != nil {
+		return subscription, err
+	}
+
+	if changes.Enabled && !subscription.Enabled {
+		subscription.ConsecutiveFailures = 0
+		subscription.DisabledReason = ""
+	}
+	subscription.URL = changes.URL
+	subscription.Events = changes.Events
+	subscription.FacilityIDs = changes.FacilityIDs
+	subscription.Enabled = changes.Enabled
+	if changes.Secret != "" {
+		subscription.Secret = changes.Secret
+	}
+
+	obj, err := json.Marshal(subscription)
+	if err != nil {
+		return subscription, err
+	}
+
+	updateStmt := fmt.Sprintf(`UPDATE %s SET %s = %s WHERE %s`,
+		pq.QuoteIdentifier(subscriptionsTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(string(obj)),
+		matchCondition(idColumn, id),
+	)
+	if _, err := dbs.Exec(updateStmt); err != nil {
+		return subscription, errors.Wrap(err, "db.webhooks.Update()")
+	}
+
+	return subscription, nil
+}
+
+// Delete deletes a subscription along with its deliveries, returning web.ErrNotFound when
+// it does not exist
+func Delete(dbs *sql.DB, id string) error {
+	deleteStmt := fmt.Sprintf(`DELETE FROM %s WHERE %s`,
+		pq.QuoteIdentifier(subscriptionsTable),
+		matchCondition(idColumn, id),
+	)
+
+	result, err := dbs.Exec(deleteStmt)
+	if err != nil {
+		return errors.Wrap(err, "db.webhooks.Delete()")
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return errors.Wrapf(web.ErrNotFound, "no webhook with id %s", id)
+	}
+
+	deleteStmt = fmt.Sprintf(`DELETE FROM %s WHERE %s`,
+		pq.QuoteIdentifier(deliveriesTable),
+		matchCondition(subscriptionIDColumn, id),
+	)
+	if _, err := dbs.Exec(deleteStmt); err != nil {
+		return errors.Wrap(err, "db.webhookdeliveries.Delete()")
+	}
+	return nil
+}
+
+// FindDeliveries returns up to limit of the most recent deliveries of a subscription, newest
+// first. An empty status matches deliveries of any status.
+func FindDeliveries(dbs *sql.DB, subscriptionID string, status string, limit int) ([]Delivery, error) {
+	conditions := []string{matchCondition(subscriptionIDColumn, subscriptionID)}
+	if status != "" {
+		conditions = append(conditions, matchCondition(statusColumn, status))
+	}
+
+	return findDeliveries(dbs, fmt.Sprintf(`%s ORDER BY (%s ->> %s)::bigint DESC LIMIT %d`,
+		strings.Join(conditions, " AND "),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(createdColumn),
+		limit,
+	))
+}
+
+// Enqueue queues a delivery of each event to every enabled subscription notified of it
+func Enqueue(dbs *sql.DB, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	// Metrics
+	metrics.GetOrRegisterGauge(`Inventory.Webhook.Enqueue.Attempt`, nil).Update(1)
+	mSuccess := metrics.GetOrRegisterGauge(`Inventory.Webhook.Enqueue.Success`, nil)
+	mEnqueueErr := metrics.GetOrRegisterGauge(`Inventory.Webhook.Enqueue.Error`, nil)
+	mQueued := metrics.GetOrRegisterCounter(`Inventory.Webhook.Enqueue.Queued`, nil)
+
+	subscriptions, err := FindAll(dbs)
+	if err != nil {
+		mEnqueueErr.Update(1)
+		return err
+	}
+
+	now := helper.UnixMilliNow()
+	var values []string
+	for _, event := range events {
+		var payload []byte
+		for _, subscription := range subscriptions {
+			if !subscription.Matches(event) {
+				continue
+			}
+			if payload == nil {
+				if payload, err = json.Marshal(event.Data); err != nil {
+					mEnqueueErr.Update(1)
+					return errors.Wrapf(err, "error marshaling %s event", event.Type)
+				}
+			}
+
+			obj, err := json.Marshal(Delivery{
+				ID:             uuid.New(),
+				SubscriptionID: subscription.ID,
+				Event:          event.Type,
+				FacilityID:     event.FacilityID,
+				Payload:        payload,
+				Status:         DeliveryPending,
+				NextAttempt:    now,
+				Created:        now,
+			})
+			if err != nil {
+				mEnqueueErr.Update(1)
+				return err
+			}
+			values = append(values, fmt.Sprintf("(%s)", pq.QuoteLiteral(string(obj))))
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	insertStmt := fmt.Sprintf(`INSERT INTO %s (%s) VALUES %s`,
+		pq.QuoteIdentifier(deliveriesTable),
+		pq.QuoteIdentifier(jsonb),
+		strings.Join(values, ", "),
+	)
+	if _, err := dbs.Exec(insertStmt); err != nil {
+		mEnqueueErr.Update(1)
+		return errors.Wrap(err, "db.webhookdeliveries.Enqueue()")
+	}
+
+	mQueued.Inc(int64(len(values)))
+	mSuccess.Update(1)
+	return nil
+}
+
+// Deliver attempts the pending deliveries that are due, recording the outcome of every
+// attempt. Failed attempts are retried following the policy, and subscriptions failing
+// too many consecutive attempts are disabled. Subscriptions are delivered to concurrently
+// by up to workers goroutines, so a slow endpoint does not hold up the others; the
+// deliveries of a subscription are attempted in order.
+func Deliver(dbs *sql.DB, client *http.Client, policy RetryPolicy, workers int) error {
+
+	now := helper.UnixMilliNow()
+	due, err := findDeliveries(dbs, fmt.Sprintf(`%s AND (%s ->> %s)::bigint <= %d ORDER BY (%s ->> %s)::bigint, (%s ->> %s)::bigint LIMIT %d`,
+		matchCondition(statusColumn, DeliveryPending),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(nextAttemptColumn),
+		now,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(nextAttemptColumn),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(createdColumn),
+		deliveryBatchSize,
+	))
+	if err != nil || len(due) == 0 {
+		return err
+	}
+
+	subscriptions, err := FindAll(dbs)
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]Subscription, len(subscriptions))
+	for _, subscription := range subscriptions {
+		byID[subscription.ID] = subscription
+	}
+
+	// Deliveries grouped by subscription, in the order they are due
+	var order []string
+	grouped := make(map[string][]Delivery)
+	for _, delivery := range due {
+		if _, ok := grouped[delivery.SubscriptionID]; !ok {
+			order = append(order, delivery.SubscriptionID)
+		}
+		grouped[delivery.SubscriptionID] = append(grouped[delivery.SubscriptionID], delivery)
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(order) {
+		workers = len(order)
+	}
+
+	queue := make(chan string)
+	errs := make(chan error, len(order))
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for subscriptionID := range queue {
+				subscription, ok := byID[subscriptionID]
+				errs <- deliverToSubscription(dbs, client, policy, subscription, ok, grouped[subscriptionID])
+			}
+		}()
+	}
+	for _, subscriptionID := range order {
+		queue <- subscriptionID
+	}
+	close(queue)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliverToSubscription attempts the deliveries of a subscription in order, failing them
+// when the subscription no longer exists or is disabled. The first failed attempt ends the
+// pass for the subscription: its later deliveries are deferred until the failed one is
+// retried so they are not delivered out of order, and an outage counts as a single failure
+// of the subscription per pass.
+func deliverToSubscription(dbs *sql.DB, client *http.Client, policy RetryPolicy, subscription Subscription, found bool, deliveries []Delivery) error {
+
+	// Metrics
+	mDelivered := metrics.GetOrRegisterCounter(`Inventory.Webhook.Deliver.Delivered`, nil)
+	mAttemptErr := metrics.GetOrRegisterCounter(`Inventory.Webhook.Deliver.Attempt-Error`, nil)
+	mFailed := metrics.GetOrRegisterCounter(`Inventory.Webhook.Deliver.Failed`, nil)
+	mDisabled := metrics.GetOrRegisterCounter(`Inventory.Webhook.Deliver.Disabled`, nil)
+
+	for _, delivery := range deliveries {
+		attemptFailed := false
+		if !found || !subscription.Enabled {
+			// Deliveries are not kept for subscriptions that can no longer receive them
+			delivery.Status = DeliveryFailed
+			delivery.NextAttempt = 0
+			delivery.LastError = "webhook is disabled"
+		} else {
+			attemptTime := helper.UnixMilliNow()
+			statusCode, err := send(client, subscription, delivery, attemptTime)
+			wasEnabled := subscription.Enabled
+			recordAttempt(&delivery, &subscription, statusCode, err, attemptTime, policy)
+
+			if err != nil {
+				attemptFailed = true
+				mAttemptErr.Inc(1)
+			}
+			if wasEnabled && !subscription.Enabled {
+				mDisabled.Inc(1)
+			}
+			if err := updateHealth(dbs, subscription); err != nil {
+				return err
+			}
+		}
+
+		switch delivery.Status {
+		case DeliveryDelivered:
+			mDelivered.Inc(1)
+		case DeliveryFailed:
+			mFailed.Inc(1)
+		}
+		if err := updateDelivery(dbs, delivery); err != nil {
+			return err
+		}
+
+		if attemptFailed {
+			if delivery.Status == DeliveryPending {
+				return deferDeliveries(dbs, subscription.ID, delivery.ID, delivery.NextAttempt)
+			}
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// deferDeliveries postpones the pending deliveries of a subscription, other than the one
+// being retried, that are due before the millisecond epoch time
+func deferDeliveries(dbs *sql.DB, subscriptionID string, retriedID string, until int64) error {
+	updateStmt := fmt.Sprintf(`UPDATE %s SET %s = jsonb_set(%s, %s, to_jsonb(%d::bigint))
+								WHERE %s AND %s AND %s ->> %s <> %s AND (%s ->> %s)::bigint < %d`,
+		pq.QuoteIdentifier(deliveriesTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral("{"+nextAttemptColumn+"}"),
+		until,
+		matchCondition(subscriptionIDColumn, subscriptionID),
+		matchCondition(statusColumn, DeliveryPending),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(idColumn),
+		pq.QuoteLiteral(retriedID),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(nextAttemptColumn),
+		until,
+	)
+
+	if _, err := dbs.Exec(updateStmt); err != nil {
+		return errors.Wrap(err, "db.webhookdeliveries.deferDeliveries()")
+	}
+	return nil
+}
+
+// Prune deletes the delivered and failed deliveries queued before the millisecond epoch time
+func Prune(dbs *sql.DB, before int64) error {
+	deleteStmt := fmt.Sprintf(`DELETE FROM %s WHERE %s ->> %s <> %s AND (%s ->> %s)::bigint < %d`,
+		pq.QuoteIdentifier(deliveriesTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(statusColumn),
+		pq.QuoteLiteral(DeliveryPending),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(createdColumn),
+		before,
+	)
+
+	if _, err := dbs.Exec(deleteStmt); err != nil {
+		return errors.Wrap(err, "db.webhookdeliveries.Prune()")
+	}
+	return nil
+}
+
+// Sign returns the signature of a body posted at the millisecond epoch time, the hex encoded
+// HMAC-SHA256 of the timestamp and the body separated by a dot, keyed with the secret of the
+// subscription and prefixed with "sha256=". Including the timestamp lets endpoints reject
+// replayed requests.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// TagEvents returns an event per event type and facility of the tags, the data of which is
+// the tags of the event
+func TagEvents(tags []tag.Tag) []Event {
+	var events []Event
+	index := make(map[[2]string]int)
+	for _, tagData := range tags {
+		if tagData.Event == "" {
+			continue
+		}
+		key := [2]string{tagData.Event, tagData.FacilityID}
+		i, ok := index[key]
+		if !ok {
+			i = len(events)
+			index[key] = i
+			events = append(events, Event{Type: tagData.Event, FacilityID: tagData.FacilityID, Data: []tag.Tag{}})
+		}
+		events[i].Data = append(events[i].Data.([]tag.Tag), tagData)
+	}
+	return events
+}
+
+// StockEvents returns an event per stock level change
+func StockEvents(stockEvents []stocklevel.Event) []Event {
+	events := make([]Event, 0, len(stockEvents))
+	for _, stockEvent := range stockEvents {
+		events = append(events, Event{Type: stockEvent.Event, FacilityID: stockEvent.FacilityID, Data: stockEvent})
+	}
+	return events
+}
+
+// send posts a delivery to its subscription, returning the status code of the response
+func send(client *http.Client, subscription Subscription, delivery Delivery, timestamp int64) (int, error) {
+	body, err := json.Marshal(Notification{
+		ID:         delivery.ID,
+		Event:      delivery.Event,
+		FacilityID: delivery.FacilityID,
+		Created:    delivery.Created,
+		Data:       delivery.Payload,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to create webhook request")
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, delivery.Event)
+	request.Header.Set(DeliveryHeader, delivery.ID)
+	request.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	request.Header.Set(SignatureHeader, Sign(subscription.Secret, timestamp, body))
+
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(response.Body, maxResponseBytes))
+		_ = response.Body.Close()
+	}()
+
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		return response.StatusCode, errors.Errorf("webhook responded with status %d", response.StatusCode)
+	}
+	return response.StatusCode, nil
+}
+
+// recordAttempt updates a delivery and its subscription with the outcome of an attempt
+func recordAttempt(delivery *Delivery, subscription *Subscription, statusCode int, err error, now int64, policy RetryPolicy) {
+	delivery.Attempts++
+	delivery.LastAttempt = now
+	delivery.LastStatusCode = statusCode
+
+	if err == nil {
+		delivery.Status = DeliveryDelivered
+		delivery.NextAttempt = 0
+		delivery.LastError = ""
+		subscription.ConsecutiveFailures = 0
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= policy.MaxAttempts {
+		delivery.Status = DeliveryFailed
+		delivery.NextAttempt = 0
+	} else {
+		delivery.NextAttempt = now + int64(retryDelay(delivery.Attempts, policy.BaseDelay)/time.Millisecond)
+	}
+
+	subscription.ConsecutiveFailures++
+	if subscription.Enabled && subscription.ConsecutiveFailures >= policy.DisableAfter {
+		subscription.Enabled = false
+		subscription.DisabledReason = fmt.Sprintf("disabled after %d consecutive failed attempts, the last one failing with: %s",
+			subscription.ConsecutiveFailures, delivery.LastError)
+	}
+}
+
+// updateHealth records the failures and enabled state of a subscription, leaving the fields
+// managed through the API untouched
+func updateHealth(dbs *sql.DB, subscription Subscription) error {
+	updateStmt := fmt.Sprintf(`UPDATE %s SET %s = %s || jsonb_build_object('consecutive_failures', %d, 'enabled', %t, 'disabled_reason', %s)
+								WHERE %s`,
+		pq.QuoteIdentifier(subscriptionsTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteIdentifier(jsonb),
+		subscription.ConsecutiveFailures,
+		subscription.Enabled,
+		pq.QuoteLiteral(subscription.DisabledReason),
+		matchCondition(idColumn, subscription.ID),
+	)
+
+	if _, err := dbs.Exec(updateStmt); err != nil {
+		return errors.Wrap(err, "db.webhooks.updateHealth()")
+	}
+	return nil
+}
+
+func updateDelivery(dbs *sql.DB, delivery Delivery) error {
+	obj, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+
+	updateStmt := fmt.Sprintf(`UPDATE %s SET %s = %s WHERE %s`,
+		pq.QuoteIdentifier(deliveriesTable),
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(string(obj)),
+		matchCondition(idColumn, delivery.ID),
+	)
+
+	if _, err := dbs.Exec(updateStmt); err != nil {
+		return errors.Wrap(err, "db.webhookdeliveries.updateDelivery()")
+	}
+	return nil
+}
+
+func findSubscriptions(dbs *sql.DB, condition string) ([]Subscription, error) {
+	selectQuery := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ORDER BY (%s ->> %s)::bigint`,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteIdentifier(subscriptionsTable),
+		condition,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteLiteral(createdColumn),
+	)
+
+	rows, err := dbs.Query(selectQuery)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving webhooks")
+	}
+	defer rows.Close()
+
+	subscriptions := make([]Subscription, 0)
+	for rows.Next() {
+		var subscription Subscription
+		if err := rows.Scan(&subscription); err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+func findDeliveries(dbs *sql.DB, condition string) ([]Delivery, error) {
+	selectQuery := fmt.Sprintf(`SELECT %s FROM %s WHERE %s`,
+		pq.QuoteIdentifier(jsonb),
+		pq.QuoteIdentifier(deliveriesTable),
+		condition,
+	)
+
+	rows, err := dbs.Query(selectQuery)
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving webhook deliveries")
+	}
+	defer rows.Close()
+
+	deliveries := make([]Delivery, 0)
+	for rows.Next() {
+		var delivery Delivery
+		if err := rows.Scan(&delivery); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func matchCondition(column string, value string) string {
+	return fmt.Sprintf(`%s ->> %s = %s`, pq.QuoteIdentifier(jsonb), pq.QuoteLiteral(column), pq.QuoteLiteral(value))
+}
@@ -0,0 +1,340 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/stocklevel"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/tag"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/integrationtest"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/web"
+	"github.com/pkg/errors"
+)
+
+var dbHost integrationtest.DBHost
+
+func TestMain(m *testing.M) {
+	dbHost = integrationtest.InitHost("webhook_test")
+	exitCode := m.Run()
+	dbHost.Close()
+	os.Exit(exitCode)
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{8, maxRetryDelay},
+		{100, maxRetryDelay},
+	}
+
+	for _, test := range tests {
+		if delay := retryDelay(test.attempts, 30*time.Second); delay != test.expected {
+			t.Errorf("Expected a delay of %v after %d attempts, got %v", test.expected, test.attempts, delay)
+		}
+	}
+}
+
+func TestRecordAttempt(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, DisableAfter: 4}
+	subscription := Subscription{Enabled: true, ConsecutiveFailures: 2}
+	delivery := Delivery{Status: DeliveryPending, Attempts: 1}
+
+	recordAttempt(&delivery, &subscription, http.StatusServiceUnavailable, errors.New("unavailable"), 1000, policy)
+	if delivery.Status != DeliveryPending || delivery.NextAttempt != 3000 || delivery.LastStatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected a retry 2s later, got %+v", delivery)
+	}
+	if subscription.ConsecutiveFailures != 3 || !subscription.Enabled {
+		t.Errorf("Expected the subscription to stay enabled with 3 failures, got %+v", subscription)
+	}
+
+	recordAttempt(&delivery, &subscription, 0, errors.New("connection refused"), 4000, policy)
+	if delivery.Status != DeliveryFailed || delivery.NextAttempt != 0 {
+		t.Errorf("Expected the delivery to fail after 3 attempts, got %+v", delivery)
+	}
+	if subscription.Enabled || subscription.DisabledReason == "" {
+		t.Errorf("Expected the subscription to be disabled after 4 failures, got %+v", subscription)
+	}
+
+	delivery = Delivery{Status: DeliveryPending}
+	recordAttempt(&delivery, &subscription, http.StatusOK, nil, 5000, policy)
+	if delivery.Status != DeliveryDelivered || delivery.LastError != "" || subscription.ConsecutiveFailures != 0 {
+		t.Errorf("Expected the delivery to succeed and reset failures, got %+v %+v", delivery, subscription)
+	}
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '1501863300375.{"event":"departed"}' | openssl dgst -sha256 -hmac secret
+	expected := "sha256=e20e2b43bd3dcc771e34819f3d8c200b9797b7034aafa5a76d5f70fd9e1b5b0e"
+	signature := Sign("secret", 1501863300375, []byte(`{"event":"departed"}`))
+	if signature != expected {
+		t.Errorf("Expected signature %s, got %s", expected, signature)
+	}
+	if Sign("secret", 1501863300376, []byte(`{"event":"departed"}`)) == signature {
+		t.Error("Expected the timestamp to be signed")
+	}
+	if Sign("other", 1501863300375, []byte(`{"event":"departed"}`)) == signature {
+		t.Error("Expected the secret to key the signature")
+	}
+}
+
+func TestTagEvents(t *testing.T) {
+	tags := []tag.Tag{
+		{Epc: "EPC1", Event: "departed", FacilityID: "store001"},
+		{Epc: "EPC2", Event: "arrival", FacilityID: "store001"},
+		{Epc: "EPC3", Event: "departed", FacilityID: "store001"},
+		{Epc: "EPC4", Event: "departed", FacilityID: "store002"},
+		{Epc: "EPC5"},
+	}
+
+	events := TagEvents(tags)
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+	if departed := events[0].Data.([]tag.Tag); events[0].Type != "departed" || events[0].FacilityID != "store001" || len(departed) != 2 {
+		t.Errorf("Expected the departed tags of store001 to be batched, got %+v", events[0])
+	}
+}
+
+func TestSubscriptionMatches(t *testing.T) {
+	subscription := Subscription{Enabled: true, Events: []string{"departed", stocklevel.EventLowStock}, FacilityIDs: []string{"store001"}}
+
+	tests := []struct {
+		event    Event
+		expected bool
+	}{
+		{Event{Type: "departed", FacilityID: "store001"}, true},
+		{Event{Type: stocklevel.EventLowStock, FacilityID: "store001"}, true},
+		{Event{Type: "arrival", FacilityID: "store001"}, false},
+		{Event{Type: "departed", FacilityID: "store002"}, false},
+	}
+	for _, test := range tests {
+		if subscription.Matches(test.event) != test.expected {
+			t.Errorf("Expected %+v to match %v", test.event, test.expected)
+		}
+	}
+
+	subscription.FacilityIDs = nil
+	if !subscription.Matches(Event{Type: "departed", FacilityID: "store002"}) {
+		t.Error("Expected a subscription without facilities to match all facilities")
+	}
+	subscription.Enabled = false
+	if subscription.Matches(Event{Type: "departed", FacilityID: "store001"}) {
+		t.Error("Expected a disabled subscription not to match")
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	var mutex sync.Mutex
+	var received []Notification
+	failing := true
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		body, err := ioutil.ReadAll(request.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		timestamp, err := strconv.ParseInt(request.Header.Get(TimestampHeader), 10, 64)
+		if err != nil || request.Header.Get(SignatureHeader) != Sign("0123456789abcdef", timestamp, body) {
+			t.Errorf("Invalid signature %s", request.Header.Get(SignatureHeader))
+		}
+		if failing {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var notification Notification
+		if err := json.Unmarshal(body, &notification); err != nil {
+			t.Error(err)
+		}
+		received = append(received, notification)
+	}))
+	defer server.Close()
+
+	subscription, err := Insert(testDB.DB, Subscription{
+		URL:    server.URL,
+		Secret: "0123456789abcdef",
+		Events: []string{"departed"},
+	})
+	if err != nil {
+		t.Fatalf("Error creating webhook: %+v", err)
+	}
+
+	tags := []tag.Tag{{Epc: "EPC1", Event: "departed", FacilityID: "store001"}, {Epc: "EPC2", Event: "arrival", FacilityID: "store001"}}
+	if err := Enqueue(testDB.DB, TagEvents(tags)); err != nil {
+		t.Fatalf("Error queuing events: %+v", err)
+	}
+
+	// A zero base delay makes retries due immediately
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: 0, DisableAfter: 5}
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	if err := Deliver(testDB.DB, client, policy, 4); err != nil {
+		t.Fatalf("Error delivering webhooks: %+v", err)
+	}
+	deliveries, err := FindDeliveries(testDB.DB, subscription.ID, DeliveryPending, 10)
+	if err != nil {
+		t.Fatalf("Error retrieving deliveries: %+v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Attempts != 1 || deliveries[0].LastStatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected a single pending delivery after a failed attempt, got %+v", deliveries)
+	}
+
+	mutex.Lock()
+	failing = false
+	mutex.Unlock()
+	if err := Deliver(testDB.DB, client, policy, 4); err != nil {
+		t.Fatalf("Error delivering webhooks: %+v", err)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(received) != 1 || received[0].Event != "departed" || received[0].ID != deliveries[0].ID {
+		t.Fatalf("Expected the departed event to be delivered, got %+v", received)
+	}
+
+	subscription, err = FindByID(testDB.DB, subscription.ID)
+	if err != nil || subscription.ConsecutiveFailures != 0 || !subscription.Enabled {
+		t.Errorf("Expected the webhook to be healthy, got %+v %v", subscription, err)
+	}
+
+	if err := Delete(testDB.DB, subscription.ID); err != nil {
+		t.Fatalf("Error deleting webhook: %+v", err)
+	}
+	if err := Delete(testDB.DB, subscription.ID); errors.Cause(err) != web.ErrNotFound {
+		t.Errorf("Expected deleting twice to be not found, got %v", err)
+	}
+}
+
+func TestDeliverConcurrently(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	// The slow endpoint only responds once the fast one has been delivered to
+	fastDelivered := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		select {
+		case <-fastDelivered:
+		case <-time.After(5 * time.Second):
+			t.Error("Expected the fast webhook to be delivered while the slow one was pending")
+		}
+	}))
+	defer slow.Close()
+	var once sync.Once
+	fast := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		once.Do(func() { close(fastDelivered) })
+	}))
+	defer fast.Close()
+
+	for _, url := range []string{slow.URL, fast.URL} {
+		if _, err := Insert(testDB.DB, Subscription{URL: url, Events: []string{"departed"}}); err != nil {
+			t.Fatalf("Error creating webhook: %+v", err)
+		}
+	}
+	tags := []tag.Tag{{Epc: "EPC1", Event: "departed", FacilityID: "store001"}}
+	if err := Enqueue(testDB.DB, TagEvents(tags)); err != nil {
+		t.Fatalf("Error queuing events: %+v", err)
+	}
+
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: 0, DisableAfter: 5}
+	client := &http.Client{Timeout: 10 * time.Second}
+	if err := Deliver(testDB.DB, client, policy, 2); err != nil {
+		t.Fatalf("Error delivering webhooks: %+v", err)
+	}
+
+	subscriptions, err := FindAll(testDB.DB)
+	if err != nil {
+		t.Fatalf("Error retrieving webhooks: %+v", err)
+	}
+	for _, subscription := range subscriptions {
+		delivered, err := FindDeliveries(testDB.DB, subscription.ID, DeliveryDelivered, 10)
+		if err != nil || len(delivered) != 1 {
+			t.Errorf("Expected a delivery to %s, got %+v %v", subscription.URL, delivered, err)
+		}
+		if err := Delete(testDB.DB, subscription.ID); err != nil {
+			t.Errorf("Error deleting webhook: %+v", err)
+		}
+	}
+}
+
+func TestDeliverStopsAtFirstFailure(t *testing.T) {
+	testDB := dbHost.CreateDB(t)
+	defer testDB.Close()
+
+	var mutex sync.Mutex
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		attempts++
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	subscription, err := Insert(testDB.DB, Subscription{URL: server.URL, Events: []string{"departed"}})
+	if err != nil {
+		t.Fatalf("Error creating webhook: %+v", err)
+	}
+	tags := []tag.Tag{
+		{Epc: "EPC1", Event: "departed", FacilityID: "store001"},
+		{Epc: "EPC2", Event: "departed", FacilityID: "store002"},
+		{Epc: "EPC3", Event: "departed", FacilityID: "store003"},
+	}
+	if err := Enqueue(testDB.DB, TagEvents(tags)); err != nil {
+		t.Fatalf("Error queuing events: %+v", err)
+	}
+
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Minute, DisableAfter: 2}
+	client := &http.Client{Timeout: 5 * time.Second}
+	if err := Deliver(testDB.DB, client, policy, 1); err != nil {
+		t.Fatalf("Error delivering webhooks: %+v", err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if attempts != 1 {
+		t.Errorf("Expected a single attempt in the pass, got %d", attempts)
+	}
+
+	subscription, err = FindByID(testDB.DB, subscription.ID)
+	if err != nil || subscription.ConsecutiveFailures != 1 || !subscription.Enabled {
+		t.Errorf("Expected a single failure of the webhook, got %+v %v", subscription, err)
+	}
+
+	// The deliveries following the failed one wait for its retry
+	deliveries, err := FindDeliveries(testDB.DB, subscription.ID, DeliveryPending, 10)
+	if err != nil || len(deliveries) != 3 {
+		t.Fatalf("Expected 3 pending deliveries, got %+v %v", deliveries, err)
+	}
+	var retryAt int64
+	for _, delivery := range deliveries {
+		if delivery.Attempts == 1 {
+			retryAt = delivery.NextAttempt
+		}
+	}
+	for _, delivery := range deliveries {
+		if delivery.NextAttempt < retryAt {
+			t.Errorf("Expected delivery %s to be deferred until %d, got %d", delivery.ID, retryAt, delivery.NextAttempt)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package webhook
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DeliveryPending is the status of a delivery waiting for its next attempt
+	DeliveryPending = "pending"
+	// DeliveryDelivered is the status of a delivery acknowledged with a 2xx response
+	DeliveryDelivered = "delivered"
+	// DeliveryFailed is the status of a delivery that will not be attempted again
+	DeliveryFailed = "failed"
+
+	// EventHeader is the request header carrying the event type of a delivery
+	EventHeader = "X-Inventory-Event"
+	// DeliveryHeader is the request header carrying the ID of a delivery, which stays
+	// the same across retries
+	DeliveryHeader = "X-Inventory-Delivery"
+	// TimestampHeader is the request header carrying the millisecond epoch time of an attempt
+	TimestampHeader = "X-Inventory-Timestamp"
+	// SignatureHeader is the request header carrying the signature of the body, see Sign
+	SignatureHeader = "X-Inventory-Signature"
+)
+
+// Subscription is an endpoint notified of the events matching its filters
+//swagger:model Webhook
+type Subscription struct {
+	// ID of the subscription
+	ID string `json:"id"`
+	// URL the events are posted to
+	URL string `json:"url"`
+	// Secret the bodies are signed with. It is only returned when the subscription is created.
+	Secret string `json:"secret,omitempty"`
+	// Event types the endpoint is notified of, such as arrival, departed or low_stock
+	Events []string `json:"events"`
+	// Facilities the endpoint is notified of, empty for all facilities
+	FacilityIDs []string `json:"facility_ids,omitempty"`
+	// Whether events are delivered to the endpoint
+	Enabled bool `json:"enabled"`
+	// Number of failed attempts since the last successful delivery
+	ConsecutiveFailures int `json:"consecutive_failures"`
+	// Why the subscription was disabled automatically
+	DisabledReason string `json:"disabled_reason,omitempty"`
+	// Millisecond epoch time the subscription was created
+	Created int64 `json:"created"`
+}
+
+// Delivery is an event queued for, or delivered to, a subscription
+//swagger:model WebhookDelivery
+type Delivery struct {
+	// ID of the delivery
+	ID string `json:"id"`
+	// ID of the subscription the event is delivered to
+	SubscriptionID string `json:"subscription_id"`
+	// Event type
+	Event string `json:"event"`
+	// Facility of the event
+	FacilityID string `json:"facility_id,omitempty"`
+	// Data of the event
+	Payload json.RawMessage `json:"payload"`
+	// Either 'pending', 'delivered' or 'failed'
+	Status string `json:"status"`
+	// Number of attempts made
+	Attempts int `json:"attempts"`
+	// Millisecond epoch time of the next attempt of a pending delivery
+	NextAttempt int64 `json:"next_attempt,omitempty"`
+	// Millisecond epoch time of the last attempt
+	LastAttempt int64 `json:"last_attempt,omitempty"`
+	// HTTP status code of the last attempt, 0 if no response was received
+	LastStatusCode int `json:"last_status_code,omitempty"`
+	// Error of the last attempt
+	LastError string `json:"last_error,omitempty"`
+	// Millisecond epoch time the delivery was queued
+	Created int64 `json:"created"`
+}
+
+// Event is an occurrence subscriptions are notified of
+type Event struct {
+	// Event type
+	Type string
+	// Facility of the event
+	FacilityID string
+	// Data of the event, marshaled as the payload of the deliveries
+	Data interface{}
+}
+
+// Notification is the body posted to a subscription
+type Notification struct {
+	// ID of the delivery
+	ID string `json:"id"`
+	// Event type
+	Event string `json:"event"`
+	// Facility of the event
+	FacilityID string `json:"facility_id,omitempty"`
+	// Millisecond epoch time the event was queued
+	Created int64 `json:"created"`
+	// Data of the event
+	Data json.RawMessage `json:"data"`
+}
+
+// RetryPolicy controls how failed deliveries are retried
+type RetryPolicy struct {
+	// Attempts after which a delivery fails
+	MaxAttempts int
+	// Delay before the first retry, doubled on every further retry
+	BaseDelay time.Duration
+	// Consecutive failed attempts after which a subscription is disabled
+	DisableAfter int
+}
+
+// Response is the model used to return the query response
+type Response struct {
+	Results interface{} `json:"results"`
+}
+
+// WithoutSecret returns the subscription without its secret, to be returned by the API
+func (subscription Subscription) WithoutSecret() Subscription {
+	subscription.Secret = ""
+	return subscription
+}
+
+// Matches reports whether the subscription is notified of the event
+func (subscription Subscription) Matches(event Event) bool {
+	if !subscription.Enabled || !contains(subscription.Events, event.Type) {
+		return false
+	}
+	return len(subscription.FacilityIDs) == 0 || contains(subscription.FacilityIDs, event.FacilityID)
+}
+
+// Value implements driver.Valuer interfaces
+func (subscription Subscription) Value() (driver.Value, error) {
+	return json.Marshal(subscription)
+}
+
+// Scan implements sql.Scanner interfaces
+func (subscription *Subscription) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, subscription)
+}
+
+// Value implements driver.Valuer interfaces
+func (delivery Delivery) Value() (driver.Value, error) {
+	return json.Marshal(delivery)
+}
+
+// Scan implements sql.Scanner interfaces
+func (delivery *Delivery) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(b, delivery)
+}
+
+// retryDelay returns how long to wait before retrying a delivery after the given number of
+// attempts, doubling the base delay on every retry up to maxRetryDelay
+func retryDelay(attempts int, baseDelay time.Duration) time.Duration {
+	delay := baseDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -17,6 +17,22 @@
 //     Produces:
 //     - application/json
 //
+//     SecurityDefinitions:
+//     api_key:
+//          type: apiKey
+//          name: X-API-Key
+//          in: header
+//     bearer:
+//          type: apiKey
+//          name: Authorization
+//          in: header
+//
+//     Security:
+//     - api_key:
+//     - bearer:
+//
+// When authEnabled is set, every route but the healthcheck requires an API key or a JWT
+// bearer token granting the reader, operator or admin role the route requires.
 //
 // swagger:meta
 package main
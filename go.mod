@@ -6,6 +6,7 @@ require (
 	github.com/edgexfoundry/app-functions-sdk-go v0.2.0-dev.37
 	github.com/edgexfoundry/go-mod-core-contracts v0.1.14
 	github.com/gorilla/mux v1.7.2
+	github.com/gorilla/websocket v1.4.1
 	github.com/intel/rsp-sw-toolkit-im-suite-expect v1.1.4
 	github.com/intel/rsp-sw-toolkit-im-suite-go-odata v0.1.0
 	github.com/intel/rsp-sw-toolkit-im-suite-gojsonschema v1.0.0
@@ -16,4 +17,5 @@ require (
 	github.com/pelletier/go-toml v1.6.0 // indirect
 	github.com/pkg/errors v0.8.1
 	github.com/sirupsen/logrus v1.4.0
+	golang.org/x/sync v0.0.0-20181221193216-37e7f081c4d4
 )
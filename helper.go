@@ -71,7 +71,7 @@ func verifyProbabilisticPlugin() {
 	}
 
 	if !pluginFound {
-		log.Warn("Unable to verify Intel Architecture, Confidence value will be set to 0")
+		log.Warn("Intel Probabilistic Algorithm plugin not found, the default confidence model will be used")
 	}
 }
 
@@ -21,15 +21,24 @@ import (
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/cloudconnector/event"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/config"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/dailyturn"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/eventstream"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/facility"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/health"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/heartbeat"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/routes"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/routes/handlers"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/sensor"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/shippingnotice"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/snapshot"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/stocklevel"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/tag"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/tagprocessor"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/webhook"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/jsonrpc"
-	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/statemodel"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/productdata"
 	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
 	reporter "github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics-influxdb"
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/helper"
 	_ "github.com/lib/pq"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -38,11 +47,16 @@ import (
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
 	serviceKey = "inventory-service"
+	// webhookDeliveryInterval is how often due webhook deliveries are sent
+	webhookDeliveryInterval = 5 * time.Second
+	// sensorStatsFlushInterval is how often the inventory_data statistics of sensors are written
+	sensorStatsFlushInterval = 10 * time.Second
 )
 
 const (
@@ -55,6 +69,7 @@ const (
 	inventoryEvent           = "inventory_event"
 	controllerStatusUpdate   = "rsp_controller_status_update"
 	controllerReady          = "controller_ready"
+	stockLevelEvent          = "stock_level_event"
 )
 
 var (
@@ -77,6 +92,19 @@ type inventoryApp struct {
 	edgexSdkContext *appcontext.Context
 	invEventChannel chan *jsonrpc.InventoryEvent
 	done            chan bool
+
+	// serializes tag processing, which reads, modifies and writes the tags of an event,
+	// between the event channel and events submitted through the REST API
+	tagDataMutex sync.Mutex
+
+	// read by the readiness endpoint, so only accessed atomically
+	sdkContextGrabbed int32
+	lastInventoryData int64
+
+	// set while the daily turn of all active products is computed
+	dailyTurnComputing int32
+	// set while the product data cache is refreshed
+	productDataRefreshing int32
 }
 
 func newInventoryApp(masterDB *sql.DB) *inventoryApp {
@@ -138,6 +166,9 @@ func main() {
 	if config.AppConfig.ProbabilisticAlgorithmPlugin {
 		verifyProbabilisticPlugin()
 	}
+	log.Infof("Using %s confidence model", handlers.ActiveConfidenceModel())
+	productdata.InitCache(time.Duration(config.AppConfig.ProductDataCacheTTLSeconds) * time.Second)
+	eventstream.Init(config.AppConfig.EventStreamBufferSize)
 
 	invApp := newInventoryApp(db)
 
@@ -148,28 +179,31 @@ func main() {
 
 	go invApp.processInventoryEventChannel()
 
+	go invApp.deliverWebhooks()
+
 	go sensor.QueryBasicInfoAllSensors(db)
 
 	// Initiate webserver and routes
 	// NOTE: The call to `startWebServer` will block the main thread forever until an osSignal interrupt is received
-	startWebServer(db, config.AppConfig.Port, config.AppConfig.ResponseLimit, config.AppConfig.ServiceName)
+	startWebServer(db, invApp, config.AppConfig.Port, config.AppConfig.ResponseLimit, config.AppConfig.ServiceName)
 
 	log.WithField("Method", "main").Info("Completed.")
 
 }
 
-func startWebServer(masterDB *sql.DB, port string, responseLimit int, serviceName string) {
+func startWebServer(masterDB *sql.DB, invApp *inventoryApp, port string, responseLimit int, serviceName string) {
 
 	// Start Webserver and pass additional data
-	router := routes.NewRouter(masterDB, responseLimit)
+	router := routes.NewRouter(masterDB, responseLimit, invApp, invApp)
 
-	// Create a new server and set timeout values.
+	// Create a new server and set timeout values. Reading bodies and writing responses is
+	// bounded per route by the router, as event streams and exports outlast any timeout.
 	server := http.Server{
-		Addr:           ":" + port,
-		Handler:        router,
-		ReadTimeout:    900 * time.Second,
-		WriteTimeout:   900 * time.Second,
-		MaxHeaderBytes: 1 << 20,
+		Addr:              ":" + port,
+		Handler:           router,
+		ReadHeaderTimeout: 60 * time.Second,
+		IdleTimeout:       900 * time.Second,
+		MaxHeaderBytes:    1 << 20,
 	}
 
 	// We want to report the listener is closed.
@@ -236,71 +270,13 @@ func processShippingNotice(data []byte, masterDB *sql.DB, tagsGauge *metrics.Gau
 	// do this before inserting the data into the database
 	dailyturn.ProcessIncomingASNList(masterDB, incomingDataSlice)
 
-	var tagData []tag.Tag
-
 	for _, asn := range incomingDataSlice {
-		if asn.ID == "" || asn.EventTime == "" || asn.SiteID == "" || asn.Items == nil {
-			return errors.New("ASN is missing data")
+		if _, err := shippingnotice.Process(masterDB, asn); err != nil {
+			return err
 		}
 		if tagsGauge != nil {
 			(*tagsGauge).Add(int64(len(asn.Items)))
 		}
-
-		for _, asnItem := range asn.Items {
-			for _, asnEpc := range asnItem.EPCs {
-				// create a temporary tag so we can check if it's whitelisted
-				tempTag := tag.Tag{}
-				tempTag.Epc = asnEpc
-				tempTag.ProductID, tempTag.URI, _ = tag.DecodeTagData(asnEpc)
-				// TODO: why aren't we checking for invalid tag encodings?
-
-				if len(config.AppConfig.EpcFilters) > 0 {
-					// ignore tags that don't match our filters
-					if !statemodel.IsTagWhitelisted(tempTag.Epc, config.AppConfig.EpcFilters) {
-						continue
-					}
-				}
-
-				// marshal the ASNContext
-				asnContextBytes, err := json.Marshal(tag.ASNContext{
-					ASNID:     asn.ID,
-					EventTime: asn.EventTime,
-					SiteID:    asn.SiteID,
-					ItemGTIN:  asnItem.ItemGTIN,
-					ItemID:    asnItem.ItemID,
-				})
-				if err != nil {
-					return errors.Wrap(err, "Unable to marshal ASNContext")
-				}
-
-				// If the tag exists, update it with the new EPCContext.
-				// If it is new, insert it with default FacilityID
-				// Note: If bottlenecks may need to redesign to eliminate large number
-				// of queries to DB currently this will make a call to the DB PER tag
-				tagFromDB, err := tag.FindByEpc(masterDB, tempTag.Epc)
-				if err != nil {
-					if dbErr := errors.Wrap(err, "Error retrieving tag from database"); dbErr != nil {
-						log.Debug(dbErr)
-					}
-				} else {
-					if tagFromDB.IsEmpty() {
-						// Tag is not in database, add with defaults
-						tempTag.FacilityID = config.AppConfig.AdvancedShippingNoticeFacilityID
-						tempTag.EpcContext = string(asnContextBytes)
-						tagData = append(tagData, tempTag)
-					} else {
-						// Found tag, only update the epc context
-						tagFromDB.EpcContext = string(asnContextBytes)
-						tagData = append(tagData, tagFromDB)
-					}
-				}
-			}
-		}
-		if len(tagData) > 0 {
-			if err := tag.Replace(masterDB, tagData); err != nil {
-				return errors.Wrap(err, "error replacing tags")
-			}
-		}
 	}
 
 	return nil
@@ -317,6 +293,8 @@ func markDepartedIfUnseen(tag *jsonrpc.TagEvent, ageOuts map[string]int, current
 		if minutes, ok := ageOuts[tag.FacilityID]; ok {
 			if tag.Timestamp+int64(minutes*60*1000) <= currentTimeMillis {
 				tag.EventType = "departed"
+				tag.DepartureReason = jsonrpc.DepartureReasonAgeOut
+				tag.DepartedAt = currentTimeMillis
 			}
 		}
 	}
@@ -362,6 +340,7 @@ func (invApp *inventoryApp) receiveZMQEvents() {
 func (invApp *inventoryApp) contextGrabber(edgexcontext *appcontext.Context, params ...interface{}) (bool, interface{}) {
 	if invApp.edgexSdkContext == nil {
 		invApp.edgexSdkContext = edgexcontext
+		atomic.StoreInt32(&invApp.sdkContextGrabbed, 1)
 		logrus.Debug("grabbed app-functions-sdk context")
 	}
 
@@ -472,6 +451,8 @@ func (invApp *inventoryApp) processEvents(edgexcontext *appcontext.Context, para
 				return false, err
 			}
 
+			atomic.StoreInt64(&invApp.lastInventoryData, helper.UnixMilliNow())
+
 			invEvent, err := tagprocessor.ProcessInventoryData(invApp.masterDB, invData)
 			if err != nil {
 				return false, err
@@ -521,6 +502,30 @@ func (invApp *inventoryApp) processEvents(edgexcontext *appcontext.Context, para
 	return false, nil
 }
 
+// ProcessTagData processes tag events submitted through the REST API, such as
+// handheld reads, the same way as events received over the EdgeX bus. Events are
+// processed one at a time so that concurrent reads of a tag do not lose updates.
+func (invApp *inventoryApp) ProcessTagData(invEvent *jsonrpc.InventoryEvent, source string) error {
+	invApp.tagDataMutex.Lock()
+	defer invApp.tagDataMutex.Unlock()
+	return invApp.skuMapping.processTagData(invApp, invEvent, source, nil)
+}
+
+// PipelineStatus reports the state of the EdgeX pipeline for the readiness endpoint
+func (invApp *inventoryApp) PipelineStatus() health.Pipeline {
+	pipeline := health.Pipeline{
+		SdkContextGrabbed:  atomic.LoadInt32(&invApp.sdkContextGrabbed) == 1,
+		LastInventoryData:  atomic.LoadInt64(&invApp.lastInventoryData),
+		EventQueueDepth:    len(invApp.invEventChannel),
+		EventQueueCapacity: cap(invApp.invEventChannel),
+	}
+	if pipeline.LastInventoryData > 0 {
+		seconds := float64(helper.UnixMilliNow()-pipeline.LastInventoryData) / 1000
+		pipeline.SecondsSinceInventoryData = &seconds
+	}
+	return pipeline
+}
+
 func (invApp *inventoryApp) processInventoryEventChannel() {
 	mRRSEventsProcessingError := metrics.GetOrRegisterGauge("Inventory.receiveZMQEvents.RRSEventsError", nil)
 
@@ -533,7 +538,7 @@ func (invApp *inventoryApp) processInventoryEventChannel() {
 
 		case invEvent := <-invApp.invEventChannel:
 			if invEvent != nil && !invEvent.IsEmpty() {
-				err := invApp.skuMapping.processTagData(invApp, invEvent, "fixed", nil)
+				err := invApp.ProcessTagData(invEvent, "fixed")
 				if err != nil {
 					errorHandler("error processing event data", err, &mRRSEventsProcessingError)
 				}
@@ -547,6 +552,32 @@ func (invApp *inventoryApp) processInventoryEventChannel() {
 func (invApp *inventoryApp) processScheduledTasks() {
 	aggregateDepartedTicker := time.NewTicker(time.Duration(config.AppConfig.AggregateDepartedThresholdMillis/5) * time.Millisecond)
 	ageoutTicker := time.NewTicker(1 * time.Hour)
+	sensorStatsTicker := time.NewTicker(sensorStatsFlushInterval)
+	defer sensorStatsTicker.Stop()
+
+	// refresh the product data cache in the background, if it is enabled
+	var productDataRefresh <-chan time.Time
+	if config.AppConfig.ProductDataCacheTTLSeconds > 0 {
+		productDataTicker := time.NewTicker(time.Duration(config.AppConfig.ProductDataCacheTTLSeconds) * time.Second)
+		defer productDataTicker.Stop()
+		productDataRefresh = productDataTicker.C
+	}
+
+	// snapshot inventory counts for as-of queries, if it is enabled
+	var snapshotTake <-chan time.Time
+	if config.AppConfig.SnapshotIntervalMinutes > 0 {
+		snapshotTicker := time.NewTicker(time.Duration(config.AppConfig.SnapshotIntervalMinutes) * time.Minute)
+		defer snapshotTicker.Stop()
+		snapshotTake = snapshotTicker.C
+	}
+
+	// compute the daily turn of all active products once a day, if it is enabled
+	var dailyTurnCompute <-chan time.Time
+	dailyTurnTimer := scheduleDailyTurn()
+	if dailyTurnTimer != nil {
+		defer dailyTurnTimer.Stop()
+		dailyTurnCompute = dailyTurnTimer.C
+	}
 
 	for {
 		select {
@@ -554,6 +585,7 @@ func (invApp *inventoryApp) processScheduledTasks() {
 			log.Info("done called. stopping scheduled tasks")
 			aggregateDepartedTicker.Stop()
 			ageoutTicker.Stop()
+			invApp.flushSensorStats()
 			return
 
 		case t := <-aggregateDepartedTicker.C:
@@ -565,10 +597,157 @@ func (invApp *inventoryApp) processScheduledTasks() {
 		case t := <-ageoutTicker.C:
 			log.Debugf("DoAgeoutTask: %v", t)
 			tagprocessor.DoAgeoutTask()
+
+		case <-sensorStatsTicker.C:
+			invApp.flushSensorStats()
+
+		case t := <-productDataRefresh:
+			log.Debugf("RefreshProductDataCache: %v", t)
+			invApp.refreshProductData()
+
+		case t := <-snapshotTake:
+			log.Debugf("TakeSnapshot: %v", t)
+			invApp.takeSnapshot()
+
+		case t := <-dailyTurnCompute:
+			log.Debugf("ComputeDailyTurn: %v", t)
+			invApp.computeDailyTurn()
+			if next, err := dailyturn.NextComputeTime(time.Now(), config.AppConfig.DailyTurnComputeTime); err == nil {
+				dailyTurnTimer.Reset(time.Until(next))
+			}
 		}
 	}
 }
 
+// computeDailyTurn computes the daily turn of all active products in the background, so
+// a slow pass does not hold up the other scheduled tasks. A pass is skipped while the
+// previous one is still running.
+func (invApp *inventoryApp) computeDailyTurn() {
+	if !atomic.CompareAndSwapInt32(&invApp.dailyTurnComputing, 0, 1) {
+		log.Warn("previous daily turn computation still running, skipping this one")
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&invApp.dailyTurnComputing, 0)
+		dailyturn.ComputeAll(invApp.masterDB)
+	}()
+}
+
+// refreshProductData refreshes the product data cache in the background, so a slow
+// mapping service does not hold up the other scheduled tasks. A refresh is skipped while
+// the previous one is still running.
+func (invApp *inventoryApp) refreshProductData() {
+	if !atomic.CompareAndSwapInt32(&invApp.productDataRefreshing, 0, 1) {
+		log.Warn("previous product data refresh still running, skipping this one")
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&invApp.productDataRefreshing, 0)
+		productdata.RefreshCache()
+	}()
+}
+
+// flushSensorStats writes the inventory_data statistics recorded since the last flush
+func (invApp *inventoryApp) flushSensorStats() {
+	mFlushErr := metrics.GetOrRegisterGauge("Inventory.flushSensorStats.Error", nil)
+
+	if err := sensor.FlushInventoryData(invApp.masterDB); err != nil {
+		errorHandler("error flushing sensor statistics", err, &mFlushErr)
+	}
+}
+
+// takeSnapshot records the current inventory counts and deletes the snapshots
+// older than the retention period
+func (invApp *inventoryApp) takeSnapshot() {
+	mSnapshotErr := metrics.GetOrRegisterGauge("Inventory.takeSnapshot.Error", nil)
+
+	now := helper.UnixMilliNow()
+	interval := time.Duration(config.AppConfig.SnapshotIntervalMinutes) * time.Minute
+	rows, err := snapshot.Take(invApp.masterDB, now, now-int64(interval/time.Millisecond), config.AppConfig.SnapshotRecordEpcs)
+	if err != nil {
+		errorHandler("error taking inventory snapshot", err, &mSnapshotErr)
+		return
+	}
+	log.Debugf("Recorded %d inventory snapshot counts", rows)
+
+	retention := time.Duration(config.AppConfig.SnapshotRetentionDays) * 24 * time.Hour
+	if err := snapshot.Purge(invApp.masterDB, now-int64(retention/time.Millisecond)); err != nil {
+		errorHandler("error purging inventory snapshots", err, &mSnapshotErr)
+	}
+}
+
+// deliverWebhooks is an infinite loop sending the queued webhook deliveries as they become
+// due, and deleting the history of finished deliveries past the retention period
+func (invApp *inventoryApp) deliverWebhooks() {
+	mWebhookErr := metrics.GetOrRegisterGauge("Inventory.deliverWebhooks.Error", nil)
+
+	// Endpoints are delivered to concurrently, each request bounded by a short timeout
+	client := &http.Client{
+		Timeout: time.Duration(config.AppConfig.WebhookTimeoutSeconds) * time.Second,
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			MaxIdleConnsPerHost: config.AppConfig.WebhookDeliveryWorkers,
+		},
+	}
+	policy := webhook.RetryPolicy{
+		MaxAttempts:  config.AppConfig.WebhookMaxAttempts,
+		BaseDelay:    time.Duration(config.AppConfig.WebhookRetryBaseSeconds) * time.Second,
+		DisableAfter: config.AppConfig.WebhookDisableAfterFailures,
+	}
+	retention := time.Duration(config.AppConfig.WebhookDeliveryRetentionDays) * 24 * time.Hour
+
+	deliverTicker := time.NewTicker(webhookDeliveryInterval)
+	defer deliverTicker.Stop()
+	pruneTicker := time.NewTicker(1 * time.Hour)
+	defer pruneTicker.Stop()
+
+	for {
+		select {
+		case <-invApp.done:
+			log.Info("done called. stopping webhook deliveries")
+			return
+
+		case <-deliverTicker.C:
+			if err := webhook.Deliver(invApp.masterDB, client, policy, config.AppConfig.WebhookDeliveryWorkers); err != nil {
+				errorHandler("error delivering webhooks", err, &mWebhookErr)
+			}
+
+		case t := <-pruneTicker.C:
+			log.Debugf("PruneWebhookDeliveries: %v", t)
+			if err := webhook.Prune(invApp.masterDB, helper.UnixMilliNow()-int64(retention/time.Millisecond)); err != nil {
+				errorHandler("error pruning webhook deliveries", err, &mWebhookErr)
+			}
+		}
+	}
+}
+
+// enqueueWebhooks queues the events for delivery to the webhooks notified of them
+func (invApp *inventoryApp) enqueueWebhooks(events []webhook.Event) {
+	mWebhookErr := metrics.GetOrRegisterGauge("Inventory.enqueueWebhooks.Error", nil)
+
+	if err := webhook.Enqueue(invApp.masterDB, events); err != nil {
+		errorHandler("error queuing webhook deliveries", err, &mWebhookErr)
+	}
+}
+
+// scheduleDailyTurn returns a timer firing at the next daily turn compute time,
+// or nil when the scheduled computation is disabled
+func scheduleDailyTurn() *time.Timer {
+	if config.AppConfig.DailyTurnComputeTime == "" {
+		return nil
+	}
+
+	next, err := dailyturn.NextComputeTime(time.Now(), config.AppConfig.DailyTurnComputeTime)
+	if err != nil {
+		log.Errorf("Unable to schedule the daily turn computation: %v", err)
+		return nil
+	}
+
+	log.Infof("Daily turn of active products is computed daily at %s, next at %v",
+		config.AppConfig.DailyTurnComputeTime, next)
+	return time.NewTimer(time.Until(next))
+}
+
 func (invApp *inventoryApp) pushEventsToCoreData(sentOn int64, controllerId string, tagEvents []tag.Tag) {
 	if len(tagEvents) > 0 {
 		log.Debugf("%+v", tagEvents)
@@ -599,6 +778,26 @@ func (invApp *inventoryApp) pushEventsToCoreData(sentOn int64, controllerId stri
 	}
 }
 
+func (invApp *inventoryApp) pushStockEventsToCoreData(controllerId string, events []stocklevel.Event) {
+	payload, err := json.Marshal(events)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Method": "pushStockEventsToCoreData",
+			"Action": "Publish Stock Events to Core Data",
+			"Error":  fmt.Sprintf("%+v", err),
+		}).Error(err)
+		return
+	}
+
+	if invApp.edgexSdkContext == nil {
+		log.Error("unable to push stock event to core data due to app-functions-sdk context has not been grabbed yet")
+		return
+	}
+	if _, err = invApp.edgexSdkContext.PushToCoreData(controllerId, stockLevelEvent, string(payload)); err != nil {
+		log.Errorf("unable to push stock level event to core-data: %v", err)
+	}
+}
+
 func dbSetup(host, port, user, password, dbname, sslmode string) (*sql.DB, error) {
 
 	// Connect to PostgreSQL database
@@ -618,6 +817,11 @@ func dbSetup(host, port, user, password, dbname, sslmode string) (*sql.DB, error
 
 	log.Info("Connected to postgreSQL database...")
 
+	// The unique index on facility names cannot be created while names are duplicated
+	if err := facility.CheckUniqueNames(db); err != nil {
+		return nil, err
+	}
+
 	// Create tables and indexes
 	_, errExec := db.Exec(config.DbSchema)
 	if errExec != nil {
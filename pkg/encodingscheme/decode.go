@@ -17,6 +17,12 @@ type TagDecoder interface {
 	Decode(tagData []byte) (productID, URI string, err error)
 }
 
+// FilterDecoder is implemented by TagDecoders whose encodings carry an EPC
+// filter value, i.e., the packaging level of the tagged item.
+type FilterDecoder interface {
+	DecodeFilter(tagData []byte) (filterValue int, err error)
+}
+
 type sgtinDecoder struct {
 	strict bool
 }
@@ -45,6 +51,22 @@ func (d *sgtinDecoder) Decode(tagData []byte) (productID, URI string, err error)
 	return
 }
 
+// DecodeFilter returns the filter value of SGTIN encoded tag data.
+func (d *sgtinDecoder) DecodeFilter(tagData []byte) (int, error) {
+	s, err := epc.DecodeSGTIN(tagData)
+	if err != nil {
+		return 0, err
+	}
+	return int(s.Filter()), nil
+}
+
+func (d *sgtinDecoder) String() string {
+	if d.strict {
+		return "sgtin (strict)"
+	}
+	return "sgtin"
+}
+
 type proprietary struct {
 	bittag.Decoder
 	prodIdx, prodHexWidth int
@@ -88,3 +110,7 @@ func (d *proprietary) Decode(tagData []byte) (productID, URI string, err error)
 	productID = bt.HexField(d.prodIdx, d.prodHexWidth)
 	return
 }
+
+func (d *proprietary) String() string {
+	return "proprietary"
+}
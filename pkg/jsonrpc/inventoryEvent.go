@@ -17,6 +17,17 @@ const (
 	inventoryEvent = "inventory_event"
 )
 
+const (
+	// DepartureReasonExit is the departure reason of a tag that left through an EXIT sensor
+	DepartureReasonExit = "exit"
+	// DepartureReasonPOS is the departure reason of a tag read by a POS sensor
+	DepartureReasonPOS = "pos"
+	// DepartureReasonFacilityChange is the departure reason of a tag read at another facility
+	DepartureReasonFacilityChange = "facility_change"
+	// DepartureReasonAgeOut is the departure reason of a tag not read within the age out of its facility
+	DepartureReasonAgeOut = "age_out"
+)
+
 type InventoryEvent struct {
 	Notification                      // embed
 	Params       InventoryEventParams `json:"params"`
@@ -37,6 +48,10 @@ type TagEvent struct {
 	Location        string `json:"location"`
 	EventType       string `json:"event_type,omitempty"`
 	Timestamp       int64  `json:"timestamp"`
+	// Why the tag departed, only set for departed events
+	DepartureReason string `json:"departure_reason,omitempty"`
+	// Millisecond epoch time the departure was detected, only set for departed events
+	DepartedAt int64 `json:"departed_at,omitempty"`
 }
 
 func (invEvent *InventoryEvent) Validate() error {
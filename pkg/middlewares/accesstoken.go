@@ -0,0 +1,118 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package middlewares
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// AccessTokenParameter is the query parameter carrying access tokens on the routes accepting
+	// them, for clients such as browser EventSource and WebSocket that cannot set headers
+	AccessTokenParameter = "access_token"
+
+	accessTokenAlgorithm = "HS256"
+	roleClaim            = "role"
+)
+
+type principalKey struct{}
+
+// AccessToken is a short-lived token passed in the access_token query parameter
+//swagger:model AccessToken
+type AccessToken struct {
+	// Token granting the role of the caller it was issued to
+	Token string `json:"access_token"`
+	// Millisecond epoch time the token expires
+	Expires int64 `json:"expires"`
+}
+
+// AccessTokens issues short-lived access tokens to authenticated callers and verifies them.
+// Tokens are HS256 JWTs granting the role of the caller they were issued to.
+type AccessTokens struct {
+	key      []byte
+	keySet   *KeySet
+	lifetime time.Duration
+	now      func() time.Time
+}
+
+// NewAccessTokens returns access tokens signed with the secret and valid for lifetime
+func NewAccessTokens(secret []byte, lifetime time.Duration) *AccessTokens {
+	return &AccessTokens{
+		key: secret,
+		keySet: &KeySet{
+			keys: []verificationKey{{keyType: "oct", algorithm: accessTokenAlgorithm, key: secret}},
+			now:  time.Now,
+		},
+		lifetime: lifetime,
+		now:      time.Now,
+	}
+}
+
+// Issue returns an access token granting the role of the principal
+func (tokens *AccessTokens) Issue(principal Principal) (AccessToken, error) {
+	expiry := tokens.now().Add(tokens.lifetime)
+
+	header, err := json.Marshal(tokenHeader{Algorithm: accessTokenAlgorithm})
+	if err != nil {
+		return AccessToken{}, err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"sub":     principal.Subject,
+		roleClaim: principal.Role.String(),
+		"exp":     expiry.Unix(),
+	})
+	if err != nil {
+		return AccessToken{}, err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	mac := hmac.New(sha256.New, tokens.key)
+	mac.Write([]byte(signed))
+	return AccessToken{
+		Token:   signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)),
+		Expires: expiry.UnixNano() / int64(time.Millisecond),
+	}, nil
+}
+
+func (tokens *AccessTokens) verify(token string) (Principal, error) {
+	claims, err := tokens.keySet.Verify(token)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	roles := claims.strings(roleClaim)
+	if len(roles) != 1 {
+		return Principal{}, errors.New("access token has no role")
+	}
+	role, err := ParseRole(roles[0])
+	if err != nil {
+		return Principal{}, err
+	}
+	return Principal{Subject: claims.Subject, Role: role}, nil
+}
+
+// PrincipalFromContext returns the caller authenticated by the Auth middleware
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// withoutAccessToken removes the access token from the request so it is never logged
+func withoutAccessToken(request *http.Request) {
+	query := request.URL.Query()
+	query.Del(AccessTokenParameter)
+	request.URL.RawQuery = query.Encode()
+	request.RequestURI = request.URL.RequestURI()
+}
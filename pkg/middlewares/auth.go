@@ -0,0 +1,217 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package middlewares
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/web"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	apiKeyHeader        = "X-API-Key"
+	authorizationHeader = "Authorization"
+	bearerPrefix        = "Bearer "
+)
+
+// Role is the level of access a route requires or a caller is granted.
+// Each role is granted the access of the roles below it.
+type Role int
+
+const (
+	// RolePublic routes are served without authentication
+	RolePublic Role = iota
+	// RoleReader may query inventory
+	RoleReader
+	// RoleOperator may also submit reads and shipping notices and update tags
+	RoleOperator
+	// RoleAdmin may also change configuration and delete data
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RolePublic:   "public",
+	RoleReader:   "reader",
+	RoleOperator: "operator",
+	RoleAdmin:    "admin",
+}
+
+// String returns the name of the role
+func (role Role) String() string {
+	if name, ok := roleNames[role]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseRole returns the role named reader, operator or admin
+func ParseRole(name string) (Role, error) {
+	for role, roleName := range roleNames {
+		if role != RolePublic && strings.EqualFold(name, roleName) {
+			return role, nil
+		}
+	}
+	return RolePublic, errors.Errorf("unknown role %q, expected reader, operator or admin", name)
+}
+
+// APIKey is a key accepted in the X-API-Key header. Name identifies the
+// caller in logs so the key itself is never logged.
+type APIKey struct {
+	Name string
+	Key  string
+	Role Role
+}
+
+// Principal is an authenticated caller
+type Principal struct {
+	Subject string
+	Role    Role
+}
+
+// Authenticator authenticates callers by API key or JWT bearer token
+type Authenticator struct {
+	APIKeys []APIKey
+	// KeySet verifies bearer tokens, nil rejects all bearer tokens
+	KeySet *KeySet
+	// Issuer and Audience are checked against the iss and aud claims when not empty
+	Issuer, Audience string
+	// RoleClaim is the claim holding the role, or roles, of the token
+	RoleClaim string
+	// AccessTokens verifies the access tokens of the routes accepting them, nil rejects them
+	AccessTokens *AccessTokens
+}
+
+// Authenticate returns the caller identified by the API key or bearer token of the request
+func (authenticator *Authenticator) Authenticate(request *http.Request) (Principal, error) {
+	if key := request.Header.Get(apiKeyHeader); key != "" {
+		return authenticator.authenticateAPIKey(key)
+	}
+
+	authorization := request.Header.Get(authorizationHeader)
+	if len(authorization) > len(bearerPrefix) && strings.EqualFold(authorization[:len(bearerPrefix)], bearerPrefix) {
+		return authenticator.authenticateToken(strings.TrimSpace(authorization[len(bearerPrefix):]))
+	}
+
+	return Principal{}, errors.New("no API key or bearer token")
+}
+
+func (authenticator *Authenticator) authenticateAPIKey(key string) (Principal, error) {
+	// compare every key in constant time so the response time does not reveal a partial match
+	var match *APIKey
+	for i := range authenticator.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(authenticator.APIKeys[i].Key), []byte(key)) == 1 {
+			match = &authenticator.APIKeys[i]
+		}
+	}
+	if match == nil {
+		return Principal{}, errors.New("unknown API key")
+	}
+	return Principal{Subject: "apikey:" + match.Name, Role: match.Role}, nil
+}
+
+func (authenticator *Authenticator) authenticateAccessToken(token string) (Principal, error) {
+	if authenticator.AccessTokens == nil {
+		return Principal{}, errors.New("access tokens are not accepted")
+	}
+	return authenticator.AccessTokens.verify(token)
+}
+
+func (authenticator *Authenticator) authenticateToken(token string) (Principal, error) {
+	if authenticator.KeySet == nil {
+		return Principal{}, errors.New("bearer tokens are not accepted")
+	}
+
+	claims, err := authenticator.KeySet.Verify(token)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	if authenticator.Issuer != "" && claims.Issuer != authenticator.Issuer {
+		return Principal{}, errors.Errorf("token issuer %q is not accepted", claims.Issuer)
+	}
+	if authenticator.Audience != "" && !claims.hasAudience(authenticator.Audience) {
+		return Principal{}, errors.New("token audience is not accepted")
+	}
+
+	// a token holding several roles is granted the highest of them,
+	// names that are not roles are ignored
+	principal := Principal{Subject: claims.Subject, Role: RolePublic}
+	for _, name := range claims.strings(authenticator.RoleClaim) {
+		if role, err := ParseRole(name); err == nil && role > principal.Role {
+			principal.Role = role
+		}
+	}
+	return principal, nil
+}
+
+// Auth middleware requires the caller to be authenticated with at least the given role
+func Auth(authenticator *Authenticator, role Role, next web.Handler) web.Handler {
+	return auth(authenticator, role, false, next)
+}
+
+// AuthWithAccessToken middleware is the Auth middleware also accepting an access token in
+// the access_token query parameter, for routes called by clients that cannot set headers
+func AuthWithAccessToken(authenticator *Authenticator, role Role, next web.Handler) web.Handler {
+	return auth(authenticator, role, true, next)
+}
+
+func auth(authenticator *Authenticator, role Role, acceptAccessToken bool, next web.Handler) web.Handler {
+	return web.Handler(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+		contextValues := ctx.Value(web.KeyValues).(*web.ContextValues)
+
+		// the access token is removed from the request so it is never logged
+		accessToken := request.URL.Query().Get(AccessTokenParameter)
+		if accessToken != "" {
+			withoutAccessToken(request)
+			contextValues.RequestURI = request.RequestURI
+		}
+
+		if role == RolePublic {
+			return next(ctx, writer, request)
+		}
+
+		var principal Principal
+		var err error
+		if acceptAccessToken && accessToken != "" {
+			principal, err = authenticator.authenticateAccessToken(accessToken)
+		} else {
+			principal, err = authenticator.Authenticate(request)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"Method":     request.Method,
+				"RequestURI": request.RequestURI,
+				"TraceID":    contextValues.TraceID,
+				"Code":       http.StatusUnauthorized,
+				"Error":      err.Error(),
+			}).Warn("Request not authenticated")
+			writer.Header().Set("WWW-Authenticate", "Bearer")
+			return web.ErrNotAuthorized
+		}
+
+		if principal.Role < role {
+			log.WithFields(log.Fields{
+				"Method":     request.Method,
+				"RequestURI": request.RequestURI,
+				"TraceID":    contextValues.TraceID,
+				"Code":       http.StatusForbidden,
+				"Subject":    principal.Subject,
+				"Role":       principal.Role.String(),
+				"Required":   role.String(),
+			}).Warn("Request not authorized")
+			return web.ErrForbidden
+		}
+
+		contextValues.Subject = principal.Subject
+		return next(context.WithValue(ctx, principalKey{}, principal), writer, request)
+	})
+}
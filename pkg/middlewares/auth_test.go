@@ -0,0 +1,342 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package middlewares
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/web"
+)
+
+var (
+	testNow    = time.Unix(1570000000, 0)
+	hmacSecret = []byte("0123456789abcdef0123456789abcdef")
+)
+
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func encodeJSONSegment(t *testing.T, value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encodeSegment(data)
+}
+
+type signFunc func(signed []byte) []byte
+
+func makeToken(t *testing.T, header, claims map[string]interface{}, sign signFunc) string {
+	signed := encodeJSONSegment(t, header) + "." + encodeJSONSegment(t, claims)
+	return signed + "." + encodeSegment(sign([]byte(signed)))
+}
+
+func signHS256(secret []byte) signFunc {
+	return func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		return mac.Sum(nil)
+	}
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey) signFunc {
+	return func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signature
+	}
+}
+
+func signES256(t *testing.T, key *ecdsa.PrivateKey) signFunc {
+	return func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		// r and s are each left padded to 32 bytes
+		signature := make([]byte, 64)
+		rBytes, sBytes := r.Bytes(), s.Bytes()
+		copy(signature[32-len(rBytes):32], rBytes)
+		copy(signature[64-len(sBytes):], sBytes)
+		return signature
+	}
+}
+
+func claimsFor(subject string, roles ...string) map[string]interface{} {
+	return map[string]interface{}{
+		"sub":   subject,
+		"iss":   "https://issuer.example.com",
+		"aud":   []string{"inventory"},
+		"exp":   testNow.Add(time.Hour).Unix(),
+		"roles": roles,
+	}
+}
+
+func newTestAuthenticator(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) *Authenticator {
+	keySetJSON := fmt.Sprintf(`{"keys":[
+		{"kty":"oct","kid":"hmac","alg":"HS256","k":"%s"},
+		{"kty":"RSA","kid":"rsa","use":"sig","n":"%s","e":"%s"},
+		{"kty":"EC","kid":"ec","crv":"P-256","x":"%s","y":"%s"},
+		{"kty":"RSA","kid":"enc","use":"enc","n":"AQAB","e":"AQAB"}
+	]}`,
+		encodeSegment(hmacSecret),
+		encodeSegment(rsaKey.N.Bytes()), encodeSegment(big.NewInt(int64(rsaKey.E)).Bytes()),
+		encodeSegment(ecKey.X.Bytes()), encodeSegment(ecKey.Y.Bytes()))
+
+	keySet, err := ParseKeySet([]byte(keySetJSON))
+	if err != nil {
+		t.Fatalf("unable to parse key set: %v", err)
+	}
+	keySet.now = func() time.Time { return testNow }
+
+	return &Authenticator{
+		APIKeys: []APIKey{
+			{Name: "dashboard", Key: "reader-key", Role: RoleReader},
+			{Name: "pipeline", Key: "operator-key", Role: RoleOperator},
+		},
+		KeySet:    keySet,
+		Issuer:    "https://issuer.example.com",
+		Audience:  "inventory",
+		RoleClaim: "roles",
+	}
+}
+
+func serve(authenticator *Authenticator, role Role, header, value string) (*httptest.ResponseRecorder, string) {
+	var subject string
+	handler := web.Handler(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+		subject = ctx.Value(web.KeyValues).(*web.ContextValues).Subject
+		writer.WriteHeader(http.StatusOK)
+		return nil
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/inventory/tags", nil)
+	if header != "" {
+		request.Header.Set(header, value)
+	}
+	recorder := httptest.NewRecorder()
+	Auth(authenticator, role, handler).ServeHTTP(recorder, request)
+	return recorder, subject
+}
+
+func TestAuth(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator := newTestAuthenticator(t, rsaKey, ecKey)
+
+	bearer := func(header, claims map[string]interface{}, sign signFunc) string {
+		return "Bearer " + makeToken(t, header, claims, sign)
+	}
+	hs256 := map[string]interface{}{"alg": "HS256", "typ": "JWT", "kid": "hmac"}
+	rs256 := map[string]interface{}{"alg": "RS256", "kid": "rsa"}
+	es256 := map[string]interface{}{"alg": "ES256"}
+
+	expired := claimsFor("alice", "admin")
+	expired["exp"] = testNow.Add(-time.Hour).Unix()
+	notYetValid := claimsFor("alice", "admin")
+	notYetValid["nbf"] = testNow.Add(time.Hour).Unix()
+	noExpiry := claimsFor("alice", "admin")
+	delete(noExpiry, "exp")
+	otherIssuer := claimsFor("alice", "admin")
+	otherIssuer["iss"] = "https://attacker.example.com"
+	otherAudience := claimsFor("alice", "admin")
+	otherAudience["aud"] = "billing"
+	singleRole := claimsFor("alice")
+	singleRole["roles"] = "Operator"
+
+	tests := []struct {
+		name            string
+		role            Role
+		header, value   string
+		expectedCode    int
+		expectedSubject string
+	}{
+		{"public route", RolePublic, "", "", http.StatusOK, ""},
+		{"missing credentials", RoleReader, "", "", http.StatusUnauthorized, ""},
+		{"api key", RoleReader, apiKeyHeader, "reader-key", http.StatusOK, "apikey:dashboard"},
+		{"api key with higher role", RoleReader, apiKeyHeader, "operator-key", http.StatusOK, "apikey:pipeline"},
+		{"api key with lower role", RoleOperator, apiKeyHeader, "reader-key", http.StatusForbidden, ""},
+		{"unknown api key", RoleReader, apiKeyHeader, "reader-key2", http.StatusUnauthorized, ""},
+		{"HS256 token", RoleAdmin, authorizationHeader, bearer(hs256, claimsFor("alice", "reader", "admin"), signHS256(hmacSecret)), http.StatusOK, "alice"},
+		{"lowercase bearer", RoleReader, authorizationHeader, "bearer " + makeToken(t, hs256, claimsFor("alice", "reader"), signHS256(hmacSecret)), http.StatusOK, "alice"},
+		{"RS256 token", RoleOperator, authorizationHeader, bearer(rs256, claimsFor("bob", "operator"), signRS256(t, rsaKey)), http.StatusOK, "bob"},
+		{"ES256 token without kid", RoleReader, authorizationHeader, bearer(es256, claimsFor("carol", "reader"), signES256(t, ecKey)), http.StatusOK, "carol"},
+		{"role claim as string", RoleOperator, authorizationHeader, bearer(hs256, singleRole, signHS256(hmacSecret)), http.StatusOK, "alice"},
+		{"token with lower role", RoleAdmin, authorizationHeader, bearer(rs256, claimsFor("bob", "operator"), signRS256(t, rsaKey)), http.StatusForbidden, ""},
+		{"token without role", RoleReader, authorizationHeader, bearer(rs256, claimsFor("bob", "guest"), signRS256(t, rsaKey)), http.StatusForbidden, ""},
+		{"wrong secret", RoleReader, authorizationHeader, bearer(hs256, claimsFor("alice", "admin"), signHS256([]byte("wrong"))), http.StatusUnauthorized, ""},
+		{"wrong kid", RoleReader, authorizationHeader, bearer(map[string]interface{}{"alg": "RS256", "kid": "ec"}, claimsFor("bob", "admin"), signRS256(t, rsaKey)), http.StatusUnauthorized, ""},
+		{"encryption key", RoleReader, authorizationHeader, bearer(map[string]interface{}{"alg": "RS256", "kid": "enc"}, claimsFor("bob", "admin"), signRS256(t, rsaKey)), http.StatusUnauthorized, ""},
+		{"alg none", RoleReader, authorizationHeader, bearer(map[string]interface{}{"alg": "none"}, claimsFor("eve", "admin"), func([]byte) []byte { return nil }), http.StatusUnauthorized, ""},
+		// an HMAC signature made with the public RSA key must not pass as RS256 or HS256
+		{"algorithm confusion", RoleReader, authorizationHeader, bearer(map[string]interface{}{"alg": "HS256", "kid": "rsa"}, claimsFor("eve", "admin"), signHS256(rsaKey.N.Bytes())), http.StatusUnauthorized, ""},
+		{"expired", RoleReader, authorizationHeader, bearer(hs256, expired, signHS256(hmacSecret)), http.StatusUnauthorized, ""},
+		{"not yet valid", RoleReader, authorizationHeader, bearer(hs256, notYetValid, signHS256(hmacSecret)), http.StatusUnauthorized, ""},
+		{"no expiry", RoleReader, authorizationHeader, bearer(hs256, noExpiry, signHS256(hmacSecret)), http.StatusUnauthorized, ""},
+		{"other issuer", RoleReader, authorizationHeader, bearer(hs256, otherIssuer, signHS256(hmacSecret)), http.StatusUnauthorized, ""},
+		{"other audience", RoleReader, authorizationHeader, bearer(hs256, otherAudience, signHS256(hmacSecret)), http.StatusUnauthorized, ""},
+		{"malformed token", RoleReader, authorizationHeader, "Bearer abc.def", http.StatusUnauthorized, ""},
+		{"basic auth", RoleReader, authorizationHeader, "Basic YWxpY2U6c2VjcmV0", http.StatusUnauthorized, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder, subject := serve(authenticator, test.role, test.header, test.value)
+			if recorder.Code != test.expectedCode {
+				t.Errorf("expected status %d, got %d: %s", test.expectedCode, recorder.Code, recorder.Body.String())
+			}
+			if subject != test.expectedSubject {
+				t.Errorf("expected subject %q, got %q", test.expectedSubject, subject)
+			}
+			if test.expectedCode == http.StatusUnauthorized && recorder.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected WWW-Authenticate header on 401 response")
+			}
+		})
+	}
+}
+
+func TestAuthWithoutKeySet(t *testing.T) {
+	authenticator := &Authenticator{APIKeys: []APIKey{{Name: "admin", Key: "admin-key", Role: RoleAdmin}}}
+
+	token := makeToken(t, map[string]interface{}{"alg": "HS256"}, claimsFor("alice", "admin"), signHS256(hmacSecret))
+	if recorder, _ := serve(authenticator, RoleReader, authorizationHeader, "Bearer "+token); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected bearer token to be rejected without a key set, got %d", recorder.Code)
+	}
+	if recorder, _ := serve(authenticator, RoleAdmin, apiKeyHeader, "admin-key"); recorder.Code != http.StatusOK {
+		t.Errorf("expected api key to be accepted, got %d", recorder.Code)
+	}
+}
+
+func TestAuthWithAccessToken(t *testing.T) {
+	tokens := NewAccessTokens([]byte("access-token-secret"), time.Minute)
+	authenticator := &Authenticator{
+		APIKeys:      []APIKey{{Name: "dashboard", Key: "reader-key", Role: RoleReader}},
+		AccessTokens: tokens,
+	}
+
+	issued, err := tokens.Issue(Principal{Subject: "apikey:dashboard", Role: RoleReader})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issued.Expires <= time.Now().UnixNano()/int64(time.Millisecond) {
+		t.Errorf("expected the token to expire in the future, got %d", issued.Expires)
+	}
+	token := issued.Token
+	expiredTokens := NewAccessTokens([]byte("access-token-secret"), time.Minute)
+	expiredTokens.now = func() time.Time { return time.Now().Add(-time.Hour) }
+	expired, err := expiredTokens.Issue(Principal{Subject: "apikey:dashboard", Role: RoleReader})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSecret, err := NewAccessTokens([]byte("other-secret"), time.Minute).Issue(Principal{Subject: "eve", Role: RoleAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		middleware   func(*Authenticator, Role, web.Handler) web.Handler
+		role         Role
+		token        string
+		expectedCode int
+	}{
+		{"access token", AuthWithAccessToken, RoleReader, token, http.StatusOK},
+		{"access token with lower role", AuthWithAccessToken, RoleOperator, token, http.StatusForbidden},
+		{"expired access token", AuthWithAccessToken, RoleReader, expired.Token, http.StatusUnauthorized},
+		{"access token of other secret", AuthWithAccessToken, RoleReader, otherSecret.Token, http.StatusUnauthorized},
+		{"route not accepting access tokens", Auth, RoleReader, token, http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requestURI string
+			var principal Principal
+			handler := web.Handler(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
+				requestURI = ctx.Value(web.KeyValues).(*web.ContextValues).RequestURI
+				principal, _ = PrincipalFromContext(ctx)
+				writer.WriteHeader(http.StatusOK)
+				return nil
+			})
+
+			request := httptest.NewRequest(http.MethodGet, "/inventory/events/stream?event=departed&access_token="+test.token, nil)
+			recorder := httptest.NewRecorder()
+			test.middleware(authenticator, test.role, handler).ServeHTTP(recorder, request)
+			if recorder.Code != test.expectedCode {
+				t.Errorf("expected status %d, got %d: %s", test.expectedCode, recorder.Code, recorder.Body.String())
+			}
+			if strings.Contains(request.RequestURI, test.token) {
+				t.Errorf("expected the access token to be removed from the request, got %s", request.RequestURI)
+			}
+			if test.expectedCode == http.StatusOK {
+				if requestURI != "/inventory/events/stream?event=departed" {
+					t.Errorf("expected the access token to be removed from the logged URI, got %s", requestURI)
+				}
+				if principal.Subject != "apikey:dashboard" || principal.Role != RoleReader {
+					t.Errorf("expected the principal the token was issued to, got %+v", principal)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	for name, expected := range map[string]Role{"reader": RoleReader, "Operator": RoleOperator, "ADMIN": RoleAdmin} {
+		role, err := ParseRole(name)
+		if err != nil || role != expected {
+			t.Errorf("expected %s for %q, got %s (%v)", expected, name, role, err)
+		}
+	}
+	for _, name := range []string{"", "public", "superuser"} {
+		if _, err := ParseRole(name); err == nil {
+			t.Errorf("expected error for role %q", name)
+		}
+	}
+}
+
+func TestParseKeySetErrors(t *testing.T) {
+	tests := map[string]string{
+		"not json":             `keys`,
+		"no keys":              `{"keys":[]}`,
+		"only encryption keys": `{"keys":[{"kty":"oct","use":"enc","k":"c2VjcmV0"}]}`,
+		"unsupported type":     `{"keys":[{"kty":"OKP","crv":"Ed25519","x":"AQAB"}]}`,
+		"mismatched alg":       `{"keys":[{"kty":"oct","alg":"RS256","k":"c2VjcmV0"}]}`,
+		"empty secret":         `{"keys":[{"kty":"oct","k":""}]}`,
+		"unsupported curve":    `{"keys":[{"kty":"EC","crv":"P-192","x":"AQAB","y":"AQAB"}]}`,
+		"point not on curve":   `{"keys":[{"kty":"EC","crv":"P-256","x":"AQAB","y":"AQAB"}]}`,
+	}
+	for name, keySet := range tests {
+		if _, err := ParseKeySet([]byte(keySet)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -17,7 +17,7 @@ func CORS(origin string, next web.Handler) web.Handler {
 	return web.Handler(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
 		writer.Header().Set("Access-Control-Allow-Origin", origin)
 		writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		writer.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding")
+		writer.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, Authorization, X-API-Key")
 
 		err := next(ctx, writer, request)
 		return err
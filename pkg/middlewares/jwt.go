@@ -0,0 +1,329 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package middlewares
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	// hash implementations used by the supported signing algorithms
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// clockSkew is how far exp and nbf may be off to allow for clocks that are not in sync
+const clockSkew = 30 * time.Second
+
+// signingAlgorithm describes a JWS alg value
+type signingAlgorithm struct {
+	keyType string
+	hash    crypto.Hash
+	pss     bool
+}
+
+var signingAlgorithms = map[string]signingAlgorithm{
+	"HS256": {keyType: "oct", hash: crypto.SHA256},
+	"HS384": {keyType: "oct", hash: crypto.SHA384},
+	"HS512": {keyType: "oct", hash: crypto.SHA512},
+	"RS256": {keyType: "RSA", hash: crypto.SHA256},
+	"RS384": {keyType: "RSA", hash: crypto.SHA384},
+	"RS512": {keyType: "RSA", hash: crypto.SHA512},
+	"PS256": {keyType: "RSA", hash: crypto.SHA256, pss: true},
+	"PS384": {keyType: "RSA", hash: crypto.SHA384, pss: true},
+	"PS512": {keyType: "RSA", hash: crypto.SHA512, pss: true},
+	"ES256": {keyType: "EC", hash: crypto.SHA256},
+	"ES384": {keyType: "EC", hash: crypto.SHA384},
+	"ES512": {keyType: "EC", hash: crypto.SHA512},
+}
+
+var curves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// jsonWebKey is a key of a JSON Web Key Set (RFC 7517)
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+	// oct
+	K string `json:"k"`
+}
+
+// verificationKey is a parsed key of a KeySet
+type verificationKey struct {
+	keyType   string
+	keyID     string
+	algorithm string
+	// one of []byte, *rsa.PublicKey or *ecdsa.PublicKey
+	key interface{}
+}
+
+// KeySet is a set of keys that JWT signatures are verified against
+type KeySet struct {
+	keys []verificationKey
+	now  func() time.Time
+}
+
+// Claims are the registered claims of a verified JWT along with all of its claims
+type Claims struct {
+	Subject string
+	Issuer  string
+	all     map[string]interface{}
+}
+
+type tokenHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// LoadKeySet reads a JSON Web Key Set from a file
+func LoadKeySet(path string) (*KeySet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read key set %s", path)
+	}
+	return ParseKeySet(data)
+}
+
+// ParseKeySet parses a JSON Web Key Set holding RSA, EC or symmetric (oct) signing keys
+func ParseKeySet(data []byte) (*KeySet, error) {
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, errors.Wrap(err, "unable to parse key set")
+	}
+
+	keySet := &KeySet{now: time.Now}
+	for i, jwk := range document.Keys {
+		// keys published for encryption are never used to verify signatures
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := parseKey(jwk)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to parse key %d (kid %q)", i, jwk.KeyID)
+		}
+		keySet.keys = append(keySet.keys, verificationKey{
+			keyType:   jwk.KeyType,
+			keyID:     jwk.KeyID,
+			algorithm: jwk.Algorithm,
+			key:       key,
+		})
+	}
+	if len(keySet.keys) == 0 {
+		return nil, errors.New("key set has no signing keys")
+	}
+	return keySet, nil
+}
+
+func parseKey(jwk jsonWebKey) (interface{}, error) {
+	if jwk.Algorithm != "" {
+		algorithm, ok := signingAlgorithms[jwk.Algorithm]
+		if !ok || algorithm.keyType != jwk.KeyType {
+			return nil, errors.Errorf("algorithm %q is not supported for key type %q", jwk.Algorithm, jwk.KeyType)
+		}
+	}
+
+	switch jwk.KeyType {
+	case "oct":
+		key, err := decodeSegment(jwk.K)
+		if err != nil || len(key) == 0 {
+			return nil, errors.New("invalid k")
+		}
+		return key, nil
+
+	case "RSA":
+		n, err := decodeSegment(jwk.N)
+		if err != nil || len(n) == 0 {
+			return nil, errors.New("invalid n")
+		}
+		e, err := decodeSegment(jwk.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid e")
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+
+	case "EC":
+		curve, ok := curves[jwk.Curve]
+		if !ok {
+			return nil, errors.Errorf("curve %q is not supported", jwk.Curve)
+		}
+		x, err := decodeSegment(jwk.X)
+		if err != nil {
+			return nil, errors.New("invalid x")
+		}
+		y, err := decodeSegment(jwk.Y)
+		if err != nil {
+			return nil, errors.New("invalid y")
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return key, nil
+	}
+
+	return nil, errors.Errorf("key type %q is not supported", jwk.KeyType)
+}
+
+// Verify checks the signature, expiry and not-before time of a compact serialized JWT
+// and returns its claims
+func (keySet *KeySet) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, errors.New("malformed token")
+	}
+
+	var header tokenHeader
+	if err := decodeJSONSegment(parts[0], &header); err != nil {
+		return Claims{}, errors.Wrap(err, "malformed token header")
+	}
+
+	// the algorithm must be one of ours, which also rules out "none"
+	algorithm, ok := signingAlgorithms[header.Algorithm]
+	if !ok {
+		return Claims{}, errors.Errorf("token algorithm %q is not supported", header.Algorithm)
+	}
+
+	signature, err := decodeSegment(parts[2])
+	if err != nil {
+		return Claims{}, errors.New("malformed token signature")
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range keySet.keys {
+		if key.keyType != algorithm.keyType ||
+			(key.algorithm != "" && key.algorithm != header.Algorithm) ||
+			(header.KeyID != "" && key.keyID != header.KeyID) {
+			continue
+		}
+		if verifySignature(algorithm, key.key, signed, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return Claims{}, errors.New("token signature is not valid")
+	}
+
+	claims := Claims{all: map[string]interface{}{}}
+	if err := decodeJSONSegment(parts[1], &claims.all); err != nil {
+		return Claims{}, errors.Wrap(err, "malformed token claims")
+	}
+	claims.Subject, _ = claims.all["sub"].(string)
+	claims.Issuer, _ = claims.all["iss"].(string)
+
+	now := keySet.now()
+	expiry, ok := claims.all["exp"].(float64)
+	if !ok {
+		return Claims{}, errors.New("token has no expiry")
+	}
+	if now.Add(-clockSkew).After(time.Unix(int64(expiry), 0)) {
+		return Claims{}, errors.New("token has expired")
+	}
+	if notBefore, ok := claims.all["nbf"].(float64); ok && now.Add(clockSkew).Before(time.Unix(int64(notBefore), 0)) {
+		return Claims{}, errors.New("token is not valid yet")
+	}
+
+	return claims, nil
+}
+
+func verifySignature(algorithm signingAlgorithm, key interface{}, signed, signature []byte) bool {
+	if algorithm.keyType == "oct" {
+		mac := hmac.New(algorithm.hash.New, key.([]byte))
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), signature)
+	}
+
+	hash := algorithm.hash.New()
+	hash.Write(signed)
+	digest := hash.Sum(nil)
+
+	switch publicKey := key.(type) {
+	case *rsa.PublicKey:
+		if algorithm.pss {
+			return rsa.VerifyPSS(publicKey, algorithm.hash, digest, signature, nil) == nil
+		}
+		return rsa.VerifyPKCS1v15(publicKey, algorithm.hash, digest, signature) == nil
+
+	case *ecdsa.PublicKey:
+		// ECDSA signatures are the big-endian r and s, each padded to the size of the curve
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(publicKey, digest, r, s)
+	}
+
+	return false
+}
+
+// hasAudience reports whether the aud claim, a string or a list of strings, holds audience
+func (claims Claims) hasAudience(audience string) bool {
+	for _, value := range claims.strings("aud") {
+		if value == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// strings returns a claim that is a string or a list of strings
+func (claims Claims) strings(name string) []string {
+	switch value := claims.all[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var values []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func decodeSegment(segment string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+}
+
+func decodeJSONSegment(segment string, value interface{}) error {
+	data, err := decodeSegment(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
@@ -20,7 +20,7 @@ import (
 func Logger(next web.Handler) web.Handler {
 	return web.Handler(func(ctx context.Context, writer http.ResponseWriter, request *http.Request) error {
 
-		tracerID := ctx.Value(web.KeyValues).(*web.ContextValues).TraceID
+		contextValues := ctx.Value(web.KeyValues).(*web.ContextValues)
 		start := time.Now()
 		err := next(ctx, writer, request)
 
@@ -29,7 +29,8 @@ func Logger(next web.Handler) web.Handler {
 				"Method":     request.Method,
 				"RequestURI": request.RequestURI,
 				"Duration":   time.Since(start),
-				"TracerId":   tracerID,
+				"TracerId":   contextValues.TraceID,
+				"Subject":    contextValues.Subject,
 			}).Debug("Http Logger middleware")
 		}
 		// return the error even if it is nil
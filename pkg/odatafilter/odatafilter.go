@@ -0,0 +1,81 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package odatafilter builds odata $filter expressions from typed conditions. Values are
+// always rendered as escaped literals, so a value taken from a request cannot change the
+// structure of the filter.
+package odatafilter
+
+import (
+	"strconv"
+	"strings"
+)
+
+// likeEscaper escapes the LIKE wildcards of startswith and endswith values, which the
+// odata postgresql adapter passes to LIKE unescaped
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Builder joins conditions with and. Fields are field names of the code, never values
+// of a request.
+type Builder struct {
+	conditions []string
+}
+
+// New returns a builder without conditions
+func New() *Builder {
+	return &Builder{}
+}
+
+// Eq adds the condition that field equals value
+func (builder *Builder) Eq(field string, value string) *Builder {
+	return builder.add(field + " eq " + quote(value))
+}
+
+// Gt adds the condition that field is greater than value
+func (builder *Builder) Gt(field string, value string) *Builder {
+	return builder.add(field + " gt " + quote(value))
+}
+
+// GeFloat adds the condition that field is greater than or equal to value
+func (builder *Builder) GeFloat(field string, value float64) *Builder {
+	return builder.add(field + " ge " + strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+// GeInt adds the condition that field is greater than or equal to value
+func (builder *Builder) GeInt(field string, value int64) *Builder {
+	return builder.add(field + " ge " + strconv.FormatInt(value, 10))
+}
+
+// LeInt adds the condition that field is less than or equal to value
+func (builder *Builder) LeInt(field string, value int64) *Builder {
+	return builder.add(field + " le " + strconv.FormatInt(value, 10))
+}
+
+// StartsWith adds the condition that field starts with prefix
+func (builder *Builder) StartsWith(field string, prefix string) *Builder {
+	return builder.add("startswith(" + field + ", " + quote(likeEscaper.Replace(prefix)) + ")")
+}
+
+// EndsWith adds the condition that field ends with suffix
+func (builder *Builder) EndsWith(field string, suffix string) *Builder {
+	return builder.add("endswith(" + field + ", " + quote(likeEscaper.Replace(suffix)) + ")")
+}
+
+// String returns the conditions joined with and, empty when there are none
+func (builder *Builder) String() string {
+	return strings.Join(builder.conditions, " and ")
+}
+
+func (builder *Builder) add(condition string) *Builder {
+	builder.conditions = append(builder.conditions, condition)
+	return builder
+}
+
+// quote returns value as an odata string literal, which escapes a quote by doubling it so
+// it can never end the literal. SQLQuery undoubles it again in the value it compares.
+func quote(value string) string {
+	return "'" + strings.Replace(value, "'", "''", -1) + "'"
+}
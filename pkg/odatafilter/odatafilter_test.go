@@ -0,0 +1,101 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package odatafilter
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-go-odata/parser"
+)
+
+func TestBuilder(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  *Builder
+		expected string
+	}{
+		{"empty", New(), ""},
+		{"eq", New().Eq("facility_id", "store001"), "facility_id eq 'store001'"},
+		{"and", New().Eq("facility_id", "store001").GeFloat("confidence", 0.75).GeInt("last_read", 1482624000000).LeInt("last_read", 1483228800000),
+			"facility_id eq 'store001' and confidence ge 0.75 and last_read ge 1482624000000 and last_read le 1483228800000"},
+		{"gt", New().Gt("epc", "3014"), "epc gt '3014'"},
+		{"startswith and endswith", New().StartsWith("epc", "0123").EndsWith("epc", "456"),
+			"startswith(epc, '0123') and endswith(epc, '456')"},
+		{"quote", New().Eq("facility_id", "O'Brien"), "facility_id eq 'O''Brien'"},
+		{"like wildcards", New().StartsWith("epc", `30%_\`), `startswith(epc, '30\%\_\\')`},
+	}
+
+	for _, test := range tests {
+		if actual := test.builder.String(); actual != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, actual)
+		}
+	}
+}
+
+// leaf is a condition of a parsed filter
+type leaf struct {
+	operator, field string
+	value           interface{}
+}
+
+// conditions returns the conditions of a parsed filter, failing if they are joined by
+// anything but and
+func conditions(t *testing.T, node *parser.ParseNode) []leaf {
+	operator, _ := node.Token.Value.(string)
+	if operator == "and" {
+		return append(conditions(t, node.Children[0]), conditions(t, node.Children[1])...)
+	}
+	if len(node.Children) != 2 || len(node.Children[0].Children) > 0 || len(node.Children[1].Children) > 0 {
+		t.Fatalf("unexpected node %s with %d children", operator, len(node.Children))
+	}
+	field, _ := node.Children[0].Token.Value.(string)
+	return []leaf{{operator: operator, field: field, value: node.Children[1].Token.Value}}
+}
+
+func TestHostileValues(t *testing.T) {
+	hostile := []string{
+		"'",
+		"''",
+		"x' or facility_id ne 'y",
+		"x') or (facility_id ne 'y",
+		"store001' and startswith(epc, '",
+		"%",
+		`\'`,
+		"x'' or ''='",
+		"') or 1 eq 1 or ('",
+		"\n' or 'a' eq 'a",
+	}
+
+	for _, value := range hostile {
+		filter := New().Eq("facility_id", value).StartsWith("epc", value).EndsWith("epc", value).Gt("epc", value).String()
+
+		result, err := parser.ParseURLValues(url.Values{parser.Filter: {filter}})
+		if err != nil {
+			t.Errorf("%q: unable to parse filter %s: %v", value, filter, err)
+			continue
+		}
+
+		leaves := conditions(t, result[parser.Filter].(*parser.ParseNode))
+		if len(leaves) != 4 {
+			t.Errorf("%q: expected 4 conditions, got %d: %+v", value, len(leaves), leaves)
+			continue
+		}
+
+		expected := []leaf{
+			{"eq", "facility_id", quote(value)},
+			{"startswith", "epc", quote(likeEscaper.Replace(value))},
+			{"endswith", "epc", quote(likeEscaper.Replace(value))},
+			{"gt", "epc", quote(value)},
+		}
+		for i := range expected {
+			if leaves[i] != expected[i] {
+				t.Errorf("%q: expected condition %+v, got %+v", value, expected[i], leaves[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,198 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package odatafilter
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-go-odata/parser"
+	odata "github.com/intel/rsp-sw-toolkit-im-suite-go-odata/postgresql"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+var sqlOperators = map[string]string{
+	"eq":         "=",
+	"ne":         "!=",
+	"gt":         ">",
+	"ge":         ">=",
+	"lt":         "<",
+	"le":         "<=",
+	"or":         "or",
+	"and":        "and",
+	"contains":   "%%%s%%",
+	"endswith":   "%%%s",
+	"startswith": "%s%%",
+}
+
+// SQLQuery runs an odata query against the jsonb column of a table. It builds the same
+// query as the odata postgresql adapter, except that values are passed as bind parameters
+// with their escaped quotes undoubled, so a value holding a quote matches the stored value.
+// Syntax errors are reported as the adapter's odata.ErrInvalidInput.
+func SQLQuery(query url.Values, table string, column string, db *sql.DB) (*sql.Rows, error) {
+	selectQuery, args, err := buildQuery(query, table, column)
+	if err != nil {
+		return nil, err
+	}
+	return db.Query(selectQuery, args...)
+}
+
+// Condition renders an odata filter as a SQL condition on the jsonb column, in parentheses
+// so it can be combined with other conditions. The values it compares are appended to args,
+// numbered as the bind parameters following those already in args.
+func Condition(filter string, column string, args []interface{}) (string, []interface{}, error) {
+	queryMap, err := parser.ParseURLValues(url.Values{parser.Filter: {filter}})
+	if err != nil {
+		return "", nil, errors.Wrap(odata.ErrInvalidInput, err.Error())
+	}
+	node, ok := queryMap[parser.Filter].(*parser.ParseNode)
+	if !ok {
+		return "", nil, errors.Wrap(odata.ErrInvalidInput, "empty filter")
+	}
+
+	condition, err := buildFilter(node, column, &args)
+	if err != nil {
+		return "", nil, errors.Wrap(odata.ErrInvalidInput, err.Error())
+	}
+	return "(" + condition + ")", args, nil
+}
+
+func buildQuery(query url.Values, table string, column string) (string, []interface{}, error) {
+	queryMap, err := parser.ParseURLValues(query)
+	if err != nil {
+		return "", nil, errors.Wrap(odata.ErrInvalidInput, err.Error())
+	}
+
+	var finalQuery strings.Builder
+	var args []interface{}
+
+	finalQuery.WriteString(buildSelectClause(queryMap, column))
+	finalQuery.WriteString(" FROM ")
+	finalQuery.WriteString(pq.QuoteIdentifier(table))
+
+	if queryMap[parser.Filter] != nil {
+		filterNode, _ := queryMap[parser.Filter].(*parser.ParseNode)
+		filterClause, err := buildFilter(filterNode, column, &args)
+		if err != nil {
+			return "", nil, errors.Wrap(odata.ErrInvalidInput, err.Error())
+		}
+		finalQuery.WriteString(" WHERE ")
+		finalQuery.WriteString(filterClause)
+	}
+
+	if orderBy, ok := queryMap[parser.OrderBy].([]parser.OrderItem); ok {
+		finalQuery.WriteString(buildOrderBy(orderBy, column))
+	}
+
+	if limit, ok := queryMap[parser.Top].(int); ok {
+		finalQuery.WriteString(" LIMIT " + strconv.Itoa(limit))
+	}
+	if skip, ok := queryMap[parser.Skip].(int); ok {
+		finalQuery.WriteString(" OFFSET " + strconv.Itoa(skip))
+	}
+
+	return finalQuery.String(), args, nil
+}
+
+func buildSelectClause(queryMap map[string]interface{}, column string) string {
+	selectSlice, _ := queryMap[parser.Select].([]string)
+	if len(selectSlice) == 0 {
+		return "SELECT * "
+	}
+
+	col := pq.QuoteIdentifier(column)
+	fields := make([]string, len(selectSlice))
+	for i, fieldName := range selectSlice {
+		fields[i] = fmt.Sprintf("%s, %s -> %s", pq.QuoteLiteral(fieldName), col, pq.QuoteLiteral(fieldName))
+	}
+	return fmt.Sprintf("SELECT id,jsonb_build_object(%s ) AS %s", strings.Join(fields, ","), col)
+}
+
+func buildOrderBy(orderBy []parser.OrderItem, column string) string {
+	items := make([]string, len(orderBy))
+	for i, item := range orderBy {
+		items[i] = fmt.Sprintf("%s ->> %s", pq.QuoteIdentifier(column), pq.QuoteLiteral(item.Field))
+		if item.Order == "desc" {
+			items[i] += " DESC "
+		}
+	}
+	return " ORDER BY " + strings.Join(items, ",")
+}
+
+// buildFilter renders a parsed filter, appending the values it compares to args
+func buildFilter(node *parser.ParseNode, column string, args *[]interface{}) (string, error) {
+	if node == nil || node.Token == nil || len(node.Children) != 2 {
+		return "", errors.New("invalid filter")
+	}
+
+	operator, _ := node.Token.Value.(string)
+	sqlOp := sqlOperators[operator]
+	if sqlOp == "" {
+		return "", errors.Errorf("unknown operator %s", operator)
+	}
+
+	switch operator {
+	case "or", "and":
+		left, err := buildFilter(node.Children[0], column, args)
+		if err != nil {
+			return "", err
+		}
+		right, err := buildFilter(node.Children[1], column, args)
+		if err != nil {
+			return "", err
+		}
+		// and binds tighter than or in SQL as in odata, so only an or within an and needs
+		// the parentheses it was parsed from
+		if operator == "and" {
+			left, right = parenthesizeOr(node.Children[0], left), parenthesizeOr(node.Children[1], right)
+		}
+		return fmt.Sprintf("%s %s %s", left, operator, right), nil
+	}
+
+	field, ok := node.Children[0].Token.Value.(string)
+	if !ok {
+		return "", errors.New("invalid field")
+	}
+	value := node.Children[1].Token.Value
+
+	switch operator {
+	case "contains", "endswith", "startswith":
+		text, ok := value.(string)
+		if !ok {
+			return "", errors.Errorf("%s expects a string", operator)
+		}
+		*args = append(*args, fmt.Sprintf(sqlOp, unquote(text)))
+		return fmt.Sprintf("%s ->> %s LIKE $%d", pq.QuoteIdentifier(column), pq.QuoteLiteral(field), len(*args)), nil
+	}
+
+	if text, ok := value.(string); ok {
+		value = unquote(text)
+	}
+	*args = append(*args, fmt.Sprintf("%v", value))
+	return fmt.Sprintf("%s ->> %s %s $%d", pq.QuoteIdentifier(column), pq.QuoteLiteral(field), sqlOp, len(*args)), nil
+}
+
+// parenthesizeOr wraps the rendered filter of a node in parentheses when it is an or
+func parenthesizeOr(node *parser.ParseNode, rendered string) string {
+	if operator, _ := node.Token.Value.(string); operator == "or" {
+		return "(" + rendered + ")"
+	}
+	return rendered
+}
+
+// unquote returns the value of an odata string literal, undoubling its escaped quotes.
+// Values that are not quoted are returned as they are.
+func unquote(value string) string {
+	if len(value) < 2 || value[0] != '\'' || value[len(value)-1] != '\'' {
+		return value
+	}
+	return strings.Replace(value[1:len(value)-1], "''", "'", -1)
+}
@@ -0,0 +1,69 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package odatafilter
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	odata "github.com/intel/rsp-sw-toolkit-im-suite-go-odata/postgresql"
+	"github.com/pkg/errors"
+)
+
+func TestBuildQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    url.Values
+		expected string
+		args     []interface{}
+	}{
+		{"all", url.Values{}, `SELECT *  FROM "tags"`, nil},
+		{"quote", url.Values{"$filter": {New().Eq("facility_id", "O'Brien").String()}},
+			`SELECT *  FROM "tags" WHERE "data" ->> 'facility_id' = $1`, []interface{}{"O'Brien"}},
+		{"like", url.Values{"$filter": {New().StartsWith("epc", "O'B%").EndsWith("epc", "n").String()}},
+			`SELECT *  FROM "tags" WHERE "data" ->> 'epc' LIKE $1 and "data" ->> 'epc' LIKE $2`,
+			[]interface{}{`O'B\%%`, "%n"}},
+		{"precedence", url.Values{"$filter": {"epc gt 'a' and (facility_id eq 'b' or facility_id eq 'c')"}},
+			`SELECT *  FROM "tags" WHERE "data" ->> 'epc' > $1 and ("data" ->> 'facility_id' = $2 or "data" ->> 'facility_id' = $3)`,
+			[]interface{}{"a", "b", "c"}},
+		{"numbers", url.Values{"$filter": {New().GeInt("last_read", 100).String()}, "$top": {"10"}, "$skip": {"5"}},
+			`SELECT *  FROM "tags" WHERE "data" ->> 'last_read' >= $1 LIMIT 10 OFFSET 5`, []interface{}{"100"}},
+		{"select and order", url.Values{"$select": {"epc,facility_id"}, "$orderby": {"epc desc"}},
+			`SELECT id,jsonb_build_object('epc', "data" -> 'epc','facility_id', "data" -> 'facility_id' ) AS "data" FROM "tags" ORDER BY "data" ->> 'epc' DESC `, nil},
+	}
+
+	for _, test := range tests {
+		query, args, err := buildQuery(test.query, "tags", "data")
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if query != test.expected || !reflect.DeepEqual(args, test.args) {
+			t.Errorf("%s: expected %s %v, got %s %v", test.name, test.expected, test.args, query, args)
+		}
+	}
+
+	if _, _, err := buildQuery(url.Values{"$filter": {"epc eq"}}, "tags", "data"); errors.Cause(err) != odata.ErrInvalidInput {
+		t.Errorf("Expected invalid input, got %v", err)
+	}
+}
+
+func TestCondition(t *testing.T) {
+	condition, args, err := Condition("qualified_state eq 'O''Brien' or startswith(epc, '3014')", "data", []interface{}{"store001"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expected := `("data" ->> 'qualified_state' = $2 or "data" ->> 'epc' LIKE $3)`
+	if condition != expected || !reflect.DeepEqual(args, []interface{}{"store001", "O'Brien", "3014%"}) {
+		t.Errorf("Expected %s, got %s %v", expected, condition, args)
+	}
+
+	if _, _, err := Condition("epc eq", "data", nil); errors.Cause(err) != odata.ErrInvalidInput {
+		t.Errorf("Expected invalid input, got %v", err)
+	}
+}
@@ -0,0 +1,298 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package prometheus exposes a go-metrics registry in the Prometheus text exposition format
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// ContentType is the content type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var quantiles = []float64{0.5, 0.75, 0.95, 0.99}
+
+// Exporter writes the metrics of a registry in the Prometheus text exposition format.
+//
+// Gauges are written with their current value and label, timers and histograms as
+// summaries. Gauge collections only hold the readings since they were last cleared, so
+// the exporter accumulates their readings per tag, writing the last reading as a gauge
+// and the sum of the readings as a counter suffixed _total. The labeled counters of the
+// default labeled registry are written with a sample per series.
+type Exporter struct {
+	registry metrics.Registry
+	labeled  *LabeledRegistry
+	// clearCollections clears gauge collections once their readings are accumulated. It
+	// must only be set when no other reporter, such as InfluxDB, reads the collections.
+	clearCollections bool
+
+	mutex       sync.Mutex
+	collections map[string]*collection
+	// collisions holds the names already reported as colliding with another metric
+	collisions map[string]bool
+}
+
+// collection is the accumulated readings of a gauge collection
+type collection struct {
+	// time of the last reading accumulated, as readings that are not cleared are read again
+	lastReading time.Time
+	series      map[string]*series
+}
+
+// series is the accumulated readings of a gauge collection with a tag
+type series struct {
+	label string
+	last  int64
+	sum   int64
+}
+
+// NewExporter returns an exporter of the registry
+func NewExporter(registry metrics.Registry, clearCollections bool) *Exporter {
+	return &Exporter{
+		registry:         registry,
+		labeled:          DefaultLabeledRegistry,
+		clearCollections: clearCollections,
+		collections:      make(map[string]*collection),
+		collisions:       make(map[string]bool),
+	}
+}
+
+// Write writes all metrics of the registry, ordered by name. Metrics whose names only
+// differ by characters Prometheus does not allow are written under distinct names, see
+// metricNames.
+func (exporter *Exporter) Write(w io.Writer) error {
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+
+	registered := make(map[string]interface{})
+	exporter.labeled.each(func(name string, counter *LabeledCounter) {
+		registered[name] = counter
+	})
+	exporter.registry.Each(func(name string, metric interface{}) {
+		registered[name] = metric
+	})
+	names := make([]string, 0, len(registered))
+	for name := range registered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	metricNames := exporter.metricNames(names)
+
+	buffer := bufio.NewWriter(w)
+	for _, name := range names {
+		metricName := metricNames[name]
+
+		switch metric := registered[name].(type) {
+		case metrics.Counter:
+			writeFamily(buffer, metricName, "counter")
+			writeSample(buffer, metricName, "", float64(metric.Count()))
+
+		case metrics.Gauge:
+			snapshot := metric.Snapshot()
+			writeFamily(buffer, metricName, "gauge")
+			writeSample(buffer, metricName, tagLabel(snapshot.Tag()), float64(snapshot.Value()))
+
+		case metrics.GaugeFloat64:
+			writeFamily(buffer, metricName, "gauge")
+			writeSample(buffer, metricName, "", metric.Snapshot().Value())
+
+		case metrics.GaugeCollection:
+			exporter.writeCollection(buffer, name, metricName, metric)
+
+		case *LabeledCounter:
+			writeFamily(buffer, metricName, "counter")
+			labels, counts := metric.series()
+			for _, label := range labels {
+				writeSample(buffer, metricName, label, float64(counts[label]))
+			}
+
+		case metrics.Meter:
+			writeFamily(buffer, metricName+"_total", "counter")
+			writeSample(buffer, metricName+"_total", "", float64(metric.Snapshot().Count()))
+
+		case metrics.Timer:
+			snapshot := metric.Snapshot()
+			// timers measure nanoseconds, Prometheus expects seconds
+			seconds := metricName + "_seconds"
+			values := snapshot.Percentiles(quantiles)
+			for i := range values {
+				values[i] /= float64(time.Second)
+			}
+			writeSummary(buffer, seconds, values, float64(snapshot.Sum())/float64(time.Second), snapshot.Count())
+
+		case metrics.Histogram:
+			snapshot := metric.Snapshot()
+			writeSummary(buffer, metricName, snapshot.Percentiles(quantiles), float64(snapshot.Sum()), snapshot.Count())
+		}
+	}
+
+	return buffer.Flush()
+}
+
+// metricNames returns the Prometheus name of each of the ordered go-metrics names. When
+// several names sanitize to the same Prometheus name, the first keeps it and the others
+// are suffixed _2, _3 and so on, and the collision is logged the first time it is seen.
+func (exporter *Exporter) metricNames(names []string) map[string]string {
+	metricNames := make(map[string]string, len(names))
+	taken := make(map[string]bool, len(names))
+	for _, name := range names {
+		taken[sanitizeName(name)] = true
+	}
+
+	assigned := make(map[string]string, len(names))
+	for _, name := range names {
+		metricName := sanitizeName(name)
+		first, collides := assigned[metricName]
+		if !collides {
+			assigned[metricName] = name
+			metricNames[name] = metricName
+			continue
+		}
+
+		unique := metricName
+		for i := 2; taken[unique]; i++ {
+			unique = metricName + "_" + strconv.Itoa(i)
+		}
+		taken[unique] = true
+		metricNames[name] = unique
+
+		if !exporter.collisions[name] {
+			exporter.collisions[name] = true
+			log.WithFields(log.Fields{
+				"Metric":    name,
+				"Collides":  first,
+				"Name":      metricName,
+				"WrittenAs": unique,
+			}).Warn("metric name collides with another metric once sanitized")
+		}
+	}
+	return metricNames
+}
+
+// writeCollection accumulates the new readings of a gauge collection and writes them
+func (exporter *Exporter) writeCollection(w io.Writer, name string, metricName string, metric metrics.GaugeCollection) {
+	accumulated, ok := exporter.collections[name]
+	if !ok {
+		accumulated = &collection{series: make(map[string]*series)}
+		exporter.collections[name] = accumulated
+	}
+
+	readings := metric.Snapshot().Readings()
+	if exporter.clearCollections && len(readings) > 0 {
+		metric.Clear()
+	}
+
+	lastReading := accumulated.lastReading
+	for _, reading := range readings {
+		if !reading.Time.After(accumulated.lastReading) {
+			continue
+		}
+		if reading.Time.After(lastReading) {
+			lastReading = reading.Time
+		}
+
+		label := tagLabel(reading.Tag)
+		current, ok := accumulated.series[label]
+		if !ok {
+			current = &series{label: label}
+			accumulated.series[label] = current
+		}
+		current.last = reading.Reading
+		current.sum += reading.Reading
+	}
+	accumulated.lastReading = lastReading
+
+	labels := make([]string, 0, len(accumulated.series))
+	for label := range accumulated.series {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	writeFamily(w, metricName, "gauge")
+	for _, label := range labels {
+		writeSample(w, metricName, label, float64(accumulated.series[label].last))
+	}
+	writeFamily(w, metricName+"_total", "counter")
+	for _, label := range labels {
+		writeSample(w, metricName+"_total", label, float64(accumulated.series[label].sum))
+	}
+}
+
+func writeFamily(w io.Writer, name string, metricType string) {
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+}
+
+func writeSample(w io.Writer, name string, label string, value float64) {
+	if label != "" {
+		fmt.Fprintf(w, "%s{%s} %s\n", name, label, formatValue(value))
+		return
+	}
+	fmt.Fprintf(w, "%s %s\n", name, formatValue(value))
+}
+
+func writeSummary(w io.Writer, name string, values []float64, sum float64, count int64) {
+	writeFamily(w, name, "summary")
+	for i, quantile := range quantiles {
+		writeSample(w, name, `quantile="`+formatValue(quantile)+`"`, values[i])
+	}
+	writeSample(w, name+"_sum", "", sum)
+	writeSample(w, name+"_count", "", float64(count))
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// tagLabel returns the label of a go-metrics tag, empty when there is no tag
+func tagLabel(tag *metrics.Tag) string {
+	if tag == nil || tag.Name == "" {
+		return ""
+	}
+	return sanitizeName(tag.Name) + `="` + labelValueEscaper.Replace(tag.Value) + `"`
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// sanitizeName turns a go-metrics name, such as Inventory.GetTags.Attempt, into a
+// Prometheus name, such as inventory_gettags_attempt
+func sanitizeName(name string) string {
+	var builder strings.Builder
+	for i, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r == '_', r == ':':
+			builder.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				builder.WriteRune('_')
+			}
+			builder.WriteRune(r)
+		default:
+			builder.WriteRune('_')
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,132 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package prometheus
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+)
+
+func write(t *testing.T, exporter *Exporter) string {
+	var buffer bytes.Buffer
+	if err := exporter.Write(&buffer); err != nil {
+		t.Fatalf("error writing metrics: %s", err)
+	}
+	return buffer.String()
+}
+
+func expectLines(t *testing.T, output string, lines ...string) {
+	for _, line := range lines {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("expected line %q in:\n%s", line, output)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	registry := metrics.NewRegistry()
+
+	metrics.GetOrRegisterGauge("Inventory.GetTags.Attempt", registry).Update(1)
+	metrics.GetOrRegisterGauge("Inventory.Alert.Received", registry).UpdateWithTag(3, metrics.Tag{Name: "DeviceId", Value: `RSP-"1"`})
+	metrics.GetOrRegisterCounter("Inventory.Requests", registry).Inc(5)
+	metrics.GetOrRegisterTimer("Inventory.GetTags.Latency", registry).Update(2 * time.Second)
+
+	output := write(t, NewExporter(registry, false))
+
+	expectLines(t, output,
+		"# TYPE inventory_gettags_attempt gauge",
+		"inventory_gettags_attempt 1",
+		`inventory_alert_received{deviceid="RSP-\"1\""} 3`,
+		"# TYPE inventory_requests counter",
+		"inventory_requests 5",
+		"# TYPE inventory_gettags_latency_seconds summary",
+		`inventory_gettags_latency_seconds{quantile="0.5"} 2`,
+		"inventory_gettags_latency_seconds_sum 2",
+		"inventory_gettags_latency_seconds_count 1",
+	)
+
+	// metrics are written in order of their names
+	if strings.Index(output, "inventory_alert_received") > strings.Index(output, "inventory_gettags_attempt") {
+		t.Errorf("expected metrics to be ordered by name:\n%s", output)
+	}
+}
+
+func TestWriteGaugeCollection(t *testing.T) {
+	for _, clear := range []bool{false, true} {
+		registry := metrics.NewRegistry()
+		events := metrics.GetOrRegisterGaugeCollection("Inventory.Events.ByType", registry)
+		exporter := NewExporter(registry, clear)
+
+		events.AddWithTag(2, metrics.Tag{Name: "Event", Value: "arrival"})
+		events.AddWithTag(3, metrics.Tag{Name: "Event", Value: "arrival"})
+		expectLines(t, write(t, exporter),
+			"# TYPE inventory_events_bytype gauge",
+			`inventory_events_bytype{event="arrival"} 3`,
+			"# TYPE inventory_events_bytype_total counter",
+			`inventory_events_bytype_total{event="arrival"} 5`,
+		)
+
+		// readings that were already accumulated are not counted again
+		events.AddWithTag(1, metrics.Tag{Name: "Event", Value: "departed"})
+		expectLines(t, write(t, exporter),
+			`inventory_events_bytype_total{event="arrival"} 5`,
+			`inventory_events_bytype_total{event="departed"} 1`,
+		)
+
+		if events.IsSet() == clear {
+			t.Errorf("expected the collection to be cleared only when clearing collections, clear: %v", clear)
+		}
+	}
+}
+
+func TestWriteLabeledCounter(t *testing.T) {
+	labeled := NewLabeledRegistry()
+	events := GetOrRegisterLabeledCounter("Inventory.Events", labeled, "event_type", "facility_id")
+	events.Inc(2, "arrival", "store001")
+	events.Inc(3, "arrival", "store001")
+	GetOrRegisterLabeledCounter("Inventory.Events", labeled, "event_type", "facility_id").Inc(1, "departed", `store "2"`)
+
+	exporter := NewExporter(metrics.NewRegistry(), true)
+	exporter.labeled = labeled
+	expectLines(t, write(t, exporter),
+		"# TYPE inventory_events counter",
+		`inventory_events{event_type="arrival",facility_id="store001"} 5`,
+		`inventory_events{event_type="departed",facility_id="store \"2\""} 1`,
+	)
+}
+
+func TestWriteCollidingNames(t *testing.T) {
+	registry := metrics.NewRegistry()
+
+	metrics.GetOrRegisterCounter("Inventory.Events.ByFacility.Front-Door", registry).Inc(1)
+	metrics.GetOrRegisterCounter("Inventory.Events.ByFacility.Front Door", registry).Inc(2)
+	metrics.GetOrRegisterCounter("Inventory.Events.ByFacility.Front_Door", registry).Inc(3)
+
+	expectLines(t, write(t, NewExporter(registry, false)),
+		"inventory_events_byfacility_front_door 2",
+		"inventory_events_byfacility_front_door_2 1",
+		"inventory_events_byfacility_front_door_3 3",
+	)
+}
+
+func TestSanitizeName(t *testing.T) {
+	tests := map[string]string{
+		"Inventory.Update-Facility.Attempt": "inventory_update_facility_attempt",
+		"Sensor.RSP.Upsert.Attempt":         "sensor_rsp_upsert_attempt",
+		"9lives":                            "_9lives",
+		"a:b c":                             "a:b_c",
+	}
+	for name, expected := range tests {
+		if sanitized := sanitizeName(name); sanitized != expected {
+			t.Errorf("expected %s to be sanitized to %s, got %s", name, expected, sanitized)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package prometheus
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// LabeledCounter is a counter with a series per combination of the values of its labels.
+// go-metrics tags hold a single label and go-metrics registries only hold their own types,
+// so labeled counters are kept in a LabeledRegistry, written by the exporter along with the
+// go-metrics registry. They are not reported to InfluxDB.
+type LabeledCounter struct {
+	labels []string
+
+	mutex  sync.Mutex
+	counts map[string]int64
+}
+
+// LabeledRegistry holds labeled counters by name
+type LabeledRegistry struct {
+	mutex    sync.Mutex
+	counters map[string]*LabeledCounter
+}
+
+// DefaultLabeledRegistry is the registry of labeled counters written by exporters
+var DefaultLabeledRegistry = NewLabeledRegistry()
+
+// NewLabeledRegistry returns an empty registry
+func NewLabeledRegistry() *LabeledRegistry {
+	return &LabeledRegistry{counters: make(map[string]*LabeledCounter)}
+}
+
+// GetOrRegisterLabeledCounter returns the labeled counter of the registry with the name,
+// registering it with the labels if there is none. A nil registry is the default registry.
+func GetOrRegisterLabeledCounter(name string, registry *LabeledRegistry, labels ...string) *LabeledCounter {
+	if registry == nil {
+		registry = DefaultLabeledRegistry
+	}
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	counter, ok := registry.counters[name]
+	if !ok {
+		counter = &LabeledCounter{labels: labels, counts: make(map[string]int64)}
+		registry.counters[name] = counter
+	}
+	return counter
+}
+
+// each calls f with each counter of the registry
+func (registry *LabeledRegistry) each(f func(name string, counter *LabeledCounter)) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	for name, counter := range registry.counters {
+		f(name, counter)
+	}
+}
+
+// Inc increments the series of the label values, given in the order of the labels
+func (counter *LabeledCounter) Inc(count int64, values ...string) {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	counter.counts[counter.label(values)] += count
+}
+
+// label renders the labels of a series, values missing for a label being empty
+func (counter *LabeledCounter) label(values []string) string {
+	pairs := make([]string, len(counter.labels))
+	for i, name := range counter.labels {
+		var value string
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = sanitizeName(name) + `="` + labelValueEscaper.Replace(value) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+// series returns the labels of each series, ordered, along with their counts
+func (counter *LabeledCounter) series() ([]string, map[string]int64) {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	labels := make([]string, 0, len(counter.counts))
+	counts := make(map[string]int64, len(counter.counts))
+	for label, count := range counter.counts {
+		labels = append(labels, label)
+		counts[label] = count
+	}
+	sort.Strings(labels)
+	return labels, counts
+}
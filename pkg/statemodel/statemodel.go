@@ -103,12 +103,31 @@ func UpdateTag(currentState tag.Tag, newTagEvent jsonrpc.TagEvent, source string
 				Source:    source}
 
 			newState.LocationHistory = AddLocationIfNew(newState.LocationHistory, locationToAdd)
+
+			// The tag has been seen again, so it is no longer a missing candidate
+			newState.MissingCandidate = false
 		}
 
 		//update epc state
 		newState.EpcState = GetEpcState(currentState.EpcState, newState)
 	}
 
+	//Keep why, where and when the tag departed, until it is seen again
+	if newTagEvent.EventType == DepartedEvent {
+		if isNewTag || currentState.EpcState != DepartedEpcState {
+			newState.DepartureReason = newTagEvent.DepartureReason
+			newState.DepartureLocation = newTagEvent.Location
+			newState.DepartedAt = newTagEvent.DepartedAt
+			if newState.DepartedAt == 0 {
+				newState.DepartedAt = newTagEvent.Timestamp
+			}
+		}
+	} else {
+		newState.DepartureReason = ""
+		newState.DepartureLocation = ""
+		newState.DepartedAt = 0
+	}
+
 	return newState
 }
 
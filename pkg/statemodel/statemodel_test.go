@@ -273,6 +273,55 @@ func TestUpdateTag_HHPriorityOlderFixed(t *testing.T) {
 	}
 }
 
+func TestUpdateTag_ClearsMissingCandidate(t *testing.T) {
+	currentTagState := getHelperTag()
+	currentTagState.MissingCandidate = true
+
+	tagState := UpdateTag(currentTagState, getHelperTagEvent(), "handheld")
+	if tagState.MissingCandidate {
+		t.Error("tagState MissingCandidate should have been cleared by a new read")
+	}
+
+	departedEvent := getHelperTagEvent()
+	departedEvent.EventType = DepartedEvent
+	currentTagState.EpcState = DepartedEpcState
+
+	tagState = UpdateTag(currentTagState, departedEvent, "fixed")
+	if !tagState.MissingCandidate {
+		t.Error("tagState MissingCandidate should not be cleared by a departed event")
+	}
+}
+
+func TestUpdateTag_DepartureReason(t *testing.T) {
+	currentTagState := getHelperTag()
+
+	departedEvent := getHelperTagEvent()
+	departedEvent.EventType = DepartedEvent
+	departedEvent.Location = "RSP-150000-0"
+	departedEvent.DepartureReason = jsonrpc.DepartureReasonExit
+	departedEvent.DepartedAt = departedEvent.Timestamp + 30000
+
+	tagState := UpdateTag(currentTagState, departedEvent, "fixed")
+	if tagState.DepartureReason != jsonrpc.DepartureReasonExit || tagState.DepartureLocation != "RSP-150000-0" {
+		t.Errorf("Expected departure through exit RSP-150000-0, got '%s' at '%s'", tagState.DepartureReason, tagState.DepartureLocation)
+	}
+	if tagState.DepartedAt != departedEvent.DepartedAt {
+		t.Errorf("Expected departure time %d, got %d", departedEvent.DepartedAt, tagState.DepartedAt)
+	}
+
+	// a repeated departure keeps the original reason
+	repeatedEvent := departedEvent
+	repeatedEvent.DepartureReason = jsonrpc.DepartureReasonAgeOut
+	if repeated := UpdateTag(tagState, repeatedEvent, "fixed"); repeated.DepartureReason != jsonrpc.DepartureReasonExit {
+		t.Errorf("Expected departure reason to be kept, got '%s'", repeated.DepartureReason)
+	}
+
+	returnedState := UpdateTag(tagState, getHelperTagEvent(), "fixed")
+	if returnedState.DepartureReason != "" || returnedState.DepartureLocation != "" || returnedState.DepartedAt != 0 {
+		t.Error("Expected departure reason to be cleared when the tag is read again")
+	}
+}
+
 func TestUpdateTag_HHPriorityNewerFixed(t *testing.T) {
 	// HH has priority, but newer fixed tag will overwrite.
 	config.AppConfig.NewerHandheldHavePriority = true
@@ -27,6 +27,9 @@ var (
 	// ErrNotAuthorized occurs when the call is not authorized.
 	ErrNotAuthorized = errors.New("Not authorized")
 
+	// ErrForbidden occurs when the caller is authenticated but lacks the required role.
+	ErrForbidden = errors.New("Forbidden")
+
 	// ErrDBNotConfigured occurs when the DB is not initialized.
 	ErrDBNotConfigured = errors.New("DB not initialized")
 
@@ -44,6 +47,12 @@ var (
 
 	// ErrEntityTooLarge occurs when the input data is invalid
 	ErrEntityTooLarge = errors.New("Request entity too large")
+
+	// ErrConflict occurs when the request conflicts with the current state of an entity
+	ErrConflict = errors.New("Conflict")
+
+	// ErrBadGateway occurs when a service the request depends on cannot be reached
+	ErrBadGateway = errors.New("Upstream service error")
 )
 
 // Error handles all error responses for the API.
@@ -67,6 +76,10 @@ func Error(ctx context.Context, writer http.ResponseWriter, err error) {
 		RespondError(ctx, writer, err, http.StatusUnauthorized)
 		return
 
+	case ErrForbidden:
+		RespondError(ctx, writer, err, http.StatusForbidden)
+		return
+
 	case ErrInvalidInput:
 		RespondError(ctx, writer, err, http.StatusBadRequest)
 		return
@@ -74,6 +87,14 @@ func Error(ctx context.Context, writer http.ResponseWriter, err error) {
 	case ErrEntityTooLarge:
 		RespondError(ctx, writer, err, http.StatusRequestEntityTooLarge)
 		return
+
+	case ErrConflict:
+		RespondError(ctx, writer, err, http.StatusConflict)
+		return
+
+	case ErrBadGateway:
+		RespondError(ctx, writer, err, http.StatusBadGateway)
+		return
 	}
 
 	// Handler server error
@@ -24,6 +24,8 @@ type ContextValues struct {
 	TraceID    string
 	Method     string
 	RequestURI string
+	// Subject identifies the authenticated caller, empty when authentication is disabled
+	Subject string
 }
 
 // Handler is a type that handles a http request
@@ -0,0 +1,190 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package productdata
+
+import (
+	"sync"
+	"time"
+
+	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+type cacheEntry struct {
+	data       map[string]ProductMetadata
+	fetched    time.Time
+	refreshing bool
+}
+
+// Cache keeps the product metadata of the SKU mapping service in memory, per mapping
+// service url. Entries older than the TTL are served while they are refreshed in the
+// background, and keep being served when the refresh fails, so confidence stays
+// available while the mapping service is slow or down. A TTL of 0 disables caching.
+// Concurrent fetches of the same url share a single call to the mapping service.
+type Cache struct {
+	mutex    sync.Mutex
+	ttl      time.Duration
+	entries  map[string]*cacheEntry
+	fetch    func(url string) (map[string]ProductMetadata, error)
+	fetching singleflight.Group
+	hits     int64
+	misses   int64
+}
+
+// NewCache creates a product metadata cache with the given TTL
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{
+		ttl:     ttl,
+		entries: make(map[string]*cacheEntry),
+		fetch:   CreateProductDataMap,
+	}
+}
+
+// defaultCache is disabled until InitCache is called
+var defaultCache = NewCache(0)
+
+// InitCache sets the TTL of the product metadata cache and drops its entries
+func InitCache(ttl time.Duration) {
+	defaultCache.mutex.Lock()
+	defaultCache.ttl = ttl
+	defaultCache.entries = make(map[string]*cacheEntry)
+	defaultCache.mutex.Unlock()
+}
+
+// GetProductDataMap returns the product metadata of the mapping service from the cache
+func GetProductDataMap(url string) (map[string]ProductMetadata, error) {
+	return defaultCache.Get(url)
+}
+
+// InvalidateCache drops all cached product metadata, so it is fetched again on next use
+func InvalidateCache() {
+	defaultCache.Invalidate()
+}
+
+// RefreshCache fetches the product metadata of every cached mapping service url
+func RefreshCache() {
+	defaultCache.RefreshAll()
+}
+
+// Get returns the product metadata of the mapping service url. It is only fetched
+// synchronously when it is not cached yet or caching is disabled.
+func (cache *Cache) Get(url string) (map[string]ProductMetadata, error) {
+	cache.mutex.Lock()
+	if cache.ttl <= 0 {
+		cache.mutex.Unlock()
+		return cache.fetchShared(url)
+	}
+
+	if entry, ok := cache.entries[url]; ok {
+		if time.Since(entry.fetched) >= cache.ttl && !entry.refreshing {
+			metrics.GetOrRegisterCounter(`Inventory.ProductDataCache.Stale`, nil).Inc(1)
+			entry.refreshing = true
+			go cache.refresh(url)
+		}
+		data := entry.data
+		cache.recordLocked(true)
+		cache.mutex.Unlock()
+		return data, nil
+	}
+	cache.recordLocked(false)
+	cache.mutex.Unlock()
+
+	data, err := cache.fetchShared(url)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.mutex.Lock()
+	if _, ok := cache.entries[url]; !ok {
+		cache.entries[url] = &cacheEntry{data: data, fetched: time.Now()}
+	}
+	cache.mutex.Unlock()
+
+	return data, nil
+}
+
+// fetchShared fetches the product metadata of the url, waiting for the fetch already
+// in flight for the same url instead of starting another one
+func (cache *Cache) fetchShared(url string) (map[string]ProductMetadata, error) {
+	data, err, _ := cache.fetching.Do(url, func() (interface{}, error) {
+		return cache.fetch(url)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.(map[string]ProductMetadata), nil
+}
+
+// Invalidate drops all cached product metadata
+func (cache *Cache) Invalidate() {
+	cache.mutex.Lock()
+	cache.entries = make(map[string]*cacheEntry)
+	cache.mutex.Unlock()
+
+	metrics.GetOrRegisterCounter(`Inventory.ProductDataCache.Invalidate`, nil).Inc(1)
+}
+
+// RefreshAll fetches the product metadata of every cached mapping service url
+func (cache *Cache) RefreshAll() {
+	cache.mutex.Lock()
+	var urls []string
+	for url, entry := range cache.entries {
+		if !entry.refreshing {
+			entry.refreshing = true
+			urls = append(urls, url)
+		}
+	}
+	cache.mutex.Unlock()
+
+	for _, url := range urls {
+		cache.refresh(url)
+	}
+}
+
+// refresh fetches the product metadata of a cached url, keeping the cached
+// data when the fetch fails
+func (cache *Cache) refresh(url string) {
+	data, err := cache.fetchShared(url)
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	entry, ok := cache.entries[url]
+	if !ok {
+		// invalidated while refreshing
+		return
+	}
+	entry.refreshing = false
+
+	if err != nil {
+		metrics.GetOrRegisterCounter(`Inventory.ProductDataCache.Refresh-Error`, nil).Inc(1)
+		log.WithFields(log.Fields{
+			"Method": "refresh",
+			"Action": "Refresh product data cache",
+			"Error":  err.Error(),
+		}).Warn("unable to refresh product data, serving cached data")
+		return
+	}
+
+	entry.data = data
+	entry.fetched = time.Now()
+	metrics.GetOrRegisterCounter(`Inventory.ProductDataCache.Refresh`, nil).Inc(1)
+}
+
+// recordLocked updates the hit rate metrics, the cache mutex must be held
+func (cache *Cache) recordLocked(hit bool) {
+	if hit {
+		cache.hits++
+		metrics.GetOrRegisterCounter(`Inventory.ProductDataCache.Hit`, nil).Inc(1)
+	} else {
+		cache.misses++
+		metrics.GetOrRegisterCounter(`Inventory.ProductDataCache.Miss`, nil).Inc(1)
+	}
+	metrics.GetOrRegisterGaugeFloat64(`Inventory.ProductDataCache.Hit-Rate`, nil).
+		Update(float64(cache.hits) / float64(cache.hits+cache.misses))
+}
@@ -0,0 +1,211 @@
+/* Apache v2 license
+*  Copyright (C) <2019> Intel Corporation
+*
+*  SPDX-License-Identifier: Apache-2.0
+ */
+
+package productdata
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeFetcher struct {
+	mutex   sync.Mutex
+	calls   int
+	err     error
+	started chan struct{}
+	release chan struct{}
+}
+
+func (fetcher *fakeFetcher) fetch(url string) (map[string]ProductMetadata, error) {
+	if fetcher.release != nil {
+		fetcher.started <- struct{}{}
+		<-fetcher.release
+	}
+	fetcher.mutex.Lock()
+	defer fetcher.mutex.Unlock()
+	fetcher.calls++
+	if fetcher.err != nil {
+		return nil, fetcher.err
+	}
+	return map[string]ProductMetadata{"00111111": {ProductID: url, BeingRead: float64(fetcher.calls)}}, nil
+}
+
+func (fetcher *fakeFetcher) callCount() int {
+	fetcher.mutex.Lock()
+	defer fetcher.mutex.Unlock()
+	return fetcher.calls
+}
+
+func newTestCache(ttl time.Duration, fetcher *fakeFetcher) *Cache {
+	cache := NewCache(ttl)
+	cache.fetch = fetcher.fetch
+	return cache
+}
+
+func TestCacheDisabled(t *testing.T) {
+	fetcher := &fakeFetcher{}
+	cache := newTestCache(0, fetcher)
+
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Get("url"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fetcher.callCount() != 2 {
+		t.Errorf("expected every call to fetch when the cache is disabled, got %d fetches", fetcher.callCount())
+	}
+}
+
+func TestCacheHit(t *testing.T) {
+	fetcher := &fakeFetcher{}
+	cache := newTestCache(time.Hour, fetcher)
+
+	for i := 0; i < 3; i++ {
+		data, err := cache.Get("url")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data["00111111"].ProductID != "url" {
+			t.Errorf("unexpected product data %v", data)
+		}
+	}
+	if fetcher.callCount() != 1 {
+		t.Errorf("expected 1 fetch, got %d", fetcher.callCount())
+	}
+	if cache.hits != 2 || cache.misses != 1 {
+		t.Errorf("expected 2 hits and 1 miss, got %d hits and %d misses", cache.hits, cache.misses)
+	}
+
+	cache.Invalidate()
+	if _, err := cache.Get("url"); err != nil {
+		t.Fatal(err)
+	}
+	if fetcher.callCount() != 2 {
+		t.Errorf("expected invalidation to force a fetch, got %d fetches", fetcher.callCount())
+	}
+}
+
+func TestCacheMissError(t *testing.T) {
+	fetcher := &fakeFetcher{err: errors.New("mapping service down")}
+	cache := newTestCache(time.Hour, fetcher)
+
+	if _, err := cache.Get("url"); err == nil {
+		t.Error("expected an error when nothing is cached and the fetch fails")
+	}
+	if len(cache.entries) != 0 {
+		t.Error("expected failed fetch not to be cached")
+	}
+}
+
+func TestCacheStaleWhileError(t *testing.T) {
+	fetcher := &fakeFetcher{}
+	cache := newTestCache(time.Hour, fetcher)
+
+	if _, err := cache.Get("url"); err != nil {
+		t.Fatal(err)
+	}
+
+	fetcher.mutex.Lock()
+	fetcher.err = errors.New("mapping service down")
+	fetcher.mutex.Unlock()
+
+	cache.RefreshAll()
+
+	data, err := cache.Get("url")
+	if err != nil {
+		t.Fatalf("expected cached data to be served when the refresh fails: %v", err)
+	}
+	if data["00111111"].BeingRead != 1 {
+		t.Errorf("expected the originally fetched data, got %v", data)
+	}
+	if cache.entries["url"].refreshing {
+		t.Error("expected refresh to be finished")
+	}
+}
+
+func TestCacheStaleRefresh(t *testing.T) {
+	fetcher := &fakeFetcher{}
+	cache := newTestCache(time.Hour, fetcher)
+
+	if _, err := cache.Get("url"); err != nil {
+		t.Fatal(err)
+	}
+
+	// age the entry past the TTL
+	cache.mutex.Lock()
+	cache.entries["url"].fetched = time.Now().Add(-2 * time.Hour)
+	cache.mutex.Unlock()
+
+	data, err := cache.Get("url")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["00111111"].BeingRead != 1 {
+		t.Errorf("expected the stale data to be served while refreshing, got %v", data)
+	}
+
+	// wait for the background refresh
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cache.mutex.Lock()
+		refreshing := cache.entries["url"].refreshing
+		cache.mutex.Unlock()
+		if !refreshing {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("background refresh did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	data, err = cache.Get("url")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["00111111"].BeingRead != 2 {
+		t.Errorf("expected refreshed data, got %v", data)
+	}
+	if fetcher.callCount() != 2 {
+		t.Errorf("expected 2 fetches, got %d", fetcher.callCount())
+	}
+}
+
+func TestCacheConcurrentMiss(t *testing.T) {
+	fetcher := &fakeFetcher{started: make(chan struct{}, 10), release: make(chan struct{})}
+	cache := newTestCache(time.Hour, fetcher)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	get := func() {
+		defer wg.Done()
+		if _, err := cache.Get("url"); err != nil {
+			errs <- err
+		}
+	}
+
+	wg.Add(1)
+	go get()
+	// wait until the first miss is fetching before the others miss too
+	<-fetcher.started
+	for i := 0; i < 9; i++ {
+		wg.Add(1)
+		go get()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(fetcher.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if fetcher.callCount() != 1 {
+		t.Errorf("expected concurrent misses to share one fetch, got %d fetches", fetcher.callCount())
+	}
+}
@@ -10,10 +10,14 @@ import (
 	"fmt"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/cloudconnector"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/config"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/eventstream"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/routes/handlers"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/rules"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/stocklevel"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/tag"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/app/webhook"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/jsonrpc"
+	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/prometheus"
 	"github.com/intel/rsp-sw-toolkit-im-suite-inventory-service/pkg/statemodel"
 	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/go-metrics"
 	"github.com/intel/rsp-sw-toolkit-im-suite-utilities/helper"
@@ -141,9 +145,67 @@ func (skuMapping SkuMapping) processTagData(invApp *inventoryApp, invEvent *json
 		}
 
 		go invApp.pushEventsToCoreData(currentTimeMillis, invEvent.Params.ControllerId, tagData)
+
+		eventstream.Publish(tagData)
+
+		tagEvents := webhook.TagEvents(tagData)
+		countEvents(tagEvents)
+		go invApp.enqueueWebhooks(tagEvents)
+
+		go skuMapping.evaluateStockLevels(invApp, invEvent.Params.ControllerId, tagData)
 	}
 
 	mProcessTagLatency.Update(time.Since(processTagTimer))
 
 	return nil
 }
+
+// evaluateStockLevels evaluates the stock level of the products of the tags, publishing an
+// event through the rules, webhooks and core-data for each product whose stock status changed
+func (skuMapping SkuMapping) evaluateStockLevels(invApp *inventoryApp, controllerId string, tagData []tag.Tag) {
+	applyConfidence := func(tags []tag.Tag) error {
+		return handlers.ApplyConfidence(invApp.masterDB, tags, skuMapping.url)
+	}
+
+	events, err := stocklevel.Evaluate(invApp.masterDB, tagData, applyConfidence)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Method": "evaluateStockLevels",
+			"Action": "Evaluate Stock Levels",
+			"Error":  fmt.Sprintf("%+v", err),
+		}).Error(err)
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	if config.AppConfig.RulesUrl != "" {
+		if err := rules.ApplyStockRules(events); err != nil {
+			log.WithFields(log.Fields{
+				"Method": "evaluateStockLevels",
+				"Action": "Apply Stock Rules",
+				"Error":  fmt.Sprintf("%+v", err),
+			}).Error(err)
+		}
+	}
+
+	stockEvents := webhook.StockEvents(events)
+	countEvents(stockEvents)
+	invApp.enqueueWebhooks(stockEvents)
+
+	invApp.pushStockEventsToCoreData(controllerId, events)
+}
+
+// countEvents counts tag and stock events by event type and facility
+func countEvents(events []webhook.Event) {
+	mEvents := prometheus.GetOrRegisterLabeledCounter("Inventory.Events", nil, "event_type", "facility_id")
+
+	for _, event := range events {
+		// tag events are batched per event type and facility
+		count := int64(1)
+		if tags, ok := event.Data.([]tag.Tag); ok {
+			count = int64(len(tags))
+		}
+		mEvents.Inc(count, event.Type, event.FacilityID)
+	}
+}